@@ -13,6 +13,7 @@ var (
 	ErrPeerChanRPCClosed    = errors.New("peer chanrpc closed")
 	ErrPeerMsgNotRegsitered = errors.New("msg not register")
 	ErrPeerChanRPCFull      = errors.New("peer chanrpc full")
+	ErrPeerMsgDropped       = errors.New("peer msg dropped")
 	ErrPeerPanic            = errors.New("peer panic")
 	ErrTimeout              = errors.New("timeout")
 )
@@ -22,13 +23,16 @@ type IServer interface {
 	// API
 	Register(msg any, f Handler)
 	RegisterByName(msgName string, f Handler)
+	RegisterPriority(msg any, f Handler)
 	Cast(ctx context.Context, req any)
 	Call(ctx context.Context, req any) *AckCtx
 	CallT(ctx context.Context, req any, timeout time.Duration) *AckCtx
 	PendReq(reqCtx *ReqCtx, block bool)
 	ChanReq() chan *ReqCtx
+	ChanPriReq() chan *ReqCtx // 高优先级消息通道，未注册高优先级消息时为nil
 	Exec(reqCtx *ReqCtx)
-	Len() int // 当前消息队列长度
+	Len() int         // 当前消息队列长度(含高优先级队列)
+	Stat() *QueueStat // 队列统计快照
 	Close()
 }
 
@@ -0,0 +1,151 @@
+package chanrpc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gapp/stat"
+)
+
+// Policy 消息队列(mailbox)写满时的处理策略
+type Policy int32
+
+const (
+	// PolicyDefault 兼容旧行为: 由PendReq的block参数决定阻塞等待或立即回复ErrPeerChanRPCFull
+	PolicyDefault Policy = iota
+	// PolicyBlock 始终阻塞等待直到入队
+	PolicyBlock
+	// PolicyBlockTimeout 阻塞等待，超过blockTimeout仍未入队则回复ErrPeerChanRPCFull
+	PolicyBlockTimeout
+	// PolicyDropNewest 丢弃新消息，不回复错误，Call方只能等到超时，适用于可丢弃的通知类消息
+	PolicyDropNewest
+	// PolicyDropOldest 丢弃队列中最旧的消息(回复ErrPeerMsgDropped)，为新消息腾出位置
+	PolicyDropOldest
+	// PolicyReject 立即回复ErrPeerChanRPCFull，不阻塞调用方
+	PolicyReject
+)
+
+const (
+	defaultBlockTimeout = time.Second
+	defaultPriorityLen  = 128
+)
+
+// String .
+func (p Policy) String() string {
+	switch p {
+	case PolicyDefault:
+		return "default"
+	case PolicyBlock:
+		return "block"
+	case PolicyBlockTimeout:
+		return "block_timeout"
+	case PolicyDropNewest:
+		return "drop_newest"
+	case PolicyDropOldest:
+		return "drop_oldest"
+	case PolicyReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+// Option Server配置项
+type Option func(s *Server)
+
+// WithPolicy 设置队列满时的处理策略
+func WithPolicy(p Policy) Option {
+	return func(s *Server) {
+		s.policy = p
+	}
+}
+
+// WithBlockTimeout 设置PolicyBlockTimeout的最大等待时间
+func WithBlockTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		if d > 0 {
+			s.blockTimeout = d
+		}
+	}
+}
+
+// WithPriorityLen 设置高优先级通道长度，默认128
+func WithPriorityLen(l int) Option {
+	return func(s *Server) {
+		if l > 0 {
+			s.priorityLen = l
+		}
+	}
+}
+
+// WithStat 开启按消息类型的队列深度统计，会带来少量加锁开销
+func WithStat() Option {
+	return func(s *Server) {
+		s.queueStat = newQueueStat()
+	}
+}
+
+// queueStat 按消息类型统计的队列状态 goroutine safe
+type queueStat struct {
+	mu      sync.Mutex
+	pending map[string]int64      // 当前在队列中等待处理的消息数
+	dropped map[string]int64      // 累计被丢弃/拒绝的消息数
+	depth   *stat.MsgStat[string] // 入队时该类型消息的排队深度采样
+}
+
+func newQueueStat() *queueStat {
+	return &queueStat{
+		pending: make(map[string]int64),
+		dropped: make(map[string]int64),
+		depth:   stat.NewStat[string](),
+	}
+}
+
+func (q *queueStat) onPend(name string) {
+	q.mu.Lock()
+	q.pending[name]++
+	depth := q.pending[name]
+	q.mu.Unlock()
+	q.depth.Add(name, depth)
+}
+
+func (q *queueStat) onDone(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending[name] > 0 {
+		q.pending[name]--
+	}
+}
+
+func (q *queueStat) onDrop(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.dropped[name]++
+}
+
+func (q *queueStat) snapshot() *QueueStat {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ret := &QueueStat{
+		Pending: make(map[string]int64, len(q.pending)),
+		Dropped: make(map[string]int64, len(q.dropped)),
+	}
+	for k, v := range q.pending {
+		if v > 0 {
+			ret.Pending[k] = v
+		}
+	}
+	for k, v := range q.dropped {
+		ret.Dropped[k] = v
+	}
+	return ret
+}
+
+// QueueStat 队列统计快照
+type QueueStat struct {
+	Len         int               // 普通队列长度
+	PriorityLen int               // 高优先级队列长度
+	Pending     map[string]int64  // 消息类型 -> 当前排队数
+	Dropped     map[string]int64  // 消息类型 -> 累计丢弃/拒绝数
+	Depth       map[string]string // 入队深度统计，格式同stat.MsgStat.Statistic
+}
@@ -27,6 +27,7 @@ type ReqCtx struct {
 	Req     any             // 入参
 	chanAck chan *AckCtx    // 结果信息返回通道
 	replied bool            // 是否已经返回 由被调用方使用
+	queued  bool            // 是否已计入队列统计 由Server使用
 	ctx     context.Context // 调用链ID
 }
 
@@ -13,15 +13,28 @@ import (
 
 // Server 代理服务器
 type Server struct {
-	handlers map[uint32]Handler
-	chanReq  chan *ReqCtx
+	handlers   map[uint32]Handler
+	chanReq    chan *ReqCtx
+	chanPriReq chan *ReqCtx        // 高优先级通道，首次RegisterPriority时创建
+	priorities map[uint32]struct{} // 走高优先级通道的消息ID
+
+	policy       Policy
+	blockTimeout time.Duration
+	priorityLen  int
+	queueStat    *queueStat // 为nil表示未开启统计
 }
 
 // NewServer 新建服务器
-func NewServer(l int) *Server {
+func NewServer(l int, opts ...Option) *Server {
 	s := new(Server)
 	s.handlers = make(map[uint32]Handler)
 	s.chanReq = make(chan *ReqCtx, l)
+	s.priorities = make(map[uint32]struct{})
+	s.blockTimeout = defaultBlockTimeout
+	s.priorityLen = defaultPriorityLen
+	for _, opt := range opts {
+		opt(s)
+	}
 	return s
 }
 
@@ -43,6 +56,16 @@ func (s *Server) RegisterByName(msgName string, f Handler) {
 	s.handlers[msgID] = f
 }
 
+// RegisterPriority 注册高优先级消息处理函数，该消息走独立通道并优先于普通消息处理
+// 通常用于停服、GM等控制类消息，需在Server开始处理消息前调用
+func (s *Server) RegisterPriority(msg any, f Handler) {
+	s.Register(msg, f)
+	s.priorities[MsgID(msg)] = struct{}{}
+	if s.chanPriReq == nil {
+		s.chanPriReq = make(chan *ReqCtx, s.priorityLen)
+	}
+}
+
 // Exist 是否存在消息处理函数
 func (s *Server) Exist(msg any) bool { return s.handlers[MsgID(msg)] != nil }
 
@@ -70,13 +93,26 @@ func (s *Server) exec(reqCtx *ReqCtx) (err error) {
 	return err
 }
 
-// Len 当前任务队列长度
+// Len 当前任务队列长度(含高优先级队列)
 func (s *Server) Len() int {
-	return len(s.chanReq)
+	return len(s.chanReq) + len(s.chanPriReq)
+}
+
+// Stat 队列统计快照，未开启WithStat时仅包含队列长度
+func (s *Server) Stat() *QueueStat {
+	ret := &QueueStat{}
+	if s.queueStat != nil {
+		ret = s.queueStat.snapshot()
+		ret.Depth = s.queueStat.depth.Statistic()
+	}
+	ret.Len = len(s.chanReq)
+	ret.PriorityLen = len(s.chanPriReq)
+	return ret
 }
 
 // Exec 执行
 func (s *Server) Exec(reqCtx *ReqCtx) {
+	s.dequeue(reqCtx)
 	reqCtx.replied = false
 	err := s.exec(reqCtx)
 	if err != nil {
@@ -111,32 +147,126 @@ func (s *Server) ChanReq() chan *ReqCtx {
 	return s.chanReq
 }
 
-// PendReq 将请求放入请求通道，当channel full时，返回ErrPeerChanRPCFull
+// ChanPriReq 返回高优先级Channel，未注册高优先级消息时为nil
+func (s *Server) ChanPriReq() chan *ReqCtx {
+	return s.chanPriReq
+}
+
+// PendReq 将请求放入请求通道，channel full时的行为由Policy决定
+// PolicyDefault下: block为true阻塞等待，否则返回ErrPeerChanRPCFull
+// 高优先级消息总是使用PolicyDefault
 func (s *Server) PendReq(reqCtx *ReqCtx, block bool) {
 	defer func() {
 		if r := recover(); r != nil {
+			s.dequeue(reqCtx)
 			err := r.(error)
 			reqCtx.ReplyErr(err)
 		}
 	}()
 
-	if block { // 阻塞模式
-		s.chanReq <- reqCtx
+	s.enqueue(reqCtx)
+	if _, ok := s.priorities[reqCtx.id]; ok && s.chanPriReq != nil {
+		s.pend(s.chanPriReq, reqCtx, block, PolicyDefault)
 		return
 	}
+	s.pend(s.chanReq, reqCtx, block, s.policy)
+}
 
-	// 非阻塞模式
+func (s *Server) pend(ch chan *ReqCtx, reqCtx *ReqCtx, block bool, policy Policy) {
+	switch policy {
+	case PolicyBlock:
+		ch <- reqCtx
+		return
+	case PolicyDefault:
+		if block {
+			ch <- reqCtx
+			return
+		}
+	case PolicyBlockTimeout:
+		select {
+		case ch <- reqCtx:
+			return
+		default:
+		}
+		t := time.NewTimer(s.blockTimeout)
+		defer t.Stop()
+		select {
+		case ch <- reqCtx:
+			return
+		case <-t.C:
+		}
+	case PolicyDropOldest:
+		// 与消费方并发出队，最多尝试有限次，避免极端情况下空转
+		for i := 0; i < 3; i++ {
+			select {
+			case ch <- reqCtx:
+				return
+			default:
+			}
+			select {
+			case old := <-ch:
+				s.dequeue(old)
+				s.drop(old, ErrPeerMsgDropped)
+			default:
+			}
+		}
+	}
+
+	// 非阻塞尝试
 	select {
-	case s.chanReq <- reqCtx:
+	case ch <- reqCtx:
+		return
 	default:
-		reqCtx.ReplyErr(ErrPeerChanRPCFull)
 	}
+	if policy == PolicyDropNewest {
+		s.dequeue(reqCtx)
+		s.drop(reqCtx, nil)
+		return
+	}
+	s.dequeue(reqCtx)
+	s.drop(reqCtx, ErrPeerChanRPCFull)
+}
+
+// drop 丢弃消息并计数，err不为nil时回复调用方
+func (s *Server) drop(reqCtx *ReqCtx, err error) {
+	if s.queueStat != nil {
+		s.queueStat.onDrop(reqCtx.GetStatName())
+	}
+	if err != nil {
+		reqCtx.ReplyErr(err)
+		return
+	}
+	logger.DefaultLogger.WarnF(reqCtx.ctx, "chanrpc Server drop newest msg: %s, len: %d", reqCtx.GetStatName(), s.Len())
+}
+
+func (s *Server) enqueue(reqCtx *ReqCtx) {
+	if s.queueStat == nil {
+		return
+	}
+	reqCtx.queued = true
+	s.queueStat.onPend(reqCtx.GetStatName())
+}
+
+func (s *Server) dequeue(reqCtx *ReqCtx) {
+	if s.queueStat == nil || !reqCtx.queued {
+		return
+	}
+	reqCtx.queued = false
+	s.queueStat.onDone(reqCtx.GetStatName())
 }
 
 // Close 关闭服务器
 func (s *Server) Close() {
+	if s.chanPriReq != nil {
+		close(s.chanPriReq)
+		for reqCtx := range s.chanPriReq {
+			s.dequeue(reqCtx)
+			reqCtx.ReplyErr(ErrPeerChanRPCClosed)
+		}
+	}
 	close(s.chanReq)
 	for reqCtx := range s.chanReq {
+		s.dequeue(reqCtx)
 		reqCtx.ReplyErr(ErrPeerChanRPCClosed)
 	}
 }
@@ -0,0 +1,101 @@
+package chanrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gapp/logger"
+	"github.com/qiafan666/gotato/commons/gface"
+)
+
+type testNtf struct{ N int }
+type testStopNtf struct{}
+
+func init() {
+	logger.DefaultLogger = gface.NewLogger("chanrpc", nil)
+}
+
+func newTestReq(req any) (*ReqCtx, chan *AckCtx) {
+	chanAck := make(chan *AckCtx, 1)
+	return &ReqCtx{id: MsgID(req), Req: req, chanAck: chanAck, ctx: context.Background()}, chanAck
+}
+
+func TestServerPolicyReject(t *testing.T) {
+	s := NewServer(1, WithPolicy(PolicyReject), WithStat())
+	s.Cast(context.Background(), &testNtf{N: 1})
+	reqCtx, chanAck := newTestReq(&testNtf{N: 2})
+	s.PendReq(reqCtx, true)
+	ack := <-chanAck
+	if !errors.Is(ack.Err, ErrPeerChanRPCFull) {
+		t.Fatalf("want ErrPeerChanRPCFull, got %v", ack.Err)
+	}
+	st := s.Stat()
+	if st.Len != 1 || st.Dropped["*chanrpc.testNtf"] != 1 || st.Pending["*chanrpc.testNtf"] != 1 {
+		t.Fatalf("unexpected stat %+v", st)
+	}
+}
+
+func TestServerPolicyDropOldest(t *testing.T) {
+	s := NewServer(1, WithPolicy(PolicyDropOldest))
+	oldReq, oldAck := newTestReq(&testNtf{N: 1})
+	s.PendReq(oldReq, false)
+	newReq, _ := newTestReq(&testNtf{N: 2})
+	s.PendReq(newReq, false)
+
+	if ack := <-oldAck; !errors.Is(ack.Err, ErrPeerMsgDropped) {
+		t.Fatalf("want ErrPeerMsgDropped, got %v", ack.Err)
+	}
+	if got := (<-s.ChanReq()).Req.(*testNtf).N; got != 2 {
+		t.Fatalf("want newest msg kept, got %d", got)
+	}
+}
+
+func TestServerPolicyDropNewest(t *testing.T) {
+	s := NewServer(1, WithPolicy(PolicyDropNewest), WithStat())
+	s.Cast(context.Background(), &testNtf{N: 1})
+	s.Cast(context.Background(), &testNtf{N: 2})
+	if got := (<-s.ChanReq()).Req.(*testNtf).N; got != 1 {
+		t.Fatalf("want oldest msg kept, got %d", got)
+	}
+	if st := s.Stat(); st.Dropped["*chanrpc.testNtf"] != 1 {
+		t.Fatalf("unexpected stat %+v", st)
+	}
+}
+
+func TestServerPolicyBlockTimeout(t *testing.T) {
+	s := NewServer(1, WithPolicy(PolicyBlockTimeout), WithBlockTimeout(20*time.Millisecond))
+	s.Cast(context.Background(), &testNtf{N: 1})
+	reqCtx, chanAck := newTestReq(&testNtf{N: 2})
+	begin := time.Now()
+	s.PendReq(reqCtx, true)
+	if ack := <-chanAck; !errors.Is(ack.Err, ErrPeerChanRPCFull) {
+		t.Fatalf("want ErrPeerChanRPCFull, got %v", ack.Err)
+	}
+	if cost := time.Since(begin); cost < 20*time.Millisecond {
+		t.Fatalf("returned before block timeout: %v", cost)
+	}
+}
+
+func TestServerPriority(t *testing.T) {
+	s := NewServer(1, WithStat())
+	var handled []string
+	s.Register(&testNtf{}, func(ctx context.Context, reqCtx *ReqCtx) { handled = append(handled, "ntf") })
+	s.RegisterPriority(&testStopNtf{}, func(ctx context.Context, reqCtx *ReqCtx) { handled = append(handled, "stop") })
+
+	s.Cast(context.Background(), &testNtf{N: 1})
+	// 普通队列已满，高优先级消息仍可入队
+	s.Cast(context.Background(), &testStopNtf{})
+	if s.Len() != 2 {
+		t.Fatalf("want len 2, got %d", s.Len())
+	}
+	s.Exec(<-s.ChanPriReq())
+	s.Exec(<-s.ChanReq())
+	if len(handled) != 2 || handled[0] != "stop" || handled[1] != "ntf" {
+		t.Fatalf("unexpected handle order %v", handled)
+	}
+	if st := s.Stat(); len(st.Pending) != 0 {
+		t.Fatalf("pending should be empty, got %+v", st.Pending)
+	}
+}
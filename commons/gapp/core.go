@@ -1,6 +1,7 @@
 package gapp
 
 import (
+	"errors"
 	"fmt"
 	"github.com/qiafan666/gotato/commons/gapp/chanrpc"
 	"github.com/qiafan666/gotato/commons/gapp/logger"
@@ -23,6 +24,9 @@ const (
 	AppStateStop        // 正在停止中
 )
 
+// ErrAlreadyStarted app已启动，需Stop后才能再次Start
+var ErrAlreadyStarted = errors.New("app already started")
+
 // 单例
 var defaultApp = NewApp()
 
@@ -31,6 +35,27 @@ type mod struct {
 	mi       module.IModule
 	closeSig chan bool
 	wg       sync.WaitGroup
+	depends  []string
+	required bool
+	state    int32        // 模块状态 ModStateXXX
+	lastErr  atomic.Value // 最近一次错误 string
+}
+
+func (m *mod) setState(s int32) {
+	atomic.StoreInt32(&m.state, s)
+}
+
+func (m *mod) getState() int32 {
+	return atomic.LoadInt32(&m.state)
+}
+
+func (m *mod) setErr(err string) {
+	m.lastErr.Store(err)
+}
+
+func (m *mod) getErr() string {
+	err, _ := m.lastErr.Load().(string)
+	return err
 }
 
 // DefaultApp 默认单例
@@ -52,12 +77,26 @@ func NewApp() *App {
 //  1. Start -> Stop: 手动启动和停止app，比较干净，通常用于测试代码
 //  2. Run -> Terminate: 基于Start/Stop封装，自动监听OS Signal或通过Terminate来终止，通常用于真正的节点启动流程
 type App struct {
+	modsMu   sync.RWMutex // 保护mods，Status等查询可能与Stop并发
 	mods     []*mod
 	state    int32
 	closeSig chan os.Signal
 	wg       sync.WaitGroup
 }
 
+// modList 返回模块列表快照，启停期间替换的是切片本身，快照可安全遍历
+func (app *App) modList() []*mod {
+	app.modsMu.RLock()
+	defer app.modsMu.RUnlock()
+	return app.mods
+}
+
+func (app *App) setMods(mods []*mod) {
+	app.modsMu.Lock()
+	app.mods = mods
+	app.modsMu.Unlock()
+}
+
 // SetState 设置状态
 func (app *App) setState(s int32) {
 	atomic.StoreInt32(&app.state, s)
@@ -69,43 +108,88 @@ func (app *App) GetState() int32 {
 }
 
 // Start 非阻塞启动app，需要在当前goroutine调用Stop来停止app
-func (app *App) Start(l gface.ILogger, mods ...module.IModule) {
+// 模块按依赖关系(IDependModule)拓扑排序后初始化和启动，无依赖关系的模块保持传入顺序
+// 依赖缺失、循环依赖，或必需模块(IRequiredModule)初始化失败时，中止启动并返回error，已初始化的模块会被逆序销毁
+// 已启动时返回ErrAlreadyStarted
+func (app *App) Start(l gface.ILogger, mods ...module.IModule) error {
 
 	if l == nil {
 		panic("logger not initialized")
 	}
 	logger.DefaultLogger = l
 
-	// 单个app不能启动两次
-	if app.GetState() != AppStateNone {
+	// 单个app不能启动两次，否则运行中的模块会被替换且不再销毁
+	if !atomic.CompareAndSwapInt32(&app.state, AppStateNone, AppStateInit) {
 		logger.DefaultLogger.ErrorF(nil, "app already started")
+		return ErrAlreadyStarted
 	}
 	if len(mods) == 0 {
-		return
+		app.setState(AppStateNone)
+		return nil
 	}
-	app.wg.Add(1)
 	// 注册module 并增加开关
 	// register
+	registered := make([]*mod, 0, len(mods))
 	for _, mi := range mods {
 		m := new(mod)
 		m.mi = mi
 		m.closeSig = make(chan bool, 1)
-		app.mods = append(app.mods, m)
+		if dm, ok := mi.(IDependModule); ok {
+			m.depends = dm.Depends()
+		}
+		if rm, ok := mi.(IRequiredModule); ok {
+			m.required = rm.Required()
+		}
+		registered = append(registered, m)
 	}
+	sorted, err := sortMods(registered)
+	if err != nil {
+		logger.DefaultLogger.ErrorF(nil, "app start error %v", err)
+		app.setState(AppStateNone)
+		return err
+	}
+	app.setMods(sorted)
 	app.setState(AppStateInit)
 	// 模块初始化
-	for _, m := range app.mods {
+	for i, m := range sorted {
 		mi := m.mi
-		if err := mi.OnInit(); err != nil {
+		m.setState(ModStateInit)
+		if err = mi.OnInit(); err != nil {
+			m.setState(ModStateFailed)
+			m.setErr(err.Error())
 			logger.DefaultLogger.ErrorF(nil, "module %v init error %v", reflect.TypeOf(mi), err)
+			if m.required {
+				app.abort(i)
+				return fmt.Errorf("required module %s init: %w", mi.Name(), err)
+			}
 		}
 	}
+	app.wg.Add(1)
 	// 模块启动
-	for _, m := range app.mods {
+	for _, m := range sorted {
 		m.wg.Add(1)
+		if m.getState() != ModStateFailed {
+			m.setState(ModStateRun)
+		}
 		go app.run(m)
 	}
 	app.setState(AppStateRun)
+	return nil
+}
+
+// abort 启动失败时逆序销毁已初始化的模块(含失败模块)
+func (app *App) abort(failedIdx int) {
+	app.setState(AppStateStop)
+	mods := app.modList()
+	for i := failedIdx; i >= 0; i-- {
+		m := mods[i]
+		app.destroy(m)
+		if m.getState() != ModStateFailed {
+			m.setState(ModStateStop)
+		}
+	}
+	app.setMods(nil)
+	app.setState(AppStateNone)
 }
 
 // Stop 停止App
@@ -115,13 +199,15 @@ func (app *App) Stop() {
 	}
 	app.setState(AppStateStop)
 	// 先进后出
-	for i := len(app.mods) - 1; i >= 0; i-- {
-		m := app.mods[i]
+	mods := app.modList()
+	for i := len(mods) - 1; i >= 0; i-- {
+		m := mods[i]
 		close(m.closeSig)
 		m.wg.Wait()
 		app.destroy(m)
+		m.setState(ModStateStop)
 	}
-	app.mods = nil
+	app.setMods(nil)
 	app.wg.Done()
 	app.setState(AppStateNone)
 }
@@ -130,7 +216,7 @@ func (app *App) Stop() {
 // goroutine safe
 func (app *App) Stats() string {
 	var ret string
-	for _, m := range app.mods {
+	for _, m := range app.modList() {
 		if m.mi.ChanSrv() != nil {
 			ret += fmt.Sprintf("chan: %v, len: %v \r\n", m.mi.Name(), m.mi.ChanSrv().Len())
 		}
@@ -141,7 +227,7 @@ func (app *App) Stats() string {
 // GetChanSrv 获取指定名字模块的消息投递通道
 // goroutine safe
 func (app *App) GetChanSrv(name string) chanrpc.IServer {
-	for _, m := range app.mods {
+	for _, m := range app.modList() {
 		if m.mi.Name() == name {
 			return m.mi.ChanSrv()
 		}
@@ -155,7 +241,7 @@ type IActorModule interface {
 
 // GetActorChanSrv 获取指定由Module管理的指定ActorID消息投递通道
 func (app *App) GetActorChanSrv(name string, actorID int64) chanrpc.IServer {
-	for _, m := range app.mods {
+	for _, m := range app.modList() {
 		if m.mi.Name() == name {
 			am, ok := m.mi.(IActorModule)
 			if !ok {
@@ -170,8 +256,13 @@ func (app *App) GetActorChanSrv(name string, actorID int64) chanrpc.IServer {
 // run 启动所有模块
 func (app *App) run(m *mod) {
 	defer func() {
-		stack := gcommon.PrintPanicStack()
-		logger.DefaultLogger.ErrorF(nil, "app run panic error: %s", stack)
+		// recover需在defer函数中直接调用，才能记录模块的panic信息
+		if r := recover(); r != nil {
+			stack := fmt.Sprintf("%v: %s", r, gcommon.Stack())
+			m.setState(ModStateFailed)
+			m.setErr(stack)
+			logger.DefaultLogger.ErrorF(nil, "app run panic error: %s", stack)
+		}
 	}()
 	defer m.wg.Done()
 	m.mi.Run(m.closeSig)
@@ -180,16 +271,22 @@ func (app *App) run(m *mod) {
 // destroy 销毁模块
 func (app *App) destroy(m *mod) {
 	defer func() {
-		stack := gcommon.PrintPanicStack()
-		logger.DefaultLogger.ErrorF(nil, "app destroy panic error: %s", stack)
+		if r := recover(); r != nil {
+			stack := fmt.Sprintf("%v: %s", r, gcommon.Stack())
+			m.setErr(stack)
+			logger.DefaultLogger.ErrorF(nil, "app destroy panic error: %s", stack)
+		}
 	}()
 	m.mi.OnDestroy()
 }
 
 // Run 阻塞启动app，在监测到SIGINT SIGTERM信号时自动终止App
 // 也可在任意goroutine调用Terminate来终止
-func (app *App) Run(l gface.ILogger, mods ...module.IModule) {
-	app.Start(l, mods...)
+// 启动失败时返回error，调用方通常应以非0状态退出进程
+func (app *App) Run(l gface.ILogger, mods ...module.IModule) error {
+	if err := app.Start(l, mods...); err != nil {
+		return err
+	}
 	// 信号监听 优雅退出
 	for {
 		signal.Notify(app.closeSig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
@@ -201,6 +298,7 @@ func (app *App) Run(l gface.ILogger, mods ...module.IModule) {
 		break
 	}
 	app.Stop()
+	return nil
 }
 
 // Terminate 用于模拟信号，终止Run，并等待app停止完成
@@ -0,0 +1,110 @@
+package gapp
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/qiafan666/gotato/commons/gapp/chanrpc"
+	"github.com/qiafan666/gotato/commons/gface"
+)
+
+type testMod struct {
+	name     string
+	depends  []string
+	required bool
+	initErr  error
+	events   *[]string
+	srv      *chanrpc.Server
+}
+
+func newTestMod(name string, events *[]string, depends ...string) *testMod {
+	return &testMod{name: name, depends: depends, events: events, srv: chanrpc.NewServer(1)}
+}
+
+func (m *testMod) OnInit() error {
+	*m.events = append(*m.events, "init:"+m.name)
+	return m.initErr
+}
+func (m *testMod) Run(closeSig chan bool)   { <-closeSig }
+func (m *testMod) OnDestroy()               { *m.events = append(*m.events, "destroy:"+m.name) }
+func (m *testMod) Name() string             { return m.name }
+func (m *testMod) ChanSrv() chanrpc.IServer { return m.srv }
+func (m *testMod) Logger() gface.ILogger    { return gface.NewLogger(m.name, nil) }
+func (m *testMod) Depends() []string        { return m.depends }
+func (m *testMod) Required() bool           { return m.required }
+
+func TestAppDependOrder(t *testing.T) {
+	var events []string
+	app := NewApp()
+	db := newTestMod("db", &events)
+	logic := newTestMod("logic", &events, "db", "cache")
+	cache := newTestMod("cache", &events, "db")
+	if err := app.Start(gface.NewLogger("app", nil), logic, cache, db); err != nil {
+		t.Fatal(err)
+	}
+	status := app.Status()
+	if status.State != "run" || len(status.Modules) != 3 || status.Modules[2].State != "run" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if err := app.Start(gface.NewLogger("app", nil), newTestMod("other", &events)); !errors.Is(err, ErrAlreadyStarted) {
+		t.Fatalf("want ErrAlreadyStarted, got %v", err)
+	}
+	if len(app.Status().Modules) != 3 {
+		t.Fatal("running modules replaced")
+	}
+	// Status与Stop并发
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			app.Status()
+		}
+	}()
+	app.Stop()
+	<-done
+
+	want := []string{"init:db", "init:cache", "init:logic", "destroy:logic", "destroy:cache", "destroy:db"}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("want %v, got %v", want, events)
+	}
+}
+
+func TestAppRequiredAbort(t *testing.T) {
+	var events []string
+	app := NewApp()
+	db := newTestMod("db", &events)
+	db.required = true
+	db.initErr = errors.New("connect refused")
+	cache := newTestMod("cache", &events)
+	logic := newTestMod("logic", &events, "db")
+	if err := app.Start(gface.NewLogger("app", nil), cache, logic, db); err == nil {
+		t.Fatal("want start error")
+	}
+	want := []string{"init:cache", "init:db", "destroy:db", "destroy:cache"}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("want %v, got %v", want, events)
+	}
+	if app.GetState() != AppStateNone {
+		t.Fatalf("unexpected app state %d", app.GetState())
+	}
+}
+
+func TestAppDependError(t *testing.T) {
+	var events []string
+	a := newTestMod("a", &events, "b")
+	b := newTestMod("b", &events, "a")
+	if err := NewApp().Start(gface.NewLogger("app", nil), a, b); err == nil {
+		t.Fatal("want cycle error")
+	}
+	c := newTestMod("c", &events, "missing")
+	if err := NewApp().Start(gface.NewLogger("app", nil), c); err == nil {
+		t.Fatal("want unknown dependency error")
+	}
+	if err := NewApp().Run(gface.NewLogger("app", nil), c); err == nil {
+		t.Fatal("want Run to return start error")
+	}
+	if len(events) != 0 {
+		t.Fatalf("no module should be initialized, got %v", events)
+	}
+}
@@ -15,6 +15,12 @@ type ISkeleton interface {
 	// Run 生命周期
 	Run(closeSig chan bool)
 
+	// Step 非阻塞地处理一条待处理消息，返回是否处理了消息
+	// 用于测试等需要单线程驱动的场景，不可与Run同时使用
+	Step() bool
+	// Idle 是否没有未完成的SafeGo异步任务
+	Idle() bool
+
 	// SafeGo 异步执行
 	SafeGo(f, cb func())
 
@@ -24,6 +30,8 @@ type ISkeleton interface {
 
 	// MsgStat 消息状态统计
 	MsgStat() map[string]string
+	// QueueStat 消息队列统计
+	QueueStat() *chanrpc.QueueStat
 
 	// TimerAPI 定时器
 	TimerAPI() timer.ITimerAPI
@@ -47,14 +55,15 @@ type skeleton struct {
 }
 
 // NewSkeleton .
-func NewSkeleton(goLen, chanrpcLen, asyncCallLen int, logger gface.ILogger) ISkeleton {
+// srvOpts 用于配置chanrpc Server的队列策略，如chanrpc.WithPolicy、chanrpc.WithStat
+func NewSkeleton(goLen, chanrpcLen, asyncCallLen int, logger gface.ILogger, srvOpts ...chanrpc.Option) ISkeleton {
 	if goLen <= 0 || chanrpcLen < 0 || asyncCallLen < 0 || logger == nil {
 		panic("invalid skeleton args")
 	}
 
 	s := &skeleton{
 		timerDelegate: timer.NewLogicDelegate(),
-		chanSrv:       chanrpc.NewServer(chanrpcLen),
+		chanSrv:       chanrpc.NewServer(chanrpcLen, srvOpts...),
 		chanCli:       chanrpc.NewClient(asyncCallLen),
 		Go:            g.New(goLen),
 		stat:          stat.NewStat[string](),
@@ -65,8 +74,22 @@ func NewSkeleton(goLen, chanrpcLen, asyncCallLen int, logger gface.ILogger) ISke
 }
 
 // Run 启动初始化
+// 高优先级消息、定时器和关闭信号优先于普通消息处理
 func (s *skeleton) Run(closeSig chan bool) {
 	for {
+		select {
+		case <-closeSig:
+			s.close()
+			return
+		case reqCtx := <-s.chanSrv.ChanPriReq():
+			s.execReq(reqCtx)
+			continue
+		case t := <-s.timerDelegate.ChanTimer():
+			s.execTimer(t)
+			continue
+		default:
+		}
+
 		select {
 		case ackCtx := <-s.chanCli.ChanAck():
 			now := time.Now()
@@ -75,25 +98,14 @@ func (s *skeleton) Run(closeSig chan bool) {
 				cost := time.Since(now).Milliseconds()
 				s.stat.Add(ackCtx.GetStatName(), cost)
 			}
+		case reqCtx := <-s.chanSrv.ChanPriReq():
+			s.execReq(reqCtx)
 		case reqCtx := <-s.chanSrv.ChanReq():
-			now := time.Now()
-			s.chanSrv.Exec(reqCtx)
-			if s.stat != nil {
-				cost := time.Since(now).Milliseconds()
-				s.stat.Add(reqCtx.GetStatName(), cost)
-				if cost > 300 { // 大于300毫秒的warn log
-					s.logger.WarnF(nil, "skeleton exec too long cost:%v stat name:%s len:%v", cost, reqCtx.GetStatName(), s.chanSrv.Len())
-				}
-			}
+			s.execReq(reqCtx)
 		case cb := <-s.Go.ChanCb:
 			s.Go.Cb(cb)
 		case t := <-s.timerDelegate.ChanTimer():
-			now := time.Now()
-			s.timerDelegate.Exec(t)
-			if s.stat != nil {
-				cost := time.Since(now).Milliseconds()
-				s.stat.Add(t.GetStatName(), cost)
-			}
+			s.execTimer(t)
 		case <-closeSig:
 			s.close()
 			return
@@ -101,6 +113,57 @@ func (s *skeleton) Run(closeSig chan bool) {
 	}
 }
 
+// Step 非阻塞地处理一条待处理消息，优先级与Run一致
+func (s *skeleton) Step() bool {
+	select {
+	case reqCtx := <-s.chanSrv.ChanPriReq():
+		s.execReq(reqCtx)
+		return true
+	case t := <-s.timerDelegate.ChanTimer():
+		s.execTimer(t)
+		return true
+	default:
+	}
+
+	select {
+	case ackCtx := <-s.chanCli.ChanAck():
+		s.chanCli.Exec(ackCtx)
+	case reqCtx := <-s.chanSrv.ChanReq():
+		s.execReq(reqCtx)
+	case cb := <-s.Go.ChanCb:
+		s.Go.Cb(cb)
+	default:
+		return false
+	}
+	return true
+}
+
+// Idle 是否没有未完成的SafeGo异步任务
+func (s *skeleton) Idle() bool {
+	return s.Go.Idle()
+}
+
+func (s *skeleton) execReq(reqCtx *chanrpc.ReqCtx) {
+	now := time.Now()
+	s.chanSrv.Exec(reqCtx)
+	if s.stat != nil {
+		cost := time.Since(now).Milliseconds()
+		s.stat.Add(reqCtx.GetStatName(), cost)
+		if cost > 300 { // 大于300毫秒的warn log
+			s.logger.WarnF(nil, "skeleton exec too long cost:%v stat name:%s len:%v", cost, reqCtx.GetStatName(), s.chanSrv.Len())
+		}
+	}
+}
+
+func (s *skeleton) execTimer(t *timer.Timer) {
+	now := time.Now()
+	s.timerDelegate.Exec(t)
+	if s.stat != nil {
+		cost := time.Since(now).Milliseconds()
+		s.stat.Add(t.GetStatName(), cost)
+	}
+}
+
 func (s *skeleton) close() {
 	s.chanSrv.Close()
 	s.Go.Close()
@@ -118,6 +181,11 @@ func (s *skeleton) MsgStat() map[string]string {
 	return s.stat.Statistic()
 }
 
+// QueueStat 消息队列统计
+func (s *skeleton) QueueStat() *chanrpc.QueueStat {
+	return s.chanSrv.Stat()
+}
+
 // Server 返回chanrpc Server
 func (s *skeleton) Server() chanrpc.IServer {
 	return s.chanSrv
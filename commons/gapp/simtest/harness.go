@@ -0,0 +1,260 @@
+package simtest
+
+/* simtest 基于虚拟时钟的确定性测试框架
+ * 在单个goroutine中驱动skeleton模块/actor与全局定时器，测试可注入chanrpc消息并断言回复，
+ * 并通过Advance快进时间，数天的逻辑定时器可在毫秒内测完
+ * 用法:
+ *	h := simtest.New(nil)          // 必须在创建skeleton之前
+ *	defer h.Close()
+ *	m := NewModule()               // 内部调用 module.NewSkeleton
+ *	h.AddModule(m, m.skeleton)
+ *	ack := h.Call(m.ChanSrv(), &Req{})
+ *	h.Advance(24 * time.Hour)
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gapp/actor"
+	"github.com/qiafan666/gotato/commons/gapp/chanrpc"
+	"github.com/qiafan666/gotato/commons/gapp/logger"
+	"github.com/qiafan666/gotato/commons/gapp/module"
+	"github.com/qiafan666/gotato/commons/gapp/timer"
+	"github.com/qiafan666/gotato/commons/gface"
+	"github.com/qiafan666/gotato/commons/gtime/logictime"
+)
+
+const (
+	defaultCallTime = 3 * time.Second  // Call默认超时(虚拟时间)
+	idleWait        = time.Millisecond // 等待SafeGo异步任务时的真实休眠间隔
+	maxIdleWait     = 5 * time.Second  // 等待SafeGo异步任务的最长真实时间
+)
+
+// ErrNoReply Call在消息全部处理完后仍未收到回复
+var ErrNoReply = errors.New("simtest no reply")
+
+// Harness 确定性测试驱动器，非goroutine safe，所有方法需在测试goroutine中调用
+type Harness struct {
+	nowMs     int64
+	sysDisp   *timer.Dispatcher
+	logicDisp *timer.Dispatcher
+	tick      int64 // 时间轮最小粒度 ms
+	skeletons []module.ISkeleton
+	modules   []module.IModule
+	actors    []actor.IActor
+	offset    time.Duration // 启动前的logictime偏移，Close时恢复
+	logger    gface.ILogger
+}
+
+// New 创建Harness并以手动模式接管全局定时器，虚拟时钟从当前真实时间开始
+// 必须在创建任何skeleton之前调用，logger为nil时使用标准库log输出
+// 全局定时器已启动(如另一个Harness未Close)时panic
+func New(l gface.ILogger) *Harness {
+	if l == nil {
+		l = gface.NewLogger("simtest", nil)
+	}
+	if logger.DefaultLogger == nil {
+		logger.DefaultLogger = l
+	}
+	h := &Harness{
+		nowMs:  time.Now().UnixMilli(),
+		offset: logictime.GetTimeOffset(),
+		logger: l,
+	}
+	var err error
+	if h.sysDisp, h.logicDisp, err = timer.RunManual(h.NowMs, l); err != nil {
+		panic(fmt.Sprintf("simtest: %v", err))
+	}
+	h.tick = max(h.sysDisp.Tick(), h.logicDisp.Tick())
+	h.syncLogicTime()
+	return h
+}
+
+// NowMs 当前虚拟时间 ms
+func (h *Harness) NowMs() int64 {
+	return h.nowMs
+}
+
+// Now 当前虚拟时间
+func (h *Harness) Now() time.Time {
+	return time.UnixMilli(h.nowMs)
+}
+
+// AddSkeleton 注册一个由Harness驱动的skeleton
+func (h *Harness) AddSkeleton(s module.ISkeleton) {
+	h.skeletons = append(h.skeletons, s)
+}
+
+// AddModule 初始化模块并注册其skeleton，模块的Run不会被调用，由Harness代为驱动skeleton
+func (h *Harness) AddModule(m module.IModule, s module.ISkeleton) error {
+	if err := m.OnInit(); err != nil {
+		return fmt.Errorf("simtest module %s init: %w", m.Name(), err)
+	}
+	h.modules = append(h.modules, m)
+	h.AddSkeleton(s)
+	return nil
+}
+
+// AddActor 初始化actor并注册其skeleton，actor的Run不会被调用，由Harness代为驱动skeleton
+func (h *Harness) AddActor(a actor.IActor, s module.ISkeleton, initData any) error {
+	if err := a.OnInit(initData); err != nil {
+		return fmt.Errorf("simtest actor init: %w", err)
+	}
+	h.actors = append(h.actors, a)
+	h.AddSkeleton(s)
+	return nil
+}
+
+// Cast 投递异步消息并处理完所有因此产生的消息
+func (h *Harness) Cast(s chanrpc.IServer, req any) {
+	s.Cast(context.Background(), req)
+	h.Drain()
+}
+
+// Call 发起调用并驱动所有skeleton直到收到回复，使用默认的虚拟超时时间
+func (h *Harness) Call(s chanrpc.IServer, req any) *chanrpc.AckCtx {
+	return h.CallT(s, req, defaultCallTime)
+}
+
+// CallT 发起调用并驱动所有skeleton直到收到回复
+// 若消息全部处理完仍未回复，则快进虚拟时间直到超时，返回chanrpc.ErrTimeout
+func (h *Harness) CallT(s chanrpc.IServer, req any, timeout time.Duration) *chanrpc.AckCtx {
+	var ret *chanrpc.AckCtx
+	cli := chanrpc.NewClient(1)
+	cli.AsyncCallT(s, context.Background(), req, func(ackCtx *chanrpc.AckCtx) {
+		ret = ackCtx
+	}, nil, timeout)
+
+	deadline := h.nowMs + timeout.Milliseconds()
+	for {
+		h.Drain()
+		select {
+		case ackCtx := <-cli.ChanAck():
+			cli.Exec(ackCtx)
+		default:
+		}
+		if ret != nil {
+			return ret
+		}
+		if h.nowMs > deadline+h.tick {
+			return &chanrpc.AckCtx{Err: ErrNoReply}
+		}
+		h.stepTo(h.nextTick())
+	}
+}
+
+// Drain 在不推进时间的前提下，处理完所有skeleton中的待处理消息
+// 若有SafeGo异步任务未完成，会以真实时间等待其回调
+func (h *Harness) Drain() {
+	waitBegin := time.Now()
+	for {
+		busy := false
+		for _, s := range h.skeletons {
+			for s.Step() {
+				busy = true
+			}
+		}
+		if busy {
+			continue
+		}
+		if h.idle() {
+			return
+		}
+		if time.Since(waitBegin) > maxIdleWait {
+			h.logger.WarnF(nil, "simtest Drain wait SafeGo timeout")
+			return
+		}
+		time.Sleep(idleWait)
+	}
+}
+
+// Advance 快进虚拟时间，途中按到期顺序逐个触发定时器，并处理由此产生的消息
+func (h *Harness) Advance(d time.Duration) {
+	h.AdvanceTo(h.nowMs + d.Milliseconds())
+}
+
+// AdvanceTo 快进虚拟时间到指定时间戳 ms，不可回退
+func (h *Harness) AdvanceTo(targetMs int64) {
+	h.Drain()
+	for {
+		next, ok := h.nextEndTs()
+		if !ok || next >= targetMs {
+			break
+		}
+		// Timer在 endTs < nowMs 且跨过tick边界时触发，因此推进到endTs之后的第一个tick边界
+		step := (next/h.tick + 1) * h.tick
+		if step <= h.nowMs {
+			step = h.nextTick()
+		}
+		if step > targetMs {
+			break
+		}
+		h.stepTo(step)
+	}
+	if targetMs > h.nowMs {
+		h.stepTo(targetMs)
+	}
+}
+
+// Close 依次关闭所有skeleton并销毁模块/actor，恢复logictime偏移并停止定时器
+func (h *Harness) Close() {
+	h.Drain()
+	closeSig := make(chan bool)
+	close(closeSig)
+	for _, s := range h.skeletons {
+		s.Run(closeSig)
+	}
+	for i := len(h.actors) - 1; i >= 0; i-- {
+		h.actors[i].OnDestroy()
+	}
+	for i := len(h.modules) - 1; i >= 0; i-- {
+		h.modules[i].OnDestroy()
+	}
+	logictime.SetTimeOffset(h.offset)
+	timer.Stop()
+}
+
+func (h *Harness) idle() bool {
+	for _, s := range h.skeletons {
+		if !s.Idle() {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *Harness) nextTick() int64 {
+	return (h.nowMs/h.tick + 1) * h.tick
+}
+
+func (h *Harness) nextEndTs() (int64, bool) {
+	sysNext, sysOk := h.sysDisp.NextEndTs()
+	logicNext, logicOk := h.logicDisp.NextEndTs()
+	switch {
+	case sysOk && logicOk:
+		return min(sysNext, logicNext), true
+	case sysOk:
+		return sysNext, true
+	default:
+		return logicNext, logicOk
+	}
+}
+
+// stepTo 将虚拟时间推进到nowMs，驱动时间轮并处理产生的消息
+func (h *Harness) stepTo(nowMs int64) {
+	if nowMs > h.nowMs {
+		h.nowMs = nowMs
+	}
+	h.syncLogicTime()
+	h.sysDisp.Step()
+	h.logicDisp.Step()
+	h.Drain()
+}
+
+// syncLogicTime 调整logictime偏移，使logictime.Now与虚拟时间一致
+func (h *Harness) syncLogicTime() {
+	logictime.SetTimeOffset(time.Duration(h.nowMs-time.Now().UnixMilli()) * time.Millisecond)
+}
@@ -0,0 +1,116 @@
+package simtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gapp/chanrpc"
+	"github.com/qiafan666/gotato/commons/gapp/module"
+	"github.com/qiafan666/gotato/commons/gapp/timer"
+	"github.com/qiafan666/gotato/commons/gface"
+	"github.com/qiafan666/gotato/commons/gtime/logictime"
+)
+
+type pingReq struct{ N int }
+type pingAck struct{ N int }
+type silentReq struct{}
+type scheduleNtf struct{ After time.Duration }
+
+type testModule struct {
+	skeleton module.ISkeleton
+	fired    []int64
+}
+
+func newTestModule() *testModule {
+	return &testModule{
+		skeleton: module.NewSkeleton(10, 100, 100, gface.NewLogger("sim", nil)),
+	}
+}
+
+func (m *testModule) OnInit() error {
+	m.skeleton.Server().Register(&pingReq{}, func(ctx context.Context, reqCtx *chanrpc.ReqCtx) {
+		reqCtx.Reply(&pingAck{N: reqCtx.Req.(*pingReq).N + 1})
+	})
+	m.skeleton.Server().Register(&silentReq{}, func(ctx context.Context, reqCtx *chanrpc.ReqCtx) {})
+	m.skeleton.Server().Register(&scheduleNtf{}, func(ctx context.Context, reqCtx *chanrpc.ReqCtx) {
+		endTs := logictime.NowMs() + reqCtx.Req.(*scheduleNtf).After.Milliseconds()
+		m.skeleton.TimerAPI().NewTimer(0, 0, endTs, func(int64) {
+			m.fired = append(m.fired, logictime.NowMs())
+		})
+	})
+	return nil
+}
+func (m *testModule) Run(closeSig chan bool)   { m.skeleton.Run(closeSig) }
+func (m *testModule) OnDestroy()               {}
+func (m *testModule) Name() string             { return "sim" }
+func (m *testModule) ChanSrv() chanrpc.IServer { return m.skeleton.Server() }
+func (m *testModule) Logger() gface.ILogger    { return m.skeleton.Logger() }
+
+func TestHarnessCall(t *testing.T) {
+	h := New(nil)
+	defer h.Close()
+	m := newTestModule()
+	if err := h.AddModule(m, m.skeleton); err != nil {
+		t.Fatal(err)
+	}
+
+	ack := h.Call(m.ChanSrv(), &pingReq{N: 1})
+	if ack.Err != nil || ack.Ack.(*pingAck).N != 2 {
+		t.Fatalf("unexpected ack %+v", ack)
+	}
+
+	begin := time.Now()
+	ack = h.CallT(m.ChanSrv(), &silentReq{}, time.Minute)
+	if !errors.Is(ack.Err, chanrpc.ErrTimeout) {
+		t.Fatalf("want ErrTimeout, got %v", ack.Err)
+	}
+	if time.Since(begin) > time.Second {
+		t.Fatalf("timeout should be fast-forwarded")
+	}
+}
+
+func TestHarnessAdvance(t *testing.T) {
+	h := New(nil)
+	defer h.Close()
+	m := newTestModule()
+	if err := h.AddModule(m, m.skeleton); err != nil {
+		t.Fatal(err)
+	}
+
+	start := h.NowMs()
+	h.Cast(m.ChanSrv(), &scheduleNtf{After: 48 * time.Hour})
+	h.Cast(m.ChanSrv(), &scheduleNtf{After: time.Hour})
+
+	h.Advance(30 * time.Minute)
+	if len(m.fired) != 0 {
+		t.Fatalf("timer fired too early: %v", m.fired)
+	}
+	h.Advance(72 * time.Hour)
+	if len(m.fired) != 2 {
+		t.Fatalf("want 2 timers fired, got %d", len(m.fired))
+	}
+	// 定时器应在到期后的一个tick内触发，且按到期顺序
+	for i, want := range []int64{start + time.Hour.Milliseconds(), start + 48*time.Hour.Milliseconds()} {
+		if diff := m.fired[i] - want; diff < 0 || diff > 2*h.tick {
+			t.Fatalf("timer %d fired at %d, want %d", i, m.fired[i], want)
+		}
+	}
+	if h.NowMs() != start+(30*time.Minute+72*time.Hour).Milliseconds() {
+		t.Fatalf("unexpected now %d", h.NowMs())
+	}
+}
+
+func TestHarnessRunning(t *testing.T) {
+	h := New(nil)
+	defer h.Close()
+	sys := timer.SysDispatcher()
+	// 已启动时不能替换正在使用的全局Dispatcher
+	if _, _, err := timer.RunManual(h.NowMs, gface.NewLogger("simtest", nil)); !errors.Is(err, timer.ErrRunning) {
+		t.Fatalf("want ErrRunning, got %v", err)
+	}
+	if timer.SysDispatcher() != sys {
+		t.Fatal("running dispatcher replaced")
+	}
+}
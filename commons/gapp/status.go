@@ -0,0 +1,158 @@
+package gapp
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/qiafan666/gotato/commons/gapp/chanrpc"
+	"github.com/qiafan666/gotato/commons/gson"
+)
+
+// 模块状态
+const (
+	ModStateNone   = iota // 未初始化
+	ModStateInit          // 正在初始化
+	ModStateRun           // 运行中
+	ModStateStop          // 已停止
+	ModStateFailed        // 初始化失败或运行时panic
+)
+
+var modStateNames = map[int32]string{
+	ModStateNone:   "none",
+	ModStateInit:   "init",
+	ModStateRun:    "run",
+	ModStateStop:   "stop",
+	ModStateFailed: "failed",
+}
+
+// IDependModule 模块可实现该接口声明依赖的模块名，App保证依赖模块先初始化/启动，后停止
+type IDependModule interface {
+	Depends() []string
+}
+
+// IRequiredModule 模块可实现该接口声明为必需模块，其OnInit失败时App中止启动
+// 未实现该接口的模块OnInit失败时仅记录错误，继续启动
+type IRequiredModule interface {
+	Required() bool
+}
+
+// IStatModule 模块可实现该接口提供消息处理耗时统计，通常直接返回skeleton.MsgStat()
+type IStatModule interface {
+	MsgStat() map[string]string
+}
+
+// ModuleStatus 模块运行状态
+type ModuleStatus struct {
+	Name     string             `json:"name"`
+	State    string             `json:"state"`
+	Required bool               `json:"required"`
+	Depends  []string           `json:"depends,omitempty"`
+	QueueLen int                `json:"queue_len"`
+	Queue    *chanrpc.QueueStat `json:"queue,omitempty"`
+	MsgStat  map[string]string  `json:"msg_stat,omitempty"`
+	LastErr  string             `json:"last_err,omitempty"`
+}
+
+// AppStatus App运行状态
+type AppStatus struct {
+	State   string          `json:"state"`
+	Modules []*ModuleStatus `json:"modules"`
+}
+
+var appStateNames = map[int32]string{
+	AppStateNone: "none",
+	AppStateInit: "init",
+	AppStateRun:  "run",
+	AppStateStop: "stop",
+}
+
+// Status 返回App及各模块的结构化运行状态，模块按启动顺序排列
+// goroutine safe
+func (app *App) Status() *AppStatus {
+	ret := &AppStatus{
+		State: appStateNames[app.GetState()],
+	}
+	for _, m := range app.modList() {
+		ms := &ModuleStatus{
+			Name:     m.mi.Name(),
+			State:    modStateNames[m.getState()],
+			Required: m.required,
+			Depends:  m.depends,
+			LastErr:  m.getErr(),
+		}
+		if srv := m.mi.ChanSrv(); srv != nil {
+			ms.QueueLen = srv.Len()
+			ms.Queue = srv.Stat()
+		}
+		if sm, ok := m.mi.(IStatModule); ok {
+			ms.MsgStat = sm.MsgStat()
+		}
+		ret.Modules = append(ret.Modules, ms)
+	}
+	return ret
+}
+
+// StatusHandler 以JSON输出Status，可直接挂载到http.ServeMux，或通过gin.WrapF挂载到gin路由
+func (app *App) StatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		data, err := gson.Marshal(app.Status())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// sortMods 按依赖关系拓扑排序，无依赖关系的模块保持原有顺序
+func sortMods(mods []*mod) ([]*mod, error) {
+	index := make(map[string]int, len(mods))
+	for i, m := range mods {
+		name := m.mi.Name()
+		if _, ok := index[name]; ok {
+			return nil, fmt.Errorf("duplicate module name %s", name)
+		}
+		index[name] = i
+	}
+	inDegree := make([]int, len(mods))
+	dependents := make([][]int, len(mods))
+	for i, m := range mods {
+		for _, dep := range m.depends {
+			j, ok := index[dep]
+			if !ok {
+				return nil, fmt.Errorf("module %s depends on unknown module %s", m.mi.Name(), dep)
+			}
+			inDegree[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	sorted := make([]*mod, 0, len(mods))
+	done := make([]bool, len(mods))
+	for len(sorted) < len(mods) {
+		// 每轮取原顺序中第一个无未满足依赖的模块，保证排序稳定
+		next := -1
+		for i := range mods {
+			if !done[i] && inDegree[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			var cycle []string
+			for i, m := range mods {
+				if !done[i] {
+					cycle = append(cycle, m.mi.Name())
+				}
+			}
+			return nil, fmt.Errorf("module dependency cycle among %v", cycle)
+		}
+		done[next] = true
+		sorted = append(sorted, mods[next])
+		for _, j := range dependents[next] {
+			inDegree[j]--
+		}
+	}
+	return sorted, nil
+}
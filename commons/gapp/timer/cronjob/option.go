@@ -0,0 +1,110 @@
+package cronjob
+
+import (
+	"time"
+)
+
+// MissedPolicy 错过执行(停机、暂停、时间调整等)时的处理策略
+type MissedPolicy int
+
+const (
+	MissedSkip    MissedPolicy = iota // 跳过所有错过的执行
+	MissedRunOnce                     // 无论错过多少次，只补执行最近的一次
+	MissedRunAll                      // 按计划时间顺序逐次补执行，最多补执行100次
+)
+
+type options struct {
+	nowMs            func() int64
+	locker           Locker
+	history          History
+	node             string
+	syncExec         bool
+	misfireThreshold time.Duration
+}
+
+// Option 调度器配置项
+type Option func(o *options)
+
+// WithNowMs 设置时间获取函数，需与timerAPI所用Dispatcher的时间一致，默认logictime.NowMs
+func WithNowMs(nowMs func() int64) Option {
+	return func(o *options) {
+		o.nowMs = nowMs
+	}
+}
+
+// WithLocker 设置集群执行锁，为nil时不加锁，每个节点都会执行
+func WithLocker(l Locker) Option {
+	return func(o *options) {
+		o.locker = l
+	}
+}
+
+// WithHistory 设置执行历史存储，默认为每个任务保留100条的内存存储
+func WithHistory(h History) Option {
+	return func(o *options) {
+		o.history = h
+	}
+}
+
+// WithNode 设置当前节点标识，记录在执行历史中
+func WithNode(node string) Option {
+	return func(o *options) {
+		o.node = node
+	}
+}
+
+// WithSyncExec 在定时器回调所在goroutine(通常为模块goroutine)中同步执行任务
+// 默认每次执行启动独立goroutine；同步模式下任务函数不可阻塞过久
+func WithSyncExec() Option {
+	return func(o *options) {
+		o.syncExec = true
+	}
+}
+
+// WithMisfireThreshold 超过计划时间多久视为错过执行，默认1分钟
+func WithMisfireThreshold(d time.Duration) Option {
+	return func(o *options) {
+		o.misfireThreshold = d
+	}
+}
+
+// JobOption 任务配置项
+type JobOption func(j *job) error
+
+// WithZone 按时区名计算cron时间，如"Asia/Shanghai"，默认使用time.Local(可由logictime.SetZone设置)
+func WithZone(name string) JobOption {
+	return func(j *job) error {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return err
+		}
+		j.loc = loc
+		return nil
+	}
+}
+
+// WithLocation 按指定时区计算cron时间
+func WithLocation(loc *time.Location) JobOption {
+	return func(j *job) error {
+		if loc != nil {
+			j.loc = loc
+		}
+		return nil
+	}
+}
+
+// WithMissedPolicy 设置错过执行的处理策略，默认MissedSkip
+func WithMissedPolicy(p MissedPolicy) JobOption {
+	return func(j *job) error {
+		j.missed = p
+		return nil
+	}
+}
+
+// WithTimeout 设置单次执行的超时时间，通过ctx传递给任务函数
+func WithTimeout(d time.Duration) JobOption {
+	return func(j *job) error {
+		j.timeout = d
+		return nil
+	}
+}
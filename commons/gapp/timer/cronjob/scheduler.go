@@ -0,0 +1,425 @@
+package cronjob
+
+/* cronjob 基于timer.CronExpr的定时任务调度
+ * 1. 使用ITimerAPI驱动，通常传入skeleton.TimerAPI()，定时器到期回调在模块goroutine中执行
+ * 2. 集群部署时通过Locker(如RedisLocker)对每次触发加锁，保证同一次触发在集群中只执行一次
+ * 3. 支持时区、错过执行策略、执行历史、手动触发与暂停
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gapp/timer"
+	"github.com/qiafan666/gotato/commons/gcommon"
+	"github.com/qiafan666/gotato/commons/gface"
+	"github.com/qiafan666/gotato/commons/gtime/logictime"
+)
+
+const (
+	defaultMisfireThreshold = time.Minute     // 超过计划时间多久视为错过
+	defaultMaxCatchUp       = 100             // MissedRunAll最多补执行次数
+	defaultHistoryLen       = 100             // 每个任务保留的历史条数
+	recordTimeout           = 5 * time.Second // 写入执行历史的超时时间
+)
+
+var (
+	ErrJobExists   = errors.New("cronjob job already exists")
+	ErrJobNotFound = errors.New("cronjob job not found")
+)
+
+// JobFunc 任务执行函数
+type JobFunc func(ctx context.Context, run *Run) error
+
+// Run 单次执行记录
+type Run struct {
+	Job         string    `json:"job"`
+	ScheduledAt time.Time `json:"scheduled_at"` // 计划执行时间
+	StartAt     time.Time `json:"start_at"`
+	EndAt       time.Time `json:"end_at"`
+	Manual      bool      `json:"manual"`   // 是否手动触发
+	CatchUp     bool      `json:"catch_up"` // 是否为错过后的补执行
+	Node        string    `json:"node"`     // 执行节点
+	Err         string    `json:"err,omitempty"`
+}
+
+// JobInfo 任务信息
+type JobInfo struct {
+	Name          string
+	Spec          string
+	Zone          string
+	Paused        bool
+	Next          time.Time // 下次计划执行时间，暂停时为零值
+	LastScheduled time.Time // 最近一次计划执行时间，零值表示从未执行
+}
+
+type job struct {
+	name      string
+	spec      string
+	expr      *timer.CronExpr
+	fn        JobFunc
+	loc       *time.Location
+	missed    MissedPolicy
+	timeout   time.Duration
+	paused    bool
+	next      time.Time // 当前已注册定时器对应的计划时间
+	timerID   int64
+	schedule  bool      // 是否已注册定时器
+	loaded    bool      // 是否已从执行历史加载lastSched
+	lastSched time.Time // 最近一次计划执行时间
+}
+
+// Scheduler 定时任务调度器 goroutine safe
+type Scheduler struct {
+	mu       sync.Mutex
+	jobs     map[string]*job
+	timerAPI timer.ITimerAPI
+	opts     *options
+	started  bool
+	logger   gface.ILogger
+}
+
+// NewScheduler 创建调度器，timerAPI通常为skeleton.TimerAPI()
+func NewScheduler(timerAPI timer.ITimerAPI, opts ...Option) *Scheduler {
+	o := &options{
+		nowMs:   logictime.NowMs,
+		history: NewMemHistory(defaultHistoryLen),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Scheduler{
+		jobs:     make(map[string]*job),
+		timerAPI: timerAPI,
+		opts:     o,
+		logger:   timerAPI.Logger(),
+	}
+}
+
+// AddJob 添加任务，spec为cron表达式，见timer.CronExpr
+// 调度器已启动时立即开始调度
+func (s *Scheduler) AddJob(name, spec string, fn JobFunc, opts ...JobOption) error {
+	expr, err := timer.NewCronExpr(spec)
+	if err != nil {
+		return err
+	}
+	j := &job{
+		name:   name,
+		spec:   spec,
+		expr:   expr,
+		fn:     fn,
+		loc:    time.Local,
+		missed: MissedSkip,
+	}
+	for _, opt := range opts {
+		if err = opt(j); err != nil {
+			return fmt.Errorf("cronjob job %s option: %w", name, err)
+		}
+	}
+
+	s.mu.Lock()
+	if _, ok := s.jobs[name]; ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrJobExists, name)
+	}
+	s.jobs[name] = j
+	var runs []*Run
+	if s.started {
+		runs = s.recover(j)
+	}
+	s.mu.Unlock()
+	s.execRuns(j, runs)
+	return nil
+}
+
+// RemoveJob 删除任务，正在执行的任务不受影响
+func (s *Scheduler) RemoveJob(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	s.unschedule(j)
+	delete(s.jobs, name)
+	return nil
+}
+
+// Start 启动调度，根据执行历史处理停机期间错过的执行
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = true
+	runs := make(map[*job][]*Run, len(s.jobs))
+	for _, j := range s.jobs {
+		runs[j] = s.recover(j)
+	}
+	s.mu.Unlock()
+	for j, jobRuns := range runs {
+		s.execRuns(j, jobRuns)
+	}
+}
+
+// Stop 停止调度，正在执行的任务不受影响
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = false
+	for _, j := range s.jobs {
+		s.unschedule(j)
+	}
+}
+
+// Pause 暂停任务调度，仅对当前节点生效
+func (s *Scheduler) Pause(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	j.paused = true
+	s.unschedule(j)
+	return nil
+}
+
+// Resume 恢复任务调度，暂停期间错过的执行按任务的MissedPolicy处理
+func (s *Scheduler) Resume(name string) error {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	var runs []*Run
+	if j.paused {
+		j.paused = false
+		if s.started {
+			runs = s.recover(j)
+		}
+	}
+	s.mu.Unlock()
+	s.execRuns(j, runs)
+	return nil
+}
+
+// Trigger 立即在当前节点手动执行一次任务，不加集群锁，不影响正常调度
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	s.execRuns(j, []*Run{s.newRun(j, s.now(j), true, false)})
+	return nil
+}
+
+// Jobs 返回所有任务信息，按名字排序
+func (s *Scheduler) Jobs() []*JobInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]*JobInfo, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		info := &JobInfo{
+			Name:          j.name,
+			Spec:          j.spec,
+			Zone:          j.loc.String(),
+			Paused:        j.paused,
+			LastScheduled: j.lastSched,
+		}
+		if j.schedule {
+			info.Next = j.next
+		}
+		ret = append(ret, info)
+	}
+	sort.Slice(ret, func(i, k int) bool { return ret[i].Name < ret[k].Name })
+	return ret
+}
+
+// History 返回任务最近n条执行记录，新记录在前
+func (s *Scheduler) History(name string, n int) ([]*Run, error) {
+	return s.opts.history.List(context.Background(), name, n)
+}
+
+// recover 从执行历史恢复任务，返回错过需补执行的记录，并注册下一次定时器 需持锁调用
+func (s *Scheduler) recover(j *job) []*Run {
+	if j.paused {
+		return nil
+	}
+	now := s.now(j)
+	if !j.loaded {
+		j.loaded = true
+		last, err := s.opts.history.Last(context.Background(), j.name)
+		if err != nil {
+			s.logger.ErrorF(nil, "cronjob load history job: %s, err: %v", j.name, err)
+		}
+		if last != nil {
+			j.lastSched = last.ScheduledAt
+		}
+	}
+	var runs []*Run
+	if !j.lastSched.IsZero() {
+		runs = s.catchUp(j, j.expr.Next(j.lastSched.In(j.loc)), now)
+	}
+	s.schedule(j, j.expr.Next(now))
+	return runs
+}
+
+// schedule 注册下一次执行的定时器 需持锁调用
+func (s *Scheduler) schedule(j *job, next time.Time) {
+	if next.IsZero() {
+		s.logger.WarnF(nil, "cronjob job %s has no next time", j.name)
+		return
+	}
+	j.next = next
+	j.schedule = true
+	j.timerID = s.timerAPI.NewTimer(0, 0, next.UnixMilli(), func(timerID int64) {
+		s.onTimer(j, timerID)
+	})
+}
+
+func (s *Scheduler) unschedule(j *job) {
+	if !j.schedule {
+		return
+	}
+	j.schedule = false
+	s.timerAPI.CancelTimer(j.timerID)
+}
+
+func (s *Scheduler) onTimer(j *job, timerID int64) {
+	s.mu.Lock()
+	// 定时器已被取消或替换
+	if !j.schedule || j.timerID != timerID || s.jobs[j.name] != j {
+		s.mu.Unlock()
+		return
+	}
+	j.schedule = false
+	now := s.now(j)
+	runs := s.catchUp(j, j.next, now)
+	s.schedule(j, j.expr.Next(now))
+	s.mu.Unlock()
+	s.execRuns(j, runs)
+}
+
+// catchUp 返回[from, now]之间需要执行的记录，超过misfireThreshold的视为错过，按MissedPolicy处理 需持锁调用
+func (s *Scheduler) catchUp(j *job, from, now time.Time) []*Run {
+	var runs []*Run
+	var missed []time.Time
+	skipped := 0
+	for t := from; !t.IsZero() && !t.After(now); t = j.expr.Next(t) {
+		j.lastSched = t
+		if now.Sub(t) <= s.misfireThreshold() {
+			runs = append(runs, s.newRun(j, t, false, false))
+			continue
+		}
+		missed = append(missed, t)
+		if len(missed) > defaultMaxCatchUp {
+			missed = missed[1:]
+			skipped++
+		}
+	}
+	if len(missed) == 0 {
+		return runs
+	}
+	switch j.missed {
+	case MissedRunOnce:
+		runs = append(runs, s.newRun(j, missed[len(missed)-1], false, true))
+	case MissedRunAll:
+		if skipped > 0 {
+			s.logger.WarnF(nil, "cronjob job %s too many missed runs, skip oldest %d", j.name, skipped)
+		}
+		for _, t := range missed {
+			runs = append(runs, s.newRun(j, t, false, true))
+		}
+	default:
+		s.logger.WarnF(nil, "cronjob job %s skip %d missed runs, first: %v", j.name, len(missed)+skipped, missed[0])
+	}
+	// 补执行按计划时间先后进行
+	sort.SliceStable(runs, func(a, b int) bool { return runs[a].ScheduledAt.Before(runs[b].ScheduledAt) })
+	return runs
+}
+
+func (s *Scheduler) newRun(j *job, scheduledAt time.Time, manual, catchUp bool) *Run {
+	return &Run{
+		Job:         j.name,
+		ScheduledAt: scheduledAt,
+		Manual:      manual,
+		CatchUp:     catchUp,
+		Node:        s.opts.node,
+	}
+}
+
+// execRuns 执行任务，异步模式下每次执行在独立goroutine中进行 不可持锁调用
+func (s *Scheduler) execRuns(j *job, runs []*Run) {
+	for _, run := range runs {
+		if s.opts.syncExec {
+			s.exec(j, run)
+			continue
+		}
+		go s.exec(j, run)
+	}
+}
+
+func (s *Scheduler) exec(j *job, run *Run) {
+	ctx := context.Background()
+	defer func() {
+		if r := recover(); r != nil {
+			run.Err = fmt.Sprintf("panic: %v: %s", r, gcommon.Stack())
+			run.EndAt = s.now(j)
+			s.logger.ErrorF(ctx, "cronjob job %s panic: %s", j.name, run.Err)
+			s.record(ctx, run)
+		}
+	}()
+
+	if !run.Manual && s.opts.locker != nil {
+		ok, err := s.opts.locker.TryLock(ctx, j.name, run.ScheduledAt)
+		if err != nil {
+			s.logger.ErrorF(ctx, "cronjob job %s lock err: %v", j.name, err)
+			return
+		}
+		if !ok { // 已被集群中其他节点执行
+			return
+		}
+	}
+
+	if j.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.timeout)
+		defer cancel()
+	}
+	run.StartAt = s.now(j)
+	if err := j.fn(ctx, run); err != nil {
+		run.Err = err.Error()
+		s.logger.ErrorF(ctx, "cronjob job %s scheduled at %v err: %v", j.name, run.ScheduledAt, err)
+	}
+	run.EndAt = s.now(j)
+	s.record(ctx, run)
+}
+
+// record 写入执行历史，任务超时后ctx已取消，使用独立的超时时间写入
+func (s *Scheduler) record(ctx context.Context, run *Run) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+	defer cancel()
+	if err := s.opts.history.Record(ctx, run); err != nil {
+		s.logger.ErrorF(ctx, "cronjob record history job: %s, err: %v", run.Job, err)
+	}
+}
+
+func (s *Scheduler) now(j *job) time.Time {
+	return time.UnixMilli(s.opts.nowMs()).In(j.loc)
+}
+
+func (s *Scheduler) misfireThreshold() time.Duration {
+	if s.opts.misfireThreshold > 0 {
+		return s.opts.misfireThreshold
+	}
+	return defaultMisfireThreshold
+}
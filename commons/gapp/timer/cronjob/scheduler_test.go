@@ -0,0 +1,141 @@
+package cronjob
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/qiafan666/gotato/commons/gapp/module"
+	"github.com/qiafan666/gotato/commons/gapp/simtest"
+	"github.com/qiafan666/gotato/commons/gface"
+	"github.com/qiafan666/gotato/commons/stores/redis_cli"
+)
+
+func newTestRedis(t *testing.T) *redis_cli.Redis {
+	s := miniredis.RunT(t)
+	return redis_cli.MustNewRedis(redis_cli.RedisConf{Host: s.Addr(), Type: redis_cli.NodeType})
+}
+
+func TestSchedulerCluster(t *testing.T) {
+	h := simtest.New(nil)
+	defer h.Close()
+	rds := newTestRedis(t)
+	history := NewRedisHistory(rds, "", 0)
+
+	var runs []*Run
+	fn := func(ctx context.Context, run *Run) error {
+		runs = append(runs, run)
+		return nil
+	}
+	newNode := func(node string) *Scheduler {
+		sk := module.NewSkeleton(1, 10, 10, gface.NewLogger(node, nil))
+		h.AddSkeleton(sk)
+		s := NewScheduler(sk.TimerAPI(), WithNowMs(h.NowMs), WithSyncExec(), WithNode(node),
+			WithLocker(NewRedisLocker(rds, "", 0, node)), WithHistory(history))
+		if err := s.AddJob("daily", "0 0 4 * * *", fn, WithZone("UTC"), WithMissedPolicy(MissedRunOnce)); err != nil {
+			t.Fatal(err)
+		}
+		s.Start()
+		return s
+	}
+	s1, s2 := newNode("node1"), newNode("node2")
+
+	h.Advance(3 * 24 * time.Hour)
+	if len(runs) != 3 {
+		t.Fatalf("each firing should run once across nodes, got %d runs", len(runs))
+	}
+	for _, run := range runs {
+		if at := run.ScheduledAt.UTC(); at.Hour() != 4 || at.Minute() != 0 {
+			t.Fatalf("unexpected scheduled time %v", at)
+		}
+	}
+
+	// 全部节点停机两天，重启后只补执行一次
+	s1.Stop()
+	s2.Stop()
+	h.Advance(2 * 24 * time.Hour)
+	runs = nil
+	newNode("node3")
+	h.Drain()
+	if len(runs) != 1 || !runs[0].CatchUp {
+		t.Fatalf("want 1 catch up run, got %+v", runs)
+	}
+	records, err := history.List(context.Background(), "daily", 10)
+	if err != nil || len(records) != 4 || !records[0].CatchUp {
+		t.Fatalf("unexpected history %+v, err: %v", records, err)
+	}
+}
+
+func TestSchedulerPauseTrigger(t *testing.T) {
+	h := simtest.New(nil)
+	defer h.Close()
+	sk := module.NewSkeleton(1, 10, 10, gface.NewLogger("cron", nil))
+	h.AddSkeleton(sk)
+
+	count := 0
+	s := NewScheduler(sk.TimerAPI(), WithNowMs(h.NowMs), WithSyncExec(), WithMisfireThreshold(time.Second))
+	if err := s.AddJob("minutely", "0 * * * * *", func(ctx context.Context, run *Run) error {
+		count++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+
+	h.Advance(10 * time.Minute)
+	if count != 10 {
+		t.Fatalf("want 10 runs, got %d", count)
+	}
+	if err := s.Pause("minutely"); err != nil {
+		t.Fatal(err)
+	}
+	h.Advance(10 * time.Minute)
+	if count != 10 {
+		t.Fatalf("paused job should not run, got %d", count)
+	}
+	if err := s.Trigger("minutely"); err != nil {
+		t.Fatal(err)
+	}
+	if count != 11 {
+		t.Fatalf("trigger should run once, got %d", count)
+	}
+	// 默认MissedSkip，恢复后不补执行暂停期间的任务
+	if err := s.Resume("minutely"); err != nil {
+		t.Fatal(err)
+	}
+	h.Advance(time.Minute)
+	if count != 12 {
+		t.Fatalf("want 12 runs, got %d", count)
+	}
+	if jobs := s.Jobs(); len(jobs) != 1 || jobs[0].Paused || jobs[0].Next.IsZero() {
+		t.Fatalf("unexpected jobs %+v", jobs[0])
+	}
+	if err := s.Trigger("missing"); err == nil {
+		t.Fatal("want job not found")
+	}
+}
+
+func TestSchedulerRecordAfterTimeout(t *testing.T) {
+	h := simtest.New(nil)
+	defer h.Close()
+	sk := module.NewSkeleton(1, 10, 10, gface.NewLogger("cron", nil))
+	h.AddSkeleton(sk)
+	history := NewRedisHistory(newTestRedis(t), "", 0)
+
+	s := NewScheduler(sk.TimerAPI(), WithNowMs(h.NowMs), WithSyncExec(), WithHistory(history))
+	// 任务执行到超时，执行历史仍需写入
+	if err := s.AddJob("slow", "0 * * * * *", func(ctx context.Context, run *Run) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithTimeout(10*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Trigger("slow"); err != nil {
+		t.Fatal(err)
+	}
+	records, err := history.List(context.Background(), "slow", 10)
+	if err != nil || len(records) != 1 || records[0].Err == "" {
+		t.Fatalf("want timed out run recorded, got %+v, err: %v", records, err)
+	}
+}
@@ -0,0 +1,186 @@
+package cronjob
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gcommon"
+	"github.com/qiafan666/gotato/commons/gson"
+	"github.com/qiafan666/gotato/commons/stores/redis_cli"
+)
+
+const (
+	defaultLockTTL     = 3600 // 单次触发锁的过期时间 秒，需大于集群节点间的时钟误差
+	defaultRedisPrefix = "cronjob"
+)
+
+// Locker 集群执行锁，同一任务的同一计划时间只有一个节点能加锁成功
+type Locker interface {
+	TryLock(ctx context.Context, job string, scheduledAt time.Time) (bool, error)
+}
+
+// History 执行历史存储
+type History interface {
+	Record(ctx context.Context, run *Run) error
+	// List 返回最近n条记录，新记录在前
+	List(ctx context.Context, job string, n int) ([]*Run, error)
+	// Last 返回最近一条记录，不存在时返回nil
+	Last(ctx context.Context, job string) (*Run, error)
+}
+
+// ------------------------ redis ------------------------
+
+// RedisLocker 基于redis SETNX的单次触发锁，锁不主动释放，过期后自动删除
+type RedisLocker struct {
+	redis  *redis_cli.Redis
+	prefix string
+	ttl    int
+	node   string
+}
+
+// NewRedisLocker prefix为空时使用"cronjob"，ttl<=0时使用1小时
+func NewRedisLocker(redis *redis_cli.Redis, prefix string, ttl int, node string) *RedisLocker {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+	return &RedisLocker{redis: redis, prefix: prefix, ttl: ttl, node: node}
+}
+
+// TryLock 对任务的某次计划执行加锁
+func (l *RedisLocker) TryLock(ctx context.Context, job string, scheduledAt time.Time) (bool, error) {
+	key := gcommon.StrJoin(redis_cli.SplitTag, l.prefix, "lock", job, strconv.FormatInt(scheduledAt.UnixMilli(), 10))
+	return l.redis.SetnxExCtx(ctx, key, l.node, l.ttl)
+}
+
+// RedisHistory 基于redis list的执行历史，每个任务保留最近limit条
+type RedisHistory struct {
+	redis  *redis_cli.Redis
+	prefix string
+	limit  int
+}
+
+// NewRedisHistory prefix为空时使用"cronjob"，limit<=0时保留100条
+func NewRedisHistory(redis *redis_cli.Redis, prefix string, limit int) *RedisHistory {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	if limit <= 0 {
+		limit = defaultHistoryLen
+	}
+	return &RedisHistory{redis: redis, prefix: prefix, limit: limit}
+}
+
+func (h *RedisHistory) key(job string) string {
+	return gcommon.StrJoin(redis_cli.SplitTag, h.prefix, "history", job)
+}
+
+// Record 记录一次执行
+func (h *RedisHistory) Record(ctx context.Context, run *Run) error {
+	data, err := gson.Marshal(run)
+	if err != nil {
+		return err
+	}
+	if _, err = h.redis.LpushCtx(ctx, h.key(run.Job), string(data)); err != nil {
+		return err
+	}
+	return h.redis.LtrimCtx(ctx, h.key(run.Job), 0, int64(h.limit-1))
+}
+
+// List 返回最近n条记录
+func (h *RedisHistory) List(ctx context.Context, job string, n int) ([]*Run, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	vals, err := h.redis.LrangeCtx(ctx, h.key(job), 0, n-1)
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]*Run, 0, len(vals))
+	for _, v := range vals {
+		run := new(Run)
+		if err = gson.Unmarshal([]byte(v), run); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// Last 返回最近一条记录
+// 手动触发的记录不代表计划执行，因此跳过
+func (h *RedisHistory) Last(ctx context.Context, job string) (*Run, error) {
+	runs, err := h.List(ctx, job, h.limit)
+	if err != nil {
+		return nil, err
+	}
+	return lastScheduled(runs), nil
+}
+
+// ------------------------ memory ------------------------
+
+// MemHistory 内存执行历史，每个任务保留最近limit条 goroutine safe
+type MemHistory struct {
+	mu    sync.Mutex
+	limit int
+	runs  map[string][]*Run // 新记录在前
+}
+
+// NewMemHistory limit<=0时保留100条
+func NewMemHistory(limit int) *MemHistory {
+	if limit <= 0 {
+		limit = defaultHistoryLen
+	}
+	return &MemHistory{limit: limit, runs: make(map[string][]*Run)}
+}
+
+// Record 记录一次执行
+func (h *MemHistory) Record(_ context.Context, run *Run) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cp := *run
+	runs := append([]*Run{&cp}, h.runs[run.Job]...)
+	if len(runs) > h.limit {
+		runs = runs[:h.limit]
+	}
+	h.runs[run.Job] = runs
+	return nil
+}
+
+// List 返回最近n条记录
+func (h *MemHistory) List(_ context.Context, job string, n int) ([]*Run, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs := h.runs[job]
+	if n < len(runs) {
+		runs = runs[:n]
+	}
+	ret := make([]*Run, 0, len(runs))
+	for _, run := range runs {
+		cp := *run
+		ret = append(ret, &cp)
+	}
+	return ret, nil
+}
+
+// Last 返回最近一条计划执行记录
+func (h *MemHistory) Last(ctx context.Context, job string) (*Run, error) {
+	runs, err := h.List(ctx, job, h.limit)
+	if err != nil {
+		return nil, err
+	}
+	return lastScheduled(runs), nil
+}
+
+func lastScheduled(runs []*Run) *Run {
+	for _, run := range runs {
+		if !run.Manual {
+			return run
+		}
+	}
+	return nil
+}
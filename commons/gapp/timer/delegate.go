@@ -31,6 +31,30 @@ func NewSysDelegate() ITimerAPI {
 	}
 }
 
+// NewDelegate 基于指定Dispatcher创建Timer代理，用于独立的时间轮
+// chanLen > 0 时维护自己的chanTimer，需由持有者通过ChanTimer/Exec执行回调，同LogicDelegate
+// chanLen == 0 时回调直接在Dispatcher中执行，同SysDelegate
+func NewDelegate(disp *Dispatcher, chanLen int) ITimerDelegate {
+	d := &Delegate{
+		dispatcher: disp,
+	}
+	if chanLen > 0 {
+		d.chanTimer = make(chan *Timer, chanLen)
+	}
+	return d
+}
+
+// Dispatcher 所属的Dispatcher
+func (d *Delegate) Dispatcher() *Dispatcher {
+	return d.dispatcher
+}
+
+// Dump 返回由该代理创建且未触发的Timer，按到期时间排序
+// 对SysDelegate返回所有直接在Dispatcher中执行回调的Timer
+func (d *Delegate) Dump() []TimerInfo {
+	return d.dispatcher.Dump(d.chanTimer)
+}
+
 // NewTimer 创建定时器
 func (d *Delegate) NewTimer(timerType int32, timerID, timeout int64, cb timerCb) int64 {
 	return d.dispatcher.NewTimer(timerType, timerID, timeout, cb, d.chanTimer)
@@ -9,6 +9,8 @@ import (
 	"github.com/qiafan666/gotato/commons/gface"
 	"github.com/qiafan666/gotato/commons/gid"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,26 +18,60 @@ import (
 // 使用时间轮算法
 // 所有的对外API均goroutine safe
 type Dispatcher struct {
-	timerSlots [timerLevel]map[int64]*Timer // 时间轮 每个level对应的slots中的timer剩余到期时间大于等于 timerTick<<level
+	timerSlots [timerLevel]map[int64]*Timer // 时间轮 每个level对应的slots中的timer剩余到期时间大于等于 tick<<level
 	chanOp     chan any                     // 用于向Dispather发送Timer相关操作命令
 	nowMs      func() int64
 	logger     gface.ILogger
+	name       string
+	tick       int64 // 最小粒度 ms
+	stopped    int32
+	metrics    *metrics      // 触发统计
+	done       chan struct{} // run退出(Stop或崩溃)时关闭
+	inCallback int32         // 正在执行回调，回调中的查询不能再经过chanOp
+	// mu 保护时间轮和统计，处理操作和tick时持有，执行回调期间释放
+	mu sync.Mutex
+
+	// 手动驱动模式，不启动goroutine，由调用方通过Step推进，通常用于测试
+	manual     bool
+	lastTick   int64
+	stepping   bool  // Step中执行回调时为true，此时新操作延迟到Step结束后执行
+	pendingOps []any // stepping期间积压的操作
 }
 
-// newDispatcher nowMs: 外部注入的时间获取接口
-func newDispatcher(nowMs func() int64, logger gface.ILogger) *Dispatcher {
+// NewDispatcher 创建独立的分发器，与全局Dispatcher互不影响，需调用Run启动(手动驱动模式除外)
+// nowMs: 外部注入的时间获取接口
+// 通常结合NewDelegate使用，使不同子系统拥有隔离的时间轮和精度
+func NewDispatcher(nowMs func() int64, logger gface.ILogger, opts ...DispatcherOption) *Dispatcher {
 	disp := new(Dispatcher)
 	for k := range disp.timerSlots {
 		disp.timerSlots[k] = make(map[int64]*Timer)
 	}
 
-	disp.chanOp = make(chan any, _timerOpChanSize)
 	disp.nowMs = nowMs
 	disp.logger = logger
+	disp.tick = timerTick
+	disp.metrics = newMetrics()
+	opChanSize := _timerOpChanSize
+	for _, opt := range opts {
+		opt(disp, &opChanSize)
+	}
+	disp.chanOp = make(chan any, opChanSize)
+	disp.done = make(chan struct{})
+	disp.lastTick = nowMs() / disp.tick
 
 	return disp
 }
 
+// Name 分发器名字
+func (disp *Dispatcher) Name() string {
+	return disp.name
+}
+
+// Tick 最小粒度 ms
+func (disp *Dispatcher) Tick() int64 {
+	return disp.tick
+}
+
 // Run 运行分发器
 func (disp *Dispatcher) Run() {
 	go disp.run()
@@ -46,24 +82,45 @@ func (disp *Dispatcher) run() {
 		if x := recover(); x != nil {
 			disp.logger.ErrorF(nil, "TIMER CRASHED %v", x)
 		}
+		atomic.StoreInt32(&disp.stopped, 1)
+		close(disp.done)
 	}()
 
-	lastTick := disp.nowMs() / timerTick
-	tickTimer := time.NewTimer(timerTick * time.Millisecond)
+	lastTick := disp.nowMs() / disp.tick
+	tickTimer := time.NewTimer(time.Duration(disp.tick) * time.Millisecond)
 	for {
 		select {
 		case t := <-disp.chanOp:
 			if t == nil {
 				return
 			}
-			disp.doOp(t)
+			disp.withLock(func() { disp.doOp(t) })
 		case <-tickTimer.C:
-			tickTimer.Reset(timerTick * time.Millisecond)
-			lastTick = disp.doTick(disp.nowMs(), lastTick)
+			tickTimer.Reset(time.Duration(disp.tick) * time.Millisecond)
+			disp.withLock(func() { lastTick = disp.doTick(disp.nowMs(), lastTick) })
 		}
 	}
 }
 
+// withLock 持有mu执行f，f中panic时同样释放mu，崩溃后查询不会阻塞
+func (disp *Dispatcher) withLock(f func()) {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	f()
+}
+
+// runCallback 释放mu执行回调，回调中可以查询统计和创建/取消Timer
+// 回调执行期间时间轮不会被修改，返回后重新持有mu
+func (disp *Dispatcher) runCallback(cb func()) {
+	atomic.StoreInt32(&disp.inCallback, 1)
+	disp.mu.Unlock()
+	defer func() {
+		disp.mu.Lock()
+		atomic.StoreInt32(&disp.inCallback, 0)
+	}()
+	cb()
+}
+
 // 删除并返回Timer
 func (disp *Dispatcher) delete(timerID int64) *Timer {
 	for i := timerLevel - 1; i >= 0; i-- {
@@ -79,11 +136,11 @@ func (disp *Dispatcher) delete(timerID int64) *Timer {
 // 将Timer放到合适的时间轮中
 func (disp *Dispatcher) place(t *Timer) {
 	diff := t.endTs - disp.nowMs()
-	if diff < timerTick {
-		diff = timerTick
+	if diff < disp.tick {
+		diff = disp.tick
 	}
 	for i := timerLevel - 1; i >= 0; i-- {
-		if diff >= (timerTick << uint(i)) {
+		if diff >= (disp.tick << uint(i)) {
 			disp.timerSlots[i][t.id] = t
 			break
 		}
@@ -93,7 +150,7 @@ func (disp *Dispatcher) place(t *Timer) {
 func (disp *Dispatcher) doTick(nowMs int64, lastTick0 int64) int64 {
 	lastTick := lastTick0
 	// 防止服务器时间手动调整前移后 Timer重复触发
-	nowTick := nowMs / timerTick
+	nowTick := nowMs / disp.tick
 	deltaTick := nowTick - lastTick
 	if deltaTick < 1 {
 		return nowTick
@@ -130,7 +187,7 @@ func (disp *Dispatcher) trigger(nowMs int64, level int) {
 			diff := v.endTs - nowMs
 			newLevel := level
 			// 直接跳到其对应的槽位中
-			for diff < (timerTick<<newLevel) && newLevel > 0 {
+			for diff < (disp.tick<<newLevel) && newLevel > 0 {
 				newLevel--
 			}
 			if newLevel != level {
@@ -159,24 +216,47 @@ func (disp *Dispatcher) trigger(nowMs int64, level int) {
 	for _, t := range tmpList {
 		// 本地触发，执行完成即清除Timer
 		if t.ownerChan == nil {
-			t.Cb()
+			disp.metrics.onFire(t, nowMs)
+			disp.runCallback(t.Cb)
 			delete(slotMap, t.id)
 			continue
 		}
 		// 远程触发，仅当非阻塞写入成功才清除timer
 		select { // 发送必须为非阻塞, 传入的chan不能关闭
 		case t.ownerChan <- t:
+			disp.metrics.onFire(t, nowMs)
 			delete(slotMap, t.id) // 如果发送失败，则尝试下次再次触发
 		default:
+			disp.metrics.retried++
 		}
 	}
 }
 
 // Stop 停止Dispatcher
 func (disp *Dispatcher) Stop() {
+	if !atomic.CompareAndSwapInt32(&disp.stopped, 0, 1) || disp.manual {
+		return
+	}
 	disp.pendOp(nil)
 }
 
+// Step 以当前nowMs推进一次时间轮，触发所有到期Timer，仅对手动驱动模式有效
+func (disp *Dispatcher) Step() {
+	if !disp.manual {
+		return
+	}
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	// 回调中可能再次创建/取消Timer，执行回调时释放mu，新操作积压到Step结束后执行
+	disp.stepping = true
+	disp.lastTick = disp.doTick(disp.nowMs(), disp.lastTick)
+	disp.stepping = false
+	for _, op := range disp.pendingOps {
+		disp.doOp(op)
+	}
+	disp.pendingOps = nil
+}
+
 // UpdateTimer 加速 Timer
 func (disp *Dispatcher) UpdateTimer(timerID, newEndTs int64) {
 	if timerID == 0 {
@@ -228,5 +308,15 @@ func (disp *Dispatcher) BatchNewTimers(ops []*NewOp) []int64 {
 }
 
 func (disp *Dispatcher) pendOp(op any) {
+	if disp.manual {
+		disp.mu.Lock()
+		defer disp.mu.Unlock()
+		if disp.stepping {
+			disp.pendingOps = append(disp.pendingOps, op)
+			return
+		}
+		disp.doOp(op)
+		return
+	}
 	disp.chanOp <- op
 }
@@ -11,6 +11,9 @@ func (disp *Dispatcher) doOp(op any) {
 		disp.doCancelOp(o)
 	case *BatchOp:
 		disp.doBatchOp(o)
+	case *queryOp:
+		o.f()
+		close(o.done)
 	default:
 		disp.logger.ErrorF(nil, "unknown type of op: %v", op)
 	}
@@ -24,6 +27,7 @@ func (disp *Dispatcher) doNewOp(op *NewOp) {
 		cb:        op.Cb,
 		ownerChan: op.OwnerChan,
 		logger:    disp.logger,
+		createTs:  disp.nowMs(),
 	}
 	disp.place(t)
 }
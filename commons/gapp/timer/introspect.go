@@ -0,0 +1,261 @@
+package timer
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"github.com/qiafan666/gotato/commons/gface"
+)
+
+// latenessBounds 触发延迟直方图的桶上界 ms，最后一个桶为+Inf
+var latenessBounds = []int64{8, 16, 32, 64, 128, 256, 512, 1024, 4096}
+
+// DispatcherOption Dispatcher配置项
+type DispatcherOption func(disp *Dispatcher, opChanSize *int)
+
+// WithName 设置分发器名字，用于日志和统计
+func WithName(name string) DispatcherOption {
+	return func(disp *Dispatcher, _ *int) {
+		disp.name = name
+	}
+}
+
+// WithTick 设置最小粒度 ms，默认8ms，精度越高tick开销越大
+func WithTick(tick int64) DispatcherOption {
+	return func(disp *Dispatcher, _ *int) {
+		if tick > 0 {
+			disp.tick = tick
+		}
+	}
+}
+
+// WithOpChanSize 设置操作队列长度，默认1000
+func WithOpChanSize(size int) DispatcherOption {
+	return func(_ *Dispatcher, opChanSize *int) {
+		if size > 0 {
+			*opChanSize = size
+		}
+	}
+}
+
+// WithManual 手动驱动模式，不启动goroutine，操作同步执行，由调用方通过Step推进，通常用于测试
+func WithManual() DispatcherOption {
+	return func(disp *Dispatcher, _ *int) {
+		disp.manual = true
+	}
+}
+
+// metrics 触发统计
+type metrics struct {
+	fired       int64
+	firedByType map[int32]int64
+	retried     int64   // ownerChan已满导致延后触发的次数
+	lateness    []int64 // 与latenessBounds对应，多一个+Inf桶
+	maxLateness int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		firedByType: make(map[int32]int64),
+		lateness:    make([]int64, len(latenessBounds)+1),
+	}
+}
+
+func (m *metrics) onFire(t *Timer, nowMs int64) {
+	m.fired++
+	m.firedByType[t.typ]++
+	late := nowMs - t.endTs
+	if late > m.maxLateness {
+		m.maxLateness = late
+	}
+	idx := sort.Search(len(latenessBounds), func(i int) bool { return late < latenessBounds[i] })
+	m.lateness[idx]++
+}
+
+// LatenessBucket 触发延迟直方图桶
+type LatenessBucket struct {
+	LessThan int64 // 延迟上界 ms，-1表示+Inf
+	Count    int64
+}
+
+// TypeCount 按Timer类型的计数
+type TypeCount struct {
+	Typ   int32
+	Count int64
+}
+
+// TimerInfo Timer快照
+type TimerInfo struct {
+	Typ      int32
+	ID       int64
+	EndTs    int64
+	CreateTs int64
+	Level    int
+}
+
+// Stat Dispatcher统计快照
+type Stat struct {
+	Name           string
+	Tick           int64
+	Pending        int              // 当前未触发的Timer数
+	PendingByLevel []int            // 各级时间轮中的Timer数
+	PendingByType  []TypeCount      // 按数量降序
+	Fired          int64            // 累计触发数
+	FiredByType    []TypeCount      // 按数量降序
+	Retried        int64            // ownerChan已满导致延后触发的次数
+	Lateness       []LatenessBucket // 触发时刻相对到期时间的延迟分布
+	MaxLateness    int64            // 最大延迟 ms
+}
+
+// queryOp 在Dispatcher goroutine中执行只读查询，保证能看到之前提交的操作
+type queryOp struct {
+	f    func()
+	done chan struct{}
+}
+
+// query 执行只读查询f
+// 通常经过chanOp在Dispatcher goroutine中执行，回调中或Dispatcher已停止(含崩溃)时持有mu直接读取
+func (disp *Dispatcher) query(f func()) {
+	if disp.manual || atomic.LoadInt32(&disp.inCallback) == 1 || atomic.LoadInt32(&disp.stopped) == 1 {
+		disp.withLock(f)
+		return
+	}
+	op := &queryOp{f: f, done: make(chan struct{})}
+	select {
+	case disp.chanOp <- op:
+	case <-disp.done:
+		disp.withLock(f)
+		return
+	}
+	select {
+	case <-op.done:
+	case <-disp.done:
+		// run退出时op可能未被执行，op.done已关闭时f已完成
+		select {
+		case <-op.done:
+		default:
+			disp.withLock(f)
+		}
+	}
+}
+
+// Stat 返回统计快照 goroutine safe
+func (disp *Dispatcher) Stat() *Stat {
+	ret := &Stat{
+		Name: disp.name,
+		Tick: disp.tick,
+	}
+	disp.query(func() {
+		pendingByType := make(map[int32]int64)
+		ret.PendingByLevel = make([]int, timerLevel)
+		for level, slotMap := range disp.timerSlots {
+			ret.PendingByLevel[level] = len(slotMap)
+			ret.Pending += len(slotMap)
+			for _, t := range slotMap {
+				pendingByType[t.typ]++
+			}
+		}
+		ret.PendingByType = sortTypeCount(pendingByType, 0)
+
+		m := disp.metrics
+		ret.Fired = m.fired
+		ret.FiredByType = sortTypeCount(m.firedByType, 0)
+		ret.Retried = m.retried
+		ret.MaxLateness = m.maxLateness
+		ret.Lateness = make([]LatenessBucket, 0, len(m.lateness))
+		for i, cnt := range m.lateness {
+			bound := int64(-1)
+			if i < len(latenessBounds) {
+				bound = latenessBounds[i]
+			}
+			ret.Lateness = append(ret.Lateness, LatenessBucket{LessThan: bound, Count: cnt})
+		}
+	})
+	return ret
+}
+
+// TopTypes 返回当前未触发Timer数量最多的前n个类型 goroutine safe
+func (disp *Dispatcher) TopTypes(n int) []TypeCount {
+	var ret []TypeCount
+	disp.query(func() {
+		pendingByType := make(map[int32]int64)
+		for _, slotMap := range disp.timerSlots {
+			for _, t := range slotMap {
+				pendingByType[t.typ]++
+			}
+		}
+		ret = sortTypeCount(pendingByType, n)
+	})
+	return ret
+}
+
+// Dump 返回属于ownerChan的所有未触发Timer，按到期时间排序 goroutine safe
+// ownerChan为nil时返回直接在Dispatcher中执行回调的Timer(如SysDelegate创建的Timer)
+func (disp *Dispatcher) Dump(ownerChan chan *Timer) []TimerInfo {
+	return disp.dump(func(t *Timer) bool { return t.ownerChan == ownerChan })
+}
+
+// DumpAll 返回所有未触发Timer，按到期时间排序 goroutine safe
+func (disp *Dispatcher) DumpAll() []TimerInfo {
+	return disp.dump(func(*Timer) bool { return true })
+}
+
+func (disp *Dispatcher) dump(filter func(t *Timer) bool) []TimerInfo {
+	var ret []TimerInfo
+	disp.query(func() {
+		for level, slotMap := range disp.timerSlots {
+			for _, t := range slotMap {
+				if !filter(t) {
+					continue
+				}
+				ret = append(ret, TimerInfo{Typ: t.typ, ID: t.id, EndTs: t.endTs, CreateTs: t.createTs, Level: level})
+			}
+		}
+	})
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].EndTs != ret[j].EndTs {
+			return ret[i].EndTs < ret[j].EndTs
+		}
+		return ret[i].ID < ret[j].ID
+	})
+	return ret
+}
+
+// NextEndTs 返回最早到期Timer的到期时间戳 goroutine safe
+func (disp *Dispatcher) NextEndTs() (int64, bool) {
+	var next int64
+	found := false
+	disp.query(func() {
+		for _, slotMap := range disp.timerSlots {
+			for _, t := range slotMap {
+				if !found || t.endTs < next {
+					next = t.endTs
+					found = true
+				}
+			}
+		}
+	})
+	return next, found
+}
+
+// Logger 日志接口
+func (disp *Dispatcher) Logger() gface.ILogger {
+	return disp.logger
+}
+
+func sortTypeCount(m map[int32]int64, n int) []TypeCount {
+	ret := make([]TypeCount, 0, len(m))
+	for typ, cnt := range m {
+		ret = append(ret, TypeCount{Typ: typ, Count: cnt})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Typ < ret[j].Typ
+	})
+	if n > 0 && len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
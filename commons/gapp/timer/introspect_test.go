@@ -0,0 +1,107 @@
+package timer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gface"
+)
+
+func TestDispatcherIntrospect(t *testing.T) {
+	disp := NewDispatcher(func() int64 { return time.Now().UnixMilli() }, gface.NewLogger("timer", nil),
+		WithName("battle"), WithTick(2))
+	disp.Run()
+	defer disp.Stop()
+
+	owner := NewDelegate(disp, 10)
+	inline := NewDelegate(disp, 0)
+	nowMs := time.Now().UnixMilli()
+	owner.NewTimer(1, 0, nowMs+20, func(int64) {})
+	owner.NewTimer(2, 0, nowMs+time.Hour.Milliseconds(), func(int64) {})
+	owner.NewTimer(2, 0, nowMs+2*time.Hour.Milliseconds(), func(int64) {})
+	fired := make(chan struct{}, 1)
+	inline.NewTimer(3, 0, nowMs+10, func(int64) { fired <- struct{}{} })
+
+	st := disp.Stat()
+	if st.Name != "battle" || st.Tick != 2 || st.Pending != 4 {
+		t.Fatalf("unexpected stat %+v", st)
+	}
+	if top := disp.TopTypes(1); len(top) != 1 || top[0].Typ != 2 || top[0].Count != 2 {
+		t.Fatalf("unexpected top types %+v", top)
+	}
+	dump := owner.(*Delegate).Dump()
+	if len(dump) != 3 || dump[0].Typ != 1 || dump[2].EndTs != nowMs+2*time.Hour.Milliseconds() {
+		t.Fatalf("unexpected dump %+v", dump)
+	}
+	if dump[1].Level <= dump[0].Level {
+		t.Fatalf("long timer should be on higher level %+v", dump)
+	}
+
+	<-fired
+	timer := <-owner.ChanTimer()
+	owner.Exec(timer)
+
+	st = disp.Stat()
+	if st.Pending != 2 || st.Fired != 2 {
+		t.Fatalf("unexpected stat after fire %+v", st)
+	}
+	var bucketed int64
+	for _, b := range st.Lateness {
+		bucketed += b.Count
+	}
+	if bucketed != 2 || st.Lateness[len(st.Lateness)-1].LessThan != -1 {
+		t.Fatalf("unexpected lateness %+v", st.Lateness)
+	}
+	if len(inline.(*Delegate).Dump()) != 0 {
+		t.Fatalf("inline timers should be fired")
+	}
+}
+
+func TestDispatcherQueryNoDeadlock(t *testing.T) {
+	disp := NewDispatcher(func() int64 { return time.Now().UnixMilli() }, gface.NewLogger("timer", nil), WithTick(2))
+	disp.Run()
+
+	// Timer回调中查询不能死锁
+	inline := NewDelegate(disp, 0)
+	pending := make(chan int, 1)
+	inline.NewTimer(1, 0, time.Now().UnixMilli()+5, func(int64) { pending <- disp.Stat().Pending })
+	select {
+	case n := <-pending:
+		if n != 1 {
+			t.Fatalf("want firing timer still pending, got %d", n)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("query from timer callback deadlocked")
+	}
+
+	// Stop后查询立即返回
+	disp.Stop()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			disp.DumpAll()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("query after Stop blocked")
+	}
+
+	// 崩溃后查询立即返回
+	crashed := NewDispatcher(func() int64 { return time.Now().UnixMilli() }, gface.NewLogger("timer", nil), WithTick(2))
+	crashed.Run()
+	NewDelegate(crashed, 0).NewTimer(1, 0, time.Now().UnixMilli()+5, func(int64) { panic("boom") })
+	time.Sleep(50 * time.Millisecond)
+	crashDone := make(chan struct{})
+	go func() {
+		crashed.Stat()
+		close(crashDone)
+	}()
+	select {
+	case <-crashDone:
+	case <-time.After(3 * time.Second):
+		t.Fatal("query after crash blocked")
+	}
+}
@@ -1,11 +1,16 @@
 package timer
 
 import (
+	"errors"
+
 	"github.com/qiafan666/gotato/commons/gface"
 	"sync/atomic"
 	"time"
 )
 
+// ErrRunning 全局定时器已启动
+var ErrRunning = errors.New("timer dispatcher already running")
+
 var (
 	// 逻辑层使用的定时器，使用外部注入的时间获取函数，可能受到外部逻辑调整时间的影响
 	// 通常用于逻辑层定时器，如科研定时
@@ -29,13 +34,13 @@ func Run(logicMowMs func() int64, logger gface.ILogger) {
 	sysNowMs := func() int64 {
 		return time.Now().UnixMilli()
 	}
-	_sysDispatcher = newDispatcher(sysNowMs, logger)
+	_sysDispatcher = NewDispatcher(sysNowMs, logger, WithName("sys"))
 	_sysDispatcher.Run()
 
 	if logicMowMs == nil {
 		logicMowMs = sysNowMs
 	}
-	_logicDispatcher = newDispatcher(logicMowMs, logger)
+	_logicDispatcher = NewDispatcher(logicMowMs, logger, WithName("logic"))
 	_logicDispatcher.Run()
 }
 
@@ -47,3 +52,27 @@ func Stop() {
 	_sysDispatcher = nil
 	atomic.CompareAndSwapInt32(&_running, 1, 0)
 }
+
+// RunManual 以手动驱动模式启动定时器汞，不启动goroutine，返回sys与logic两个Dispatcher
+// 调用方需在修改nowMs返回的时间后调用Dispatcher.Step触发到期Timer，通常用于确定性测试
+// 需在创建Delegate(如NewSkeleton)之前调用，结束后调用Stop
+// 已通过Run或RunManual启动时返回ErrRunning，不替换正在运行的全局Dispatcher
+func RunManual(nowMs func() int64, logger gface.ILogger) (sysDisp, logicDisp *Dispatcher, err error) {
+	if !atomic.CompareAndSwapInt32(&_running, 0, 1) {
+		logger.WarnF(nil, "timer dispatcher already running, RunManual ignored")
+		return nil, nil, ErrRunning
+	}
+	_sysDispatcher = NewDispatcher(nowMs, logger, WithName("sys"), WithManual())
+	_logicDispatcher = NewDispatcher(nowMs, logger, WithName("logic"), WithManual())
+	return _sysDispatcher, _logicDispatcher, nil
+}
+
+// SysDispatcher 全局系统层Dispatcher，用于查询统计信息，未Run时为nil
+func SysDispatcher() *Dispatcher {
+	return _sysDispatcher
+}
+
+// LogicDispatcher 全局逻辑层Dispatcher，用于查询统计信息，未Run时为nil
+func LogicDispatcher() *Dispatcher {
+	return _logicDispatcher
+}
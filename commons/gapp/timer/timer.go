@@ -8,7 +8,7 @@ import (
 
 // Timer 默认定义
 const (
-	timerTick  = 8  // 最小粒度 ms 考虑将其定义为2^N 提高效率
+	timerTick  = 8  // 默认最小粒度 ms 考虑将其定义为2^N 提高效率
 	timerLevel = 24 // 时间段最大分级
 )
 
@@ -21,6 +21,8 @@ type Timer struct {
 	id    int64   // ID
 	endTs int64   // 到期时间戳 ms
 	cb    timerCb // timer 回调
+	// 创建时间戳 ms，用于调试
+	createTs int64
 	// timer 触发后会写入该channel，由该channel的持有者执行回调
 	// 如果ownerChan为nil，则直接在Dispatcher中执行回调
 	ownerChan chan *Timer
@@ -2,6 +2,7 @@ package gbatcher
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/qiafan666/gotato/commons/gcommon"
 	"github.com/qiafan666/gotato/commons/gerr"
@@ -16,6 +17,9 @@ var (
 	DefaultBuffer       = 100
 	DefaultWorker       = 5
 	DefaultInterval     = time.Second
+
+	DefaultWALSegmentSize int64 = 64 << 20
+	DefaultRetryBackoff         = 100 * time.Millisecond
 )
 
 type Config struct {
@@ -24,6 +28,13 @@ type Config struct {
 	worker   int           // 并行处理的工作协程数量
 	interval time.Duration // 消息聚合的时间间隔（批次处理的时间间隔）
 	syncWait bool          // 分发消息后是否同步等待消息被消费完成
+
+	walDir         string        // 预写日志目录，为空时不启用
+	walSegmentSize int64         // 预写日志单个分段文件的大小
+	walSync        bool          // 每次写入预写日志后是否fsync
+	retry          int           // DoErr返回错误后的重试次数
+	retryBackoff   time.Duration // 重试间隔，按重试次数线性增长
+	closeTimeout   time.Duration // Close等待剩余数据处理完成的最长时间，0为一直等待
 }
 
 type Option func(c *Config)
@@ -58,43 +69,119 @@ func WithSyncWait(wait bool) Option {
 	}
 }
 
+// WithWAL 启用本地磁盘上的预写日志，Put的数据先写入日志，批次处理完成（成功或交给DeadLetter）后确认
+// 进程异常退出时未确认的数据在下次Start时重放，同一日志分段中已确认的数据也可能被重放，即至少一次
+func WithWAL(dir string) Option {
+	return func(c *Config) {
+		c.walDir = dir
+	}
+}
+
+// WithWALSegmentSize 设置预写日志单个分段文件的大小，分段中的数据全部确认后删除文件
+func WithWALSegmentSize(size int64) Option {
+	return func(c *Config) {
+		c.walSegmentSize = size
+	}
+}
+
+// WithWALSync 设置每次写入预写日志后是否fsync，开启后机器掉电也不丢数据，但Put的开销更大
+func WithWALSync(sync bool) Option {
+	return func(c *Config) {
+		c.walSync = sync
+	}
+}
+
+// WithRetry 设置DoErr返回错误后的重试次数与间隔，重试耗尽后交给DeadLetter
+func WithRetry(times int, backoff time.Duration) Option {
+	return func(c *Config) {
+		c.retry = times
+		c.retryBackoff = backoff
+	}
+}
+
+// WithCloseTimeout 设置Close等待剩余数据处理完成的最长时间，超时后未处理完成的数据保留在预写日志中
+func WithCloseTimeout(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.closeTimeout = timeout
+	}
+}
+
+// entry 进入调度协程的数据，seg为数据在预写日志中所在的分段
+type entry[T any] struct {
+	val *T
+	seg *walSegment
+}
+
 type Batcher[T any] struct {
 	config *Config
 
-	globalCtx  context.Context
-	cancel     context.CancelFunc
-	Do         func(ctx context.Context, channelID int, val *Msg[T])
+	globalCtx   context.Context
+	cancel      context.CancelFunc
+	flushCtx    context.Context
+	flushCancel context.CancelFunc
+	Do          func(ctx context.Context, channelID int, val *Msg[T])
+	// DoErr 返回错误的批次处理函数，设置后代替Do，返回错误时按WithRetry重试，重试耗尽后交给DeadLetter
+	DoErr func(ctx context.Context, channelID int, val *Msg[T]) error
+	// DeadLetter 批次重试耗尽后的回调，回调返回后批次视为已处理
+	DeadLetter func(channelID int, val *Msg[T], err error)
 	OnComplete func(lastMessage *T, totalCount int)
 	Sharding   func(key string) int
 	Key        func(data *T) string
 	HookFunc   func(triggerID string, messages map[string][]*T, totalCount int, lastMessage *T)
-	data       chan *T
+	// Marshal Unmarshal 数据写入预写日志时的编解码，默认json
+	Marshal   func(data *T) ([]byte, error)
+	Unmarshal func(b []byte) (*T, error)
+	// OnWALError 重放预写日志时遇到损坏的分段或无法解码的数据时的回调
+	OnWALError func(err error)
+	data       chan *entry[T]
 	chArrays   []chan *Msg[T]
 	wait       sync.WaitGroup
 	counter    sync.WaitGroup
+	wal        *wal
 }
 
 func emptyOnComplete[T any](*T, int) {}
 func emptyHookFunc[T any](string, map[string][]*T, int, *T) {
 }
+func emptyDeadLetter[T any](int, *Msg[T], error) {}
+func emptyOnWALError(error)                      {}
+
+func jsonMarshal[T any](data *T) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+func jsonUnmarshal[T any](b []byte) (*T, error) {
+	data := new(T)
+	if err := json.Unmarshal(b, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
 
 func New[T any](opts ...Option) *Batcher[T] {
 	b := &Batcher[T]{
 		OnComplete: emptyOnComplete[T],
 		HookFunc:   emptyHookFunc[T],
+		DeadLetter: emptyDeadLetter[T],
+		Marshal:    jsonMarshal[T],
+		Unmarshal:  jsonUnmarshal[T],
+		OnWALError: emptyOnWALError,
 	}
 	config := &Config{
-		size:     DefaultSize,
-		buffer:   DefaultBuffer,
-		worker:   DefaultWorker,
-		interval: DefaultInterval,
+		size:           DefaultSize,
+		buffer:         DefaultBuffer,
+		worker:         DefaultWorker,
+		interval:       DefaultInterval,
+		walSegmentSize: DefaultWALSegmentSize,
+		retryBackoff:   DefaultRetryBackoff,
 	}
 	for _, opt := range opts {
 		opt(config)
 	}
 	b.config = config
-	b.data = make(chan *T, DefaultDataChanSize)
+	b.data = make(chan *entry[T], DefaultDataChanSize)
 	b.globalCtx, b.cancel = context.WithCancel(context.Background())
+	b.flushCtx, b.flushCancel = context.WithCancel(context.Background())
 
 	b.chArrays = make([]chan *Msg[T], b.config.worker)
 	for i := 0; i < b.config.worker; i++ {
@@ -111,35 +198,98 @@ func (b *Batcher[T]) Start() error {
 	if b.Sharding == nil {
 		return gerr.New("Sharding function is required").Wrap()
 	}
-	if b.Do == nil {
+	if b.Do == nil && b.DoErr == nil {
 		return gerr.New("Do function is required").Wrap()
 	}
 	if b.Key == nil {
 		return gerr.New("Key function is required").Wrap()
 	}
+	if b.config.walDir != "" {
+		w, err := openWAL(b.config.walDir, b.config.walSegmentSize, b.config.walSync)
+		if err != nil {
+			return gerr.WrapMsg(err, "open wal failed", "dir", b.config.walDir)
+		}
+		b.wal = w
+	}
 	b.wait.Add(b.config.worker)
 	for i := 0; i < b.config.worker; i++ {
 		go b.run(i, b.chArrays[i])
 	}
 	b.wait.Add(1)
 	go b.scheduler()
+	if b.wal != nil {
+		return b.replay()
+	}
+	return nil
+}
+
+// replay 将预写日志中未确认的数据重新放入队列，在Start返回前完成
+// 先读出全部记录再入队，避免入队阻塞时工作协程确认记录与读取日志互相等待
+func (b *Batcher[T]) replay() error {
+	var entries []*entry[T]
+	var bad []*walSegment
+	corrupt, err := b.wal.recover(func(seg *walSegment, payload []byte) {
+		data, err := b.Unmarshal(payload)
+		if err != nil {
+			b.OnWALError(gerr.WrapMsg(err, "unmarshal wal record failed", "segment", seg.path))
+			bad = append(bad, seg)
+			return
+		}
+		entries = append(entries, &entry[T]{val: data, seg: seg})
+	})
+	for _, path := range corrupt {
+		b.OnWALError(gerr.WrapMsg(errWALCorrupt, "wal segment truncated", "segment", path))
+	}
+	if err != nil {
+		return gerr.WrapMsg(err, "recover wal failed", "dir", b.config.walDir)
+	}
+	for _, seg := range bad {
+		b.wal.ack(seg, 1)
+	}
+	for _, e := range entries {
+		b.data <- e
+	}
 	return nil
 }
 
+// Put 添加数据，返回错误时数据未被接收，已写入预写日志的记录随之确认
+// 启用WithWAL时，若进程在该记录所在分段删除前异常退出，返回错误的数据仍可能在重放时被处理
 func (b *Batcher[T]) Put(ctx context.Context, data *T) error {
 	if data == nil {
 		return gerr.New("data can not be nil").Wrap()
 	}
+	if b.globalCtx.Err() != nil {
+		return gerr.New("data channel is closed").Wrap()
+	}
+	e := &entry[T]{val: data}
+	if b.wal != nil {
+		payload, err := b.Marshal(data)
+		if err != nil {
+			return gerr.WrapMsg(err, "marshal data failed")
+		}
+		if e.seg, err = b.wal.append(payload); err != nil {
+			return gerr.WrapMsg(err, "write wal failed")
+		}
+	}
 	select {
 	case <-b.globalCtx.Done():
+		b.ackEntry(e)
 		return gerr.New("data channel is closed").Wrap()
 	case <-ctx.Done():
+		b.ackEntry(e)
 		return ctx.Err()
-	case b.data <- data:
+	case b.data <- e:
 		return nil
 	}
 }
 
+// ackEntry 确认未被接收的数据对应的预写日志记录，调用方已收到错误，不应再重放
+func (b *Batcher[T]) ackEntry(e *entry[T]) {
+	if e.seg != nil {
+		b.wal.ack(e.seg, 1)
+	}
+}
+
 func (b *Batcher[T]) scheduler() {
 	ticker := time.NewTicker(b.config.interval)
 	defer func() {
@@ -152,40 +302,46 @@ func (b *Batcher[T]) scheduler() {
 	}()
 
 	vals := make(map[string][]*T)
+	segs := make(map[string][]*walSegment)
 	count := 0
 	var lastAny *T
 
 	for {
 		select {
-		case data, ok := <-b.data:
+		case e, ok := <-b.data:
 			if !ok {
 				// If the data channel is closed unexpectedly
 				return
 			}
-			if data == nil {
+			if e == nil {
 				if count > 0 {
-					b.distributeMessage(vals, count, lastAny)
+					b.distributeMessage(vals, segs, count, lastAny)
 				}
 				return
 			}
 
-			key := b.Key(data)
-			vals[key] = append(vals[key], data)
-			lastAny = data
+			key := b.Key(e.val)
+			vals[key] = append(vals[key], e.val)
+			if e.seg != nil {
+				segs[key] = append(segs[key], e.seg)
+			}
+			lastAny = e.val
 
 			count++
 			if count >= b.config.size {
 
-				b.distributeMessage(vals, count, lastAny)
+				b.distributeMessage(vals, segs, count, lastAny)
 				vals = make(map[string][]*T)
+				segs = make(map[string][]*walSegment)
 				count = 0
 			}
 
 		case <-ticker.C:
 			if count > 0 {
 
-				b.distributeMessage(vals, count, lastAny)
+				b.distributeMessage(vals, segs, count, lastAny)
 				vals = make(map[string][]*T)
+				segs = make(map[string][]*walSegment)
 				count = 0
 			}
 		}
@@ -196,6 +352,7 @@ type Msg[T any] struct {
 	key       string
 	triggerID string
 	val       []*T
+	segs      []*walSegment
 }
 
 func (m Msg[T]) Key() string {
@@ -225,7 +382,7 @@ func (m Msg[T]) String() string {
 	return sb.String()
 }
 
-func (b *Batcher[T]) distributeMessage(messages map[string][]*T, totalCount int, lastMessage *T) {
+func (b *Batcher[T]) distributeMessage(messages map[string][]*T, segs map[string][]*walSegment, totalCount int, lastMessage *T) {
 	triggerID := gcommon.GenerateUUID()
 	b.HookFunc(triggerID, messages, totalCount, lastMessage)
 	for key, data := range messages {
@@ -233,7 +390,7 @@ func (b *Batcher[T]) distributeMessage(messages map[string][]*T, totalCount int,
 			b.counter.Add(1)
 		}
 		channelID := b.Sharding(key)
-		b.chArrays[channelID] <- &Msg[T]{key: key, triggerID: triggerID, val: data}
+		b.chArrays[channelID] <- &Msg[T]{key: key, triggerID: triggerID, val: data, segs: segs[key]}
 	}
 	if b.config.syncWait {
 		b.counter.Wait()
@@ -249,7 +406,9 @@ func (b *Batcher[T]) run(channelID int, ch <-chan *Msg[T]) {
 			if !ok {
 				return
 			}
-			b.Do(context.Background(), channelID, messages)
+			if b.process(channelID, messages) {
+				b.ack(messages)
+			}
 			if b.config.syncWait {
 				b.counter.Done()
 			}
@@ -257,9 +416,79 @@ func (b *Batcher[T]) run(channelID int, ch <-chan *Msg[T]) {
 	}
 }
 
+// process 处理一个批次，返回false表示Close超时中断了重试，批次未处理完成
+func (b *Batcher[T]) process(channelID int, messages *Msg[T]) bool {
+	if b.DoErr == nil {
+		b.Do(b.flushCtx, channelID, messages)
+		return true
+	}
+	var err error
+	for attempt := 0; attempt <= b.config.retry; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-b.flushCtx.Done():
+				return false
+			case <-time.After(time.Duration(attempt) * b.config.retryBackoff):
+			}
+		}
+		if err = b.DoErr(b.flushCtx, channelID, messages); err == nil {
+			return true
+		}
+		if b.flushCtx.Err() != nil {
+			return false
+		}
+	}
+	b.DeadLetter(channelID, messages, err)
+	return true
+}
+
+// ack 确认批次中的数据已处理完成，按所在分段合并后确认
+func (b *Batcher[T]) ack(messages *Msg[T]) {
+	if b.wal == nil || len(messages.segs) == 0 {
+		return
+	}
+	counts := make(map[*walSegment]int)
+	for _, seg := range messages.segs {
+		counts[seg]++
+	}
+	for seg, n := range counts {
+		b.wal.ack(seg, n)
+	}
+}
+
+// Close 停止接收数据并等待已接收的数据处理完成，设置了WithCloseTimeout时最多等待该时间
 func (b *Batcher[T]) Close() {
+	ctx := context.Background()
+	if b.config.closeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.config.closeTimeout)
+		defer cancel()
+	}
+	_ = b.CloseContext(ctx)
+}
+
+// CloseContext 停止接收数据并等待已接收的数据处理完成，ctx结束时取消传给Do的ctx、中断重试并返回ctx.Err()
+// 超时后未处理完成的数据保留在预写日志中，下次Start时重放，未启用预写日志时这部分数据丢失
+func (b *Batcher[T]) CloseContext(ctx context.Context) error {
 	b.cancel() // Signal to stop put data
-	b.data <- nil
-	//wait all goroutines exit
-	b.wait.Wait()
+	done := make(chan struct{})
+	go func() {
+		b.data <- nil
+		//wait all goroutines exit
+		b.wait.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	b.flushCancel()
+	if b.wal != nil {
+		if cerr := b.wal.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
 }
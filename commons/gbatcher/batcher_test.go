@@ -2,11 +2,16 @@ package gbatcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/qiafan666/gotato/commons/gcast"
 	"github.com/qiafan666/gotato/commons/gcommon"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -71,3 +76,158 @@ func TestBatcher(t *testing.T) {
 		t.Error("Data channel should be empty after closing")
 	}
 }
+
+func newWALBatcher(dir string, opts ...Option) *Batcher[string] {
+	opts = append([]Option{
+		WithSize(10),
+		WithWorker(2),
+		WithInterval(10 * time.Millisecond),
+		WithWAL(dir),
+		WithWALSegmentSize(64),
+	}, opts...)
+	b := New[string](opts...)
+	b.Sharding = func(key string) int {
+		return int(gcommon.StrHash(key)) % 2
+	}
+	b.Key = func(data *string) string {
+		return *data
+	}
+	return b
+}
+
+func TestBatcherWALReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	// 第一次运行处理一直失败，Close超时后数据保留在预写日志中
+	b := newWALBatcher(dir, WithRetry(1000, 10*time.Millisecond))
+	b.DoErr = func(ctx context.Context, channelID int, val *Msg[string]) error {
+		return errors.New("downstream unavailable")
+	}
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		data := fmt.Sprintf("data-%d", i)
+		if err := b.Put(context.Background(), &data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := b.CloseContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CloseContext err = %v, want deadline exceeded", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*"+walExt)); len(files) == 0 {
+		t.Fatal("wal segments should remain after close timeout")
+	}
+
+	// 第二次运行重放全部数据
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	b = newWALBatcher(dir)
+	b.Do = func(ctx context.Context, channelID int, val *Msg[string]) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, v := range val.Val() {
+			seen[*v] = true
+		}
+	}
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	if len(seen) != 50 {
+		t.Fatalf("replayed %d items, want 50", len(seen))
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("wal segments should be removed after ack, got %d", len(entries))
+	}
+}
+
+func TestBatcherWALTruncated(t *testing.T) {
+	dir := t.TempDir()
+	w, err := openWAL(dir, DefaultWALSegmentSize, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "b"} {
+		if _, err = w.append([]byte(`"` + v + `"`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := w.active.path
+	_ = w.file.Close()
+	// 模拟写入一半时进程退出
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte{0, 0, 0, 9, 1})
+	_ = f.Close()
+
+	var walErrs atomic.Int32
+	var count atomic.Int32
+	b := newWALBatcher(dir)
+	b.OnWALError = func(err error) {
+		walErrs.Add(1)
+	}
+	b.Do = func(ctx context.Context, channelID int, val *Msg[string]) {
+		count.Add(int32(len(val.Val())))
+	}
+	if err = b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	if count.Load() != 2 {
+		t.Fatalf("replayed %d items, want 2", count.Load())
+	}
+	if walErrs.Load() != 1 {
+		t.Fatalf("OnWALError called %d times, want 1", walErrs.Load())
+	}
+}
+
+func TestBatcherRetryDeadLetter(t *testing.T) {
+	b := New[string](
+		WithSize(1),
+		WithWorker(1),
+		WithInterval(10*time.Millisecond),
+		WithRetry(2, time.Millisecond),
+	)
+	b.Sharding = func(key string) int { return 0 }
+	b.Key = func(data *string) string { return *data }
+
+	var attempts atomic.Int32
+	b.DoErr = func(ctx context.Context, channelID int, val *Msg[string]) error {
+		if *val.Val()[0] == "ok" && attempts.Add(1) == 2 {
+			return nil
+		}
+		if *val.Val()[0] == "ok" {
+			return errors.New("temporary")
+		}
+		return errors.New("permanent")
+	}
+	var dead []string
+	b.DeadLetter = func(channelID int, val *Msg[string], err error) {
+		dead = append(dead, val.Key())
+	}
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"ok", "bad"} {
+		data := v
+		if err := b.Put(context.Background(), &data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Close()
+	if attempts.Load() != 2 {
+		t.Fatalf("attempts = %d, want 2", attempts.Load())
+	}
+	if len(dead) != 1 || dead[0] != "bad" {
+		t.Fatalf("dead letters = %v, want [bad]", dead)
+	}
+}
@@ -0,0 +1,232 @@
+package gbatcher
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	walExt        = ".wal"
+	walHeaderSize = 8 // 4字节长度 + 4字节crc32
+)
+
+var (
+	errWALCorrupt = errors.New("wal record corrupt")
+	errWALClosed  = errors.New("wal closed")
+)
+
+// walSegment 预写日志的一个分段文件，pending为已写入但还未处理完成的记录数
+// 非活跃分段的pending降为0后删除文件
+type walSegment struct {
+	id      uint64
+	path    string
+	size    int64
+	pending int
+}
+
+// wal 本地磁盘上的预写日志，Put时先写入日志再进入内存队列，批次处理完成后确认
+// 进程退出时未确认的记录所在的分段会保留，下次启动时重放，同一分段中已确认的记录也会被重放，即至少一次
+type wal struct {
+	dir         string
+	segmentSize int64
+	sync        bool
+
+	mu       sync.Mutex
+	file     *os.File
+	active   *walSegment
+	segments map[uint64]*walSegment
+	nextID   uint64
+	closed   bool
+}
+
+func openWAL(dir string, segmentSize int64, syncWrite bool) (*wal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &wal{
+		dir:         dir,
+		segmentSize: segmentSize,
+		sync:        syncWrite,
+		segments:    make(map[uint64]*walSegment),
+	}, nil
+}
+
+// recover 按写入顺序读取已有分段中的记录，每条记录计入所在分段的pending
+// 分段末尾写了一半的记录被忽略，返回读取过程中遇到的损坏分段
+func (w *wal) recover(fn func(seg *walSegment, payload []byte)) (corrupt []string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, walExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, walExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		seg := &walSegment{id: id, path: w.segmentPath(id)}
+		w.nextID = max(w.nextID, id+1)
+		if err = w.readSegment(seg, fn); err != nil {
+			if !errors.Is(err, errWALCorrupt) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return corrupt, err
+			}
+			corrupt = append(corrupt, seg.path)
+		}
+		if seg.pending == 0 {
+			_ = os.Remove(seg.path)
+			continue
+		}
+		w.segments[id] = seg
+	}
+	return corrupt, nil
+}
+
+func (w *wal) readSegment(seg *walSegment, fn func(seg *walSegment, payload []byte)) error {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	header := make([]byte, walHeaderSize)
+	for {
+		if _, err = io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		size := binary.BigEndian.Uint32(header)
+		payload := make([]byte, size)
+		if _, err = io.ReadFull(r, payload); err != nil {
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			return errWALCorrupt
+		}
+		seg.pending++
+		fn(seg, payload)
+	}
+}
+
+// append 写入一条记录，返回记录所在的分段
+func (w *wal) append(payload []byte) (*walSegment, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil, errWALClosed
+	}
+	if w.active == nil || w.active.size >= w.segmentSize {
+		if err := w.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	buf := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(payload))
+	copy(buf[walHeaderSize:], payload)
+	if _, err := w.file.Write(buf); err != nil {
+		return nil, err
+	}
+	if w.sync {
+		if err := w.file.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	w.active.size += int64(len(buf))
+	w.active.pending++
+	return w.active, nil
+}
+
+// rotate 关闭当前分段并创建新分段，调用方需持有锁
+func (w *wal) rotate() error {
+	if w.active != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		old := w.active
+		w.active, w.file = nil, nil
+		if old.pending == 0 {
+			w.removeSegment(old)
+		}
+	}
+	seg := &walSegment{id: w.nextID, path: w.segmentPath(w.nextID)}
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	w.nextID++
+	w.active, w.file = seg, f
+	w.segments[seg.id] = seg
+	return nil
+}
+
+// ack 确认分段中的n条记录已处理完成
+func (w *wal) ack(seg *walSegment, n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seg.pending -= n
+	if seg.pending <= 0 && seg != w.active {
+		w.removeSegment(seg)
+	}
+}
+
+func (w *wal) removeSegment(seg *walSegment) {
+	delete(w.segments, seg.id)
+	_ = os.Remove(seg.path)
+}
+
+// close 关闭日志，所有记录都已确认时删除活跃分段
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.active == nil {
+		return nil
+	}
+	err := w.file.Close()
+	if w.active.pending <= 0 {
+		w.removeSegment(w.active)
+	}
+	w.active, w.file = nil, nil
+	return err
+}
+
+// pending 未确认的记录数
+func (w *wal) pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := 0
+	for _, seg := range w.segments {
+		n += seg.pending
+	}
+	return n
+}
+
+func (w *wal) segmentPath(id uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", id, walExt))
+}
@@ -0,0 +1,242 @@
+package gbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/qiafan666/gotato/commons/gcommon"
+	"github.com/qiafan666/gotato/commons/gface"
+	"github.com/qiafan666/gotato/commons/stores/redis_cli"
+)
+
+// ITransport 跨进程转发事件的传输层
+type ITransport interface {
+	// Publish 向subject发布消息
+	Publish(ctx context.Context, subject string, data []byte) error
+	// Subscribe 订阅subject，返回取消订阅的函数
+	Subscribe(subject string, handler func(data []byte)) (unsubscribe func() error, err error)
+}
+
+// NatsTransport 基于NATS的传输层
+type NatsTransport struct {
+	conn *nats.Conn
+}
+
+// NewNatsTransport 创建NATS传输层，使用mq/nats的客户端时传入Connection()
+func NewNatsTransport(conn *nats.Conn) *NatsTransport {
+	return &NatsTransport{conn: conn}
+}
+
+func (t *NatsTransport) Publish(_ context.Context, subject string, data []byte) error {
+	return t.conn.Publish(subject, data)
+}
+
+func (t *NatsTransport) Subscribe(subject string, handler func(data []byte)) (func() error, error) {
+	sub, err := t.conn.Subscribe(subject, func(msg *nats.Msg) {
+		handler(msg.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sub.Unsubscribe, nil
+}
+
+// RedisTransport 基于redis pub/sub的传输层，每个subject使用一个订阅连接
+type RedisTransport struct {
+	rds *redis_cli.Redis
+}
+
+// NewRedisTransport 创建redis传输层
+func NewRedisTransport(rds *redis_cli.Redis) *RedisTransport {
+	return &RedisTransport{rds: rds}
+}
+
+func (t *RedisTransport) Publish(ctx context.Context, subject string, data []byte) error {
+	_, err := t.rds.PublishCtx(ctx, subject, string(data))
+	return err
+}
+
+func (t *RedisTransport) Subscribe(subject string, handler func(data []byte)) (func() error, error) {
+	pubsub, err := t.rds.Subscribe(context.Background(), subject)
+	if err != nil {
+		return nil, err
+	}
+	ch := pubsub.Channel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range ch {
+			handler([]byte(msg.Payload))
+		}
+	}()
+	return func() error {
+		err := pubsub.Close()
+		<-done
+		return err
+	}, nil
+}
+
+// envelope 跨进程传输的事件
+type envelope struct {
+	Node string `json:"node"`
+	Data []byte `json:"data"`
+}
+
+type bridgeOptions struct {
+	node      string
+	prefix    string
+	marshal   func(v any) ([]byte, error)
+	unmarshal func(data []byte, v any) error
+	logger    gface.ILogger
+}
+
+// BridgeOption 桥接配置项
+type BridgeOption func(o *bridgeOptions)
+
+// WithNode 设置本进程的节点标识，默认随机生成
+func WithNode(node string) BridgeOption {
+	return func(o *bridgeOptions) {
+		o.node = node
+	}
+}
+
+// WithSubjectPrefix 设置传输层subject前缀，默认"gbus."
+func WithSubjectPrefix(prefix string) BridgeOption {
+	return func(o *bridgeOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithCodec 设置事件数据的编解码，默认json
+func WithCodec(marshal func(v any) ([]byte, error), unmarshal func(data []byte, v any) error) BridgeOption {
+	return func(o *bridgeOptions) {
+		o.marshal = marshal
+		o.unmarshal = unmarshal
+	}
+}
+
+// WithBridgeLogger 设置日志
+func WithBridgeLogger(logger gface.ILogger) BridgeOption {
+	return func(o *bridgeOptions) {
+		o.logger = logger
+	}
+}
+
+// Bridge 将总线上选定主题的事件转发到其他进程，并把其他进程发布的事件投递到本地总线
+// 本地订阅者对本进程与其他进程发布的事件一视同仁，可通过Event.Source区分来源
+type Bridge[T any] struct {
+	bus       *Bus[T]
+	transport ITransport
+	opts      *bridgeOptions
+
+	mu     sync.Mutex
+	topics map[string]func() error
+}
+
+// NewBridge 创建桥接
+func NewBridge[T any](bus *Bus[T], transport ITransport, opts ...BridgeOption) *Bridge[T] {
+	o := &bridgeOptions{
+		node:      gcommon.GenerateUUID(),
+		prefix:    "gbus.",
+		marshal:   json.Marshal,
+		unmarshal: json.Unmarshal,
+		logger:    gface.NewLogger("gbus", nil),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Bridge[T]{bus: bus, transport: transport, opts: o, topics: make(map[string]func() error)}
+}
+
+// Node 返回本进程的节点标识
+func (b *Bridge[T]) Node() string {
+	return b.opts.node
+}
+
+// Forward 转发主题，本地发布的事件发送到传输层，传输层收到的其他节点的事件在本地同步分发
+// 转发失败的错误会作为Publish的错误返回
+func (b *Bridge[T]) Forward(topics ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, topic := range topics {
+		if _, ok := b.topics[topic]; ok {
+			continue
+		}
+		unsubscribeRemote, err := b.transport.Subscribe(b.opts.prefix+topic, func(data []byte) {
+			b.receive(topic, data)
+		})
+		if err != nil {
+			return err
+		}
+		unsubscribeLocal := b.bus.Subscribe(topic, b.send)
+		b.topics[topic] = func() error {
+			unsubscribeLocal()
+			return unsubscribeRemote()
+		}
+	}
+	return nil
+}
+
+// Stop 停止转发主题
+func (b *Bridge[T]) Stop(topics ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var errs []error
+	for _, topic := range topics {
+		if stop, ok := b.topics[topic]; ok {
+			errs = append(errs, stop())
+			delete(b.topics, topic)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close 停止转发所有主题
+func (b *Bridge[T]) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var errs []error
+	for topic, stop := range b.topics {
+		errs = append(errs, stop())
+		delete(b.topics, topic)
+	}
+	return errors.Join(errs...)
+}
+
+// send 将本地发布的事件发送到传输层，其他节点转发来的事件不再转发
+func (b *Bridge[T]) send(ctx context.Context, e *Event[T]) error {
+	if e.Source != "" {
+		return nil
+	}
+	data, err := b.opts.marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(envelope{Node: b.opts.node, Data: data})
+	if err != nil {
+		return err
+	}
+	return b.transport.Publish(ctx, b.opts.prefix+e.Topic, msg)
+}
+
+// receive 将其他节点的事件分发到本地总线，忽略本节点发出的事件
+func (b *Bridge[T]) receive(topic string, msg []byte) {
+	ctx := context.Background()
+	var env envelope
+	if err := json.Unmarshal(msg, &env); err != nil {
+		b.opts.logger.WarnF(ctx, "gbus.receive: unmarshal envelope fail, topic=%s, err=%v", topic, err)
+		return
+	}
+	if env.Node == b.opts.node {
+		return
+	}
+	var data T
+	if err := b.opts.unmarshal(env.Data, &data); err != nil {
+		b.opts.logger.WarnF(ctx, "gbus.receive: unmarshal event fail, topic=%s, node=%s, err=%v", topic, env.Node, err)
+		return
+	}
+	_ = b.bus.dispatch(ctx, &Event[T]{Topic: topic, Data: data, Source: env.Node})
+}
@@ -7,6 +7,9 @@ import (
 	"reflect"
 )
 
+// MsgBus 基于反射的单主题消息总线
+//
+// Deprecated: 使用类型化的 Bus，支持多个主题、错误与panic上报、中间件与跨进程转发
 type MsgBus struct {
 	topic       string       // 主题
 	bus         EventBus.Bus // 事件总线
@@ -0,0 +1,283 @@
+package gbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"runtime/debug"
+	"slices"
+	"sync"
+
+	"github.com/qiafan666/gotato/commons/gface"
+)
+
+var (
+	// ErrBusClosed 事件总线已关闭
+	ErrBusClosed = errors.New("gbus: bus closed")
+	// ErrHandlerPanic 处理函数panic，通过errors.Is判断
+	ErrHandlerPanic = errors.New("gbus: handler panic")
+)
+
+// Event 事件
+type Event[T any] struct {
+	Topic  string
+	Data   T
+	Source string // 来源节点，本进程发布时为空，通过Bridge从其他进程转发时为对方的节点标识
+}
+
+// Handler 类型化的事件处理函数，返回的错误与panic会交给ErrorHandler
+type Handler[T any] func(ctx context.Context, e *Event[T]) error
+
+// Middleware 处理函数中间件，可用于日志、耗时统计、过滤等
+type Middleware[T any] func(next Handler[T]) Handler[T]
+
+// ErrorHandler 处理函数返回错误或panic时的回调
+type ErrorHandler[T any] func(ctx context.Context, e *Event[T], err error)
+
+type subscriber[T any] struct {
+	id      uint64
+	handler Handler[T]
+	once    bool
+}
+
+type asyncEvent[T any] struct {
+	ctx   context.Context
+	event *Event[T]
+}
+
+type busOptions struct {
+	workers   int
+	queueSize int
+	logger    gface.ILogger
+}
+
+// BusOption 事件总线配置项
+type BusOption func(o *busOptions)
+
+// WithAsync 设置异步投递的worker数与每个worker的队列长度，同一主题的事件总是由同一个worker按发布顺序处理
+func WithAsync(workers, queueSize int) BusOption {
+	return func(o *busOptions) {
+		o.workers = workers
+		o.queueSize = queueSize
+	}
+}
+
+// WithBusLogger 设置未设置ErrorHandler时记录错误的日志
+func WithBusLogger(logger gface.ILogger) BusOption {
+	return func(o *busOptions) {
+		o.logger = logger
+	}
+}
+
+// Bus 类型化的进程内事件总线，支持多个主题，goroutine safe
+// Publish 在调用方goroutine中按订阅顺序同步执行处理函数，PublishAsync 投递到有界队列由worker执行
+type Bus[T any] struct {
+	mu          sync.RWMutex
+	subscribers map[string][]*subscriber[T]
+	middlewares []Middleware[T]
+	onError     ErrorHandler[T]
+	seq         uint64
+	opts        *busOptions
+
+	closeMu sync.RWMutex
+	closed  bool
+	queues  []chan asyncEvent[T]
+	wg      sync.WaitGroup
+}
+
+// NewBus 创建事件总线
+func NewBus[T any](opts ...BusOption) *Bus[T] {
+	o := &busOptions{
+		workers:   1,
+		queueSize: 1024,
+		logger:    gface.NewLogger("gbus", nil),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.workers = max(o.workers, 1)
+	o.queueSize = max(o.queueSize, 1)
+
+	b := &Bus[T]{
+		subscribers: make(map[string][]*subscriber[T]),
+		opts:        o,
+		queues:      make([]chan asyncEvent[T], o.workers),
+	}
+	for i := range b.queues {
+		b.queues[i] = make(chan asyncEvent[T], o.queueSize)
+		b.wg.Add(1)
+		go b.work(b.queues[i])
+	}
+	return b
+}
+
+// Use 添加中间件，先添加的在外层，对已有的订阅同样生效
+func (b *Bus[T]) Use(middlewares ...Middleware[T]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.middlewares = append(b.middlewares, middlewares...)
+}
+
+// OnError 设置错误回调，未设置时记录日志
+func (b *Bus[T]) OnError(handler ErrorHandler[T]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onError = handler
+}
+
+// Subscribe 订阅主题，返回取消订阅的函数
+func (b *Bus[T]) Subscribe(topic string, handler Handler[T]) (unsubscribe func()) {
+	return b.subscribe(topic, handler, false)
+}
+
+// SubscribeOnce 订阅主题，处理一次事件后自动取消订阅
+func (b *Bus[T]) SubscribeOnce(topic string, handler Handler[T]) (unsubscribe func()) {
+	return b.subscribe(topic, handler, true)
+}
+
+func (b *Bus[T]) subscribe(topic string, handler Handler[T], once bool) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	id := b.seq
+	b.subscribers[topic] = append(b.subscribers[topic], &subscriber[T]{id: id, handler: handler, once: once})
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(topic, id)
+	}
+}
+
+// remove 移除订阅，调用方需持有写锁
+func (b *Bus[T]) remove(topic string, id uint64) bool {
+	subs := b.subscribers[topic]
+	for i, s := range subs {
+		if s.id == id {
+			// 复制而不是原地修改，正在分发的事件持有旧切片
+			subs = append(subs[:i:i], subs[i+1:]...)
+			if len(subs) == 0 {
+				delete(b.subscribers, topic)
+			} else {
+				b.subscribers[topic] = subs
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// HasSubscribers 主题是否有订阅者
+func (b *Bus[T]) HasSubscribers(topic string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subscribers[topic]) > 0
+}
+
+// Topics 返回有订阅者的主题
+func (b *Bus[T]) Topics() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	topics := make([]string, 0, len(b.subscribers))
+	for topic := range b.subscribers {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// Publish 同步发布事件，按订阅顺序依次执行处理函数，一个处理函数失败不影响后续处理函数
+// 返回所有处理函数的错误，panic被转换为包装了ErrHandlerPanic的错误
+func (b *Bus[T]) Publish(ctx context.Context, topic string, data T) error {
+	return b.dispatch(ctx, &Event[T]{Topic: topic, Data: data})
+}
+
+// PublishAsync 异步发布事件，队列满时阻塞直到有空位或ctx结束
+// 处理函数的错误只交给ErrorHandler
+func (b *Bus[T]) PublishAsync(ctx context.Context, topic string, data T) error {
+	return b.enqueue(ctx, &Event[T]{Topic: topic, Data: data})
+}
+
+func (b *Bus[T]) enqueue(ctx context.Context, e *Event[T]) error {
+	b.closeMu.RLock()
+	defer b.closeMu.RUnlock()
+	if b.closed {
+		return ErrBusClosed
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(e.Topic))
+	select {
+	case b.queues[h.Sum32()%uint32(len(b.queues))] <- asyncEvent[T]{ctx: context.WithoutCancel(ctx), event: e}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close 停止接收异步事件，等待队列中的事件处理完成
+func (b *Bus[T]) Close() {
+	b.closeMu.Lock()
+	if b.closed {
+		b.closeMu.Unlock()
+		return
+	}
+	b.closed = true
+	for _, q := range b.queues {
+		close(q)
+	}
+	b.closeMu.Unlock()
+	b.wg.Wait()
+}
+
+func (b *Bus[T]) work(queue chan asyncEvent[T]) {
+	defer b.wg.Done()
+	for item := range queue {
+		_ = b.dispatch(item.ctx, item.event)
+	}
+}
+
+func (b *Bus[T]) dispatch(ctx context.Context, e *Event[T]) error {
+	b.mu.RLock()
+	subs := b.subscribers[e.Topic]
+	middlewares := b.middlewares
+	onError := b.onError
+	b.mu.RUnlock()
+
+	if slices.ContainsFunc(subs, func(s *subscriber[T]) bool { return s.once }) {
+		// 一次性订阅在分发前移除，保证并发发布时只执行一次
+		b.mu.Lock()
+		subs = b.subscribers[e.Topic]
+		for _, s := range subs {
+			if s.once {
+				b.remove(e.Topic, s.id)
+			}
+		}
+		b.mu.Unlock()
+	}
+
+	var errs []error
+	for _, s := range subs {
+		h := s.handler
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			h = middlewares[i](h)
+		}
+		if err := call(ctx, h, e); err != nil {
+			errs = append(errs, err)
+			if onError != nil {
+				onError(ctx, e, err)
+			} else {
+				b.opts.logger.ErrorF(ctx, "gbus.dispatch: handle event fail, topic=%s, err=%v", e.Topic, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// call 执行处理函数，将panic转换为错误
+func call[T any](ctx context.Context, h Handler[T], e *Event[T]) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v\n%s", ErrHandlerPanic, r, debug.Stack())
+		}
+	}()
+	return h(ctx, e)
+}
@@ -0,0 +1,199 @@
+package gbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/qiafan666/gotato/commons/stores/redis_cli"
+)
+
+type orderEvent struct {
+	ID    int64 `json:"id"`
+	Price int64 `json:"price"`
+}
+
+func TestTypedBus(t *testing.T) {
+	ctx := context.Background()
+	bus := NewBus[orderEvent]()
+	defer bus.Close()
+
+	var got []string
+	bus.Use(func(next Handler[orderEvent]) Handler[orderEvent] {
+		return func(ctx context.Context, e *Event[orderEvent]) error {
+			got = append(got, "mw:"+e.Topic)
+			return next(ctx, e)
+		}
+	})
+	bus.Subscribe("created", func(ctx context.Context, e *Event[orderEvent]) error {
+		got = append(got, "sub1")
+		return nil
+	})
+	unsubscribe := bus.Subscribe("created", func(ctx context.Context, e *Event[orderEvent]) error {
+		got = append(got, "sub2")
+		return nil
+	})
+	bus.SubscribeOnce("paid", func(ctx context.Context, e *Event[orderEvent]) error {
+		got = append(got, "paid")
+		return nil
+	})
+
+	if err := bus.Publish(ctx, "created", orderEvent{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 || got[1] != "sub1" || got[3] != "sub2" {
+		t.Fatalf("order: %v", got)
+	}
+
+	got = nil
+	unsubscribe()
+	_ = bus.Publish(ctx, "created", orderEvent{ID: 2})
+	_ = bus.Publish(ctx, "paid", orderEvent{ID: 2})
+	_ = bus.Publish(ctx, "paid", orderEvent{ID: 3})
+	if len(got) != 4 || got[3] != "paid" || bus.HasSubscribers("paid") {
+		t.Fatalf("after unsubscribe: %v", got)
+	}
+}
+
+func TestTypedBusError(t *testing.T) {
+	ctx := context.Background()
+	bus := NewBus[int]()
+	defer bus.Close()
+
+	var reported []error
+	bus.OnError(func(ctx context.Context, e *Event[int], err error) {
+		reported = append(reported, err)
+	})
+	errFail := errors.New("fail")
+	bus.Subscribe("t", func(ctx context.Context, e *Event[int]) error {
+		return errFail
+	})
+	bus.Subscribe("t", func(ctx context.Context, e *Event[int]) error {
+		panic("boom")
+	})
+	called := false
+	bus.Subscribe("t", func(ctx context.Context, e *Event[int]) error {
+		called = true
+		return nil
+	})
+
+	err := bus.Publish(ctx, "t", 1)
+	if !errors.Is(err, errFail) || !errors.Is(err, ErrHandlerPanic) || !called {
+		t.Fatalf("err %v, called %v", err, called)
+	}
+	if len(reported) != 2 {
+		t.Fatalf("reported %v", reported)
+	}
+}
+
+func TestTypedBusAsync(t *testing.T) {
+	ctx := context.Background()
+	bus := NewBus[int](WithAsync(4, 8))
+
+	var lock sync.Mutex
+	got := map[string][]int{}
+	for _, topic := range []string{"a", "b", "c"} {
+		bus.Subscribe(topic, func(ctx context.Context, e *Event[int]) error {
+			lock.Lock()
+			got[e.Topic] = append(got[e.Topic], e.Data)
+			lock.Unlock()
+			return nil
+		})
+	}
+	for i := 0; i < 100; i++ {
+		for _, topic := range []string{"a", "b", "c"} {
+			if err := bus.PublishAsync(ctx, topic, i); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	bus.Close()
+	for topic, values := range got {
+		if len(values) != 100 {
+			t.Fatalf("topic %s got %d events", topic, len(values))
+		}
+		// 同一主题按发布顺序处理
+		for i, v := range values {
+			if v != i {
+				t.Fatalf("topic %s out of order: %v", topic, values)
+			}
+		}
+	}
+	if err := bus.PublishAsync(ctx, "a", 1); !errors.Is(err, ErrBusClosed) {
+		t.Fatalf("want ErrBusClosed, got %v", err)
+	}
+
+	// 队列满时等待ctx结束
+	bus = NewBus[int](WithAsync(1, 1))
+	block := make(chan struct{})
+	bus.Subscribe("a", func(ctx context.Context, e *Event[int]) error {
+		<-block
+		return nil
+	})
+	_ = bus.PublishAsync(ctx, "a", 1)
+	_ = bus.PublishAsync(ctx, "a", 2)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := bus.PublishAsync(timeoutCtx, "a", 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want DeadlineExceeded, got %v", err)
+	}
+	close(block)
+	bus.Close()
+}
+
+func TestBridge(t *testing.T) {
+	ctx := context.Background()
+	s := miniredis.RunT(t)
+	rds := redis_cli.MustNewRedis(redis_cli.RedisConf{Host: s.Addr(), Type: redis_cli.NodeType})
+
+	busA, busB := NewBus[orderEvent](), NewBus[orderEvent]()
+	bridgeA := NewBridge(busA, NewRedisTransport(rds), WithNode("A"))
+	bridgeB := NewBridge(busB, NewRedisTransport(rds), WithNode("B"))
+	defer bridgeA.Close()
+	defer bridgeB.Close()
+	if err := bridgeA.Forward("created"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bridgeB.Forward("created"); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan *Event[orderEvent], 10)
+	busB.Subscribe("created", func(ctx context.Context, e *Event[orderEvent]) error {
+		received <- e
+		return nil
+	})
+	local := 0
+	busA.Subscribe("created", func(ctx context.Context, e *Event[orderEvent]) error {
+		local++
+		return nil
+	})
+	busA.Subscribe("local", func(ctx context.Context, e *Event[orderEvent]) error {
+		return nil
+	})
+
+	if err := busA.Publish(ctx, "created", orderEvent{ID: 1, Price: 100}); err != nil {
+		t.Fatal(err)
+	}
+	_ = busA.Publish(ctx, "local", orderEvent{ID: 2})
+	select {
+	case e := <-received:
+		if e.Source != "A" || e.Data.ID != 1 || e.Data.Price != 100 {
+			t.Fatalf("received %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event not forwarded")
+	}
+	select {
+	case e := <-received:
+		t.Fatalf("unexpected event %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// 转发来的事件不会回传，发布方也不会收到自己的事件
+	if local != 1 {
+		t.Fatalf("local handler called %d times", local)
+	}
+}
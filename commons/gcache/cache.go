@@ -1,24 +1,29 @@
 package gcache
 
 import (
+	"container/list"
 	"encoding/gob"
 	"fmt"
 	"io"
 	"os"
+	"reflect"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/exp/constraints"
 )
 
 // Item 结构体表示一个缓存项，包括对象和过期时间。
-type Item struct {
-	Object     interface{} // 存储的对象。
-	Expiration int64       // 过期时间（纳秒），0 表示没有设置过期时间。
+type Item[V any] struct {
+	Object     V     // 存储的对象。
+	Expiration int64 // 过期时间（纳秒），0 表示没有设置过期时间。
 }
 
 // Expired 方法检查 Item 是否已经过期。
 // 返回值：如果 Item 已过期，则返回 true；否则返回 false。
-func (item Item) Expired() bool {
+func (item Item[V]) Expired() bool {
 	if item.Expiration == 0 {
 		return false
 	}
@@ -30,49 +35,93 @@ const (
 	DefaultExpiration time.Duration = 0
 )
 
+// Number 支持 Increment、Decrement 的数值类型。
+type Number interface {
+	constraints.Integer | constraints.Float
+}
+
+// Stats 缓存的命中与淘汰统计。
+type Stats struct {
+	Hits      int64 // Get 命中次数。
+	Misses    int64 // Get 未命中次数，包括已过期未清理的键。
+	Evictions int64 // 超出容量上限被淘汰的键数。
+	Expired   int64 // 过期被清理的键数。
+}
+
+// IUpdater 可以原子更新值的缓存，Cache 与 ShardedCache 均实现了该接口。
+type IUpdater[K comparable, V any] interface {
+	Update(k K, fn func(v V) V) (V, error)
+}
+
+// Increment 将缓存中指定键的值增加 n，并返回增加后的值。
+// 如果键不存在或已过期，则返回错误。
+func Increment[K comparable, V Number](c IUpdater[K, V], k K, n V) (V, error) {
+	return c.Update(k, func(v V) V {
+		return v + n
+	})
+}
+
+// Decrement 将缓存中指定键的值减少 n，并返回减少后的值。
+// 如果键不存在或已过期，则返回错误。
+func Decrement[K comparable, V Number](c IUpdater[K, V], k K, n V) (V, error) {
+	return c.Update(k, func(v V) V {
+		return v - n
+	})
+}
+
 // Cache 结构体封装了缓存功能，包括过期时间和缓存项等。
-type Cache struct {
-	*cache // 内部缓存结构体的嵌入。
+type Cache[K comparable, V any] struct {
+	*cache[K, V] // 内部缓存结构体的嵌入。
+}
+
+// cacheEntry 缓存项及其在淘汰链表中的位置。
+type cacheEntry[K comparable, V any] struct {
+	key  K
+	item Item[V]
+	size int64         // 估算的字节数，仅设置了字节上限时计算。
+	elem *list.Element // 在 lru 链表中的位置。
 }
 
 // cache 结构体表示缓存的内部实现，包括默认过期时间、缓存项和互斥锁。
-type cache struct {
-	defaultExpiration time.Duration             // 默认过期时间。
-	items             map[string]Item           // 存储缓存项的映射表。
-	mu                sync.RWMutex              // 读写互斥锁，保护缓存项的并发访问。
-	onEvicted         func(string, interface{}) // 当缓存项被驱逐时的回调函数。
-	janitor           *janitor                  // 管理员，用于定期清理过期项。
+type cache[K comparable, V any] struct {
+	defaultExpiration time.Duration           // 默认过期时间。
+	items             map[K]*cacheEntry[K, V] // 存储缓存项的映射表。
+	lru               *list.List              // 按访问顺序排列的缓存项，最近访问的在前。
+	mu                sync.RWMutex            // 读写互斥锁，保护缓存项的并发访问。
+	onEvicted         func(K, V)              // 当缓存项被驱逐时的回调函数。
+	janitor           *janitor                // 管理员，用于定期清理过期项。
+	maxEntries        int                     // 最大键数，0 表示不限制。
+	maxBytes          int64                   // 最大估算字节数，0 表示不限制。
+	bytes             int64                   // 当前估算字节数。
+	sizer             func(k K, v V) int64    // 估算缓存项字节数的函数。
+	hits              atomic.Int64            // 命中次数。
+	misses            atomic.Int64            // 未命中次数。
+	evictions         atomic.Int64            // 超出容量被淘汰的键数。
+	expired           atomic.Int64            // 过期被清理的键数。
+	evictedItems      []keyAndValue[K, V]     // 本次加锁期间需要回调的键值对，在解锁后回调。
+}
+
+// keyAndValue 是一个结构体，用于存储键值对。
+type keyAndValue[K comparable, V any] struct {
+	key   K
+	value V
 }
 
 // Set 方法在缓存中设置一个键值对，并为其指定过期时间。
+// 如果超出了容量上限，则淘汰最久未访问的键。
 // 参数：
 // - k: 键名，表示要设置的键。
 // - x: 值，表示要存储的对象。
 // - d: 过期时间，如果为 `DefaultExpiration`，则使用缓存的默认过期时间。
 // 返回值：无。
-func (c *cache) Set(k string, x interface{}, d time.Duration) {
-	var e int64
-	if d == DefaultExpiration {
-		d = c.defaultExpiration
-	}
-	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
-	}
+func (c *cache[K, V]) Set(k K, x V, d time.Duration) {
 	c.mu.Lock()
-	c.items[k] = Item{
-		Object:     x,
-		Expiration: e,
-	}
-	c.mu.Unlock()
+	c.set(k, x, d)
+	c.unlockAndNotify()
 }
 
-// set 方法是 Set 方法的内部实现，用于在缓存中设置一个键值对。
-// 参数：
-// - k: 键名，表示要设置的键。
-// - x: 值，表示要存储的对象。
-// - d: 过期时间，如果为 `DefaultExpiration`，则使用缓存的默认过期时间。
-// 返回值：无。
-func (c *cache) set(k string, x interface{}, d time.Duration) {
+// set 方法是 Set 方法的内部实现，调用方需持有写锁。
+func (c *cache[K, V]) set(k K, x V, d time.Duration) {
 	var e int64
 	if d == DefaultExpiration {
 		d = c.defaultExpiration
@@ -80,10 +129,21 @@ func (c *cache) set(k string, x interface{}, d time.Duration) {
 	if d > 0 {
 		e = time.Now().Add(d).UnixNano()
 	}
-	c.items[k] = Item{
+	item := Item[V]{
 		Object:     x,
 		Expiration: e,
 	}
+	if ce, found := c.items[k]; found {
+		ce.item = item
+		c.resize(ce)
+		c.lru.MoveToFront(ce.elem)
+	} else {
+		ce = &cacheEntry[K, V]{key: k, item: item}
+		ce.elem = c.lru.PushFront(ce)
+		c.items[k] = ce
+		c.resize(ce)
+	}
+	c.evict()
 }
 
 // SetDefault 方法在缓存中设置一个键值对，并使用默认过期时间。
@@ -91,7 +151,7 @@ func (c *cache) set(k string, x interface{}, d time.Duration) {
 // - k: 键名，表示要设置的键。
 // - x: 值，表示要存储的对象。
 // 返回值：无。
-func (c *cache) SetDefault(k string, x interface{}) {
+func (c *cache[K, V]) SetDefault(k K, x V) {
 	c.Set(k, x, DefaultExpiration)
 }
 
@@ -103,15 +163,14 @@ func (c *cache) SetDefault(k string, x interface{}) {
 // - d: 过期时间。
 // 返回值：
 // - 错误，如果键已存在，则返回错误。
-func (c *cache) Add(k string, x interface{}, d time.Duration) error {
+func (c *cache[K, V]) Add(k K, x V, d time.Duration) error {
 	c.mu.Lock()
-	_, found := c.get(k)
-	if found {
+	if _, found := c.get(k); found {
 		c.mu.Unlock()
-		return fmt.Errorf("item %s already exists", k)
+		return fmt.Errorf("item %v already exists", k)
 	}
 	c.set(k, x, d)
-	c.mu.Unlock()
+	c.unlockAndNotify()
 	return nil
 }
 
@@ -123,15 +182,14 @@ func (c *cache) Add(k string, x interface{}, d time.Duration) error {
 // - d: 过期时间。
 // 返回值：
 // - 错误，如果键不存在，则返回错误。
-func (c *cache) Replace(k string, x interface{}, d time.Duration) error {
+func (c *cache[K, V]) Replace(k K, x V, d time.Duration) error {
 	c.mu.Lock()
-	_, found := c.get(k)
-	if !found {
+	if _, found := c.get(k); !found {
 		c.mu.Unlock()
-		return fmt.Errorf("item %s doesn't exist", k)
+		return fmt.Errorf("item %v doesn't exist", k)
 	}
 	c.set(k, x, d)
-	c.mu.Unlock()
+	c.unlockAndNotify()
 	return nil
 }
 
@@ -139,877 +197,335 @@ func (c *cache) Replace(k string, x interface{}, d time.Duration) error {
 // 参数：
 // - k: 键名，表示要获取的键。
 // 返回值：
-// - interface{}: 获取到的值。
+// - V: 获取到的值。
 // - bool: 如果键存在并且未过期，则返回 true；否则返回 false。
-func (c *cache) Get(k string) (interface{}, bool) {
-	c.mu.RLock()
-	item, found := c.items[k]
-	if !found {
-		c.mu.RUnlock()
-		return nil, false
-	}
-	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			c.mu.RUnlock()
-			return nil, false
-		}
-	}
-	c.mu.RUnlock()
-	return item.Object, true
+func (c *cache[K, V]) Get(k K) (V, bool) {
+	v, _, found := c.GetWithExpiration(k)
+	return v, found
 }
 
 // GetWithExpiration 方法从缓存中获取指定键的值和过期时间。
 // 参数：
 // - k: 键名，表示要获取的键。
 // 返回值：
-// - interface{}: 获取到的值。
-// - time.Time: 键的过期时间。
+// - V: 获取到的值。
+// - time.Time: 键的过期时间，没有设置过期时间时为零值。
 // - bool: 如果键存在并且未过期，则返回 true；否则返回 false。
-func (c *cache) GetWithExpiration(k string) (interface{}, time.Time, bool) {
+func (c *cache[K, V]) GetWithExpiration(k K) (V, time.Time, bool) {
 	c.mu.RLock()
-	item, found := c.items[k]
-	if !found {
+	ce, found := c.items[k]
+	if !found || ce.item.Expired() {
 		c.mu.RUnlock()
-		return nil, time.Time{}, false
-	}
-	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			c.mu.RUnlock()
-			return nil, time.Time{}, false
-		}
-		c.mu.RUnlock()
-		return item.Object, time.Unix(0, item.Expiration), true
+		c.misses.Add(1)
+		var zero V
+		return zero, time.Time{}, false
 	}
+	item, bounded := ce.item, c.bounded()
 	c.mu.RUnlock()
-	return item.Object, time.Time{}, true
-}
+	c.hits.Add(1)
 
-// GetDefault 方法从缓存中获取指定键的值，并使用默认过期时间。
-// 参数：
-// - k: 键名，表示要获取的键。
-// 返回值：
-func (c *cache) get(k string) (interface{}, bool) {
-	item, found := c.items[k]
-	if !found {
-		return nil, false
-	}
-
-	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			return nil, false
+	// 设置了容量上限时才需要维护访问顺序，避免无上限时读操作加写锁
+	if bounded {
+		c.mu.Lock()
+		if c.items[k] == ce {
+			c.lru.MoveToFront(ce.elem)
 		}
-	}
-	return item.Object, true
-}
-
-// Increment 方法增加缓存中指定键的值。
-// 如果键不存在或已过期，则返回错误。
-// 参数：
-// - k: 键名，表示要增加的键。
-// - n: 增加的数值。
-// 返回值：
-// - 错误，如果键不存在或已过期，则返回错误。
-func (c *cache) Increment(k string, n int64) error {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return fmt.Errorf("item %s not found", k)
-	}
-	switch v.Object.(type) {
-	case int:
-		v.Object = v.Object.(int) + int(n)
-	case int8:
-		v.Object = v.Object.(int8) + int8(n)
-	case int16:
-		v.Object = v.Object.(int16) + int16(n)
-	case int32:
-		v.Object = v.Object.(int32) + int32(n)
-	case int64:
-		v.Object = v.Object.(int64) + n
-	case uint:
-		v.Object = v.Object.(uint) + uint(n)
-	case uintptr:
-		v.Object = v.Object.(uintptr) + uintptr(n)
-	case uint8:
-		v.Object = v.Object.(uint8) + uint8(n)
-	case uint16:
-		v.Object = v.Object.(uint16) + uint16(n)
-	case uint32:
-		v.Object = v.Object.(uint32) + uint32(n)
-	case uint64:
-		v.Object = v.Object.(uint64) + uint64(n)
-	case float32:
-		v.Object = v.Object.(float32) + float32(n)
-	case float64:
-		v.Object = v.Object.(float64) + float64(n)
-	default:
-		c.mu.Unlock()
-		return fmt.Errorf("the value for %s is not an integer", k)
-	}
-	c.items[k] = v
-	c.mu.Unlock()
-	return nil
-}
-
-// IncrementFloat 方法增加缓存中指定键的浮点值。
-// 如果键不存在或已过期，则返回错误。
-// 参数：
-// - k: 键名，表示要增加的键。
-// - n: 增加的数值（浮点数）。
-// 返回值：
-// - 错误，如果键不存在或已过期，则返回错误。
-func (c *cache) IncrementFloat(k string, n float64) error {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return fmt.Errorf("item %s not found", k)
-	}
-	switch v.Object.(type) {
-	case float32:
-		v.Object = v.Object.(float32) + float32(n)
-	case float64:
-		v.Object = v.Object.(float64) + n
-	default:
-		c.mu.Unlock()
-		return fmt.Errorf("the value for %s does not have type float32 or float64", k)
-	}
-	c.items[k] = v
-	c.mu.Unlock()
-	return nil
-}
-
-// IncrementInt 方法增加缓存中指定键的整数值。
-// 如果键不存在或已过期，则返回错误。
-// 参数：
-// - k: 键名，表示要增加的键。
-// - n: 增加的整数值。
-// 返回值：
-// - int: 增加后的值。
-// - 错误，如果键不存在或已过期，则返回错误。
-func (c *cache) IncrementInt(k string, n int) (int, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
 	}
-	rv, ok := v.Object.(int)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int", k)
+	if item.Expiration > 0 {
+		return item.Object, time.Unix(0, item.Expiration), true
 	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return item.Object, time.Time{}, true
 }
 
-// IncrementInt8 方法增加缓存中指定键的 8 位整数值。
-// 如果键不存在或已过期，则返回错误。
-// 参数：
-// - k: 键名，表示要增加的键。
-// - n: 增加的 8 位整数值。
-// 返回值：
-// - int8: 增加后的值。
-// - 错误，如果键不存在或已过期，则返回错误。
-func (c *cache) IncrementInt8(k string, n int8) (int8, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
+// get 方法是 Get 方法的内部实现，调用方需持有锁，不更新访问顺序与统计。
+func (c *cache[K, V]) get(k K) (V, bool) {
+	ce, found := c.items[k]
+	if !found || ce.item.Expired() {
+		var zero V
+		return zero, false
 	}
-	rv, ok := v.Object.(int8)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int8", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return ce.item.Object, true
 }
 
-// IncrementInt16 方法增加缓存中指定键的 16 位整数值。
+// Update 方法使用 fn 的返回值原子地替换缓存中指定键的值，过期时间不变。
 // 如果键不存在或已过期，则返回错误。
 // 参数：
-// - k: 键名，表示要增加的键。
-// - n: 增加的 16 位整数值。
+// - k: 键名，表示要更新的键。
+// - fn: 根据旧值计算新值的函数，在持有锁时调用，不能再访问该缓存。
 // 返回值：
-// - int16: 增加后的值。
+// - V: 更新后的值。
 // - 错误，如果键不存在或已过期，则返回错误。
-func (c *cache) IncrementInt16(k string, n int16) (int16, error) {
+func (c *cache[K, V]) Update(k K, fn func(v V) V) (V, error) {
 	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
+	ce, found := c.items[k]
+	if !found || ce.item.Expired() {
 		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
+		var zero V
+		return zero, fmt.Errorf("item %v not found", k)
 	}
-	rv, ok := v.Object.(int16)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int16", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
+	nv := fn(ce.item.Object)
+	ce.item.Object = nv
+	c.resize(ce)
+	c.lru.MoveToFront(ce.elem)
+	c.evict()
+	c.unlockAndNotify()
 	return nv, nil
 }
 
-// IncrementInt32 方法增加缓存中指定键的 32 位整数值。
-// 如果键不存在或已过期，则返回错误。
-// 参数：
-// - k: 键名，表示要增加的键。
-// - n: 增加的 32 位整数值。
-// 返回值：
-// - int32: 增加后的值。
-// - 错误，如果键不存在或已过期，则返回错误。
-func (c *cache) IncrementInt32(k string, n int32) (int32, error) {
+// Delete 从缓存中删除指定键对应的值。
+// 如果设置了 evict 回调函数并且键对应的值被成功删除，则会调用回调函数。
+func (c *cache[K, V]) Delete(k K) {
 	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
+	if ce, found := c.items[k]; found {
+		c.remove(ce)
 	}
-	rv, ok := v.Object.(int32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int32", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	c.unlockAndNotify()
 }
 
-// IncrementInt64 方法增加缓存中指定键的 64 位整数值。
-// 如果键不存在或已过期，则返回错误。
-// 参数：
-// - k: 键名，表示要增加的键。
-// - n: 增加的 64 位整数值。
-// 返回值：
-// - int64: 增加后的值。
-// - 错误，如果键不存在或已过期，则返回错误。
-func (c *cache) IncrementInt64(k string, n int64) (int64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(int64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int64", k)
+// remove 从缓存中删除缓存项，设置了回调函数时记录到 evictedItems，调用方需持有写锁。
+func (c *cache[K, V]) remove(ce *cacheEntry[K, V]) {
+	delete(c.items, ce.key)
+	c.lru.Remove(ce.elem)
+	c.bytes -= ce.size
+	if c.onEvicted != nil {
+		c.evictedItems = append(c.evictedItems, keyAndValue[K, V]{ce.key, ce.item.Object})
 	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
 }
 
-// IncrementUint 方法增加缓存中指定键的无符号整数值。
-// 如果键不存在或已过期，则返回错误。
-// 参数：
-// - k: 键名，表示要增加的键。
-// - n: 增加的无符号整数值。
-// 返回值：
-// - uint: 增加后的值。
-// - 错误，如果键不存在或已过期，则返回错误。
-func (c *cache) IncrementUint(k string, n uint) (uint, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(uint)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
+// unlockAndNotify 释放写锁，并对本次加锁期间删除的键值对调用回调函数。
+func (c *cache[K, V]) unlockAndNotify() {
+	evictedItems, onEvicted := c.evictedItems, c.onEvicted
+	c.evictedItems = nil
 	c.mu.Unlock()
-	return nv, nil
-}
-
-// IncrementUintptr 方法增加缓存中指定键的指针值。
-// 如果键不存在或已过期，则返回错误。
-// 参数：
-// - k: 键名，表示要增加的键。
-// - n: 增加的指针值。
-// 返回值：
-// - uintptr: 增加后的值。
-// - 错误，如果键不存在或已过期，则返回错误。
-func (c *cache) IncrementUintptr(k string, n uintptr) (uintptr, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(uintptr)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uintptr", k)
+	for _, v := range evictedItems {
+		onEvicted(v.key, v.value)
 	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
 }
 
-// IncrementUint8 方法增加缓存中指定键的 8 位无符号整数值。
-// 如果键不存在或已过期，则返回错误。
-// 参数：
-// - k: 键名，表示要增加的键。
-// - n: 增加的 8 位无符号整数值。
-// 返回值：
-// - uint8: 增加后的值。
-// - 错误，如果键不存在或已过期，则返回错误。
-func (c *cache) IncrementUint8(k string, n uint8) (uint8, error) {
+// DeleteExpired 删除缓存中所有过期的键值对。
+// 如果设置了 evict 回调函数，则会在删除每个过期键后调用回调函数。
+func (c *cache[K, V]) DeleteExpired() {
+	now := time.Now().UnixNano()
 	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(uint8)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint8", k)
+	for _, ce := range c.items {
+		// 内联过期检查
+		if ce.item.Expiration > 0 && now > ce.item.Expiration {
+			c.remove(ce)
+			c.expired.Add(1)
+		}
 	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	c.unlockAndNotify()
 }
 
-// IncrementUint16 方法增加缓存中指定键的 16 位无符号整数值。
-// 如果键不存在或已过期，则返回错误。
-// 参数：
-// - k: 键名，表示要增加的键。
-// - n: 增加的 16 位无符号整数值。
-// 返回值：
-// - uint16: 增加后的值。
-// - 错误，如果键不存在或已过期，则返回错误。
-func (c *cache) IncrementUint16(k string, n uint16) (uint16, error) {
+// OnEvicted 设置键值对被移除时的回调函数，包括删除、过期清理与超出容量淘汰。
+func (c *cache[K, V]) OnEvicted(f func(K, V)) {
 	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(uint16)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint16", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
+	c.onEvicted = f
 	c.mu.Unlock()
-	return nv, nil
 }
 
-// IncrementUint32 方法增加缓存中指定键的 32 位无符号整数值。
-// 如果键不存在或已过期，则返回错误。
-// 参数：
-// - k: 键名，表示要增加的键。
-// - n: 增加的 32 位无符号整数值。
-// 返回值：
-// - uint32: 增加后的值。
-// - 错误，如果键不存在或已过期，则返回错误。
-func (c *cache) IncrementUint32(k string, n uint32) (uint32, error) {
+// SetMaxEntries 设置最大键数，超出时淘汰最久未访问的键，0 表示不限制。
+func (c *cache[K, V]) SetMaxEntries(n int) {
 	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(uint32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint32", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	c.maxEntries = max(n, 0)
+	c.evict()
+	c.unlockAndNotify()
 }
 
-// IncrementUint64 方法增加缓存中指定键的 64 位无符号整数值。
-// 如果键不存在或已过期，则返回错误。
+// SetMaxBytes 设置最大估算字节数，超出时淘汰最久未访问的键，0 表示不限制。
 // 参数：
-// - k: 键名，表示要增加的键。
-// - n: 增加的 64 位无符号整数值。
-// 返回值：
-// - uint64: 增加后的值。
-// - 错误，如果键不存在或已过期，则返回错误。
-func (c *cache) IncrementUint64(k string, n uint64) (uint64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(uint64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint64", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-func (c *cache) IncrementFloat32(k string, n float32) (float32, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(float32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an float32", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-func (c *cache) IncrementFloat64(k string, n float64) (float64, error) {
+// - n: 最大字节数。
+// - sizer: 估算一个键值对字节数的函数，为 nil 时按类型大小与字符串、切片、map 的长度估算。
+func (c *cache[K, V]) SetMaxBytes(n int64, sizer func(k K, v V) int64) {
 	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
+	c.maxBytes = max(n, 0)
+	c.sizer = sizer
+	c.bytes = 0
+	for _, ce := range c.items {
+		ce.size = 0
+		c.resize(ce)
 	}
-	rv, ok := v.Object.(float64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an float64", k)
-	}
-	nv := rv + n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	c.evict()
+	c.unlockAndNotify()
 }
 
-func (c *cache) Decrement(k string, n int64) error {
-
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return fmt.Errorf("item not found")
-	}
-	switch v.Object.(type) {
-	case int:
-		v.Object = v.Object.(int) - int(n)
-	case int8:
-		v.Object = v.Object.(int8) - int8(n)
-	case int16:
-		v.Object = v.Object.(int16) - int16(n)
-	case int32:
-		v.Object = v.Object.(int32) - int32(n)
-	case int64:
-		v.Object = v.Object.(int64) - n
-	case uint:
-		v.Object = v.Object.(uint) - uint(n)
-	case uintptr:
-		v.Object = v.Object.(uintptr) - uintptr(n)
-	case uint8:
-		v.Object = v.Object.(uint8) - uint8(n)
-	case uint16:
-		v.Object = v.Object.(uint16) - uint16(n)
-	case uint32:
-		v.Object = v.Object.(uint32) - uint32(n)
-	case uint64:
-		v.Object = v.Object.(uint64) - uint64(n)
-	case float32:
-		v.Object = v.Object.(float32) - float32(n)
-	case float64:
-		v.Object = v.Object.(float64) - float64(n)
-	default:
-		c.mu.Unlock()
-		return fmt.Errorf("the value for %s is not an integer", k)
-	}
-	c.items[k] = v
-	c.mu.Unlock()
-	return nil
+// bounded 是否设置了容量上限，调用方需持有锁。
+func (c *cache[K, V]) bounded() bool {
+	return c.maxEntries > 0 || c.maxBytes > 0
 }
 
-func (c *cache) DecrementFloat(k string, n float64) error {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return fmt.Errorf("item %s not found", k)
+// resize 重新估算缓存项的字节数，调用方需持有写锁。
+func (c *cache[K, V]) resize(ce *cacheEntry[K, V]) {
+	if c.maxBytes <= 0 {
+		return
 	}
-	switch v.Object.(type) {
-	case float32:
-		v.Object = v.Object.(float32) - float32(n)
-	case float64:
-		v.Object = v.Object.(float64) - n
-	default:
-		c.mu.Unlock()
-		return fmt.Errorf("the value for %s does not have type float32 or float64", k)
+	var size int64
+	if c.sizer != nil {
+		size = c.sizer(ce.key, ce.item.Object)
+	} else {
+		size = estimateSize(ce.key) + estimateSize(ce.item.Object)
 	}
-	c.items[k] = v
-	c.mu.Unlock()
-	return nil
+	c.bytes += size - ce.size
+	ce.size = size
 }
 
-func (c *cache) DecrementInt(k string, n int) (int, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(int)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int", k)
+// evict 淘汰最久未访问的键直到不超过容量上限，调用方需持有写锁。
+// 单个键值对超出字节上限时，该键值对本身也会被淘汰。
+func (c *cache[K, V]) evict() {
+	for c.lru.Len() > 0 &&
+		(c.maxEntries > 0 && len(c.items) > c.maxEntries || c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.remove(c.lru.Back().Value.(*cacheEntry[K, V]))
+		c.evictions.Add(1)
 	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
 }
 
-func (c *cache) DecrementInt8(k string, n int8) (int8, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(int8)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int8", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-func (c *cache) DecrementInt16(k string, n int16) (int16, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(int16)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int16", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-func (c *cache) DecrementInt32(k string, n int32) (int32, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
+// Stats 返回缓存的命中与淘汰统计。
+func (c *cache[K, V]) Stats() Stats {
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Expired:   c.expired.Load(),
 	}
-	rv, ok := v.Object.(int32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int32", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
 }
 
-func (c *cache) DecrementInt64(k string, n int64) (int64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(int64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int64", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-func (c *cache) DecrementUint(k string, n uint) (uint, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(uint)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-func (c *cache) DecrementUintptr(k string, n uintptr) (uintptr, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(uintptr)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uintptr", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-func (c *cache) DecrementUint8(k string, n uint8) (uint8, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(uint8)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint8", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-func (c *cache) DecrementUint16(k string, n uint16) (uint16, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(uint16)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint16", k)
+// Save 使用 Gob 编码将缓存的内容保存到指定的 Writer 中。
+// 编码格式与 map[string]Item{Object interface{}, Expiration int64} 一致，K 为 string 时兼容旧版本保存的快照。
+// 如果在编码过程中发生错误，则会返回一个错误。
+func (c *cache[K, V]) Save(w io.Writer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	items := make(map[K]Item[V], len(c.items))
+	for k, ce := range c.items {
+		items[k] = ce.item
 	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return saveItems(w, items)
 }
 
-func (c *cache) DecrementUint32(k string, n uint32) (uint32, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(uint32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint32", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+// SaveFile 使用 Gob 编码将缓存的内容保存到指定的文件中。
+// 如果在创建或保存文件时发生错误，则会返回错误。
+func (c *cache[K, V]) SaveFile(fName string) error {
+	return saveFile(fName, c.Save)
 }
 
-func (c *cache) DecrementUint64(k string, n uint64) (uint64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(uint64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint64", k)
+// Load 使用 Gob 解码从指定的 Reader 中加载缓存的内容，已存在且未过期的键不会被覆盖。
+// 如果在解码过程中发生错误或值的类型不是 V，则会返回错误。
+func (c *cache[K, V]) Load(r io.Reader) error {
+	items, err := loadItems[K, V](r)
+	if err != nil {
+		return err
 	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
-}
-
-func (c *cache) DecrementFloat32(k string, n float32) (float32, error) {
 	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(float32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an float32", k)
-	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	c.load(items)
+	c.unlockAndNotify()
+	return nil
 }
 
-func (c *cache) DecrementFloat64(k string, n float64) (float64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Object.(float64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an float64", k)
+// load 合并加载的缓存项，调用方需持有写锁。
+func (c *cache[K, V]) load(items map[K]Item[V]) {
+	for k, v := range items {
+		if _, found := c.get(k); found || v.Expired() {
+			continue
+		}
+		if ce, found := c.items[k]; found {
+			c.remove(ce)
+		}
+		ce := &cacheEntry[K, V]{key: k, item: v}
+		ce.elem = c.lru.PushFront(ce)
+		c.items[k] = ce
+		c.resize(ce)
 	}
-	nv := rv - n
-	v.Object = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	c.evict()
 }
 
-// Delete 从缓存中删除指定键对应的值。
-// 如果设置了 evict 回调函数并且键对应的值被成功删除，则会调用回调函数。
-func (c *cache) Delete(k string) {
-	c.mu.Lock()
-	v, evicted := c.delete(k)
-	c.mu.Unlock()
-	if evicted {
-		c.onEvicted(k, v)
-	}
+// LoadFile 使用 Gob 解码从指定的文件中加载缓存的内容。
+// 如果在打开或加载文件时发生错误，则会返回错误。
+func (c *cache[K, V]) LoadFile(fName string) error {
+	return loadFile(fName, c.Load)
 }
 
-// delete 从缓存中删除指定键对应的值，并返回删除的值和一个布尔值，表示是否成功删除。
-func (c *cache) delete(k string) (interface{}, bool) {
-	if c.onEvicted != nil {
-		if v, found := c.items[k]; found {
-			delete(c.items, k)
-			return v.Object, true
+// Items 返回缓存中所有未过期的键值对。
+// 返回的 map 是一个副本，原始缓存不会被修改。
+func (c *cache[K, V]) Items() map[K]Item[V] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m := make(map[K]Item[V], len(c.items))
+	now := time.Now().UnixNano()
+	for k, ce := range c.items {
+		// 内联过期检查
+		if ce.item.Expiration > 0 && now > ce.item.Expiration {
+			continue
 		}
+		m[k] = ce.item
 	}
-	delete(c.items, k)
-	return nil, false
+	return m
 }
 
-// keyAndValue 是一个结构体，用于存储键值对。
-type keyAndValue struct {
-	key   string
-	value interface{}
+// ItemCount 返回缓存中键值对的数量，包括已过期未清理的键。
+func (c *cache[K, V]) ItemCount() int {
+	c.mu.RLock()
+	n := len(c.items)
+	c.mu.RUnlock()
+	return n
 }
 
-// DeleteExpired 删除缓存中所有过期的键值对。
-// 如果设置了 evict 回调函数，则会在删除每个过期键后调用回调函数。
-func (c *cache) DeleteExpired() {
-	var evictedItems []keyAndValue
-	now := time.Now().UnixNano()
+// Flush 清空缓存中的所有键值对，不调用回调函数。
+func (c *cache[K, V]) Flush() {
 	c.mu.Lock()
-	for k, v := range c.items {
-		// 内联过期检查
-		if v.Expiration > 0 && now > v.Expiration {
-			ov, evicted := c.delete(k)
-			if evicted {
-				evictedItems = append(evictedItems, keyAndValue{k, ov})
-			}
-		}
-	}
+	c.items = map[K]*cacheEntry[K, V]{}
+	c.lru.Init()
+	c.bytes = 0
 	c.mu.Unlock()
-	for _, v := range evictedItems {
-		c.onEvicted(v.key, v.value)
-	}
 }
 
-// OnEvicted 设置键值对被移除时的回调函数。
-func (c *cache) OnEvicted(f func(string, interface{})) {
-	c.mu.Lock()
-	c.onEvicted = f
-	c.mu.Unlock()
+// snapshotItem Save、Load 使用的 Gob 编码格式，与泛型改造前的 Item 字段一致。
+type snapshotItem struct {
+	Object     interface{}
+	Expiration int64
 }
 
-// Save 使用 Gob 编码将缓存的内容保存到指定的 Writer 中。
-// 如果在编码过程中发生错误，则会返回一个错误。
-func (c *cache) Save(w io.Writer) (err error) {
-	enc := gob.NewEncoder(w)
+// saveItems 将缓存项以 Gob 编码写入 w。
+func saveItems[K comparable, V any](w io.Writer, items map[K]Item[V]) (err error) {
 	defer func() {
 		if x := recover(); x != nil {
 			err = fmt.Errorf("error registering item types with Gob library")
 		}
 	}()
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	for _, v := range c.items {
+	snapshot := make(map[K]snapshotItem, len(items))
+	for k, v := range items {
 		gob.Register(v.Object)
+		snapshot[k] = snapshotItem{Object: v.Object, Expiration: v.Expiration}
 	}
-	err = enc.Encode(&c.items)
-	return
+	return gob.NewEncoder(w).Encode(&snapshot)
 }
 
-// SaveFile 使用 Gob 编码将缓存的内容保存到指定的文件中。
-// 如果在创建或保存文件时发生错误，则会返回错误。
-func (c *cache) SaveFile(fName string) error {
+// loadItems 从 r 中解码缓存项，值的类型不是 V 时返回错误。
+func loadItems[K comparable, V any](r io.Reader) (map[K]Item[V], error) {
+	snapshot := map[K]snapshotItem{}
+	if err := gob.NewDecoder(r).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+	items := make(map[K]Item[V], len(snapshot))
+	for k, v := range snapshot {
+		var obj V
+		if v.Object != nil {
+			var ok bool
+			if obj, ok = v.Object.(V); !ok {
+				return nil, fmt.Errorf("the value for %v is %T, not %T", k, v.Object, obj)
+			}
+		}
+		items[k] = Item[V]{Object: obj, Expiration: v.Expiration}
+	}
+	return items, nil
+}
+
+func saveFile(fName string, save func(w io.Writer) error) error {
 	fp, err := os.Create(fName)
 	if err != nil {
 		return err
 	}
-	err = c.Save(fp)
+	err = save(fp)
 	if err != nil {
 		fp.Close()
 		return err
@@ -1017,33 +533,12 @@ func (c *cache) SaveFile(fName string) error {
 	return fp.Close()
 }
 
-// Load 使用 Gob 解码从指定的 Reader 中加载缓存的内容。
-// 如果在解码过程中发生错误，则会返回错误。
-func (c *cache) Load(r io.Reader) error {
-	dec := gob.NewDecoder(r)
-	items := map[string]Item{}
-	err := dec.Decode(&items)
-	if err == nil {
-		c.mu.Lock()
-		defer c.mu.Unlock()
-		for k, v := range items {
-			ov, found := c.items[k]
-			if !found || ov.Expired() {
-				c.items[k] = v
-			}
-		}
-	}
-	return err
-}
-
-// LoadFile 使用 Gob 解码从指定的文件中加载缓存的内容。
-// 如果在打开或加载文件时发生错误，则会返回错误。
-func (c *cache) LoadFile(fName string) error {
+func loadFile(fName string, load func(r io.Reader) error) error {
 	fp, err := os.Open(fName)
 	if err != nil {
 		return err
 	}
-	err = c.Load(fp)
+	err = load(fp)
 	if err != nil {
 		fp.Close()
 		return err
@@ -1051,38 +546,31 @@ func (c *cache) LoadFile(fName string) error {
 	return fp.Close()
 }
 
-// Items 返回缓存中所有未过期的键值对。
-// 返回的 map 是一个副本，原始缓存不会被修改。
-func (c *cache) Items() map[string]Item {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	m := make(map[string]Item, len(c.items))
-	now := time.Now().UnixNano()
-	for k, v := range c.items {
-		// 内联过期检查
-		if v.Expiration > 0 {
-			if now > v.Expiration {
-				continue
-			}
+// estimateSize 估算值占用的字节数，字符串、切片、map 按长度计算，指针计算其指向的值，不递归。
+func estimateSize(v any) int64 {
+	switch x := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(x)) + 16
+	case []byte:
+		return int64(len(x)) + 24
+	}
+	rv := reflect.ValueOf(v)
+	size := int64(rv.Type().Size())
+	switch rv.Kind() {
+	case reflect.String:
+		size += int64(rv.Len())
+	case reflect.Slice:
+		size += int64(rv.Len()) * int64(rv.Type().Elem().Size())
+	case reflect.Map:
+		size += int64(rv.Len()) * int64(rv.Type().Key().Size()+rv.Type().Elem().Size())
+	case reflect.Pointer:
+		if !rv.IsNil() {
+			size += int64(rv.Type().Elem().Size())
 		}
-		m[k] = v
 	}
-	return m
-}
-
-// ItemCount 返回缓存中键值对的数量。
-func (c *cache) ItemCount() int {
-	c.mu.RLock()
-	n := len(c.items)
-	c.mu.RUnlock()
-	return n
-}
-
-// Flush 清空缓存中的所有键值对。
-func (c *cache) Flush() {
-	c.mu.Lock()
-	c.items = map[string]Item{}
-	c.mu.Unlock()
+	return size
 }
 
 // janitor 是一个负责定期清理过期缓存的结构体。
@@ -1091,13 +579,13 @@ type janitor struct {
 	stop     chan bool
 }
 
-// Run 定期调用 DeleteExpired 方法清理过期缓存。
-func (j *janitor) Run(c *cache) {
+// Run 定期调用 deleteExpired 清理过期缓存。
+func (j *janitor) Run(deleteExpired func()) {
 	ticker := time.NewTicker(j.Interval)
 	for {
 		select {
 		case <-ticker.C:
-			c.DeleteExpired()
+			deleteExpired()
 		case <-j.stop:
 			ticker.Stop()
 			return
@@ -1105,41 +593,48 @@ func (j *janitor) Run(c *cache) {
 	}
 }
 
-// stopJanitor 停止 janitor 的运行。
-func stopJanitor(c *Cache) {
-	c.janitor.stop <- true
-}
-
-// runJanitor 启动 janitor，以指定的间隔运行 DeleteExpired 方法。
-func runJanitor(c *cache, ci time.Duration) {
+// runJanitor 启动 janitor，以指定的间隔运行 deleteExpired。
+func runJanitor(ci time.Duration, deleteExpired func()) *janitor {
 	j := &janitor{
 		Interval: ci,
 		stop:     make(chan bool),
 	}
-	c.janitor = j
-	go j.Run(c)
+	go j.Run(deleteExpired)
+	return j
+}
+
+// stopJanitor 停止 janitor 的运行。
+func stopJanitor[K comparable, V any](c *Cache[K, V]) {
+	c.janitor.stop <- true
 }
 
 // newCache 创建一个新的缓存实例。
-func newCache(de time.Duration, m map[string]Item) *cache {
+func newCache[K comparable, V any](de time.Duration, m map[K]Item[V]) *cache[K, V] {
 	if de == 0 {
 		de = -1
 	}
-	c := &cache{
+	c := &cache[K, V]{
 		defaultExpiration: de,
-		items:             m,
+		items:             make(map[K]*cacheEntry[K, V], len(m)),
+		lru:               list.New(),
+	}
+	for k, v := range m {
+		ce := &cacheEntry[K, V]{key: k, item: v}
+		ce.elem = c.lru.PushFront(ce)
+		c.items[k] = ce
 	}
 	return c
 }
 
 // newCacheWithJanitor 创建一个新的缓存实例，并启动 janitor。
-func newCacheWithJanitor(de time.Duration, ci time.Duration, m map[string]Item) *Cache {
+func newCacheWithJanitor[K comparable, V any](de time.Duration, ci time.Duration, m map[K]Item[V]) *Cache[K, V] {
 	c := newCache(de, m)
 
-	C := &Cache{c}
+	C := &Cache[K, V]{c}
 	if ci > 0 {
-		runJanitor(c, ci)
-		runtime.SetFinalizer(C, stopJanitor)
+		// janitor 只引用内部的 cache，外层 Cache 不再被引用时由 finalizer 停止 janitor
+		c.janitor = runJanitor(ci, c.DeleteExpired)
+		runtime.SetFinalizer(C, stopJanitor[K, V])
 	}
 	return C
 }
@@ -1148,9 +643,8 @@ func newCacheWithJanitor(de time.Duration, ci time.Duration, m map[string]Item)
 // 参数：
 // - defaultExpiration: 默认过期时间。
 // - cleanupInterval: 定期清理过期缓存的时间间隔。
-func NewCache(defaultExpiration, cleanupInterval time.Duration) *Cache {
-	items := make(map[string]Item)
-	return newCacheWithJanitor(defaultExpiration, cleanupInterval, items)
+func NewCache[K comparable, V any](defaultExpiration, cleanupInterval time.Duration) *Cache[K, V] {
+	return newCacheWithJanitor[K, V](defaultExpiration, cleanupInterval, nil)
 }
 
 // NewFromCache 创建一个新的缓存实例，并启动 janitor。
@@ -1158,6 +652,6 @@ func NewCache(defaultExpiration, cleanupInterval time.Duration) *Cache {
 // - defaultExpiration: 默认过期时间。
 // - cleanupInterval: 定期清理过期缓存的时间间隔。
 // - items: 初始缓存项。
-func NewFromCache(defaultExpiration, cleanupInterval time.Duration, items map[string]Item) *Cache {
+func NewFromCache[K comparable, V any](defaultExpiration, cleanupInterval time.Duration, items map[K]Item[V]) *Cache[K, V] {
 	return newCacheWithJanitor(defaultExpiration, cleanupInterval, items)
 }
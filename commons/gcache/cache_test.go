@@ -1,6 +1,8 @@
 package gcache
 
 import (
+	"bytes"
+	"encoding/gob"
 	"testing"
 	"time"
 )
@@ -11,7 +13,7 @@ type TestStruct struct {
 }
 
 func TestCache(t *testing.T) {
-	tc := NewCache(3*time.Second, 5*time.Second)
+	tc := NewCache[string, any](3*time.Second, 5*time.Second)
 
 	tc.Set("a", 1, DefaultExpiration)
 	tc.Set("b", "b", DefaultExpiration)
@@ -35,7 +37,7 @@ func TestCache(t *testing.T) {
 func TestCacheTimes(t *testing.T) {
 	var found bool
 
-	tc := NewCache(50*time.Millisecond, 1*time.Millisecond)
+	tc := NewCache[string, any](50*time.Millisecond, 1*time.Millisecond)
 	tc.Set("a", 1, DefaultExpiration)
 	tc.Set("b", 2, DefaultExpiration)
 	tc.Set("c", 3, 20*time.Millisecond)
@@ -71,17 +73,17 @@ func TestCacheTimes(t *testing.T) {
 }
 
 func TestNewFrom(t *testing.T) {
-	m := map[string]Item{
-		"a": Item{
+	m := map[string]Item[any]{
+		"a": {
 			Object:     1,
 			Expiration: 0,
 		},
-		"b": Item{
+		"b": {
 			Object:     2,
 			Expiration: 0,
 		},
 	}
-	tc := NewFromCache(DefaultExpiration, 0, m)
+	tc := NewFromCache[string, any](DefaultExpiration, 0, m)
 	a, found := tc.Get("a")
 	if !found {
 		t.Fatal("Did not find a")
@@ -99,7 +101,7 @@ func TestNewFrom(t *testing.T) {
 }
 
 func TestAdd(t *testing.T) {
-	tc := NewCache(DefaultExpiration, 0)
+	tc := NewCache[string, any](DefaultExpiration, 0)
 	err := tc.Add("foo", "bar", DefaultExpiration)
 	if err != nil {
 		t.Error("Couldn't add foo even though it shouldn't exist")
@@ -111,7 +113,7 @@ func TestAdd(t *testing.T) {
 }
 
 func TestReplace(t *testing.T) {
-	tc := NewCache(DefaultExpiration, 0)
+	tc := NewCache[string, any](DefaultExpiration, 0)
 	err := tc.Replace("foo", "bar", DefaultExpiration)
 	if err == nil {
 		t.Error("Replaced foo when it shouldn't exist")
@@ -124,7 +126,7 @@ func TestReplace(t *testing.T) {
 }
 
 func TestDelete(t *testing.T) {
-	tc := NewCache(DefaultExpiration, 0)
+	tc := NewCache[string, any](DefaultExpiration, 0)
 	tc.Set("foo", "bar", DefaultExpiration)
 	tc.Delete("foo")
 	x, found := tc.Get("foo")
@@ -137,7 +139,7 @@ func TestDelete(t *testing.T) {
 }
 
 func TestItemCount(t *testing.T) {
-	tc := NewCache(DefaultExpiration, 0)
+	tc := NewCache[string, any](DefaultExpiration, 0)
 	tc.Set("foo", "1", DefaultExpiration)
 	tc.Set("bar", "2", DefaultExpiration)
 	tc.Set("baz", "3", DefaultExpiration)
@@ -147,7 +149,7 @@ func TestItemCount(t *testing.T) {
 }
 
 func TestFlush(t *testing.T) {
-	tc := NewCache(DefaultExpiration, 0)
+	tc := NewCache[string, any](DefaultExpiration, 0)
 	tc.Set("foo", "bar", DefaultExpiration)
 	tc.Set("baz", "yes", DefaultExpiration)
 	tc.Flush()
@@ -168,17 +170,125 @@ func TestFlush(t *testing.T) {
 }
 
 func TestIncrementWithInt64(t *testing.T) {
-	tc := NewCache(DefaultExpiration, 0)
-	tc.Set("tint64", int64(1), DefaultExpiration)
-	err := tc.Increment("tint64", 2)
+	tc := NewCache[string, int64](DefaultExpiration, 0)
+	tc.Set("tint64", 1, DefaultExpiration)
+	n, err := Increment(tc, "tint64", 2)
 	if err != nil {
 		t.Error("Error incrementing:", err)
 	}
-	x, found := tc.Get("tint64")
-	if !found {
-		t.Error("tint64 was not found")
+	if n != 3 {
+		t.Error("tint64 is not 3:", n)
+	}
+	if n, _ = Decrement(tc, "tint64", 5); n != -2 {
+		t.Error("tint64 is not -2:", n)
+	}
+	if _, err = Increment(tc, "missing", 1); err == nil {
+		t.Error("Incremented missing key")
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	tc := NewCache[string, int](DefaultExpiration, 0)
+	var evicted []string
+	tc.OnEvicted(func(k string, v int) {
+		evicted = append(evicted, k)
+	})
+	tc.SetMaxEntries(2)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Get("a")
+	tc.Set("c", 3, DefaultExpiration)
+	if _, found := tc.Get("b"); found {
+		t.Error("b should have been evicted as least recently used")
+	}
+	if _, found := tc.Get("a"); !found {
+		t.Error("a should not have been evicted")
+	}
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Error("unexpected evicted keys:", evicted)
+	}
+	stats := tc.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Evictions != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	tc := NewCache[string, string](DefaultExpiration, 0)
+	tc.SetMaxBytes(10, func(k string, v string) int64 {
+		return int64(len(v))
+	})
+	tc.Set("a", "12345", DefaultExpiration)
+	tc.Set("b", "12345", DefaultExpiration)
+	tc.Set("c", "123", DefaultExpiration)
+	if _, found := tc.Get("a"); found {
+		t.Error("a should have been evicted")
+	}
+	if n := tc.ItemCount(); n != 2 {
+		t.Errorf("Item count is not 2: %d", n)
+	}
+	tc.Set("d", "12345678901", DefaultExpiration)
+	if _, found := tc.Get("d"); found {
+		t.Error("d is larger than max bytes and should not be kept")
+	}
+}
+
+// legacyItem 泛型改造前 Item 的定义，用于验证旧快照的兼容性
+type legacyItem struct {
+	Object     interface{}
+	Expiration int64
+}
+
+func TestSaveLoad(t *testing.T) {
+	var buf bytes.Buffer
+	old := map[string]legacyItem{
+		"a": {Object: 1},
+		"b": {Object: 2, Expiration: time.Now().Add(time.Hour).UnixNano()},
+	}
+	if err := gob.NewEncoder(&buf).Encode(&old); err != nil {
+		t.Fatal(err)
+	}
+	tc := NewCache[string, int](DefaultExpiration, 0)
+	if err := tc.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := tc.Get("a"); a != 1 {
+		t.Error("a is not 1:", a)
+	}
+	if b, _ := tc.Get("b"); b != 2 {
+		t.Error("b is not 2:", b)
+	}
+
+	buf.Reset()
+	if err := tc.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	sc := NewShardedCache[string, int](DefaultExpiration, 0, 4)
+	if err := sc.Load(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if n := sc.ItemCount(); n != 2 {
+		t.Errorf("Item count is not 2: %d", n)
+	}
+	if err := NewCache[string, string](DefaultExpiration, 0).Load(&buf); err == nil {
+		t.Error("Loaded int values into a string cache")
+	}
+}
+
+func TestShardedCache(t *testing.T) {
+	sc := NewShardedCache[int, int](DefaultExpiration, 0, 4)
+	sc.SetMaxEntries(40)
+	for i := 0; i < 100; i++ {
+		sc.Set(i, i, DefaultExpiration)
+	}
+	if n := sc.ItemCount(); n > 40 {
+		t.Errorf("Item count exceeds max entries: %d", n)
+	}
+	sc.Set(1000, 1, DefaultExpiration)
+	if n, err := Increment(sc, 1000, 1); err != nil || n != 2 {
+		t.Error("Error incrementing:", n, err)
 	}
-	if x.(int64) != 3 {
-		t.Error("tint64 is not 3:", x)
+	if stats := sc.Stats(); stats.Evictions == 0 {
+		t.Errorf("unexpected stats %+v", stats)
 	}
 }
@@ -1,65 +1,314 @@
 package gcache
 
 import (
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// OverflowPolicy 订阅者缓冲区满时的处理策略
+type OverflowPolicy int
+
+const (
+	OverflowDrop       OverflowPolicy = iota // 丢弃新消息
+	OverflowDropOldest                       // 丢弃缓冲区中最旧的消息后写入新消息
+	OverflowBlock                            // 阻塞等待订阅者消费，超过超时时间后丢弃新消息
+)
+
+type subOptions struct {
+	bufSize int
+	policy  OverflowPolicy
+	timeout time.Duration
+}
+
+// SubOption 订阅配置项，传给NewChannelHub时作为所有订阅的默认配置
+type SubOption func(o *subOptions)
+
+// WithBufSize 设置订阅者的缓冲区大小
+func WithBufSize(size int) SubOption {
+	return func(o *subOptions) {
+		o.bufSize = size
+	}
+}
+
+// WithOverflow 设置缓冲区满时的处理策略，默认OverflowDrop
+func WithOverflow(policy OverflowPolicy) SubOption {
+	return func(o *subOptions) {
+		o.policy = policy
+	}
+}
+
+// WithBlockTimeout 使用OverflowBlock策略并设置最长阻塞时间，timeout<=0时一直阻塞直到订阅者消费或取消订阅
+func WithBlockTimeout(timeout time.Duration) SubOption {
+	return func(o *subOptions) {
+		o.policy = OverflowBlock
+		o.timeout = timeout
+	}
+}
+
+// ChannelHub 按主题分发消息，每个订阅者有独立的channel，同一主题的所有订阅者都会收到消息
+// 主题以"."分隔，订阅时可使用通配符："*"匹配一段，">"匹配之后的一段或多段，如 "kline.*.1m"、"trade.>"
 type ChannelHub[T any] struct {
 	mu       sync.RWMutex
-	channels map[string]chan T
-	bufSize  int
+	exact    map[string]map[*Subscription[T]]struct{} // 不含通配符的订阅，按主题索引
+	patterns map[*Subscription[T]]struct{}            // 含通配符的订阅
+	opts     []SubOption
+	dropped  atomic.Uint64
 }
 
-func NewChannelHub[T any](bufSize int) *ChannelHub[T] {
+// NewChannelHub 创建ChannelHub
+// bufSize: 订阅者默认的缓冲区大小
+// opts: 所有订阅的默认配置，Subscribe时传入的配置优先
+func NewChannelHub[T any](bufSize int, opts ...SubOption) *ChannelHub[T] {
 	return &ChannelHub[T]{
-		channels: make(map[string]chan T),
-		bufSize:  bufSize,
+		exact:    make(map[string]map[*Subscription[T]]struct{}),
+		patterns: make(map[*Subscription[T]]struct{}),
+		opts:     append([]SubOption{WithBufSize(bufSize)}, opts...),
+	}
+}
+
+// Subscription 一个订阅，从C读取消息，不再需要时调用Unsubscribe，之后C会被关闭
+type Subscription[T any] struct {
+	C <-chan T
+
+	hub     *ChannelHub[T]
+	pattern string
+	ch      chan T
+	opts    subOptions
+
+	mu      sync.RWMutex // 发送时持有读锁，关闭时持有写锁，避免向已关闭的channel发送
+	closed  bool
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Uint64
+}
+
+// Pattern 返回订阅的主题或通配符
+func (s *Subscription[T]) Pattern() string {
+	return s.pattern
+}
+
+// Dropped 返回该订阅因缓冲区满丢弃的消息数
+func (s *Subscription[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Unsubscribe 取消订阅并关闭C，可重复调用
+func (s *Subscription[T]) Unsubscribe() {
+	s.hub.mu.Lock()
+	s.hub.remove(s)
+	s.hub.mu.Unlock()
+	s.close()
+}
+
+func (s *Subscription[T]) close() {
+	s.once.Do(func() {
+		// 先通知阻塞中的发送方退出，再关闭channel
+		close(s.done)
+		s.mu.Lock()
+		s.closed = true
+		close(s.ch)
+		s.mu.Unlock()
+	})
+}
+
+// send 按溢出策略发送消息，返回是否写入了缓冲区
+func (s *Subscription[T]) send(msg T) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.ch <- msg:
+		return true
+	default:
+	}
+
+	switch s.opts.policy {
+	case OverflowDropOldest:
+		if cap(s.ch) == 0 {
+			break
+		}
+		for {
+			select {
+			case s.ch <- msg:
+				return true
+			default:
+			}
+			select {
+			case <-s.ch:
+				s.drop()
+			default:
+			}
+		}
+	case OverflowBlock:
+		var timeout <-chan time.Time
+		if s.opts.timeout > 0 {
+			t := time.NewTimer(s.opts.timeout)
+			defer t.Stop()
+			timeout = t.C
+		}
+		select {
+		case s.ch <- msg:
+			return true
+		case <-s.done:
+			return false
+		case <-timeout:
+		}
 	}
+	s.drop()
+	return false
 }
 
-// Subscribe 订阅某个 channel，返回一个只读 channel
-func (h *ChannelHub[T]) Subscribe(symbol string) <-chan T {
+func (s *Subscription[T]) drop() {
+	s.dropped.Add(1)
+	s.hub.dropped.Add(1)
+}
+
+// Subscribe 订阅主题或通配符，返回独立的订阅
+func (h *ChannelHub[T]) Subscribe(pattern string, opts ...SubOption) *Subscription[T] {
+	o := subOptions{}
+	for _, opt := range h.opts {
+		opt(&o)
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	ch := make(chan T, max(o.bufSize, 0))
+	s := &Subscription[T]{
+		C:       ch,
+		hub:     h,
+		pattern: pattern,
+		ch:      ch,
+		opts:    o,
+		done:    make(chan struct{}),
+	}
+
 	h.mu.Lock()
 	defer h.mu.Unlock()
-
-	if ch, ok := h.channels[symbol]; ok {
-		return ch
+	if isTopicPattern(pattern) {
+		h.patterns[s] = struct{}{}
+	} else {
+		subs, ok := h.exact[pattern]
+		if !ok {
+			subs = make(map[*Subscription[T]]struct{})
+			h.exact[pattern] = subs
+		}
+		subs[s] = struct{}{}
 	}
-	ch := make(chan T, h.bufSize)
-	h.channels[symbol] = ch
-	return ch
+	return s
 }
 
-// Publish 往某个 channel 推消息
-func (h *ChannelHub[T]) Publish(symbol string, msg T) {
+// Publish 向主题的所有订阅者推送消息，返回成功写入的订阅者数
+// 订阅者之间互不影响，但OverflowBlock的订阅者会使Publish阻塞
+func (h *ChannelHub[T]) Publish(topic string, msg T) int {
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	subs := make([]*Subscription[T], 0, len(h.exact[topic]))
+	for s := range h.exact[topic] {
+		subs = append(subs, s)
+	}
+	for s := range h.patterns {
+		if matchTopic(s.pattern, topic) {
+			subs = append(subs, s)
+		}
+	}
+	h.mu.RUnlock()
 
-	if ch, ok := h.channels[symbol]; ok {
-		select {
-		case ch <- msg:
-		default:
-			// 如果满了，可以选择丢弃/覆盖/阻塞，这里先丢弃
+	n := 0
+	for _, s := range subs {
+		if s.send(msg) {
+			n++
 		}
 	}
+	return n
+}
+
+// Dropped 返回所有订阅因缓冲区满丢弃的消息总数，包括已取消的订阅
+func (h *ChannelHub[T]) Dropped() uint64 {
+	return h.dropped.Load()
 }
 
-// CloseAll 关闭所有 channel
+// CloseAll 取消所有订阅
 func (h *ChannelHub[T]) CloseAll() {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	for sym, ch := range h.channels {
-		close(ch)
-		delete(h.channels, sym)
+	var subs []*Subscription[T]
+	for topic, m := range h.exact {
+		for s := range m {
+			subs = append(subs, s)
+		}
+		delete(h.exact, topic)
+	}
+	for s := range h.patterns {
+		subs = append(subs, s)
+		delete(h.patterns, s)
+	}
+	h.mu.Unlock()
+	for _, s := range subs {
+		s.close()
 	}
 }
 
-// CloseChannel 关闭某个 channel
+// CloseChannel 取消以symbol订阅的所有订阅，symbol需与订阅时的主题或通配符完全相同
 func (h *ChannelHub[T]) CloseChannel(symbol string) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	if ch, ok := h.channels[symbol]; ok {
-		close(ch)
-		delete(h.channels, symbol)
+	var subs []*Subscription[T]
+	for s := range h.exact[symbol] {
+		subs = append(subs, s)
+	}
+	delete(h.exact, symbol)
+	for s := range h.patterns {
+		if s.pattern == symbol {
+			subs = append(subs, s)
+			delete(h.patterns, s)
+		}
+	}
+	h.mu.Unlock()
+	for _, s := range subs {
+		s.close()
+	}
+}
+
+// remove 从索引中移除订阅，调用方需持有写锁
+func (h *ChannelHub[T]) remove(s *Subscription[T]) {
+	if _, ok := h.patterns[s]; ok {
+		delete(h.patterns, s)
+		return
+	}
+	if subs, ok := h.exact[s.pattern]; ok {
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(h.exact, s.pattern)
+		}
+	}
+}
+
+// isTopicPattern 判断是否包含通配符段
+func isTopicPattern(pattern string) bool {
+	for _, token := range strings.Split(pattern, ".") {
+		if token == "*" || token == ">" {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTopic 判断主题是否匹配通配符
+func matchTopic(pattern, topic string) bool {
+	for {
+		p, pRest, pMore := strings.Cut(pattern, ".")
+		t, tRest, tMore := strings.Cut(topic, ".")
+		switch p {
+		case ">":
+			return true
+		case "*", t:
+		default:
+			return false
+		}
+		if !pMore || !tMore {
+			return pMore == tMore
+		}
+		pattern, topic = pRest, tRest
 	}
 }
@@ -0,0 +1,110 @@
+package gcache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChannelHubFanOut(t *testing.T) {
+	hub := NewChannelHub[int](4)
+	a := hub.Subscribe("trade.BTC")
+	b := hub.Subscribe("trade.BTC")
+	star := hub.Subscribe("trade.*")
+	all := hub.Subscribe("trade.>")
+	kline := hub.Subscribe("kline.*.1m")
+
+	if n := hub.Publish("trade.BTC", 1); n != 4 {
+		t.Fatalf("want 4 deliveries, got %d", n)
+	}
+	for _, s := range []*Subscription[int]{a, b, star, all} {
+		if v := <-s.C; v != 1 {
+			t.Fatalf("%s got %d", s.Pattern(), v)
+		}
+	}
+	if n := hub.Publish("trade.BTC.spot", 2); n != 1 || <-all.C != 2 {
+		t.Fatalf("only trade.> should match, got %d", n)
+	}
+	if n := hub.Publish("kline.ETH.1m", 3); n != 1 || <-kline.C != 3 {
+		t.Fatalf("kline pattern should match, got %d", n)
+	}
+	if n := hub.Publish("trade", 4); n != 0 {
+		t.Fatalf("trade.> should not match trade, got %d", n)
+	}
+
+	a.Unsubscribe()
+	a.Unsubscribe()
+	if _, ok := <-a.C; ok {
+		t.Fatal("channel should be closed after unsubscribe")
+	}
+	if n := hub.Publish("trade.BTC", 5); n != 3 {
+		t.Fatalf("want 3 deliveries after unsubscribe, got %d", n)
+	}
+
+	hub.CloseChannel("trade.*")
+	// 关闭前已写入的消息仍可读取
+	if v := <-star.C; v != 5 {
+		t.Fatalf("trade.* got %d", v)
+	}
+	if _, ok := <-star.C; ok {
+		t.Fatal("trade.* should be closed")
+	}
+	hub.CloseAll()
+	if n := hub.Publish("trade.BTC", 6); n != 0 {
+		t.Fatalf("want 0 deliveries after close all, got %d", n)
+	}
+}
+
+func TestChannelHubOverflow(t *testing.T) {
+	hub := NewChannelHub[int](2)
+	drop := hub.Subscribe("t")
+	oldest := hub.Subscribe("t", WithOverflow(OverflowDropOldest))
+	block := hub.Subscribe("t", WithBlockTimeout(20*time.Millisecond))
+	for i := 1; i <= 4; i++ {
+		hub.Publish("t", i)
+	}
+
+	if v1, v2 := <-drop.C, <-drop.C; v1 != 1 || v2 != 2 || drop.Dropped() != 2 {
+		t.Fatalf("drop: %d %d dropped %d", v1, v2, drop.Dropped())
+	}
+	if v1, v2 := <-oldest.C, <-oldest.C; v1 != 3 || v2 != 4 || oldest.Dropped() != 2 {
+		t.Fatalf("drop oldest: %d %d dropped %d", v1, v2, oldest.Dropped())
+	}
+	if block.Dropped() != 2 || hub.Dropped() != 6 {
+		t.Fatalf("block dropped %d, hub dropped %d", block.Dropped(), hub.Dropped())
+	}
+
+	// 阻塞的发送在订阅者消费后完成
+	<-block.C
+	<-block.C
+	hub.Publish("t", 5)
+	hub.Publish("t", 6)
+	done := make(chan struct{})
+	go func() {
+		hub.Publish("t", 7)
+		close(done)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	<-block.C
+	<-done
+	if v1, v2 := <-block.C, <-block.C; v1 != 6 || v2 != 7 {
+		t.Fatalf("block: %d %d", v1, v2)
+	}
+}
+
+// TestChannelHubUnsubscribeWhileBlocked 取消订阅时阻塞中的发送立即返回
+func TestChannelHubUnsubscribeWhileBlocked(t *testing.T) {
+	hub := NewChannelHub[int](0, WithBlockTimeout(0))
+	s := hub.Subscribe("t")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hub.Publish("t", i)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	s.Unsubscribe()
+	wg.Wait()
+}
@@ -0,0 +1,91 @@
+package gconsistent
+
+import "math"
+
+// defaultLoadFactor 默认有界负载系数
+const defaultLoadFactor = 1.25
+
+// GetLeast 有界负载的一致性哈希查找，从键的位置沿哈希环顺时针查找第一个未超过负载上限的节点
+// 热点节点满载后请求溢出到环上的下一个节点，节点负载通过 Inc、Done 维护
+func (c *Consistent) GetLeast(name string) (string, error) {
+	c.RLock()
+	defer c.RUnlock()
+	return c.getLeast(name)
+}
+
+// Acquire 原子地执行 GetLeast 并将返回节点的负载加1，处理完成后调用 Done
+func (c *Consistent) Acquire(name string) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	elt, err := c.getLeast(name)
+	if err != nil {
+		return "", err
+	}
+	c.loads[elt]++
+	c.totalLoad++
+	return elt, nil
+}
+
+func (c *Consistent) getLeast(name string) (string, error) {
+	if len(c.circle) == 0 {
+		return "", ErrEmptyCircle
+	}
+	start := c.search(c.hashKey(name))
+	for i := 0; i < len(c.sortedHashes); i++ {
+		elt := c.circle[c.sortedHashes[(start+i)%len(c.sortedHashes)]]
+		if c.loads[elt]+1 <= c.maxLoad(elt) {
+			return elt, nil
+		}
+	}
+	// 负载系数小于1时所有节点都可能满载，退化为普通一致性哈希
+	return c.circle[c.sortedHashes[start]], nil
+}
+
+// maxLoad 节点的负载上限，按权重分摊加入新请求后的总负载再乘以负载系数，向上取整
+func (c *Consistent) maxLoad(elt string) int64 {
+	avg := float64(c.totalLoad+1) * float64(c.weights[elt]) / float64(c.totalWeight)
+	return int64(math.Ceil(avg * c.LoadFactor))
+}
+
+// MaxLoad 返回节点当前的负载上限
+func (c *Consistent) MaxLoad(elt string) int64 {
+	c.RLock()
+	defer c.RUnlock()
+	if _, ok := c.weights[elt]; !ok {
+		return 0
+	}
+	return c.maxLoad(elt)
+}
+
+// Inc 节点负载加1
+func (c *Consistent) Inc(elt string) {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.weights[elt]; !ok {
+		return
+	}
+	c.loads[elt]++
+	c.totalLoad++
+}
+
+// Done 节点负载减1
+func (c *Consistent) Done(elt string) {
+	c.Lock()
+	defer c.Unlock()
+	if c.loads[elt] <= 0 {
+		return
+	}
+	c.loads[elt]--
+	c.totalLoad--
+}
+
+// Loads 返回各节点的当前负载
+func (c *Consistent) Loads() map[string]int64 {
+	c.RLock()
+	defer c.RUnlock()
+	loads := make(map[string]int64, len(c.weights))
+	for elt := range c.weights {
+		loads[elt] = c.loads[elt]
+	}
+	return loads
+}
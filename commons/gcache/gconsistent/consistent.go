@@ -3,6 +3,7 @@ package gconsistent
 import (
 	"errors"
 	"hash/crc32"
+	"slices"
 	"sort"
 	"strconv"
 	"sync"
@@ -10,11 +11,22 @@ import (
 
 var ErrEmptyCircle = errors.New("empty circle")
 
+// IHasher 根据键选择节点，Consistent 与 Rendezvous 均实现了该接口
+type IHasher interface {
+	Get(name string) (string, error)
+	GetN(name string, n int) ([]string, error)
+}
+
 // Consistent 实现一致性哈希算法的结构体
 type Consistent struct {
 	circle           map[uint32]string // 哈希环，使用哈希值映射到节点
 	sortedHashes     []uint32          // 排序后的哈希值列表，用于快速查找
+	weights          map[string]int    // 节点权重，虚拟节点数量为 NumberOfReplicas*权重
+	totalWeight      int               // 所有节点的权重之和
+	loads            map[string]int64  // 节点当前负载，用于有界负载查找
+	totalLoad        int64             // 所有节点的负载之和
 	NumberOfReplicas int               // 每个节点的虚拟节点数量
+	LoadFactor       float64           // 有界负载系数，节点负载不超过平均负载的 LoadFactor 倍，默认 1.25
 	sync.RWMutex                       // 读写锁，保证并发安全
 }
 
@@ -24,7 +36,10 @@ type Consistent struct {
 func New(replicasCount int) *Consistent {
 	c := new(Consistent)
 	c.NumberOfReplicas = replicasCount
+	c.LoadFactor = defaultLoadFactor
 	c.circle = make(map[uint32]string)
+	c.weights = make(map[string]int)
+	c.loads = make(map[string]int64)
 	return c
 }
 
@@ -36,16 +51,26 @@ func (c *Consistent) eltKey(elt string, idx int) string {
 
 // Add 添加一个新节点到哈希环
 func (c *Consistent) Add(elt string) {
+	c.AddWeighted(elt, 1)
+}
+
+// AddWeighted 添加一个带权重的节点，权重越大分到的键越多，已存在时更新权重
+func (c *Consistent) AddWeighted(elt string, weight int) {
 	c.Lock()
 	defer c.Unlock()
-	c.add(elt)
+	if _, ok := c.weights[elt]; ok {
+		c.remove(elt)
+	}
+	c.add(elt, max(weight, 1))
 }
 
 // add 添加节点并创建其对应的虚拟节点到哈希环中
-func (c *Consistent) add(elt string) {
-	for i := 0; i < c.NumberOfReplicas; i++ {
+func (c *Consistent) add(elt string, weight int) {
+	for i := 0; i < c.NumberOfReplicas*weight; i++ {
 		c.circle[c.hashKey(c.eltKey(elt, i))] = elt
 	}
+	c.weights[elt] = weight
+	c.totalWeight += weight
 	c.updateSortedHashes() // 更新排序的哈希值列表
 }
 
@@ -58,12 +83,49 @@ func (c *Consistent) Remove(elt string) {
 
 // remove 从哈希环中移除指定节点的所有虚拟节点
 func (c *Consistent) remove(elt string) {
-	for i := 0; i < c.NumberOfReplicas; i++ {
+	weight, ok := c.weights[elt]
+	if !ok {
+		return
+	}
+	for i := 0; i < c.NumberOfReplicas*weight; i++ {
 		delete(c.circle, c.hashKey(c.eltKey(elt, i)))
 	}
+	delete(c.weights, elt)
+	c.totalWeight -= weight
+	c.totalLoad -= c.loads[elt]
+	delete(c.loads, elt)
 	c.updateSortedHashes() // 更新排序的哈希值列表
 }
 
+// Members 返回所有节点
+func (c *Consistent) Members() []string {
+	c.RLock()
+	defer c.RUnlock()
+	members := make([]string, 0, len(c.weights))
+	for elt := range c.weights {
+		members = append(members, elt)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Clone 复制节点与权重，不复制负载，用于在副本上修改节点后通过 Plan 计算迁移
+func (c *Consistent) Clone() *Consistent {
+	c.RLock()
+	defer c.RUnlock()
+	clone := New(c.NumberOfReplicas)
+	clone.LoadFactor = c.LoadFactor
+	for k, v := range c.circle {
+		clone.circle[k] = v
+	}
+	for k, v := range c.weights {
+		clone.weights[k] = v
+	}
+	clone.totalWeight = c.totalWeight
+	clone.sortedHashes = append([]uint32(nil), c.sortedHashes...)
+	return clone
+}
+
 // Get 根据键获取哈希环上的最近节点
 // name 是要查找的键，返回映射到的节点名称
 func (c *Consistent) Get(name string) (string, error) {
@@ -77,6 +139,26 @@ func (c *Consistent) Get(name string) (string, error) {
 	return c.circle[c.sortedHashes[i]], nil
 }
 
+// GetN 从键的位置沿哈希环顺时针查找 n 个不同的节点，用于副本放置，第一个与 Get 的结果相同
+// 节点数不足 n 时返回所有节点
+func (c *Consistent) GetN(name string, n int) ([]string, error) {
+	c.RLock()
+	defer c.RUnlock()
+	if len(c.circle) == 0 {
+		return nil, ErrEmptyCircle
+	}
+	n = min(n, len(c.weights))
+	res := make([]string, 0, n)
+	start := c.search(c.hashKey(name))
+	for i := 0; i < len(c.sortedHashes) && len(res) < n; i++ {
+		elt := c.circle[c.sortedHashes[(start+i)%len(c.sortedHashes)]]
+		if !slices.Contains(res, elt) {
+			res = append(res, elt)
+		}
+	}
+	return res, nil
+}
+
 // search 在排序后的哈希列表中查找大于给定键的第一个哈希值的索引
 func (c *Consistent) search(key uint32) (i int) {
 	f := func(x int) bool {
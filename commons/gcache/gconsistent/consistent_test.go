@@ -2,13 +2,33 @@ package gconsistent
 
 import (
 	"fmt"
+	"strconv"
 	"testing"
 )
 
+func newTestConsistent(nodes ...string) *Consistent {
+	c := New(100)
+	for _, node := range nodes {
+		c.Add(node)
+	}
+	return c
+}
+
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "User" + strconv.Itoa(i)
+	}
+	return keys
+}
+
 func TestConsistentHash(t *testing.T) {
 
 	// 创建一个一致性哈希实例，每个节点有3个虚拟节点
-	consistent := New("NodeA", "NodeB", "NodeC", "NodeD", "NodeE", "NodeF", "NodeG", "NodeH", "NodeI", "NodeJ")
+	consistent := New(3)
+	for _, node := range []string{"NodeA", "NodeB", "NodeC", "NodeD", "NodeE", "NodeF", "NodeG", "NodeH", "NodeI", "NodeJ"} {
+		consistent.Add(node)
+	}
 
 	// 模拟请求，根据请求 key 分配到合适的节点
 	requests := []string{"User1", "User2", "User3", "User4"}
@@ -33,3 +53,123 @@ func TestConsistentHash(t *testing.T) {
 		}
 	}
 }
+
+func TestWeighted(t *testing.T) {
+	for name, h := range map[string]interface {
+		IHasher
+		AddWeighted(elt string, weight int)
+	}{"consistent": New(200), "rendezvous": NewRendezvous()} {
+		t.Run(name, func(t *testing.T) {
+			h.AddWeighted("A", 1)
+			h.AddWeighted("B", 3)
+			counts := map[string]int{}
+			for _, key := range testKeys(10000) {
+				node, _ := h.Get(key)
+				counts[node]++
+			}
+			ratio := float64(counts["B"]) / float64(counts["A"])
+			if ratio < 2.4 || ratio > 3.6 {
+				t.Fatalf("weight 3:1 got %v", counts)
+			}
+		})
+	}
+}
+
+func TestGetN(t *testing.T) {
+	for name, h := range map[string]IHasher{
+		"consistent": newTestConsistent("A", "B", "C", "D"),
+		"rendezvous": NewRendezvous("A", "B", "C", "D"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			nodes, err := h.GetN("key", 3)
+			if err != nil || len(nodes) != 3 {
+				t.Fatalf("getN: %v %v", nodes, err)
+			}
+			if first, _ := h.Get("key"); first != nodes[0] {
+				t.Fatalf("first %s, get %s", nodes[0], first)
+			}
+			seen := map[string]bool{}
+			for _, node := range nodes {
+				if seen[node] {
+					t.Fatalf("duplicated node in %v", nodes)
+				}
+				seen[node] = true
+			}
+			if nodes, _ = h.GetN("key", 10); len(nodes) != 4 {
+				t.Fatalf("want all 4 nodes, got %v", nodes)
+			}
+		})
+	}
+	if _, err := New(10).GetN("key", 1); err != ErrEmptyCircle {
+		t.Fatalf("want ErrEmptyCircle, got %v", err)
+	}
+	if _, err := NewRendezvous().Get("key"); err != ErrEmptyCircle {
+		t.Fatalf("want ErrEmptyCircle, got %v", err)
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	c := newTestConsistent("A", "B", "C", "D")
+	// 同一个热点键的请求溢出到其他节点
+	for i := 0; i < 100; i++ {
+		if _, err := c.Acquire("hot"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loads := c.Loads()
+	for node, load := range loads {
+		if load > c.MaxLoad(node) || load > 32 {
+			t.Fatalf("node %s load %d exceeds bound, loads %v", node, load, loads)
+		}
+	}
+	owner, _ := c.Get("hot")
+	if least, _ := c.GetLeast("hot"); least == owner {
+		t.Fatalf("owner %s is full but still chosen", owner)
+	}
+	for i := 0; i < 10; i++ {
+		c.Done(owner)
+	}
+	if least, _ := c.GetLeast("hot"); least != owner {
+		t.Fatalf("want owner %s after done, got %s", owner, least)
+	}
+	c.Remove(owner)
+	if _, ok := c.Loads()[owner]; ok {
+		t.Fatal("removed node still has load")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	keys := testKeys(10000)
+	for name, h := range map[string]interface {
+		IHasher
+		Add(elt string)
+	}{"consistent": newTestConsistent("A", "B", "C", "D"), "rendezvous": NewRendezvous("A", "B", "C", "D")} {
+		t.Run(name, func(t *testing.T) {
+			var next interface {
+				IHasher
+				Add(elt string)
+			}
+			switch h := h.(type) {
+			case *Consistent:
+				next = h.Clone()
+			case *Rendezvous:
+				next = h.Clone()
+			}
+			next.Add("E")
+			plan, err := Plan(h, next, keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 增加一个节点时只有约 1/5 的键迁移到新节点
+			if ratio := plan.Ratio(); ratio < 0.1 || ratio > 0.3 {
+				t.Fatalf("move ratio %.3f", ratio)
+			}
+			if incoming := plan.Incoming(); len(incoming) != 1 || incoming["E"] != len(plan.Moves) {
+				t.Fatalf("incoming %v", incoming)
+			}
+			if _, err = Plan(h, New(10), keys); err != ErrEmptyCircle {
+				t.Fatalf("want ErrEmptyCircle, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package gconsistent
+
+// Move 一个键的迁移
+type Move struct {
+	Key  string
+	From string // 原节点，原来没有节点时为空
+	To   string
+}
+
+// MigrationPlan 节点变化后的迁移计划
+type MigrationPlan struct {
+	Total int    // 参与计算的键数
+	Moves []Move // 需要迁移的键
+}
+
+// Ratio 需要迁移的键所占的比例
+func (p *MigrationPlan) Ratio() float64 {
+	if p.Total == 0 {
+		return 0
+	}
+	return float64(len(p.Moves)) / float64(p.Total)
+}
+
+// Outgoing 按原节点统计迁出的键数
+func (p *MigrationPlan) Outgoing() map[string]int {
+	res := make(map[string]int)
+	for _, m := range p.Moves {
+		res[m.From]++
+	}
+	return res
+}
+
+// Incoming 按新节点统计迁入的键数
+func (p *MigrationPlan) Incoming() map[string]int {
+	res := make(map[string]int)
+	for _, m := range p.Moves {
+		res[m.To]++
+	}
+	return res
+}
+
+// Plan 计算 keys 从 from 到 to 的归属变化，通常先 Clone 当前的哈希，在副本上增删节点后与原哈希比较
+//
+//	next := c.Clone()
+//	next.Add("NodeK")
+//	plan, _ := gconsistent.Plan(c, next, keys)
+func Plan(from, to IHasher, keys []string) (*MigrationPlan, error) {
+	plan := &MigrationPlan{Total: len(keys)}
+	for _, key := range keys {
+		dst, err := to.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		// 原哈希为空时所有键都需要分配
+		src, _ := from.Get(key)
+		if src != dst {
+			plan.Moves = append(plan.Moves, Move{Key: key, From: src, To: dst})
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,152 @@
+package gconsistent
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Rendezvous 带权重的最高随机权重哈希(HRW)
+// 每个键对所有节点计算得分并选择得分最高的节点，节点变化时只有归属于该节点的键会迁移
+// 不需要虚拟节点，分布比哈希环均匀，但每次查找的复杂度为 O(节点数)
+type Rendezvous struct {
+	members map[string]rendezvousMember
+	sync.RWMutex
+}
+
+type rendezvousMember struct {
+	hash   uint64
+	weight float64
+}
+
+// NewRendezvous 创建 Rendezvous，members 为初始节点，权重均为1
+func NewRendezvous(members ...string) *Rendezvous {
+	r := &Rendezvous{members: make(map[string]rendezvousMember, len(members))}
+	for _, elt := range members {
+		r.add(elt, 1)
+	}
+	return r
+}
+
+// Add 添加节点
+func (r *Rendezvous) Add(elt string) {
+	r.AddWeighted(elt, 1)
+}
+
+// AddWeighted 添加一个带权重的节点，已存在时更新权重
+func (r *Rendezvous) AddWeighted(elt string, weight int) {
+	r.Lock()
+	defer r.Unlock()
+	r.add(elt, max(weight, 1))
+}
+
+func (r *Rendezvous) add(elt string, weight int) {
+	r.members[elt] = rendezvousMember{hash: hash64(elt), weight: float64(weight)}
+}
+
+// Remove 移除节点
+func (r *Rendezvous) Remove(elt string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.members, elt)
+}
+
+// Members 返回所有节点
+func (r *Rendezvous) Members() []string {
+	r.RLock()
+	defer r.RUnlock()
+	members := make([]string, 0, len(r.members))
+	for elt := range r.members {
+		members = append(members, elt)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Clone 复制节点与权重
+func (r *Rendezvous) Clone() *Rendezvous {
+	r.RLock()
+	defer r.RUnlock()
+	clone := &Rendezvous{members: make(map[string]rendezvousMember, len(r.members))}
+	for k, v := range r.members {
+		clone.members[k] = v
+	}
+	return clone
+}
+
+// Get 返回得分最高的节点
+func (r *Rendezvous) Get(name string) (string, error) {
+	r.RLock()
+	defer r.RUnlock()
+	if len(r.members) == 0 {
+		return "", ErrEmptyCircle
+	}
+	key := hash64(name)
+	var (
+		best      string
+		bestScore = math.Inf(-1)
+	)
+	for elt, m := range r.members {
+		// 得分相同时按节点名排序，保证结果与遍历顺序无关
+		if score := m.score(key); score > bestScore || score == bestScore && elt < best {
+			best, bestScore = elt, score
+		}
+	}
+	return best, nil
+}
+
+// GetN 按得分从高到低返回 n 个节点，用于副本放置，第一个与 Get 的结果相同
+// 节点数不足 n 时返回所有节点
+func (r *Rendezvous) GetN(name string, n int) ([]string, error) {
+	r.RLock()
+	defer r.RUnlock()
+	if len(r.members) == 0 {
+		return nil, ErrEmptyCircle
+	}
+	key := hash64(name)
+	type scored struct {
+		elt   string
+		score float64
+	}
+	all := make([]scored, 0, len(r.members))
+	for elt, m := range r.members {
+		all = append(all, scored{elt, m.score(key)})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].score != all[j].score {
+			return all[i].score > all[j].score
+		}
+		return all[i].elt < all[j].elt
+	})
+	n = min(n, len(all))
+	res := make([]string, n)
+	for i := range res {
+		res[i] = all[i].elt
+	}
+	return res, nil
+}
+
+// score 带权重的节点得分 -weight/ln(u)，u 为键与节点的哈希映射到 (0,1) 的均匀分布
+func (m rendezvousMember) score(key uint64) float64 {
+	h := mix64(key ^ m.hash)
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return -m.weight / math.Log(u)
+}
+
+// hash64 计算字符串的 64 位 FNV-1a 哈希
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return mix64(h.Sum64())
+}
+
+// mix64 splitmix64 的混合函数，使相近的输入得到差异较大的输出
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
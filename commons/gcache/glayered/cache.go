@@ -0,0 +1,378 @@
+package glayered
+
+/* glayered 本地+redis两级缓存
+ * 1. 读取顺序: 本地expirable LRU -> redis -> Loader，同一key的并发回源通过singleflight合并
+ * 2. Loader返回ErrNotFound时写入负缓存，防止不存在的key反复击穿到数据源
+ * 3. 本地与redis的过期时间按比例随机抖动，避免大量key同时过期
+ * 4. Set/Delete后通过redis pub/sub广播失效消息，其他节点删除本地副本
+ */
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gcache/glru/exprire"
+	"github.com/qiafan666/gotato/commons/gcommon"
+	"github.com/qiafan666/gotato/commons/gerr"
+	"github.com/qiafan666/gotato/commons/gson"
+	"github.com/qiafan666/gotato/commons/stores/redis_cli"
+	"github.com/zeromicro/go-zero/core/syncx"
+)
+
+// ErrNotFound key不存在，Loader返回该错误时会写入负缓存
+var ErrNotFound = errors.New("glayered: not found")
+
+// redis中value的首字节，区分正常值与负缓存
+const (
+	markValue    = '1'
+	markNotFound = '0'
+)
+
+// Loader 回源函数，key不存在时返回ErrNotFound
+type Loader[V any] func(ctx context.Context, key string) (V, error)
+
+// Stats 命中统计
+type Stats struct {
+	LocalHits     int64 // 本地命中，含负缓存
+	RedisHits     int64 // redis命中，含负缓存
+	Loads         int64 // 调用Loader次数
+	LoadErrors    int64 // Loader返回ErrNotFound以外错误的次数
+	Invalidations int64 // 收到其他节点的失效消息中的key数
+}
+
+// entry 本地缓存项
+type entry[V any] struct {
+	value    V
+	found    bool
+	expireAt int64 // 毫秒时间戳，按抖动后的过期时间提前失效
+}
+
+// flightResult 合并回源的结果
+type flightResult struct {
+	val any
+	err error
+}
+
+// invalidation 失效广播消息
+type invalidation struct {
+	Node string   `json:"node"`
+	Keys []string `json:"keys"`
+}
+
+// Cache 两级缓存 goroutine safe
+type Cache[V any] struct {
+	name    string
+	rds     *redis_cli.Redis
+	local   *exprire.LRU[string, *entry[V]]
+	loader  Loader[V]
+	flight  syncx.SingleFlight
+	opts    *options
+	node    string
+	channel string
+
+	pubsub *redis_cli.PubSub
+	cancel context.CancelFunc
+
+	localHits     atomic.Int64
+	redisHits     atomic.Int64
+	loads         atomic.Int64
+	loadErrors    atomic.Int64
+	invalidations atomic.Int64
+}
+
+// New 创建两级缓存并订阅失效频道，不再使用时调用Close
+// name: 缓存名，作为redis key和失效频道的一部分，同一份数据在所有节点上需使用相同的name
+// loader: 回源函数，为nil时Get在两级缓存都未命中时返回ErrNotFound
+func New[V any](ctx context.Context, name string, rds *redis_cli.Redis, loader Loader[V], opts ...Option) (*Cache[V], error) {
+	o := newOptions(opts...)
+	c := &Cache[V]{
+		name:    name,
+		rds:     rds,
+		loader:  loader,
+		flight:  syncx.NewSingleFlight(),
+		opts:    o,
+		node:    gcommon.GenerateUUID(),
+		channel: o.prefix + name + ":invalidate",
+	}
+	// LRU按最长抖动时间过期，实际过期由entry.expireAt判断
+	c.local = exprire.NewLRU[string, *entry[V]](o.localSize, nil, c.maxLocalTTL())
+
+	ctx, c.cancel = context.WithCancel(ctx)
+	pubsub, err := rds.Subscribe(ctx, c.channel)
+	if err != nil {
+		c.cancel()
+		return nil, gerr.WrapMsg(err, "subscribe invalidation channel fail", "channel", c.channel)
+	}
+	c.pubsub = pubsub
+	go c.listen(ctx)
+	return c, nil
+}
+
+// Get 依次读取本地、redis和Loader，不存在时返回ErrNotFound
+func (c *Cache[V]) Get(ctx context.Context, key string) (V, error) {
+	if e, ok := c.getLocal(key); ok {
+		c.localHits.Add(1)
+		return e.result()
+	}
+
+	// 合并的回源不受某一个调用方取消的影响，各调用方只按自己的ctx放弃等待
+	loadCtx := context.WithoutCancel(ctx)
+	done := make(chan flightResult, 1)
+	go func() {
+		val, err := c.flight.Do(key, func() (any, error) {
+			// 合并期间其他请求可能已写入本地
+			if e, ok := c.getLocal(key); ok {
+				return e, nil
+			}
+			e, err := c.load(loadCtx, key)
+			if err != nil {
+				return nil, err
+			}
+			c.setLocal(key, e)
+			return e, nil
+		})
+		done <- flightResult{val: val, err: err}
+	}()
+
+	var zero V
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return zero, r.err
+		}
+		return r.val.(*entry[V]).result()
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// Set 写入redis和本地，并通知其他节点删除本地副本
+func (c *Cache[V]) Set(ctx context.Context, key string, value V) error {
+	e := &entry[V]{value: value, found: true}
+	if err := c.setRedis(ctx, key, e); err != nil {
+		return err
+	}
+	c.setLocal(key, e)
+	c.publish(ctx, key)
+	return nil
+}
+
+// Delete 删除redis和本地，并通知其他节点删除本地副本，通常在更新数据源后调用
+func (c *Cache[V]) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = c.redisKey(key)
+	}
+	if _, err := c.rds.DelCtx(ctx, redisKeys...); err != nil {
+		return gerr.WrapMsg(err, "delete redis fail", "cache", c.name)
+	}
+	// 先删redis再删本地，否则删除间隙的并发Get会从redis读到旧值重新写入本地
+	for _, key := range keys {
+		c.local.Remove(key)
+	}
+	c.publish(ctx, keys...)
+	return nil
+}
+
+// Stats 命中统计
+func (c *Cache[V]) Stats() Stats {
+	return Stats{
+		LocalHits:     c.localHits.Load(),
+		RedisHits:     c.redisHits.Load(),
+		Loads:         c.loads.Load(),
+		LoadErrors:    c.loadErrors.Load(),
+		Invalidations: c.invalidations.Load(),
+	}
+}
+
+// Close 取消订阅失效频道
+func (c *Cache[V]) Close() {
+	c.cancel()
+	_ = c.pubsub.Close()
+}
+
+// load 读取redis，未命中时调用Loader并回写redis
+func (c *Cache[V]) load(ctx context.Context, key string) (*entry[V], error) {
+	if e, ok := c.getRedis(ctx, key); ok {
+		c.redisHits.Add(1)
+		return e, nil
+	}
+	if c.loader == nil {
+		return &entry[V]{}, nil
+	}
+
+	c.loads.Add(1)
+	value, err := c.loader(ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		c.loadErrors.Add(1)
+		return nil, err
+	}
+	e := &entry[V]{value: value, found: err == nil}
+	if e.found || c.opts.negativeTTL > 0 {
+		ok, err := c.fillRedis(ctx, key, e)
+		if err != nil {
+			c.opts.logger.WarnF(ctx, "glayered.load: write redis fail, cache=%s, key=%s, err=%v", c.name, key, err)
+		} else if !ok {
+			// 回源期间已有Set写入更新的值，以redis为准
+			if cur, hit := c.getRedis(ctx, key); hit {
+				return cur, nil
+			}
+		}
+	}
+	return e, nil
+}
+
+func (c *Cache[V]) getLocal(key string) (*entry[V], bool) {
+	e, ok := c.local.Get(key)
+	if !ok {
+		return nil, false
+	}
+	if time.Now().UnixMilli() > e.expireAt {
+		c.local.Remove(key)
+		return nil, false
+	}
+	return e, true
+}
+
+func (c *Cache[V]) setLocal(key string, e *entry[V]) {
+	ttl := c.opts.localTTL
+	if !e.found {
+		if c.opts.negativeTTL <= 0 {
+			return
+		}
+		ttl = min(ttl, c.opts.negativeTTL)
+	}
+	local := *e
+	local.expireAt = time.Now().Add(c.jitter(ttl)).UnixMilli()
+	c.local.Add(key, &local)
+}
+
+// getRedis 读取失败时降级为未命中
+func (c *Cache[V]) getRedis(ctx context.Context, key string) (*entry[V], bool) {
+	val, err := c.rds.GetCtx(ctx, c.redisKey(key))
+	if err != nil {
+		c.opts.logger.WarnF(ctx, "glayered.getRedis: read redis fail, cache=%s, key=%s, err=%v", c.name, key, err)
+		return nil, false
+	}
+	if val == "" {
+		return nil, false
+	}
+	switch val[0] {
+	case markNotFound:
+		return &entry[V]{}, true
+	case markValue:
+		e := &entry[V]{found: true}
+		if err = c.opts.unmarshal([]byte(val[1:]), &e.value); err != nil {
+			c.opts.logger.WarnF(ctx, "glayered.getRedis: unmarshal fail, cache=%s, key=%s, err=%v", c.name, key, err)
+			return nil, false
+		}
+		return e, true
+	}
+	return nil, false
+}
+
+// setRedis 无条件写入redis，用于Set
+func (c *Cache[V]) setRedis(ctx context.Context, key string, e *entry[V]) error {
+	val, ttl, err := c.encode(key, e)
+	if err != nil {
+		return err
+	}
+	if err = c.rds.SetExCtx(ctx, c.redisKey(key), val, c.jitter(ttl)); err != nil {
+		return gerr.WrapMsg(err, "write redis fail", "cache", c.name, "key", key)
+	}
+	return nil
+}
+
+// fillRedis 回源后仅在key不存在时写入redis，避免较慢的回源覆盖回源期间Set写入的新值，返回是否写入
+func (c *Cache[V]) fillRedis(ctx context.Context, key string, e *entry[V]) (bool, error) {
+	val, ttl, err := c.encode(key, e)
+	if err != nil {
+		return false, err
+	}
+	seconds := max(int(c.jitter(ttl)/time.Second), 1)
+	ok, err := c.rds.SetnxExCtx(ctx, c.redisKey(key), val, seconds)
+	if err != nil {
+		return false, gerr.WrapMsg(err, "write redis fail", "cache", c.name, "key", key)
+	}
+	return ok, nil
+}
+
+// encode 编码redis中保存的值与过期时间
+func (c *Cache[V]) encode(key string, e *entry[V]) (string, time.Duration, error) {
+	if !e.found {
+		return string(markNotFound), c.opts.negativeTTL, nil
+	}
+	data, err := c.opts.marshal(e.value)
+	if err != nil {
+		return "", 0, gerr.WrapMsg(err, "marshal value fail", "cache", c.name, "key", key)
+	}
+	return string(markValue) + string(data), c.opts.redisTTL, nil
+}
+
+// publish 广播失效消息，失败时其他节点的本地副本在本地过期后恢复一致
+func (c *Cache[V]) publish(ctx context.Context, keys ...string) {
+	data, err := gson.Marshal(&invalidation{Node: c.node, Keys: keys})
+	if err != nil {
+		return
+	}
+	if _, err = c.rds.PublishCtx(ctx, c.channel, string(data)); err != nil {
+		c.opts.logger.WarnF(ctx, "glayered.publish: publish invalidation fail, cache=%s, err=%v", c.name, err)
+	}
+}
+
+// listen 接收其他节点的失效消息
+func (c *Cache[V]) listen(ctx context.Context) {
+	ch := c.pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var inv invalidation
+			if err := gson.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+				c.opts.logger.WarnF(ctx, "glayered.listen: bad invalidation, cache=%s, err=%v", c.name, err)
+				continue
+			}
+			if inv.Node == c.node {
+				continue
+			}
+			for _, key := range inv.Keys {
+				c.local.Remove(key)
+			}
+			c.invalidations.Add(int64(len(inv.Keys)))
+		}
+	}
+}
+
+func (c *Cache[V]) redisKey(key string) string {
+	return c.opts.prefix + c.name + ":" + key
+}
+
+// jitter 在±jitter比例内随机调整ttl
+func (c *Cache[V]) jitter(ttl time.Duration) time.Duration {
+	if c.opts.jitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	delta := time.Duration(float64(ttl) * c.opts.jitter * (2*rand.Float64() - 1))
+	return max(ttl+delta, time.Millisecond)
+}
+
+func (c *Cache[V]) maxLocalTTL() time.Duration {
+	return time.Duration(float64(c.opts.localTTL) * (1 + max(c.opts.jitter, 0)))
+}
+
+func (e *entry[V]) result() (V, error) {
+	if !e.found {
+		return e.value, ErrNotFound
+	}
+	return e.value, nil
+}
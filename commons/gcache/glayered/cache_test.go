@@ -0,0 +1,221 @@
+package glayered
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/qiafan666/gotato/commons/stores/redis_cli"
+)
+
+type user struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func newTestCache(t *testing.T, rds *redis_cli.Redis, loader Loader[*user]) *Cache[*user] {
+	c, err := New[*user](context.Background(), "user", rds, loader, WithLocal(100, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReadThrough(t *testing.T) {
+	s := miniredis.RunT(t)
+	rds := redis_cli.MustNewRedis(redis_cli.RedisConf{Host: s.Addr(), Type: redis_cli.NodeType})
+
+	var loads atomic.Int32
+	loader := func(ctx context.Context, key string) (*user, error) {
+		loads.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return &user{Id: key, Name: "tom"}, nil
+	}
+	c := newTestCache(t, rds, loader)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := c.Get(context.Background(), "1")
+			if err != nil || u.Name != "tom" {
+				t.Errorf("get fail, user=%v, err=%v", u, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if loads.Load() != 1 {
+		t.Fatalf("want 1 load, got %d", loads.Load())
+	}
+	if _, err := c.Get(context.Background(), "1"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.Loads != 1 || stats.LocalHits == 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// 另一个节点从redis读取，不再回源
+	other := newTestCache(t, rds, loader)
+	u, err := other.Get(context.Background(), "1")
+	if err != nil || u.Name != "tom" {
+		t.Fatalf("get fail, user=%v, err=%v", u, err)
+	}
+	if loads.Load() != 1 || other.Stats().RedisHits != 1 {
+		t.Fatalf("want redis hit, loads=%d, stats=%+v", loads.Load(), other.Stats())
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	s := miniredis.RunT(t)
+	rds := redis_cli.MustNewRedis(redis_cli.RedisConf{Host: s.Addr(), Type: redis_cli.NodeType})
+
+	var loads atomic.Int32
+	c := newTestCache(t, rds, func(ctx context.Context, key string) (*user, error) {
+		loads.Add(1)
+		return nil, ErrNotFound
+	})
+	for i := 0; i < 3; i++ {
+		if _, err := c.Get(context.Background(), "404"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("want ErrNotFound, got %v", err)
+		}
+	}
+	if loads.Load() != 1 {
+		t.Fatalf("want 1 load, got %d", loads.Load())
+	}
+	if ttl := s.TTL("glayered:user:404"); ttl <= 0 || ttl > defaultNegativeTTL*2 {
+		t.Fatalf("unexpected negative ttl %v", ttl)
+	}
+
+	// 其他错误不缓存
+	boom := errors.New("boom")
+	failed := newTestCache(t, rds, func(ctx context.Context, key string) (*user, error) {
+		return nil, boom
+	})
+	if _, err := failed.Get(context.Background(), "500"); !errors.Is(err, boom) {
+		t.Fatalf("want boom, got %v", err)
+	}
+	if s.Exists("glayered:user:500") || failed.Stats().LoadErrors != 1 {
+		t.Fatal("load error should not be cached")
+	}
+}
+
+func TestInvalidation(t *testing.T) {
+	s := miniredis.RunT(t)
+	rds := redis_cli.MustNewRedis(redis_cli.RedisConf{Host: s.Addr(), Type: redis_cli.NodeType})
+
+	a := newTestCache(t, rds, nil)
+	b := newTestCache(t, rds, nil)
+	ctx := context.Background()
+
+	if err := a.Set(ctx, "1", &user{Id: "1", Name: "tom"}); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := b.Get(ctx, "1"); err != nil || u.Name != "tom" {
+		t.Fatalf("get fail, user=%v, err=%v", u, err)
+	}
+
+	// a更新后b的本地副本被删除，重新从redis读取
+	if err := a.Set(ctx, "1", &user{Id: "1", Name: "jerry"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		u, err := b.Get(ctx, "1")
+		return err == nil && u.Name == "jerry"
+	})
+	if b.Stats().Invalidations == 0 || a.Stats().Invalidations != 0 {
+		t.Fatalf("unexpected invalidations, a=%+v, b=%+v", a.Stats(), b.Stats())
+	}
+
+	if err := b.Delete(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		_, err := a.Get(ctx, "1")
+		return errors.Is(err, ErrNotFound)
+	})
+}
+
+func TestCancelledWaiter(t *testing.T) {
+	s := miniredis.RunT(t)
+	rds := redis_cli.MustNewRedis(redis_cli.RedisConf{Host: s.Addr(), Type: redis_cli.NodeType})
+
+	var loads atomic.Int32
+	c := newTestCache(t, rds, func(ctx context.Context, key string) (*user, error) {
+		loads.Add(1)
+		select {
+		case <-time.After(100 * time.Millisecond):
+			return &user{Id: key, Name: "tom"}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+
+	// 第一个调用方取消不影响合并等待的其他调用方
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.Get(ctx, "1")
+		first <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	u, err := c.Get(context.Background(), "1")
+	if err != nil || u.Name != "tom" {
+		t.Fatalf("get fail, user=%v, err=%v", u, err)
+	}
+	if err = <-first; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded, got %v", err)
+	}
+	if loads.Load() != 1 {
+		t.Fatalf("want 1 load, got %d", loads.Load())
+	}
+}
+
+// TestSlowLoadKeepsSet 回源期间Set写入的新值不被较慢的回源结果覆盖
+func TestSlowLoadKeepsSet(t *testing.T) {
+	s := miniredis.RunT(t)
+	rds := redis_cli.MustNewRedis(redis_cli.RedisConf{Host: s.Addr(), Type: redis_cli.NodeType})
+
+	loading, release := make(chan struct{}), make(chan struct{})
+	c := newTestCache(t, rds, func(ctx context.Context, key string) (*user, error) {
+		close(loading)
+		<-release
+		return &user{Id: key, Name: "tom"}, nil
+	})
+	other := newTestCache(t, rds, nil)
+
+	got := make(chan *user, 1)
+	go func() {
+		u, _ := c.Get(context.Background(), "1")
+		got <- u
+	}()
+	<-loading
+	if err := other.Set(context.Background(), "1", &user{Id: "1", Name: "jerry"}); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	if u := <-got; u == nil || u.Name != "jerry" {
+		t.Fatalf("want jerry, got %v", u)
+	}
+	u, err := other.Get(context.Background(), "1")
+	if err != nil || u.Name != "jerry" {
+		t.Fatalf("redis overwritten, user=%v, err=%v", u, err)
+	}
+}
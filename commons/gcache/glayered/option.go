@@ -0,0 +1,102 @@
+package glayered
+
+import (
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gface"
+	"github.com/qiafan666/gotato/commons/gson"
+)
+
+const (
+	defaultLocalSize   = 10000
+	defaultLocalTTL    = time.Minute
+	defaultRedisTTL    = 10 * time.Minute
+	defaultNegativeTTL = 30 * time.Second
+	defaultJitter      = 0.1
+	defaultPrefix      = "glayered:"
+)
+
+type options struct {
+	localSize   int
+	localTTL    time.Duration
+	redisTTL    time.Duration
+	negativeTTL time.Duration
+	jitter      float64
+	prefix      string
+	marshal     func(v any) ([]byte, error)
+	unmarshal   func(data []byte, v any) error
+	logger      gface.ILogger
+}
+
+// Option 缓存配置项
+type Option func(o *options)
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		localSize:   defaultLocalSize,
+		localTTL:    defaultLocalTTL,
+		redisTTL:    defaultRedisTTL,
+		negativeTTL: defaultNegativeTTL,
+		jitter:      defaultJitter,
+		prefix:      defaultPrefix,
+		marshal:     gson.Marshal,
+		unmarshal:   gson.Unmarshal,
+		logger:      gface.NewLogger("glayered", nil),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithLocal 设置本地LRU容量和过期时间，默认10000条、1分钟
+// 本地副本依赖失效广播保持一致，过期时间决定广播丢失时的最长不一致时间
+func WithLocal(size int, ttl time.Duration) Option {
+	return func(o *options) {
+		o.localSize = size
+		o.localTTL = ttl
+	}
+}
+
+// WithRedisTTL 设置redis过期时间，默认10分钟
+func WithRedisTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.redisTTL = ttl
+	}
+}
+
+// WithNegativeTTL 设置Loader返回ErrNotFound时的负缓存时间，默认30秒，小于等于0时不缓存
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithJitter 设置过期时间的随机抖动比例，如0.1表示在±10%内随机，默认0.1
+func WithJitter(jitter float64) Option {
+	return func(o *options) {
+		o.jitter = jitter
+	}
+}
+
+// WithPrefix 设置redis key与失效频道的前缀，默认"glayered:"
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithCodec 设置写入redis的序列化方法，默认json
+func WithCodec(marshal func(v any) ([]byte, error), unmarshal func(data []byte, v any) error) Option {
+	return func(o *options) {
+		o.marshal = marshal
+		o.unmarshal = unmarshal
+	}
+}
+
+// WithLogger 设置日志
+func WithLogger(logger gface.ILogger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
@@ -0,0 +1,217 @@
+package tinylfu
+
+import "sync"
+
+// 节点所在的队列
+const (
+	queueWindow uint8 = iota
+	queueProbation
+	queueProtected
+)
+
+type node[K comparable, V any] struct {
+	key        K
+	value      V
+	hash       uint64
+	cost       int64
+	expireAt   int64 // 纳秒时间戳，0为不过期
+	queue      uint8
+	prev, next *node[K, V]
+}
+
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expireAt > 0 && now > n.expireAt
+}
+
+// lruList 带哨兵的双向循环链表，front为最近访问
+type lruList[K comparable, V any] struct {
+	root node[K, V]
+	cost int64
+}
+
+func (l *lruList[K, V]) init() {
+	l.root.next = &l.root
+	l.root.prev = &l.root
+	l.cost = 0
+}
+
+func (l *lruList[K, V]) pushFront(n *node[K, V]) {
+	n.prev = &l.root
+	n.next = l.root.next
+	l.root.next.prev = n
+	l.root.next = n
+	l.cost += n.cost
+}
+
+func (l *lruList[K, V]) remove(n *node[K, V]) {
+	n.prev.next = n.next
+	n.next.prev = n.prev
+	n.prev, n.next = nil, nil
+	l.cost -= n.cost
+}
+
+func (l *lruList[K, V]) moveToFront(n *node[K, V]) {
+	if l.root.next == n {
+		return
+	}
+	l.remove(n)
+	l.pushFront(n)
+}
+
+// front 返回最近访问的节点，链表为空时返回nil
+func (l *lruList[K, V]) front() *node[K, V] {
+	if l.root.next == &l.root {
+		return nil
+	}
+	return l.root.next
+}
+
+// back 返回最久未访问的节点，链表为空时返回nil
+func (l *lruList[K, V]) back() *node[K, V] {
+	if l.root.prev == &l.root {
+		return nil
+	}
+	return l.root.prev
+}
+
+// shard 一个分片的W-TinyLFU淘汰策略，调用方需持有lock
+type shard[K comparable, V any] struct {
+	lock  sync.Mutex
+	items map[K]*node[K, V]
+
+	window    lruList[K, V] // 窗口LRU，新key进入的位置
+	probation lruList[K, V] // 主区试用段，从窗口晋升或从保护段降级的key
+	protected lruList[K, V] // 主区保护段，在试用段中再次被访问的key
+
+	maxCost       int64
+	windowCost    int64
+	protectedCost int64
+	sketch        *cmSketch
+
+	keepEvicted bool
+	evicted     []*node[K, V] // 待在锁外回调的节点
+}
+
+func newShard[K comparable, V any](maxCost int64, counters int, keepEvicted bool) *shard[K, V] {
+	windowCost := max(maxCost*windowPercent/100, 1)
+	s := &shard[K, V]{
+		items:         make(map[K]*node[K, V]),
+		maxCost:       maxCost,
+		windowCost:    windowCost,
+		protectedCost: (maxCost - windowCost) * protectedPercent / 100,
+		sketch:        newCmSketch(counters),
+		keepEvicted:   keepEvicted,
+	}
+	s.window.init()
+	s.probation.init()
+	s.protected.init()
+	return s
+}
+
+func (s *shard[K, V]) get(key K, hash uint64, now int64) (value V, ok bool) {
+	s.sketch.increment(hash)
+	n, found := s.items[key]
+	if !found {
+		return
+	}
+	if n.expired(now) {
+		s.remove(n)
+		return
+	}
+	s.onHit(n)
+	return n.value, true
+}
+
+func (s *shard[K, V]) set(key K, hash uint64, value V, cost int64, expireAt int64) bool {
+	if cost > s.maxCost {
+		if n, found := s.items[key]; found {
+			s.remove(n)
+		}
+		return false
+	}
+	s.sketch.increment(hash)
+	if n, found := s.items[key]; found {
+		n.value, n.expireAt = value, expireAt
+		s.list(n).cost += cost - n.cost
+		n.cost = cost
+		s.onHit(n)
+	} else {
+		n = &node[K, V]{key: key, value: value, hash: hash, cost: cost, expireAt: expireAt, queue: queueWindow}
+		s.items[key] = n
+		s.window.pushFront(n)
+	}
+	s.evictWindow()
+	s.evictMain()
+	return true
+}
+
+// onHit 访问命中后调整节点位置，试用段的节点晋升到保护段
+func (s *shard[K, V]) onHit(n *node[K, V]) {
+	switch n.queue {
+	case queueWindow:
+		s.window.moveToFront(n)
+	case queueProbation:
+		s.probation.remove(n)
+		n.queue = queueProtected
+		s.protected.pushFront(n)
+		// 保护段超出容量时将最久未访问的节点降级到试用段
+		for s.protected.cost > s.protectedCost {
+			demote := s.protected.back()
+			s.protected.remove(demote)
+			demote.queue = queueProbation
+			s.probation.pushFront(demote)
+		}
+	case queueProtected:
+		s.protected.moveToFront(n)
+	}
+}
+
+// evictWindow 将超出窗口容量的节点移入试用段，由evictMain决定其去留
+func (s *shard[K, V]) evictWindow() {
+	for s.window.cost > s.windowCost {
+		n := s.window.back()
+		s.window.remove(n)
+		n.queue = queueProbation
+		s.probation.pushFront(n)
+	}
+}
+
+// evictMain 主区超出容量时，比较试用段头部的候选节点(刚从窗口进入)与末尾的受害节点的访问频率，淘汰频率较低者
+func (s *shard[K, V]) evictMain() {
+	for s.window.cost+s.probation.cost+s.protected.cost > s.maxCost {
+		candidate, victim := s.probation.front(), s.probation.back()
+		if victim == candidate {
+			victim = s.protected.back()
+		}
+		switch {
+		case candidate == nil:
+			s.remove(victim)
+		case victim == nil:
+			s.remove(candidate)
+		// 频率相同时淘汰候选，保护已经在主区中的key
+		case s.sketch.estimate(candidate.hash) > s.sketch.estimate(victim.hash):
+			s.remove(victim)
+		default:
+			s.remove(candidate)
+		}
+	}
+}
+
+func (s *shard[K, V]) list(n *node[K, V]) *lruList[K, V] {
+	switch n.queue {
+	case queueWindow:
+		return &s.window
+	case queueProbation:
+		return &s.probation
+	default:
+		return &s.protected
+	}
+}
+
+func (s *shard[K, V]) remove(n *node[K, V]) {
+	s.list(n).remove(n)
+	delete(s.items, n.key)
+	if s.keepEvicted {
+		s.evicted = append(s.evicted, n)
+	}
+}
@@ -0,0 +1,81 @@
+package tinylfu
+
+import "math/bits"
+
+const (
+	sketchDepth = 4                  // 每个key使用的计数器行数
+	counterMax  = 15                 // 4位计数器的最大值
+	resetMask   = 0x7777777777777777 // 计数器减半时清除每个4位计数器移入的高位
+)
+
+// cmSketch 4位计数器的count-min sketch，用于估算key的近期访问频率
+// 计数总数达到resetAt后所有计数器减半，使频率随时间衰减
+type cmSketch struct {
+	rows      [sketchDepth][]uint64 // 每个uint64存放16个4位计数器
+	mask      uint64                // 每行计数器数-1
+	additions int
+	resetAt   int
+}
+
+// newCmSketch 创建计数器个数不少于counters的sketch
+func newCmSketch(counters int) *cmSketch {
+	n := nextPowerOfTwo(max(counters, 16))
+	s := &cmSketch{
+		mask:    uint64(n - 1),
+		resetAt: n * 10,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint64, n/16)
+	}
+	return s
+}
+
+// increment 增加hash对应的计数
+func (s *cmSketch) increment(hash uint64) {
+	h1, h2 := hash, hash>>32|hash<<32
+	for i := range s.rows {
+		idx := (h1 + uint64(i)*h2) & s.mask
+		word, shift := idx>>4, (idx&15)<<2
+		if (s.rows[i][word]>>shift)&counterMax < counterMax {
+			s.rows[i][word] += 1 << shift
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+// estimate 返回hash对应的估算频率，取各行计数的最小值
+func (s *cmSketch) estimate(hash uint64) uint8 {
+	h1, h2 := hash, hash>>32|hash<<32
+	minCount := uint64(counterMax)
+	for i := range s.rows {
+		idx := (h1 + uint64(i)*h2) & s.mask
+		word, shift := idx>>4, (idx&15)<<2
+		minCount = min(minCount, (s.rows[i][word]>>shift)&counterMax)
+	}
+	return uint8(minCount)
+}
+
+// reset 所有计数器减半
+func (s *cmSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = (s.rows[i][j] >> 1) & resetMask
+		}
+	}
+	s.additions /= 2
+}
+
+// clear 清空所有计数
+func (s *cmSketch) clear() {
+	for i := range s.rows {
+		clear(s.rows[i])
+	}
+	s.additions = 0
+}
+
+func nextPowerOfTwo(n int) int {
+	return 1 << bits.Len(uint(n-1))
+}
@@ -0,0 +1,255 @@
+// Package tinylfu 线程安全的W-TinyLFU缓存
+//
+// 新key先进入占容量1%的窗口LRU，被挤出窗口后与主区(分段LRU)的淘汰候选比较count-min sketch估算的访问频率，
+// 频率更高者留下，使偶发的大量一次性访问(如遍历)不会挤掉热点数据。
+// 容量按每个key的cost计算，key可单独设置过期时间。缓存按key的哈希分片加锁，每个分片独立执行淘汰策略。
+package tinylfu
+
+import (
+	"errors"
+	"hash/maphash"
+	"math/bits"
+	"runtime"
+	"time"
+)
+
+const (
+	windowPercent    = 1  // 窗口LRU占容量的百分比
+	protectedPercent = 80 // 主区中保护段占主区容量的百分比
+	maxCounters      = 1 << 20
+	minShardCost     = 64 // 每个分片的最小容量，容量较小时减少分片数，避免分片后无法容纳较大cost的key
+)
+
+type options struct {
+	counters int
+	shards   int
+}
+
+// Option 缓存配置项
+type Option func(o *options)
+
+// WithCounters 设置频率统计的计数器个数，应接近缓存能容纳的key数量
+// 默认取总cost，最多1<<20个，cost按字节等较大单位计算时应设置为预估的key数量
+func WithCounters(counters int) Option {
+	return func(o *options) {
+		o.counters = counters
+	}
+}
+
+// WithShards 设置分片数，会调整为2的幂，默认为GOMAXPROCS*4
+// 分片越多并发性能越好，但每个分片的容量与频率统计越小，命中率会略有下降
+func WithShards(shards int) Option {
+	return func(o *options) {
+		o.shards = shards
+	}
+}
+
+// Cache W-TinyLFU缓存 goroutine safe
+type Cache[K comparable, V any] struct {
+	shards    []*shard[K, V]
+	shardBits int
+	seed      maphash.Seed
+	onEvicted func(key K, value V)
+}
+
+// New 创建总容量为maxCost的缓存
+func New[K comparable, V any](maxCost int64, opts ...Option) (*Cache[K, V], error) {
+	return NewWithEvict[K, V](maxCost, nil, opts...)
+}
+
+// NewWithEvict 创建总容量为maxCost的缓存，并指定key被淘汰、过期或删除时的回调函数
+// 回调函数在锁外调用
+func NewWithEvict[K comparable, V any](maxCost int64, onEvicted func(key K, value V), opts ...Option) (*Cache[K, V], error) {
+	if maxCost <= 0 {
+		return nil, errors.New("must provide a positive cost")
+	}
+	o := &options{
+		counters: int(min(maxCost, maxCounters)),
+		shards:   runtime.GOMAXPROCS(0) * 4,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	shards := nextPowerOfTwo(max(o.shards, 1))
+	for shards > 1 && maxCost/int64(shards) < minShardCost {
+		shards >>= 1
+	}
+	c := &Cache[K, V]{
+		shards:    make([]*shard[K, V], shards),
+		shardBits: bits.Len(uint(shards - 1)),
+		seed:      maphash.MakeSeed(),
+		onEvicted: onEvicted,
+	}
+	for i := range c.shards {
+		// 余数分给前面的分片，保证总容量为maxCost
+		cost := maxCost / int64(shards)
+		if int64(i) < maxCost%int64(shards) {
+			cost++
+		}
+		c.shards[i] = newShard[K, V](cost, max(o.counters/shards, 1), onEvicted != nil)
+	}
+	return c, nil
+}
+
+func (c *Cache[K, V]) hash(key K) uint64 {
+	return maphash.Comparable(c.seed, key)
+}
+
+func (c *Cache[K, V]) shard(hash uint64) *shard[K, V] {
+	if c.shardBits == 0 {
+		return c.shards[0]
+	}
+	return c.shards[hash>>(64-c.shardBits)]
+}
+
+// Get 返回key的值并记录一次访问，key不存在或已过期时返回false
+func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
+	h := c.hash(key)
+	s := c.shard(h)
+	s.lock.Lock()
+	value, ok = s.get(key, h, time.Now().UnixNano())
+	c.unlock(s)
+	return
+}
+
+// Peek 返回key的值，不记录访问
+func (c *Cache[K, V]) Peek(key K) (value V, ok bool) {
+	h := c.hash(key)
+	s := c.shard(h)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if n, found := s.items[key]; found && !n.expired(time.Now().UnixNano()) {
+		return n.value, true
+	}
+	return
+}
+
+// Contains 检查key是否存在，不记录访问
+func (c *Cache[K, V]) Contains(key K) bool {
+	_, ok := c.Peek(key)
+	return ok
+}
+
+// Add 添加cost为1且不过期的key，返回是否写入
+func (c *Cache[K, V]) Add(key K, value V) bool {
+	return c.Set(key, value, 1, 0)
+}
+
+// Set 写入key，ttl小于等于0时不过期
+// 新key先进入窗口LRU，之后是否保留由访问频率决定，cost超过分片容量时不写入并返回false
+func (c *Cache[K, V]) Set(key K, value V, cost int64, ttl time.Duration) bool {
+	h := c.hash(key)
+	s := c.shard(h)
+	var expireAt int64
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl).UnixNano()
+	}
+	s.lock.Lock()
+	ok := s.set(key, h, value, max(cost, 0), expireAt)
+	c.unlock(s)
+	return ok
+}
+
+// Remove 删除key，返回key是否存在
+func (c *Cache[K, V]) Remove(key K) (present bool) {
+	h := c.hash(key)
+	s := c.shard(h)
+	s.lock.Lock()
+	if n, found := s.items[key]; found {
+		s.remove(n)
+		present = true
+	}
+	c.unlock(s)
+	return
+}
+
+// DeleteExpired 删除所有已过期的key，返回删除的个数
+func (c *Cache[K, V]) DeleteExpired() int {
+	now := time.Now().UnixNano()
+	count := 0
+	for _, s := range c.shards {
+		s.lock.Lock()
+		for _, n := range s.items {
+			if n.expired(now) {
+				s.remove(n)
+				count++
+			}
+		}
+		c.unlock(s)
+	}
+	return count
+}
+
+// Purge 清空缓存与访问频率统计
+func (c *Cache[K, V]) Purge() {
+	for _, s := range c.shards {
+		s.lock.Lock()
+		for _, n := range s.items {
+			s.remove(n)
+		}
+		s.sketch.clear()
+		c.unlock(s)
+	}
+}
+
+// Len 返回key的数量，包括已过期未清理的key
+func (c *Cache[K, V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.lock.Lock()
+		n += len(s.items)
+		s.lock.Unlock()
+	}
+	return n
+}
+
+// Cost 返回当前已使用的cost
+func (c *Cache[K, V]) Cost() int64 {
+	var cost int64
+	for _, s := range c.shards {
+		s.lock.Lock()
+		cost += s.window.cost + s.probation.cost + s.protected.cost
+		s.lock.Unlock()
+	}
+	return cost
+}
+
+// MaxCost 返回总容量
+func (c *Cache[K, V]) MaxCost() int64 {
+	var cost int64
+	for _, s := range c.shards {
+		cost += s.maxCost
+	}
+	return cost
+}
+
+// Keys 返回所有未过期的key，顺序不确定
+func (c *Cache[K, V]) Keys() []K {
+	now := time.Now().UnixNano()
+	var keys []K
+	for _, s := range c.shards {
+		s.lock.Lock()
+		for k, n := range s.items {
+			if !n.expired(now) {
+				keys = append(keys, k)
+			}
+		}
+		s.lock.Unlock()
+	}
+	return keys
+}
+
+// unlock 释放分片锁，并在锁外调用被淘汰key的回调函数
+func (c *Cache[K, V]) unlock(s *shard[K, V]) {
+	if c.onEvicted == nil || len(s.evicted) == 0 {
+		s.lock.Unlock()
+		return
+	}
+	evicted := s.evicted
+	s.evicted = nil
+	s.lock.Unlock()
+	for _, n := range evicted {
+		c.onEvicted(n.key, n.value)
+	}
+}
@@ -0,0 +1,215 @@
+package tinylfu
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gcache/glru"
+	"github.com/qiafan666/gotato/commons/gcache/glru/arc"
+)
+
+func TestCache(t *testing.T) {
+	var evicted []int
+	c, err := NewWithEvict[int, int](100, func(k int, v int) {
+		evicted = append(evicted, k)
+	}, WithShards(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New[int, int](0); err == nil {
+		t.Fatal("want error for zero cost")
+	}
+
+	for i := 0; i < 100; i++ {
+		c.Add(i, i)
+	}
+	if v, ok := c.Get(1); !ok || v != 1 {
+		t.Fatalf("get 1: %v %v", v, ok)
+	}
+	for i := 100; i < 200; i++ {
+		c.Add(i, i)
+	}
+	if c.Cost() > c.MaxCost() || c.Len() > 100 {
+		t.Fatalf("cost %d exceeds max cost %d", c.Cost(), c.MaxCost())
+	}
+	if len(evicted) != 100 {
+		t.Fatalf("want 100 evicted, got %d", len(evicted))
+	}
+
+	if !c.Remove(1) || c.Contains(1) || c.Remove(1) {
+		t.Fatal("remove 1 fail")
+	}
+	if c.Set(-1, -1, 101, 0) {
+		t.Fatal("cost larger than capacity should be rejected")
+	}
+	c.Purge()
+	if c.Len() != 0 || c.Cost() != 0 {
+		t.Fatalf("purge fail, len %d cost %d", c.Len(), c.Cost())
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c, _ := New[string, int](10)
+	c.Set("a", 1, 1, 20*time.Millisecond)
+	c.Set("b", 2, 1, 0)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a should exist")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("a should be expired")
+	}
+	c.Set("c", 3, 1, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if n := c.DeleteExpired(); n != 1 || c.Len() != 1 {
+		t.Fatalf("want 1 expired, got %d, len %d", n, c.Len())
+	}
+}
+
+func TestCost(t *testing.T) {
+	c, _ := New[int, string](1000, WithShards(1))
+	for i := 0; i < 100; i++ {
+		c.Set(i, "v", int64(i%20+1), 0)
+		if c.Cost() > 1000 {
+			t.Fatalf("cost %d exceeds 1000", c.Cost())
+		}
+	}
+	// 更新已有key的cost
+	c.Set(99, "v", 500, 0)
+	if c.Cost() > 1000 {
+		t.Fatalf("cost %d exceeds 1000", c.Cost())
+	}
+}
+
+// TestScanResistance 热点key不会被一次性遍历的冷数据挤出
+func TestScanResistance(t *testing.T) {
+	c, _ := New[int, int](100, WithShards(1))
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 50; i++ {
+			if _, ok := c.Get(i); !ok {
+				c.Add(i, i)
+			}
+		}
+	}
+	for i := 1000; i < 11000; i++ {
+		c.Add(i, i)
+	}
+	hot := 0
+	for i := 0; i < 50; i++ {
+		if c.Contains(i) {
+			hot++
+		}
+	}
+	if hot < 45 {
+		t.Fatalf("only %d hot keys survived scan", hot)
+	}
+}
+
+func TestHitRatio(t *testing.T) {
+	trace := zipfTrace(200000, 100000)
+	tiny, _ := New[uint64, uint64](1000, WithShards(1))
+	lru, _ := glru.New[uint64, uint64](1000)
+	tinyRatio := hitRatio(trace, tiny.Get, tiny.Add)
+	lruRatio := hitRatio(trace, lru.Get, lru.Add)
+	t.Logf("hit ratio tinylfu %.4f, lru %.4f", tinyRatio, lruRatio)
+	if tinyRatio <= lruRatio {
+		t.Fatalf("tinylfu hit ratio %.4f should be higher than lru %.4f", tinyRatio, lruRatio)
+	}
+}
+
+func zipfTrace(n int, keys uint64) []uint64 {
+	z := rand.NewZipf(rand.New(rand.NewSource(1)), 1.01, 1, keys-1)
+	trace := make([]uint64, n)
+	for i := range trace {
+		trace[i] = z.Uint64()
+	}
+	return trace
+}
+
+func hitRatio[F ~func(k, v uint64) bool](trace []uint64, get func(k uint64) (uint64, bool), add F) float64 {
+	hit := 0
+	for _, k := range trace {
+		if _, ok := get(k); ok {
+			hit++
+		} else {
+			add(k, k)
+		}
+	}
+	return float64(hit) / float64(len(trace))
+}
+
+// 偏斜访问下与glru.Cache、arc.ARCCache的命中率与单线程耗时对比
+func BenchmarkZipf_TinyLFU(b *testing.B) {
+	c, _ := New[uint64, uint64](8192)
+	benchmarkZipf(b, c.Get, c.Add)
+}
+
+func BenchmarkZipf_LRU(b *testing.B) {
+	c, _ := glru.New[uint64, uint64](8192)
+	benchmarkZipf(b, c.Get, c.Add)
+}
+
+func BenchmarkZipf_ARC(b *testing.B) {
+	c, _ := arc.NewARC[uint64, uint64](8192)
+	benchmarkZipf(b, c.Get, func(k, v uint64) bool {
+		c.Add(k, v)
+		return true
+	})
+}
+
+func benchmarkZipf(b *testing.B, get func(k uint64) (uint64, bool), add func(k, v uint64) bool) {
+	trace := zipfTrace(1<<20, 1<<20)
+	b.ResetTimer()
+	hit := 0
+	for i := 0; i < b.N; i++ {
+		k := trace[i&(len(trace)-1)]
+		if _, ok := get(k); ok {
+			hit++
+		} else {
+			add(k, k)
+		}
+	}
+	b.ReportMetric(float64(hit)/float64(b.N)*100, "hit%")
+}
+
+// 偏斜访问下的并发吞吐量对比
+func BenchmarkZipfParallel_TinyLFU(b *testing.B) {
+	c, _ := New[uint64, uint64](8192)
+	benchmarkZipfParallel(b, c.Get, c.Add)
+}
+
+func BenchmarkZipfParallel_LRU(b *testing.B) {
+	c, _ := glru.New[uint64, uint64](8192)
+	benchmarkZipfParallel(b, c.Get, c.Add)
+}
+
+func BenchmarkZipfParallel_ARC(b *testing.B) {
+	c, _ := arc.NewARC[uint64, uint64](8192)
+	benchmarkZipfParallel(b, c.Get, func(k, v uint64) bool {
+		c.Add(k, v)
+		return true
+	})
+}
+
+func benchmarkZipfParallel(b *testing.B, get func(k uint64) (uint64, bool), add func(k, v uint64) bool) {
+	trace := zipfTrace(1<<20, 1<<20)
+	var seq, hits atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(seq.Add(1) * 7919)
+		hit := 0
+		for pb.Next() {
+			k := trace[i&(len(trace)-1)]
+			if _, ok := get(k); ok {
+				hit++
+			} else {
+				add(k, k)
+			}
+			i++
+		}
+		hits.Add(int64(hit))
+	})
+	b.ReportMetric(float64(hits.Load())/float64(b.N)*100, "hit%")
+}
@@ -0,0 +1,243 @@
+package grank
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gapp/timer"
+)
+
+var (
+	// ErrScoreRange 分数分量为负数或超出Layout中的位数
+	ErrScoreRange = errors.New("grank: score out of range")
+	// ErrTimeBits Layout的时间位数不足以覆盖一个赛季
+	ErrTimeBits = errors.New("grank: time bits cannot cover the season")
+	// ErrScoreCount 分数分量个数与Layout不一致
+	ErrScoreCount = errors.New("grank: score count mismatch")
+	// ErrEpochRequired redis排行榜比较时间且未设置赛季时需指定Layout.Epoch
+	ErrEpochRequired = errors.New("grank: layout epoch required")
+)
+
+// ILeaderboard 排行榜，内存实现MemBoard与redis实现RedisBoard的排名规则相同，同一份业务代码可以在单机与集群间切换
+// 名次从1开始，分数按Layout编码为一个int64后降序排列
+type ILeaderboard interface {
+	// Put 设置玩家的各项分数，个数需与Layout.Bits一致，返回名次
+	Put(ctx context.Context, id int64, scores ...int64) (int32, error)
+	// Incr 在玩家当前分数上累加各项分数，个数可少于Layout.Bits，返回名次
+	Incr(ctx context.Context, id int64, deltas ...int64) (int32, error)
+	// Get 获取玩家的条目，不在榜上时返回nil
+	Get(ctx context.Context, id int64) (*Item, error)
+	// Del 从榜上删除玩家
+	Del(ctx context.Context, id int64) error
+	// Total 榜上的条目数
+	Total(ctx context.Context) (int32, error)
+	// Page 获取名次在[start, stop]之间的条目
+	Page(ctx context.Context, start, stop int32) ([]*Item, error)
+	// Around 获取玩家前后各n名的条目，包括玩家自己，玩家不在榜上时返回nil
+	Around(ctx context.Context, id int64, n int32) ([]*Item, error)
+	// Reset 清空当前赛季的排行榜
+	Reset(ctx context.Context) error
+}
+
+// Layout 复合分数的位布局，各分数分量与更新时间从高位到低位拼接为一个非负整数
+// 总位数不超过53位，保证redis中以float64保存时不丢失精度
+type Layout struct {
+	Bits     []uint8 // 各分数分量的位数，按比较优先级从高到低
+	TimeBits uint8   // 更新时间(秒)的位数，分数相同时先达到的排名靠前，0为不比较时间
+	Epoch    int64   // 未设置赛季时计算更新时间的起点(unix秒)，内存排行榜为0时取创建时间，redis排行榜必须设置，设置赛季时使用赛季开始时间
+}
+
+// DefaultLayout 默认布局，单项32位分数，时间21位约可区分24天内的先后
+// 未设置赛季时从Epoch起约24天后不再比较时间，redis排行榜需设置Epoch或赛季
+var DefaultLayout = &Layout{Bits: []uint8{32}, TimeBits: 21}
+
+// validate 检查布局是否有效
+func (l *Layout) validate() error {
+	total := int(l.TimeBits)
+	for _, b := range l.Bits {
+		if b == 0 {
+			return errors.New("grank: zero score bits")
+		}
+		total += int(b)
+	}
+	if len(l.Bits) == 0 || total > 53 {
+		return errors.New("grank: layout needs 1 to 53 bits")
+	}
+	return nil
+}
+
+// shift 第i个分数分量的起始位
+func (l *Layout) shift(i int) uint8 {
+	shift := l.TimeBits
+	for _, b := range l.Bits[i+1:] {
+		shift += b
+	}
+	return shift
+}
+
+// timePart 更新时间对应的低位，越早更新值越大，超出范围后为0
+func (l *Layout) timePart(elapsed int64) int64 {
+	if l.TimeBits == 0 {
+		return 0
+	}
+	maxTime := int64(1)<<l.TimeBits - 1
+	return maxTime - min(max(elapsed, 0), maxTime)
+}
+
+// encode 将各分数分量与更新时间编码为排序用的分数
+func (l *Layout) encode(scores []int64, elapsed int64) (int64, error) {
+	if len(scores) != len(l.Bits) {
+		return 0, ErrScoreCount
+	}
+	var v int64
+	for i, s := range scores {
+		if s < 0 || s >= int64(1)<<l.Bits[i] {
+			return 0, ErrScoreRange
+		}
+		v |= s << l.shift(i)
+	}
+	return v | l.timePart(elapsed), nil
+}
+
+// decode 从排序用的分数中解出各分数分量
+func (l *Layout) decode(v int64) []int64 {
+	scores := make([]int64, len(l.Bits))
+	for i, b := range l.Bits {
+		scores[i] = v >> l.shift(i) & (int64(1)<<b - 1)
+	}
+	return scores
+}
+
+// Season 按cron表达式周期重置的赛季，表达式的每次触发时间为一个赛季的开始
+// 各节点使用相同的表达式与起点时得到相同的赛季，不需要在某个节点上执行重置
+type Season struct {
+	expr   *timer.CronExpr
+	anchor time.Time
+	lock   sync.Mutex
+	start  time.Time
+	end    time.Time
+}
+
+// NewSeason 创建赛季
+// expr: cron表达式，如每周一0点 "0 0 * * 1"
+// anchor: 第一个赛季的开始时间，之后的赛季从该时间起按expr推算
+func NewSeason(expr string, anchor time.Time) (*Season, error) {
+	cronExpr, err := timer.NewCronExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Season{expr: cronExpr, anchor: anchor, start: anchor, end: anchor}, nil
+}
+
+// At 返回now所在赛季的开始与结束时间，now早于anchor时返回第一个赛季
+func (s *Season) At(now time.Time) (start, end time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if now.Before(s.start) {
+		s.start, s.end = s.anchor, s.anchor
+	}
+	if s.end.Equal(s.start) {
+		s.end = s.next(s.start)
+	}
+	for !now.Before(s.end) {
+		s.start, s.end = s.end, s.next(s.end)
+	}
+	return s.start, s.end
+}
+
+// next 下一个赛季的开始时间，表达式不再触发时返回最大时间
+func (s *Season) next(t time.Time) time.Time {
+	next := s.expr.Next(t)
+	if next.IsZero() {
+		return time.Unix(1<<62, 0)
+	}
+	return next
+}
+
+type boardOptions struct {
+	layout    *Layout
+	season    *Season
+	prefix    string
+	retention time.Duration
+}
+
+// BoardOption 排行榜配置项
+type BoardOption func(o *boardOptions)
+
+func newBoardOptions(opts ...BoardOption) (*boardOptions, error) {
+	o := &boardOptions{
+		layout:    DefaultLayout,
+		prefix:    "grank:",
+		retention: 7 * 24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := o.layout.validate(); err != nil {
+		return nil, err
+	}
+	if o.layout.TimeBits > 0 {
+		if o.season != nil {
+			// 赛季长度超出时间位数时赛季后段无法比较先后
+			start, end := o.season.At(time.Now())
+			if end.Unix()-start.Unix() > int64(1)<<o.layout.TimeBits-1 {
+				return nil, ErrTimeBits
+			}
+		}
+	}
+	return o, nil
+}
+
+// needEpoch 比较时间且未设置赛季时是否缺少计时起点
+func (o *boardOptions) needEpoch() bool {
+	return o.layout.TimeBits > 0 && o.season == nil && o.layout.Epoch == 0
+}
+
+// defaultEpoch 缺少计时起点时从创建时开始计时，不修改调用方传入的Layout
+// 以1970年为起点时时间部分恒为0
+func (o *boardOptions) defaultEpoch() {
+	if !o.needEpoch() {
+		return
+	}
+	layout := *o.layout
+	layout.Epoch = time.Now().Unix()
+	o.layout = &layout
+}
+
+// WithLayout 设置复合分数的位布局，默认DefaultLayout
+func WithLayout(layout *Layout) BoardOption {
+	return func(o *boardOptions) {
+		o.layout = layout
+	}
+}
+
+// WithSeason 设置赛季，新赛季开始时排行榜自动清空
+func WithSeason(season *Season) BoardOption {
+	return func(o *boardOptions) {
+		o.season = season
+	}
+}
+
+// WithPrefix 设置redis key前缀，默认"grank:"
+func WithPrefix(prefix string) BoardOption {
+	return func(o *boardOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithRetention 设置赛季结束后redis中旧赛季排行榜的保留时间，默认7天
+func WithRetention(retention time.Duration) BoardOption {
+	return func(o *boardOptions) {
+		o.retention = retention
+	}
+}
+
+// seasonAt 返回now所在赛季的开始时间与结束时间，未设置赛季时开始时间为Layout.Epoch，结束时间为零值
+func (o *boardOptions) seasonAt(now time.Time) (start, end time.Time) {
+	if o.season == nil {
+		return time.Unix(o.layout.Epoch, 0), time.Time{}
+	}
+	return o.season.At(now)
+}
@@ -0,0 +1,194 @@
+package grank
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/qiafan666/gotato/commons/stores/redis_cli"
+)
+
+// testBoards 以相同配置创建内存与redis排行榜，两者的结果应一致
+func testBoards(t *testing.T, opts ...BoardOption) map[string]ILeaderboard {
+	s := miniredis.RunT(t)
+	rds := redis_cli.MustNewRedis(redis_cli.RedisConf{Host: s.Addr(), Type: redis_cli.NodeType})
+	mem, err := NewMemBoard("test", nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisBoard, err := NewRedisBoard(rds, "test", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]ILeaderboard{"mem": mem, "redis": redisBoard}
+}
+
+func ids(items []*Item) []int64 {
+	res := make([]int64, len(items))
+	for i, item := range items {
+		res[i] = item.ID
+	}
+	return res
+}
+
+func equalIds(a []int64, b ...int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLeaderboard(t *testing.T) {
+	ctx := context.Background()
+	for name, board := range testBoards(t, WithLayout(&Layout{Bits: []uint8{20, 12}})) {
+		t.Run(name, func(t *testing.T) {
+			for id := int64(1); id <= 5; id++ {
+				if _, err := board.Put(ctx, id, id*10, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 第一分量相同时比较第二分量
+			if place, err := board.Put(ctx, 6, 30, 1); err != nil || place != 3 {
+				t.Fatalf("put 6: place %d, err %v", place, err)
+			}
+			if place, err := board.Incr(ctx, 1, 45); err != nil || place != 1 {
+				t.Fatalf("incr 1: place %d, err %v", place, err)
+			}
+			item, err := board.Get(ctx, 1)
+			if err != nil || item.Place != 1 || item.Scores[0] != 55 || item.Scores[1] != 0 {
+				t.Fatalf("get 1: %+v, err %v", item, err)
+			}
+			if item, _ = board.Get(ctx, 100); item != nil {
+				t.Fatalf("get 100: %+v", item)
+			}
+
+			page, _ := board.Page(ctx, 1, 3)
+			if !equalIds(ids(page), 1, 5, 4) || page[2].Place != 3 {
+				t.Fatalf("page: %v", ids(page))
+			}
+			around, _ := board.Around(ctx, 3, 1)
+			if !equalIds(ids(around), 6, 3, 2) {
+				t.Fatalf("around: %v", ids(around))
+			}
+			if total, _ := board.Total(ctx); total != 6 {
+				t.Fatalf("total %d", total)
+			}
+
+			if _, err = board.Put(ctx, 7, 1<<20, 0); !errors.Is(err, ErrScoreRange) {
+				t.Fatalf("want ErrScoreRange, got %v", err)
+			}
+			if _, err = board.Incr(ctx, 1, -100); !errors.Is(err, ErrScoreRange) {
+				t.Fatalf("want ErrScoreRange, got %v", err)
+			}
+			if _, err = board.Put(ctx, 7, 1); !errors.Is(err, ErrScoreCount) {
+				t.Fatalf("want ErrScoreCount, got %v", err)
+			}
+
+			if err = board.Del(ctx, 1); err != nil {
+				t.Fatal(err)
+			}
+			if page, _ = board.Page(ctx, 1, 1); !equalIds(ids(page), 5) {
+				t.Fatalf("page after del: %v", ids(page))
+			}
+			if err = board.Reset(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if total, _ := board.Total(ctx); total != 0 {
+				t.Fatalf("total after reset %d", total)
+			}
+		})
+	}
+}
+
+// TestTieBreak 分数相同时先达到的排名靠前
+func TestTieBreak(t *testing.T) {
+	ctx := context.Background()
+	layout := &Layout{Bits: []uint8{32}, TimeBits: 21, Epoch: time.Now().Add(-time.Hour).Unix()}
+	for name, board := range testBoards(t, WithLayout(layout)) {
+		t.Run(name, func(t *testing.T) {
+			board.Put(ctx, 2, 100)
+			time.Sleep(1100 * time.Millisecond)
+			board.Put(ctx, 1, 100)
+			board.Incr(ctx, 3, 100)
+			page, _ := board.Page(ctx, 1, 3)
+			if !equalIds(ids(page)[:1], 2) {
+				t.Fatalf("page: %v", ids(page))
+			}
+		})
+	}
+}
+
+// TestTieBreakDefaultLayout 默认布局未设置Epoch时内存排行榜同样按先后排名，redis排行榜需指定Epoch
+func TestTieBreakDefaultLayout(t *testing.T) {
+	ctx := context.Background()
+	board, err := NewMemBoard("test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	board.Put(ctx, 1, 100)
+	time.Sleep(1100 * time.Millisecond)
+	board.Put(ctx, 2, 100)
+	page, _ := board.Page(ctx, 1, 2)
+	if !equalIds(ids(page), 1, 2) {
+		t.Fatalf("page: %v", ids(page))
+	}
+	if DefaultLayout.Epoch != 0 {
+		t.Fatal("DefaultLayout should not be modified")
+	}
+
+	s := miniredis.RunT(t)
+	rds := redis_cli.MustNewRedis(redis_cli.RedisConf{Host: s.Addr(), Type: redis_cli.NodeType})
+	if _, err = NewRedisBoard(rds, "test"); err != ErrEpochRequired {
+		t.Fatalf("want ErrEpochRequired, got %v", err)
+	}
+	if _, err = NewRedisBoard(rds, "test", WithLayout(&Layout{Bits: []uint8{32}})); err != nil {
+		t.Fatalf("layout without time: %v", err)
+	}
+	// 月赛季超出默认布局21位时间可表示的范围
+	season, _ := NewSeason("0 0 1 * *", time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local))
+	if _, err := NewMemBoard("test", nil, WithSeason(season)); err != ErrTimeBits {
+		t.Fatalf("want ErrTimeBits, got %v", err)
+	}
+}
+
+func TestSeason(t *testing.T) {
+	season, err := NewSeason("0 0 * * 1", time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, end := season.At(time.Date(2024, 3, 6, 12, 0, 0, 0, time.Local))
+	if !start.Equal(time.Date(2024, 3, 4, 0, 0, 0, 0, time.Local)) || !end.Equal(start.AddDate(0, 0, 7)) {
+		t.Fatalf("season %v - %v", start, end)
+	}
+	// 时间回退时重新计算
+	start, _ = season.At(time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local))
+	if !start.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("season start %v", start)
+	}
+
+	ctx := context.Background()
+	// 每秒一个赛季
+	season, _ = NewSeason("* * * * * *", time.Now().Truncate(time.Second))
+	for name, board := range testBoards(t, WithSeason(season)) {
+		t.Run(name, func(t *testing.T) {
+			board.Put(ctx, 1, 100)
+			time.Sleep(1100 * time.Millisecond)
+			if total, _ := board.Total(ctx); total != 0 {
+				t.Fatalf("new season total %d", total)
+			}
+			if rb, ok := board.(*RedisBoard); ok {
+				page, _ := rb.PageAt(ctx, time.Now().Add(-time.Second), 1, 10)
+				if !equalIds(ids(page), 1) {
+					t.Fatalf("last season page %v", ids(page))
+				}
+			}
+		})
+	}
+}
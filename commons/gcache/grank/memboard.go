@@ -0,0 +1,168 @@
+package grank
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var _ ILeaderboard = (*MemBoard)(nil)
+
+// MemBoard 基于List的内存排行榜 goroutine safe
+type MemBoard struct {
+	lock   sync.Mutex
+	list   *List
+	opts   *boardOptions
+	season time.Time // 当前数据所属赛季的开始时间
+}
+
+// NewMemBoard 使用已有的List创建内存排行榜，如从数据库加载的List，list为nil时新建
+// List中已有条目的Score需是按相同Layout编码的分数
+func NewMemBoard(typ string, list *List, opts ...BoardOption) (*MemBoard, error) {
+	o, err := newBoardOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	o.defaultEpoch()
+	if list == nil {
+		list = newRankList(typ)
+	}
+	m := &MemBoard{list: list, opts: o}
+	m.season, _ = o.seasonAt(time.Now())
+	return m, nil
+}
+
+// Board 获取或创建指定类型的内存排行榜，与Mgr共用同一个List
+// Mgr本身不是goroutine safe，通过MemBoard访问时不能再直接调用Mgr的方法修改该排行榜
+func (mgr *Mgr) Board(typ string, opts ...BoardOption) (*MemBoard, error) {
+	mgr.NewRankList(typ)
+	return NewMemBoard(typ, mgr.Ranks[typ], opts...)
+}
+
+// List 返回底层的List，用于持久化，调用方需保证此时没有并发修改
+func (m *MemBoard) List() *List {
+	return m.list
+}
+
+// roll 进入新赛季时清空排行榜，返回赛季开始时间
+func (m *MemBoard) roll(now time.Time) time.Time {
+	start, _ := m.opts.seasonAt(now)
+	if !start.Equal(m.season) {
+		m.season = start
+		m.reset()
+	}
+	return start
+}
+
+func (m *MemBoard) reset() {
+	m.list.Items = m.list.Items[:0]
+	m.list.ID2Idx = make(map[int64]int32, DefRankCount)
+}
+
+func (m *MemBoard) Put(_ context.Context, id int64, scores ...int64) (int32, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	start := m.roll(now)
+	v, err := m.opts.layout.encode(scores, now.Unix()-start.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return m.list.put(id, v, nil), nil
+}
+
+func (m *MemBoard) Incr(_ context.Context, id int64, deltas ...int64) (int32, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	start := m.roll(now)
+	layout := m.opts.layout
+	if len(deltas) > len(layout.Bits) {
+		return 0, ErrScoreCount
+	}
+	scores := make([]int64, len(layout.Bits))
+	if item := m.list.get(id); item != nil {
+		scores = layout.decode(item.Score)
+	}
+	for i, d := range deltas {
+		scores[i] += d
+	}
+	v, err := layout.encode(scores, now.Unix()-start.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return m.list.put(id, v, nil), nil
+}
+
+func (m *MemBoard) Get(_ context.Context, id int64) (*Item, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.roll(time.Now())
+	item := m.list.get(id)
+	if item == nil {
+		return nil, nil
+	}
+	return m.clone(item), nil
+}
+
+func (m *MemBoard) Del(_ context.Context, id int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.roll(time.Now())
+	m.list.del(id)
+	return nil
+}
+
+func (m *MemBoard) Total(_ context.Context) (int32, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.roll(time.Now())
+	return int32(len(m.list.Items)), nil
+}
+
+func (m *MemBoard) Page(_ context.Context, start, stop int32) ([]*Item, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.roll(time.Now())
+	return m.page(start, stop), nil
+}
+
+func (m *MemBoard) Around(_ context.Context, id int64, n int32) ([]*Item, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.roll(time.Now())
+	item := m.list.get(id)
+	if item == nil {
+		return nil, nil
+	}
+	return m.page(item.Place-n, item.Place+n), nil
+}
+
+func (m *MemBoard) Reset(_ context.Context) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.roll(time.Now())
+	m.reset()
+	return nil
+}
+
+// page 复制名次在[start, stop]之间的条目
+func (m *MemBoard) page(start, stop int32) []*Item {
+	start = max(start, 1)
+	if stop < start {
+		return nil
+	}
+	items := m.list.seePage(start-1, stop-start+1)
+	res := make([]*Item, len(items))
+	for i, item := range items {
+		res[i] = m.clone(item)
+	}
+	return res
+}
+
+// clone 复制条目并解出各分数分量，避免调用方在锁外读到被修改的条目
+func (m *MemBoard) clone(item *Item) *Item {
+	c := *item
+	c.Scores = m.opts.layout.decode(item.Score)
+	return &c
+}
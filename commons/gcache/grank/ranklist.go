@@ -11,6 +11,7 @@ type Item struct {
 	Score     int64
 	Place     int32 // 排名
 	ExtraData any
+	Scores    []int64 `bson:"-"` // 复合分数的各分量，仅ILeaderboard返回的条目有值
 }
 
 // ItemList 用于排序
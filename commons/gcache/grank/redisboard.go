@@ -0,0 +1,221 @@
+package grank
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/stores/redis_cli"
+)
+
+var _ ILeaderboard = (*RedisBoard)(nil)
+
+// incrScript 在redis中解出各分数分量并累加，重新拼接更新时间后写回，返回0开始的倒序名次
+// ARGV: member, timePart, 之后每3个参数为一个分量的 shift, bits, delta
+var incrScript = redis_cli.NewScript(`
+local v = tonumber(redis.call('ZSCORE', KEYS[1], ARGV[1]) or '0')
+local total = tonumber(ARGV[2])
+for i = 3, #ARGV, 3 do
+	local shift, size, delta = 2 ^ tonumber(ARGV[i]), 2 ^ tonumber(ARGV[i + 1]), tonumber(ARGV[i + 2])
+	local c = math.floor(v / shift) % size + delta
+	if c < 0 or c >= size then
+		return redis.error_reply('grank: score out of range')
+	end
+	total = total + c * shift
+end
+redis.call('ZADD', KEYS[1], string.format('%.0f', total), ARGV[1])
+return redis.call('ZREVRANK', KEYS[1], ARGV[1])
+`)
+
+// RedisBoard 基于redis有序集合的排行榜，多个节点可同时读写同一个排行榜 goroutine safe
+// 设置赛季时每个赛季使用单独的key，旧赛季的key在赛季结束后保留WithRetention设置的时间
+type RedisBoard struct {
+	rds  *redis_cli.Redis
+	typ  string
+	opts *boardOptions
+
+	lock    sync.Mutex
+	expired time.Time // 已设置过期时间的赛季开始时间
+}
+
+// NewRedisBoard 创建redis排行榜，typ为排行榜类型，与前缀、赛季开始时间组成redis key
+// Layout比较时间且未设置赛季时需指定Epoch，否则返回ErrEpochRequired
+func NewRedisBoard(rds *redis_cli.Redis, typ string, opts ...BoardOption) (*RedisBoard, error) {
+	o, err := newBoardOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	// 各进程创建时间不同，以创建时间为起点会使不同进程写入的时间部分无法比较
+	if o.needEpoch() {
+		return nil, ErrEpochRequired
+	}
+	return &RedisBoard{rds: rds, typ: typ, opts: o}, nil
+}
+
+// Key 返回t所在赛季的redis key，可用于读取旧赛季的排行榜
+func (r *RedisBoard) Key(t time.Time) string {
+	if r.opts.season == nil {
+		return r.opts.prefix + r.typ
+	}
+	start, _ := r.opts.season.At(t)
+	return r.opts.prefix + r.typ + ":" + strconv.FormatInt(start.Unix(), 10)
+}
+
+// current 返回当前赛季的key与开始、结束时间
+func (r *RedisBoard) current() (string, time.Time, time.Time) {
+	now := time.Now()
+	start, end := r.opts.seasonAt(now)
+	return r.Key(now), start, end
+}
+
+// touch 写入后为当前赛季的key设置过期时间，每个赛季只设置一次
+func (r *RedisBoard) touch(ctx context.Context, key string, start, end time.Time) error {
+	if r.opts.season == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.expired.Equal(start) {
+		return nil
+	}
+	if err := r.rds.ExpireatCtx(ctx, key, end.Add(r.opts.retention).Unix()); err != nil {
+		return err
+	}
+	r.expired = start
+	return nil
+}
+
+func (r *RedisBoard) Put(ctx context.Context, id int64, scores ...int64) (int32, error) {
+	key, start, end := r.current()
+	v, err := r.opts.layout.encode(scores, time.Now().Unix()-start.Unix())
+	if err != nil {
+		return 0, err
+	}
+	member := strconv.FormatInt(id, 10)
+	if _, err = r.rds.ZaddCtx(ctx, key, v, member); err != nil {
+		return 0, err
+	}
+	if err = r.touch(ctx, key, start, end); err != nil {
+		return 0, err
+	}
+	rank, err := r.rds.ZrevrankCtx(ctx, key, member)
+	if err != nil {
+		return 0, err
+	}
+	return int32(rank) + 1, nil
+}
+
+func (r *RedisBoard) Incr(ctx context.Context, id int64, deltas ...int64) (int32, error) {
+	layout := r.opts.layout
+	if len(deltas) > len(layout.Bits) {
+		return 0, ErrScoreCount
+	}
+	key, start, end := r.current()
+	args := []any{id, layout.timePart(time.Now().Unix() - start.Unix())}
+	for i, b := range layout.Bits {
+		var delta int64
+		if i < len(deltas) {
+			delta = deltas[i]
+		}
+		args = append(args, layout.shift(i), b, delta)
+	}
+	rank, err := r.rds.ScriptRunCtx(ctx, incrScript, []string{key}, args...)
+	if err != nil {
+		if err.Error() == ErrScoreRange.Error() {
+			return 0, ErrScoreRange
+		}
+		return 0, err
+	}
+	if err = r.touch(ctx, key, start, end); err != nil {
+		return 0, err
+	}
+	return int32(rank.(int64)) + 1, nil
+}
+
+func (r *RedisBoard) Get(ctx context.Context, id int64) (*Item, error) {
+	key, _, _ := r.current()
+	member := strconv.FormatInt(id, 10)
+	score, err := r.rds.ZscoreCtx(ctx, key, member)
+	if errors.Is(err, redis_cli.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rank, err := r.rds.ZrevrankCtx(ctx, key, member)
+	if errors.Is(err, redis_cli.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Item{ID: id, Score: score, Place: int32(rank) + 1, Scores: r.opts.layout.decode(score)}, nil
+}
+
+func (r *RedisBoard) Del(ctx context.Context, id int64) error {
+	key, _, _ := r.current()
+	_, err := r.rds.ZremCtx(ctx, key, strconv.FormatInt(id, 10))
+	return err
+}
+
+func (r *RedisBoard) Total(ctx context.Context) (int32, error) {
+	key, _, _ := r.current()
+	n, err := r.rds.ZcardCtx(ctx, key)
+	return int32(n), err
+}
+
+func (r *RedisBoard) Page(ctx context.Context, start, stop int32) ([]*Item, error) {
+	key, _, _ := r.current()
+	return r.page(ctx, key, start, stop)
+}
+
+// PageAt 获取t所在赛季的排行榜中名次在[start, stop]之间的条目，用于发放上个赛季的奖励等
+func (r *RedisBoard) PageAt(ctx context.Context, t time.Time, start, stop int32) ([]*Item, error) {
+	return r.page(ctx, r.Key(t), start, stop)
+}
+
+func (r *RedisBoard) Around(ctx context.Context, id int64, n int32) ([]*Item, error) {
+	key, _, _ := r.current()
+	rank, err := r.rds.ZrevrankCtx(ctx, key, strconv.FormatInt(id, 10))
+	if errors.Is(err, redis_cli.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	place := int32(rank) + 1
+	return r.page(ctx, key, place-n, place+n)
+}
+
+func (r *RedisBoard) Reset(ctx context.Context) error {
+	key, _, _ := r.current()
+	_, err := r.rds.DelCtx(ctx, key)
+	if err == nil {
+		r.lock.Lock()
+		r.expired = time.Time{}
+		r.lock.Unlock()
+	}
+	return err
+}
+
+func (r *RedisBoard) page(ctx context.Context, key string, start, stop int32) ([]*Item, error) {
+	start = max(start, 1)
+	if stop < start {
+		return nil, nil
+	}
+	pairs, err := r.rds.ZrevrangeWithScoresCtx(ctx, key, int64(start-1), int64(stop-1))
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*Item, 0, len(pairs))
+	for i, p := range pairs {
+		id, err := strconv.ParseInt(p.Key, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &Item{ID: id, Score: p.Score, Place: start + int32(i), Scores: r.opts.layout.decode(p.Score)})
+	}
+	return items, nil
+}
@@ -1,176 +1,224 @@
 package gcache
 
 import (
-	"crypto/rand"
-	"math"
-	"math/big"
-	insecurerand "math/rand"
-	"os"
+	"hash/maphash"
+	"io"
 	"runtime"
 	"time"
 )
 
-type unexportedShardedCache struct {
-	*shardedCache
-}
-
-type shardedCache struct {
-	seed    uint32
-	m       uint32
-	cs      []*cache
-	janitor *shardedJanitor
-}
-
-func djb33(seed uint32, k string) uint32 {
-	var (
-		l = uint32(len(k))
-		d = 5381 + seed + l
-		i = uint32(0)
-	)
-	if l >= 4 {
-		for i < l-4 {
-			d = (d * 33) ^ uint32(k[i])
-			d = (d * 33) ^ uint32(k[i+1])
-			d = (d * 33) ^ uint32(k[i+2])
-			d = (d * 33) ^ uint32(k[i+3])
-			i += 4
-		}
-	}
-	switch l - i {
-	case 1:
-	case 2:
-		d = (d * 33) ^ uint32(k[i])
-	case 3:
-		d = (d * 33) ^ uint32(k[i])
-		d = (d * 33) ^ uint32(k[i+1])
-	case 4:
-		d = (d * 33) ^ uint32(k[i])
-		d = (d * 33) ^ uint32(k[i+1])
-		d = (d * 33) ^ uint32(k[i+2])
-	}
-	return d ^ (d >> 16)
+// defaultShards NewShardedCache 未指定分片数时使用的分片数。
+const defaultShards = 16
+
+// ShardedCache 按键的哈希值分片的缓存，每个分片独立加锁，适合高并发写入的场景。
+type ShardedCache[K comparable, V any] struct {
+	*shardedCache[K, V]
+}
+
+type shardedCache[K comparable, V any] struct {
+	seed    maphash.Seed
+	cs      []*cache[K, V]
+	janitor *janitor
 }
 
-func (sc *shardedCache) bucket(k string) *cache {
-	return sc.cs[djb33(sc.seed, k)%sc.m]
+// bucket 返回键所在的分片。
+func (sc *shardedCache[K, V]) bucket(k K) *cache[K, V] {
+	return sc.cs[maphash.Comparable(sc.seed, k)%uint64(len(sc.cs))]
 }
 
-func (sc *shardedCache) Set(k string, x interface{}, d time.Duration) {
+// Set 在键所在的分片中设置一个键值对，参见 Cache.Set。
+func (sc *shardedCache[K, V]) Set(k K, x V, d time.Duration) {
 	sc.bucket(k).Set(k, x, d)
 }
 
-func (sc *shardedCache) Add(k string, x interface{}, d time.Duration) error {
+// SetDefault 使用默认过期时间设置一个键值对。
+func (sc *shardedCache[K, V]) SetDefault(k K, x V) {
+	sc.bucket(k).Set(k, x, DefaultExpiration)
+}
+
+// Add 添加一个新的键值对，如果键已存在，则返回错误。
+func (sc *shardedCache[K, V]) Add(k K, x V, d time.Duration) error {
 	return sc.bucket(k).Add(k, x, d)
 }
 
-func (sc *shardedCache) Replace(k string, x interface{}, d time.Duration) error {
+// Replace 替换已存在的键值对，如果键不存在，则返回错误。
+func (sc *shardedCache[K, V]) Replace(k K, x V, d time.Duration) error {
 	return sc.bucket(k).Replace(k, x, d)
 }
 
-func (sc *shardedCache) Get(k string) (interface{}, bool) {
+// Get 获取指定键的值。
+func (sc *shardedCache[K, V]) Get(k K) (V, bool) {
 	return sc.bucket(k).Get(k)
 }
 
-func (sc *shardedCache) Increment(k string, n int64) error {
-	return sc.bucket(k).Increment(k, n)
-}
-
-func (sc *shardedCache) IncrementFloat(k string, n float64) error {
-	return sc.bucket(k).IncrementFloat(k, n)
+// GetWithExpiration 获取指定键的值和过期时间。
+func (sc *shardedCache[K, V]) GetWithExpiration(k K) (V, time.Time, bool) {
+	return sc.bucket(k).GetWithExpiration(k)
 }
 
-func (sc *shardedCache) Decrement(k string, n int64) error {
-	return sc.bucket(k).Decrement(k, n)
+// Update 原子地更新指定键的值，参见 Cache.Update。
+func (sc *shardedCache[K, V]) Update(k K, fn func(v V) V) (V, error) {
+	return sc.bucket(k).Update(k, fn)
 }
 
-func (sc *shardedCache) Delete(k string) {
+// Delete 删除指定键。
+func (sc *shardedCache[K, V]) Delete(k K) {
 	sc.bucket(k).Delete(k)
 }
 
-func (sc *shardedCache) DeleteExpired() {
+// DeleteExpired 删除所有分片中过期的键值对。
+func (sc *shardedCache[K, V]) DeleteExpired() {
 	for _, v := range sc.cs {
 		v.DeleteExpired()
 	}
 }
 
-func (sc *shardedCache) Items() []map[string]Item {
-	res := make([]map[string]Item, len(sc.cs))
-	for i, v := range sc.cs {
-		res[i] = v.Items()
+// OnEvicted 设置所有分片中键值对被移除时的回调函数。
+func (sc *shardedCache[K, V]) OnEvicted(f func(K, V)) {
+	for _, v := range sc.cs {
+		v.OnEvicted(f)
 	}
-	return res
 }
 
-func (sc *shardedCache) Flush() {
+// SetMaxEntries 设置最大键数，平均分配到每个分片，0 表示不限制。
+func (sc *shardedCache[K, V]) SetMaxEntries(n int) {
+	per := sc.perShard(int64(n))
 	for _, v := range sc.cs {
-		v.Flush()
+		v.SetMaxEntries(int(per))
+	}
+}
+
+// SetMaxBytes 设置最大估算字节数，平均分配到每个分片，0 表示不限制，参见 Cache.SetMaxBytes。
+func (sc *shardedCache[K, V]) SetMaxBytes(n int64, sizer func(k K, v V) int64) {
+	per := sc.perShard(n)
+	for _, v := range sc.cs {
+		v.SetMaxBytes(per, sizer)
+	}
+}
+
+// perShard 每个分片分到的容量，向上取整。
+func (sc *shardedCache[K, V]) perShard(n int64) int64 {
+	if n <= 0 {
+		return 0
 	}
+	shards := int64(len(sc.cs))
+	return (n + shards - 1) / shards
 }
 
-type shardedJanitor struct {
-	Interval time.Duration
-	stop     chan bool
+// Stats 返回所有分片的统计之和。
+func (sc *shardedCache[K, V]) Stats() Stats {
+	var s Stats
+	for _, v := range sc.cs {
+		cs := v.Stats()
+		s.Hits += cs.Hits
+		s.Misses += cs.Misses
+		s.Evictions += cs.Evictions
+		s.Expired += cs.Expired
+	}
+	return s
 }
 
-func (j *shardedJanitor) Run(sc *shardedCache) {
-	j.stop = make(chan bool)
-	tick := time.Tick(j.Interval)
-	for {
-		select {
-		case <-tick:
-			sc.DeleteExpired()
-		case <-j.stop:
-			return
+// Items 返回所有分片中未过期的键值对。
+func (sc *shardedCache[K, V]) Items() map[K]Item[V] {
+	res := make(map[K]Item[V])
+	for _, v := range sc.cs {
+		for k, item := range v.Items() {
+			res[k] = item
 		}
 	}
+	return res
 }
 
-func stopShardedJanitor(sc *unexportedShardedCache) {
-	sc.janitor.stop <- true
+// ItemCount 返回所有分片中键值对的数量。
+func (sc *shardedCache[K, V]) ItemCount() int {
+	n := 0
+	for _, v := range sc.cs {
+		n += v.ItemCount()
+	}
+	return n
+}
+
+// Flush 清空所有分片。
+func (sc *shardedCache[K, V]) Flush() {
+	for _, v := range sc.cs {
+		v.Flush()
+	}
 }
 
-func runShardedJanitor(sc *shardedCache, ci time.Duration) {
-	j := &shardedJanitor{
-		Interval: ci,
+// Save 将所有分片的内容保存到 w 中，格式与 Cache.Save 相同。
+func (sc *shardedCache[K, V]) Save(w io.Writer) error {
+	items := make(map[K]Item[V])
+	for _, v := range sc.cs {
+		v.mu.RLock()
+		for k, ce := range v.items {
+			items[k] = ce.item
+		}
+		v.mu.RUnlock()
 	}
-	sc.janitor = j
-	go j.Run(sc)
+	return saveItems(w, items)
+}
+
+// SaveFile 将所有分片的内容保存到指定的文件中。
+func (sc *shardedCache[K, V]) SaveFile(fName string) error {
+	return saveFile(fName, sc.Save)
 }
 
-func newShardedCache(n int, de time.Duration) *shardedCache {
-	maxUint32 := big.NewInt(0).SetUint64(uint64(math.MaxUint32))
-	rnd, err := rand.Int(rand.Reader, maxUint32)
-	var seed uint32
+// Load 从 r 中加载缓存内容并分配到各个分片，可以加载 Cache.Save 保存的内容。
+func (sc *shardedCache[K, V]) Load(r io.Reader) error {
+	items, err := loadItems[K, V](r)
 	if err != nil {
-		os.Stderr.Write([]byte("WARNING: go-cache's newShardedCache failed to read from the system CSPRNG (/dev/urandom or equivalent.) Your system's security may be compromised. Continuing with an insecure seed.\n"))
-		seed = insecurerand.Uint32()
-	} else {
-		seed = uint32(rnd.Uint64())
+		return err
 	}
-	sc := &shardedCache{
-		seed: seed,
-		m:    uint32(n),
-		cs:   make([]*cache, n),
+	buckets := make(map[*cache[K, V]]map[K]Item[V], len(sc.cs))
+	for k, item := range items {
+		c := sc.bucket(k)
+		if buckets[c] == nil {
+			buckets[c] = make(map[K]Item[V])
+		}
+		buckets[c][k] = item
+	}
+	for c, m := range buckets {
+		c.mu.Lock()
+		c.load(m)
+		c.unlockAndNotify()
+	}
+	return nil
+}
+
+// LoadFile 从指定的文件中加载缓存内容。
+func (sc *shardedCache[K, V]) LoadFile(fName string) error {
+	return loadFile(fName, sc.Load)
+}
+
+func stopShardedJanitor[K comparable, V any](sc *ShardedCache[K, V]) {
+	sc.janitor.stop <- true
+}
+
+func newShardedCache[K comparable, V any](n int, de time.Duration) *shardedCache[K, V] {
+	sc := &shardedCache[K, V]{
+		seed: maphash.MakeSeed(),
+		cs:   make([]*cache[K, V], n),
 	}
 	for i := 0; i < n; i++ {
-		c := &cache{
-			defaultExpiration: de,
-			items:             map[string]Item{},
-		}
-		sc.cs[i] = c
+		sc.cs[i] = newCache[K, V](de, nil)
 	}
 	return sc
 }
 
-func unexportedNewSharded(defaultExpiration, cleanupInterval time.Duration, shards int) *unexportedShardedCache {
-	if defaultExpiration == 0 {
-		defaultExpiration = -1
+// NewShardedCache 创建一个分片缓存，并启动 janitor。
+// 参数：
+// - defaultExpiration: 默认过期时间。
+// - cleanupInterval: 定期清理过期缓存的时间间隔。
+// - shards: 分片数，小于等于 0 时使用 16。
+func NewShardedCache[K comparable, V any](defaultExpiration, cleanupInterval time.Duration, shards int) *ShardedCache[K, V] {
+	if shards <= 0 {
+		shards = defaultShards
 	}
-	sc := newShardedCache(shards, defaultExpiration)
-	SC := &unexportedShardedCache{sc}
+	sc := newShardedCache[K, V](shards, defaultExpiration)
+	SC := &ShardedCache[K, V]{sc}
 	if cleanupInterval > 0 {
-		runShardedJanitor(sc, cleanupInterval)
-		runtime.SetFinalizer(SC, stopShardedJanitor)
+		sc.janitor = runJanitor(cleanupInterval, sc.DeleteExpired)
+		runtime.SetFinalizer(SC, stopShardedJanitor[K, V])
 	}
 	return SC
 }
@@ -6,5 +6,5 @@ import (
 
 // IClient grpc 客户端调用接口
 type IClient interface {
-	Do(ctx context.Context, request *Message) (*Message, error)
+	Do(ctx context.Context, request *Message, opts ...CallOption) (*Message, error)
 }
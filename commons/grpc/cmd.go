@@ -5,4 +5,7 @@ type Command uint32
 const (
 	CmdHeartbeat Command = 0
 	CmdTestLogic Command = 1
+
+	CmdHandshake Command = 0xFFFFFFFF // 连接认证握手，保留命令
+	CmdKick      Command = 0xFFFFFFFE // 服务端踢下线通知，body为原因，保留命令
 )
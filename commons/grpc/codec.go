@@ -0,0 +1,146 @@
+package grpc
+
+import (
+	"sync"
+
+	"github.com/qiafan666/gotato/commons/gcompress"
+	"github.com/qiafan666/gotato/commons/gerr"
+	"github.com/qiafan666/gotato/commons/gson"
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+)
+
+// 内置编码名，通过元数据MetaCodec协商，未指定时为json
+const (
+	CodecJSON    = "json"
+	CodecProto   = "proto"
+	CodecMsgpack = "msgpack"
+	CodecGob     = "gob"
+)
+
+// MetaCodec 请求body编码方式的元数据key，服务端按请求的编码回复
+const MetaCodec = "grpc-codec"
+
+// ICodec body编解码接口
+type ICodec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	codecMu sync.RWMutex
+	codecs  = make(map[string]ICodec)
+)
+
+func init() {
+	RegisterCodec(jsonCodec{})
+	RegisterCodec(protoCodec{})
+	RegisterCodec(newMsgpackCodec())
+	RegisterCodec(gobCodec{encoder: gcompress.NewGobEncoder()})
+}
+
+// RegisterCodec 注册编码，同名覆盖
+func RegisterCodec(c ICodec) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	codecs[c.Name()] = c
+}
+
+// GetCodec 按名字获取编码，name为空时返回json
+func GetCodec(name string) (ICodec, bool) {
+	if name == "" {
+		name = CodecJSON
+	}
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	c, ok := codecs[name]
+	return c, ok
+}
+
+// MessageCodec 消息使用的编码
+func MessageCodec(msg *Message) (ICodec, error) {
+	name := msg.Metadata.Get(MetaCodec)
+	c, ok := GetCodec(name)
+	if !ok {
+		return nil, gerr.New("unsupported codec", "codec", name)
+	}
+	return c, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return CodecJSON
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return gson.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return gson.Unmarshal(data, v)
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Name() string {
+	return CodecProto
+}
+
+func (protoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, gerr.New("proto codec: value is not proto.Message")
+	}
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return gerr.New("proto codec: value is not proto.Message")
+	}
+	return proto.Unmarshal(data, m)
+}
+
+type msgpackCodec struct {
+	handle *codec.MsgpackHandle
+}
+
+func newMsgpackCodec() msgpackCodec {
+	h := &codec.MsgpackHandle{}
+	h.RawToString = true
+	h.WriteExt = true
+	return msgpackCodec{handle: h}
+}
+
+func (msgpackCodec) Name() string {
+	return CodecMsgpack
+}
+
+func (c msgpackCodec) Marshal(v any) ([]byte, error) {
+	var data []byte
+	err := codec.NewEncoderBytes(&data, c.handle).Encode(v)
+	return data, err
+}
+
+func (c msgpackCodec) Unmarshal(data []byte, v any) error {
+	return codec.NewDecoderBytes(data, c.handle).Decode(v)
+}
+
+type gobCodec struct {
+	encoder gcompress.IEncoder
+}
+
+func (gobCodec) Name() string {
+	return CodecGob
+}
+
+func (c gobCodec) Marshal(v any) ([]byte, error) {
+	return c.encoder.Encode(v)
+}
+
+func (c gobCodec) Unmarshal(data []byte, v any) error {
+	return c.encoder.Decode(data, v)
+}
@@ -0,0 +1,117 @@
+package grpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/qiafan666/gotato/commons/gcompress"
+	"github.com/qiafan666/gotato/commons/gerr"
+)
+
+// 内置压缩算法
+const (
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+// MetaCompress body压缩算法的元数据key，由协议层在编码时写入、解码时移除
+const MetaCompress = "grpc-compress"
+
+// ICompressor body压缩接口
+type ICompressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// ILimitedDecompressor 可限制解压后长度的压缩算法，协议层解码时优先使用，防止压缩炸弹
+type ILimitedDecompressor interface {
+	DecompressLimit(data []byte, limit int) ([]byte, error)
+}
+
+var (
+	compressorMu sync.RWMutex
+	compressors  = make(map[string]ICompressor)
+)
+
+func init() {
+	RegisterCompressor(gzipCompressor{compressor: gcompress.NewGzipCompressor()})
+	RegisterCompressor(zstdCompressor{})
+}
+
+// RegisterCompressor 注册压缩算法，同名覆盖
+func RegisterCompressor(c ICompressor) {
+	compressorMu.Lock()
+	defer compressorMu.Unlock()
+	compressors[c.Name()] = c
+}
+
+// GetCompressor 按名字获取压缩算法
+func GetCompressor(name string) (ICompressor, bool) {
+	compressorMu.RLock()
+	defer compressorMu.RUnlock()
+	c, ok := compressors[name]
+	return c, ok
+}
+
+type gzipCompressor struct {
+	compressor gcompress.ICompressor
+}
+
+func (gzipCompressor) Name() string {
+	return CompressGzip
+}
+
+func (c gzipCompressor) Compress(data []byte) ([]byte, error) {
+	return c.compressor.CompressWithPool(data)
+}
+
+func (c gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	return c.compressor.DecompressWithPool(data)
+}
+
+func (gzipCompressor) DecompressLimit(data []byte, limit int) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, gerr.WrapMsg(err, "gzip reader init fail")
+	}
+	defer reader.Close()
+	ret, err := io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+	if err != nil {
+		return nil, gerr.WrapMsg(err, "gzip decompress fail")
+	}
+	if len(ret) > limit {
+		return nil, gerr.New("gzip decompressed data too long", "limit", limit)
+	}
+	return ret, nil
+}
+
+type zstdCompressor struct{}
+
+func (zstdCompressor) Name() string {
+	return CompressZstd
+}
+
+func (zstdCompressor) Compress(data []byte) ([]byte, error) {
+	return gcompress.ZstdEncode(data), nil
+}
+
+func (zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	return gcompress.ZstdDecode(data)
+}
+
+func (zstdCompressor) DecompressLimit(data []byte, limit int) ([]byte, error) {
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true), zstd.WithDecoderMaxMemory(uint64(limit)))
+	if err != nil {
+		return nil, gerr.WrapMsg(err, "zstd decoder init fail")
+	}
+	defer decoder.Close()
+	ret, err := decoder.DecodeAll(data, nil)
+	if err != nil {
+		return nil, gerr.WrapMsg(err, "zstd decompress fail", "limit", limit)
+	}
+	return ret, nil
+}
@@ -0,0 +1,32 @@
+// grpcgen 根据YAML IDL或protobuf service生成grpc命令常量、服务端接口与客户端方法
+//
+//	go run github.com/qiafan666/gotato/commons/grpc/grpcgen/cmd/grpcgen -in chat.yaml -test
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/qiafan666/gotato/commons/grpc/grpcgen"
+)
+
+func main() {
+	in := flag.String("in", "", "IDL文件,.yaml/.yml或.proto")
+	out := flag.String("out", "", "输出目录,默认与IDL文件相同")
+	withTest := flag.Bool("test", false, "同时生成本地回环测试")
+	flag.Parse()
+
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	files, err := grpcgen.Run(*in, *out, *withTest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "grpcgen: %+v\n", err)
+		os.Exit(1)
+	}
+	for _, file := range files {
+		fmt.Println(file)
+	}
+}
@@ -0,0 +1,107 @@
+// Code generated by grpcgen. DO NOT EDIT.
+// source: chat.yaml
+
+package example
+
+import (
+	"context"
+	"github.com/qiafan666/gotato/commons/grpc"
+	"time"
+)
+
+const (
+	CmdChatLogin       grpc.Command = 1001 // 登录
+	CmdChatSendMessage grpc.Command = 1002 // 发送消息到房间
+	CmdRoomList        grpc.Command = 1101
+)
+
+type LoginReq struct {
+	UserId string `json:"user_id"`
+	Token  string `json:"token"`
+}
+
+type LoginResp struct {
+	Nickname string `json:"nickname"`
+}
+
+// SendMessageReq 房间消息
+type SendMessageReq struct {
+	RoomId  int64  `json:"room_id"` // 房间ID
+	Content string `json:"content"`
+}
+
+type SendMessageResp struct {
+	MsgId int64 `json:"id"`
+}
+
+type ListRoomReq struct {
+}
+
+type ListRoomResp struct {
+	Rooms []*Room `json:"rooms"`
+}
+
+type Room struct {
+	Id     int64  `json:"id"`
+	Name   string `json:"name"`
+	Online int    `json:"online"`
+}
+
+// ChatServer Chat服务端接口,聊天服务
+type ChatServer interface {
+	// Login 登录
+	Login(ctx context.Context, req *LoginReq) (*LoginResp, error)
+	// SendMessage 发送消息到房间
+	SendMessage(ctx context.Context, req *SendMessageReq) (*SendMessageResp, error)
+}
+
+// RegisterChatServer 将srv注册到router,请求按编码自动反序列化,返回error时回复grpc.ResultFail
+func RegisterChatServer(router *grpc.Router, srv ChatServer) {
+	router.Register(CmdChatLogin, grpc.NewTypedHandler(srv.Login))
+	router.Register(CmdChatSendMessage, grpc.NewTypedHandler(srv.SendMessage), grpc.WithRouteTimeout(3*time.Second))
+}
+
+// ChatClient Chat客户端,cc可以是tcp.Client、tcp.ServiceClient等
+type ChatClient struct {
+	cc grpc.IClient
+}
+
+// NewChatClient 创建Chat客户端
+func NewChatClient(cc grpc.IClient) *ChatClient {
+	return &ChatClient{cc: cc}
+}
+
+// Login 登录
+func (c *ChatClient) Login(ctx context.Context, req *LoginReq, opts ...grpc.CallOption) (*LoginResp, error) {
+	return grpc.Call[LoginResp](ctx, c.cc, CmdChatLogin, req, opts...)
+}
+
+// SendMessage 发送消息到房间
+func (c *ChatClient) SendMessage(ctx context.Context, req *SendMessageReq, opts ...grpc.CallOption) (*SendMessageResp, error) {
+	return grpc.Call[SendMessageResp](ctx, c.cc, CmdChatSendMessage, req, opts...)
+}
+
+// RoomServer Room服务端接口
+type RoomServer interface {
+	List(ctx context.Context, req *ListRoomReq) (*ListRoomResp, error)
+}
+
+// RegisterRoomServer 将srv注册到router,请求按编码自动反序列化,返回error时回复grpc.ResultFail
+func RegisterRoomServer(router *grpc.Router, srv RoomServer) {
+	router.Register(CmdRoomList, grpc.NewTypedHandler(srv.List), grpc.WithRouteTimeout(500*time.Millisecond))
+}
+
+// RoomClient Room客户端,cc可以是tcp.Client、tcp.ServiceClient等
+type RoomClient struct {
+	cc grpc.IClient
+}
+
+// NewRoomClient 创建Room客户端
+func NewRoomClient(cc grpc.IClient) *RoomClient {
+	return &RoomClient{cc: cc}
+}
+
+// List 调用CmdRoomList
+func (c *RoomClient) List(ctx context.Context, req *ListRoomReq, opts ...grpc.CallOption) (*ListRoomResp, error) {
+	return grpc.Call[ListRoomResp](ctx, c.cc, CmdRoomList, req, opts...)
+}
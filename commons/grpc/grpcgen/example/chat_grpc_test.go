@@ -0,0 +1,89 @@
+// Code generated by grpcgen. DO NOT EDIT.
+// source: chat.yaml
+
+package example
+
+import (
+	"context"
+	"github.com/qiafan666/gotato/commons/gface"
+	"github.com/qiafan666/gotato/commons/grpc"
+	"github.com/qiafan666/gotato/commons/grpc/tcp"
+	"net"
+	"testing"
+	"time"
+)
+
+// testChatServer 所有命令返回空响应
+type testChatServer struct{}
+
+func (testChatServer) Login(ctx context.Context, req *LoginReq) (*LoginResp, error) {
+	return &LoginResp{}, nil
+}
+
+func (testChatServer) SendMessage(ctx context.Context, req *SendMessageReq) (*SendMessageResp, error) {
+	return &SendMessageResp{}, nil
+}
+
+func TestChatLoopback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	logger := gface.NewLogger("Chat", nil)
+	router := grpc.NewRouter(logger)
+	RegisterChatServer(router, testChatServer{})
+	tcp.NewServer(addr, router, &tcp.ServerOptions{Timeout: 3 * time.Second, Logger: logger}).Run(ctx)
+
+	client := NewChatClient(tcp.NewClient(ctx, addr, &tcp.ClientOptions{
+		MaxConn:    1,
+		Timeout:    3 * time.Second,
+		RetryLimit: 1,
+		Logger:     logger,
+	}))
+	if _, err = client.Login(ctx, &LoginReq{}); err != nil {
+		t.Fatalf("Chat.Login: %v", err)
+	}
+	if _, err = client.SendMessage(ctx, &SendMessageReq{}); err != nil {
+		t.Fatalf("Chat.SendMessage: %v", err)
+	}
+}
+
+// testRoomServer 所有命令返回空响应
+type testRoomServer struct{}
+
+func (testRoomServer) List(ctx context.Context, req *ListRoomReq) (*ListRoomResp, error) {
+	return &ListRoomResp{}, nil
+}
+
+func TestRoomLoopback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	logger := gface.NewLogger("Room", nil)
+	router := grpc.NewRouter(logger)
+	RegisterRoomServer(router, testRoomServer{})
+	tcp.NewServer(addr, router, &tcp.ServerOptions{Timeout: 3 * time.Second, Logger: logger}).Run(ctx)
+
+	client := NewRoomClient(tcp.NewClient(ctx, addr, &tcp.ClientOptions{
+		MaxConn:    1,
+		Timeout:    3 * time.Second,
+		RetryLimit: 1,
+		Logger:     logger,
+	}))
+	if _, err = client.List(ctx, &ListRoomReq{}); err != nil {
+		t.Fatalf("Room.List: %v", err)
+	}
+}
@@ -0,0 +1,4 @@
+// Package example grpcgen根据chat.yaml生成的代码示例
+package example
+
+//go:generate go run ../cmd/grpcgen -in chat.yaml -test
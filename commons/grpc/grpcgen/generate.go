@@ -0,0 +1,294 @@
+package grpcgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gcommon"
+	"github.com/qiafan666/gotato/commons/gerr"
+	"github.com/qiafan666/gotato/commons/grpc"
+)
+
+// Run 解析in并在outDir生成<name>_grpc.go,withTest时同时生成<name>_grpc_test.go
+// outDir为空时与in在同一目录,返回生成的文件路径
+func Run(in string, outDir string, withTest bool) ([]string, error) {
+	f, err := ParseFile(in)
+	if err != nil {
+		return nil, err
+	}
+	if outDir == "" {
+		outDir = filepath.Dir(in)
+	}
+	base := strings.TrimSuffix(filepath.Base(in), filepath.Ext(in))
+
+	type output struct {
+		name string
+		gen  func(*File) ([]byte, error)
+	}
+	outputs := []output{{base + "_grpc.go", Generate}}
+	if withTest {
+		outputs = append(outputs, output{base + "_grpc_test.go", GenerateTest})
+	}
+	files := make([]string, 0, len(outputs))
+	for _, out := range outputs {
+		code, e := out.gen(f)
+		if e != nil {
+			return nil, e
+		}
+		filename := filepath.Join(outDir, out.name)
+		if e = os.WriteFile(filename, code, 0644); e != nil {
+			return nil, gerr.WrapMsg(e, "write file fail", "file", filename)
+		}
+		files = append(files, filename)
+	}
+	return files, nil
+}
+
+// Generate 生成命令常量、消息结构体、服务端接口与注册函数、客户端方法
+func Generate(f *File) ([]byte, error) {
+	imports := []string{"context", "github.com/qiafan666/gotato/commons/grpc"}
+	if f.hasTimeout() {
+		imports = append(imports, "time")
+	}
+	return execute(serviceTemplate, f, append(imports, f.Imports...))
+}
+
+// GenerateTest 生成测试,每个服务启动本地回环tcp.Server并通过生成的客户端调用所有命令
+func GenerateTest(f *File) ([]byte, error) {
+	imports := []string{
+		"context",
+		"net",
+		"testing",
+		"time",
+		"github.com/qiafan666/gotato/commons/gface",
+		"github.com/qiafan666/gotato/commons/grpc",
+		"github.com/qiafan666/gotato/commons/grpc/tcp",
+	}
+	return execute(testTemplate, f, append(imports, f.typeImports()...))
+}
+
+func execute(tmpl *template.Template, f *File, imports []string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, map[string]any{
+		"File":    f,
+		"Imports": dedupe(imports),
+	})
+	if err != nil {
+		return nil, gerr.WrapMsg(err, "execute template fail", "template", tmpl.Name())
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, gerr.WrapMsg(err, "format generated code fail", "template", tmpl.Name())
+	}
+	return code, nil
+}
+
+func (f *File) hasTimeout() bool {
+	for _, svc := range f.Services {
+		for _, m := range svc.Commands {
+			if m.Timeout > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeImports 请求、响应类型引用到的导入
+func (f *File) typeImports() []string {
+	var used []string
+	for _, importPath := range f.Imports {
+		prefix := path.Base(importPath) + "."
+		for _, svc := range f.Services {
+			for _, m := range svc.Commands {
+				if strings.HasPrefix(m.Request, prefix) || strings.HasPrefix(m.Response, prefix) {
+					used = append(used, importPath)
+				}
+			}
+		}
+	}
+	return used
+}
+
+func dedupe(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	ret := make([]string, 0, len(items))
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// durationExpr 超时时间转为Go表达式,如3*time.Second
+func durationExpr(d time.Duration) string {
+	units := []struct {
+		unit time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+		{time.Microsecond, "time.Microsecond"},
+	}
+	for _, u := range units {
+		if d%u.unit == 0 {
+			return fmt.Sprintf("%d * %s", d/u.unit, u.name)
+		}
+	}
+	return fmt.Sprintf("time.Duration(%d)", int64(d))
+}
+
+// codecExpr 编码名转为Go表达式,内置编码使用grpc包的常量
+func codecExpr(codec string) string {
+	switch codec {
+	case grpc.CodecJSON:
+		return "grpc.CodecJSON"
+	case grpc.CodecProto:
+		return "grpc.CodecProto"
+	case grpc.CodecMsgpack:
+		return "grpc.CodecMsgpack"
+	case grpc.CodecGob:
+		return "grpc.CodecGob"
+	}
+	return fmt.Sprintf("%q", codec)
+}
+
+func jsonTag(field *Field) string {
+	if field.Json != "" {
+		return field.Json
+	}
+	return gcommon.UnderscoreName(field.Name)
+}
+
+var funcs = template.FuncMap{
+	"cmdName": func(svc *Service, m *Method) string {
+		return "Cmd" + svc.Name + m.Name
+	},
+	"duration": durationExpr,
+	"codec":    codecExpr,
+	"jsonTag":  jsonTag,
+}
+
+var serviceTemplate = template.Must(template.New("service").Funcs(funcs).Parse(`// Code generated by grpcgen. DO NOT EDIT.
+// source: {{.File.Source}}
+
+package {{.File.Package}}
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+)
+{{- $file := .File}}
+
+const (
+{{- range $svc := .File.Services}}{{range .Commands}}
+	{{cmdName $svc .}} grpc.Command = {{.Cmd}}{{if .Comment}} // {{.Comment}}{{end}}
+{{- end}}{{end}}
+)
+{{range .File.Messages}}
+{{if .Comment}}// {{.Name}} {{.Comment}}
+{{end -}}
+type {{.Name}} struct {
+{{- range .Fields}}
+	{{.Name}} {{.Type}} ` + "`json:\"{{jsonTag .}}\"`" + `{{if .Comment}} // {{.Comment}}{{end}}
+{{- end}}
+}
+{{end}}
+{{- range $svc := .File.Services}}
+// {{.Name}}Server {{.Name}}服务端接口{{if .Comment}},{{.Comment}}{{end}}
+type {{.Name}}Server interface {
+{{- range .Commands}}
+	{{- if .Comment}}
+	// {{.Name}} {{.Comment}}
+	{{- end}}
+	{{.Name}}(ctx context.Context, req *{{.Request}}) (*{{.Response}}, error)
+{{- end}}
+}
+
+// Register{{.Name}}Server 将srv注册到router,请求按编码自动反序列化,返回error时回复grpc.ResultFail
+func Register{{.Name}}Server(router *grpc.Router, srv {{.Name}}Server) {
+{{- range .Commands}}
+	router.Register({{cmdName $svc .}}, grpc.NewTypedHandler(srv.{{.Name}}){{if .Timeout}}, grpc.WithRouteTimeout({{duration .Timeout}}){{end}})
+{{- end}}
+}
+
+// {{.Name}}Client {{.Name}}客户端,cc可以是tcp.Client、tcp.ServiceClient等
+type {{.Name}}Client struct {
+	cc grpc.IClient
+}
+
+// New{{.Name}}Client 创建{{.Name}}客户端
+func New{{.Name}}Client(cc grpc.IClient) *{{.Name}}Client {
+	return &{{.Name}}Client{cc: cc}
+}
+{{range .Commands}}
+// {{.Name}} {{if .Comment}}{{.Comment}}{{else}}调用{{cmdName $svc .}}{{end}}
+func (c *{{$svc.Name}}Client) {{.Name}}(ctx context.Context, req *{{.Request}}, opts ...grpc.CallOption) (*{{.Response}}, error) {
+{{- if $file.Codec}}
+	opts = append([]grpc.CallOption{grpc.WithCodec({{codec $file.Codec}})}, opts...)
+{{- end}}
+	return grpc.Call[{{.Response}}](ctx, c.cc, {{cmdName $svc .}}, req, opts...)
+}
+{{end}}
+{{- end}}
+`))
+
+var testTemplate = template.Must(template.New("test").Funcs(funcs).Parse(`// Code generated by grpcgen. DO NOT EDIT.
+// source: {{.File.Source}}
+
+package {{.File.Package}}
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+)
+{{range $svc := .File.Services}}
+// test{{.Name}}Server 所有命令返回空响应
+type test{{.Name}}Server struct{}
+{{range .Commands}}
+func (test{{$svc.Name}}Server) {{.Name}}(ctx context.Context, req *{{.Request}}) (*{{.Response}}, error) {
+	return &{{.Response}}{}, nil
+}
+{{end}}
+func Test{{.Name}}Loopback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	logger := gface.NewLogger("{{.Name}}", nil)
+	router := grpc.NewRouter(logger)
+	Register{{.Name}}Server(router, test{{.Name}}Server{})
+	tcp.NewServer(addr, router, &tcp.ServerOptions{Timeout: 3 * time.Second, Logger: logger}).Run(ctx)
+
+	client := New{{.Name}}Client(tcp.NewClient(ctx, addr, &tcp.ClientOptions{
+		MaxConn:    1,
+		Timeout:    3 * time.Second,
+		RetryLimit: 1,
+		Logger:     logger,
+	}))
+{{- range .Commands}}
+	if _, err = client.{{.Name}}(ctx, &{{.Request}}{}); err != nil {
+		t.Fatalf("{{$svc.Name}}.{{.Name}}: %v", err)
+	}
+{{- end}}
+}
+{{end}}`))
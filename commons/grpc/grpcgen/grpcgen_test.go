@@ -0,0 +1,121 @@
+package grpcgen
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGenerateExample 生成结果需与example目录中提交的代码一致,修改模板后执行go generate ./example
+func TestGenerateExample(t *testing.T) {
+	dir := t.TempDir()
+	files, err := Run("example/chat.yaml", dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		got, _ := os.ReadFile(file)
+		want, err := os.ReadFile(filepath.Join("example", filepath.Base(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s is stale, run go generate ./example", filepath.Base(file))
+		}
+	}
+}
+
+func TestParseProto(t *testing.T) {
+	f, err := ParseFile("testdata/game.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Package != "gamepb" || len(f.Services) != 1 || len(f.Services[0].Commands) != 2 {
+		t.Fatalf("unexpected file %+v", f)
+	}
+	svc := f.Services[0]
+	start, cancel := svc.Commands[0], svc.Commands[1]
+	if svc.Name != "Match" || svc.Comment != "对局服务" {
+		t.Fatalf("unexpected service %+v", svc)
+	}
+	if start.Cmd != 2001 || start.Timeout != 5*time.Second || start.Comment != "开始匹配" || start.Request != "StartReq" {
+		t.Fatalf("unexpected start %+v", start)
+	}
+	if cancel.Cmd != 2002 || cancel.Request != "CancelReq" || cancel.Response != "emptypb.Empty" || cancel.Comment != "取消匹配" {
+		t.Fatalf("unexpected cancel %+v", cancel)
+	}
+
+	code, err := Generate(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"google.golang.org/protobuf/types/known/emptypb"`,
+		"CmdMatchStart  grpc.Command = 2001",
+		"grpc.WithRouteTimeout(5*time.Second)",
+		"opts = append([]grpc.CallOption{grpc.WithCodec(grpc.CodecProto)}, opts...)",
+		"grpc.Call[emptypb.Empty](ctx, c.cc, CmdMatchCancel, req, opts...)",
+	} {
+		if !strings.Contains(string(code), want) {
+			t.Fatalf("generated code missing %q\n%s", want, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := map[string]string{
+		"duplicate": `
+package: p
+services:
+  - name: A
+    commands:
+      - {name: X, cmd: 1, request: Req, response: Resp}
+      - {name: Y, cmd: 1, request: Req, response: Resp}
+`,
+		"reserved": `
+package: p
+services:
+  - name: A
+    commands:
+      - {name: X, cmd: 0, request: Req, response: Resp}
+`,
+		"unexported": `
+package: p
+services:
+  - name: a
+    commands:
+      - {name: X, cmd: 1, request: Req, response: Resp}
+`,
+		"unknown field": `
+package: p
+service: []
+`,
+	}
+	for name, idl := range cases {
+		if _, err := ParseYAML([]byte(idl)); err == nil {
+			t.Fatalf("%s: want error", name)
+		}
+	}
+
+	noCmd := `
+package p;
+service A {
+  rpc X(Req) returns (Resp);
+}
+`
+	if _, err := ParseProto([]byte(noCmd)); err == nil {
+		t.Fatal("want missing cmd error")
+	}
+	stream := `
+package p;
+service A {
+  rpc X(stream Req) returns (Resp); // cmd=1
+}
+`
+	if _, err := ParseProto([]byte(stream)); err == nil {
+		t.Fatal("want stream rpc error")
+	}
+}
@@ -0,0 +1,97 @@
+// Package grpcgen 根据服务定义(YAML IDL或protobuf service)生成grpc.Command常量、服务端接口与客户端方法
+package grpcgen
+
+import (
+	"fmt"
+	"go/token"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gerr"
+	"github.com/qiafan666/gotato/commons/grpc"
+)
+
+// File 一个IDL文件的定义,生成一个Go文件
+type File struct {
+	Source   string     `yaml:"-"`       // 来源文件名,写入生成代码的头部注释
+	Package  string     `yaml:"package"` // 生成代码的Go包名
+	Imports  []string   `yaml:"imports"` // 请求、响应类型所在包等额外导入
+	Codec    string     `yaml:"codec"`   // 客户端默认编码,为空时使用调用配置的编码(默认json)
+	Services []*Service `yaml:"services"`
+	Messages []*Message `yaml:"messages"` // 生成的消息结构体,protobuf定义时为空
+}
+
+// Service 服务定义
+type Service struct {
+	Name     string    `yaml:"name"`
+	Comment  string    `yaml:"comment"`
+	Commands []*Method `yaml:"commands"`
+}
+
+// Method 命令定义
+type Method struct {
+	Name     string        `yaml:"name"`
+	Cmd      uint32        `yaml:"cmd"`      // 命令号
+	Request  string        `yaml:"request"`  // 请求类型名,可带包前缀如pb.LoginReq
+	Response string        `yaml:"response"` // 响应类型名
+	Timeout  time.Duration `yaml:"timeout"`  // 服务端处理超时,0为不限制
+	Comment  string        `yaml:"comment"`
+}
+
+// Message 消息结构体定义
+type Message struct {
+	Name    string   `yaml:"name"`
+	Comment string   `yaml:"comment"`
+	Fields  []*Field `yaml:"fields"`
+}
+
+// Field 消息字段定义
+type Field struct {
+	Name    string `yaml:"name"`
+	Type    string `yaml:"type"` // Go类型,如string、int64、[]*Item
+	Json    string `yaml:"json"` // json tag,为空时使用字段名的下划线写法
+	Comment string `yaml:"comment"`
+}
+
+// Validate 检查定义是否完整,命令号不能重复且不能使用保留命令
+func (f *File) Validate() error {
+	if !token.IsIdentifier(f.Package) {
+		return gerr.New("invalid package name", "package", f.Package)
+	}
+	if len(f.Services) == 0 {
+		return gerr.New("no service defined", "source", f.Source)
+	}
+	cmds := make(map[uint32]string)
+	for _, svc := range f.Services {
+		if !token.IsExported(svc.Name) {
+			return gerr.New("service name must be exported", "service", svc.Name)
+		}
+		for _, m := range svc.Commands {
+			name := fmt.Sprintf("%s.%s", svc.Name, m.Name)
+			if !token.IsExported(m.Name) {
+				return gerr.New("command name must be exported", "command", name)
+			}
+			if m.Request == "" || m.Response == "" {
+				return gerr.New("command request and response required", "command", name)
+			}
+			switch grpc.Command(m.Cmd) {
+			case grpc.CmdHeartbeat, grpc.CmdHandshake, grpc.CmdKick:
+				return gerr.New("command id reserved", "command", name, "cmd", m.Cmd)
+			}
+			if exist, ok := cmds[m.Cmd]; ok {
+				return gerr.New("duplicate command id", "command", name, "exist", exist, "cmd", m.Cmd)
+			}
+			cmds[m.Cmd] = name
+		}
+	}
+	for _, msg := range f.Messages {
+		if !token.IsExported(msg.Name) {
+			return gerr.New("message name must be exported", "message", msg.Name)
+		}
+		for _, field := range msg.Fields {
+			if !token.IsExported(field.Name) || field.Type == "" {
+				return gerr.New("invalid message field", "message", msg.Name, "field", field.Name)
+			}
+		}
+	}
+	return nil
+}
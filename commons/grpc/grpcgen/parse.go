@@ -0,0 +1,201 @@
+package grpcgen
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gerr"
+	"github.com/qiafan666/gotato/commons/grpc"
+	"gopkg.in/yaml.v3"
+)
+
+// ParseFile 按扩展名解析.yaml/.yml或.proto文件
+func ParseFile(filename string) (*File, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var f *File
+	switch ext := filepath.Ext(filename); ext {
+	case ".yaml", ".yml":
+		f, err = ParseYAML(data)
+	case ".proto":
+		f, err = ParseProto(data)
+	default:
+		return nil, gerr.New("unsupported idl file", "file", filename)
+	}
+	if err != nil {
+		return nil, gerr.WrapMsg(err, "parse idl fail", "file", filename)
+	}
+	f.Source = filepath.Base(filename)
+	return f, nil
+}
+
+// ParseYAML 解析YAML IDL,格式见File、Service、Method、Message的yaml tag
+func ParseYAML(data []byte) (*File, error) {
+	f := &File{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(f); err != nil {
+		return nil, err
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var (
+	protoPackage   = regexp.MustCompile(`^package\s+([\w.]+)\s*;`)
+	protoGoPackage = regexp.MustCompile(`^option\s+go_package\s*=\s*"([^"]+)"\s*;`)
+	protoService   = regexp.MustCompile(`^service\s+(\w+)\s*\{`)
+	protoRpc       = regexp.MustCompile(`^rpc\s+(\w+)\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*returns\s*\(\s*(stream\s+)?([\w.]+)\s*\)`)
+	protoAnnotate  = regexp.MustCompile(`\b(cmd|timeout)\s*=\s*(\S+)`)
+)
+
+// protoWellKnown protobuf内置类型对应的Go类型与导入路径
+var protoWellKnown = map[string][2]string{
+	"google.protobuf.Empty":     {"emptypb.Empty", "google.golang.org/protobuf/types/known/emptypb"},
+	"google.protobuf.Any":       {"anypb.Any", "google.golang.org/protobuf/types/known/anypb"},
+	"google.protobuf.Timestamp": {"timestamppb.Timestamp", "google.golang.org/protobuf/types/known/timestamppb"},
+}
+
+// ParseProto 解析protobuf文件中的service定义,生成的代码与protoc-gen-go的消息类型在同一个包
+// 命令号与超时写在rpc的注释中,如:
+//
+//	// 发送消息 cmd=1001 timeout=3s
+//	rpc Send(SendReq) returns (SendResp);
+//
+// 不支持stream rpc
+func ParseProto(data []byte) (*File, error) {
+	f := &File{Codec: grpc.CodecProto}
+	var (
+		protoPkg string
+		svc      *Service
+		depth    int
+		comments []string
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		code, comment := splitComment(scanner.Text())
+		if code == "" {
+			if comment != "" {
+				comments = append(comments, comment)
+			} else {
+				comments = nil
+			}
+			continue
+		}
+		if comment != "" {
+			comments = append(comments, comment)
+		}
+
+		switch {
+		case svc == nil && protoPackage.MatchString(code):
+			protoPkg = protoPackage.FindStringSubmatch(code)[1]
+		case svc == nil && protoGoPackage.MatchString(code):
+			f.Package = goPackageName(protoGoPackage.FindStringSubmatch(code)[1])
+		case svc == nil && depth == 0 && protoService.MatchString(code):
+			svc = &Service{Name: protoService.FindStringSubmatch(code)[1], Comment: strings.Join(comments, " ")}
+			f.Services = append(f.Services, svc)
+		case svc != nil && depth == 1 && protoRpc.MatchString(code):
+			m, err := parseRpc(f, protoRpc.FindStringSubmatch(code), comments)
+			if err != nil {
+				return nil, gerr.WrapMsg(err, "parse rpc fail", "line", lineNo)
+			}
+			svc.Commands = append(svc.Commands, m)
+		}
+		comments = nil
+
+		depth += strings.Count(code, "{") - strings.Count(code, "}")
+		if depth == 0 {
+			svc = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if f.Package == "" && protoPkg != "" {
+		f.Package = protoPkg[strings.LastIndex(protoPkg, ".")+1:]
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// parseRpc 解析rpc定义及其注释中的cmd、timeout
+func parseRpc(f *File, match []string, comments []string) (*Method, error) {
+	m := &Method{Name: match[1]}
+	if match[2] != "" || match[4] != "" {
+		return nil, gerr.New("stream rpc not supported", "rpc", m.Name)
+	}
+	m.Request = protoGoType(f, match[3])
+	m.Response = protoGoType(f, match[5])
+
+	hasCmd := false
+	text := strings.Join(comments, " ")
+	for _, kv := range protoAnnotate.FindAllStringSubmatch(text, -1) {
+		switch kv[1] {
+		case "cmd":
+			cmd, err := strconv.ParseUint(kv[2], 0, 32)
+			if err != nil {
+				return nil, gerr.WrapMsg(err, "invalid cmd", "rpc", m.Name, "cmd", kv[2])
+			}
+			m.Cmd, hasCmd = uint32(cmd), true
+		case "timeout":
+			timeout, err := time.ParseDuration(kv[2])
+			if err != nil {
+				return nil, gerr.WrapMsg(err, "invalid timeout", "rpc", m.Name, "timeout", kv[2])
+			}
+			m.Timeout = timeout
+		}
+	}
+	if !hasCmd {
+		return nil, gerr.New("missing cmd annotation", "rpc", m.Name)
+	}
+	m.Comment = strings.Join(strings.Fields(protoAnnotate.ReplaceAllString(text, "")), " ")
+	return m, nil
+}
+
+// protoGoType protobuf消息名转为Go类型,内置类型会追加导入
+func protoGoType(f *File, name string) string {
+	name = strings.TrimPrefix(name, ".")
+	if wk, ok := protoWellKnown[name]; ok {
+		f.addImport(wk[1])
+		return wk[0]
+	}
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// goPackageName 由go_package选项得到包名,如 "github.com/x/pb;chatpb" 为chatpb
+func goPackageName(goPackage string) string {
+	if i := strings.LastIndex(goPackage, ";"); i >= 0 {
+		return goPackage[i+1:]
+	}
+	return path.Base(goPackage)
+}
+
+// splitComment 拆分一行中的代码与//注释
+func splitComment(line string) (code string, comment string) {
+	if i := strings.Index(line, "//"); i >= 0 {
+		return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+2:])
+	}
+	return strings.TrimSpace(line), ""
+}
+
+func (f *File) addImport(importPath string) {
+	for _, exist := range f.Imports {
+		if exist == importPath {
+			return
+		}
+	}
+	f.Imports = append(f.Imports, importPath)
+}
@@ -0,0 +1,233 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/qiafan666/gotato/commons/gerr"
+	"github.com/qiafan666/gotato/commons/gface"
+	"golang.org/x/time/rate"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// UnaryHandler 服务端请求处理函数
+type UnaryHandler func(ctx context.Context, request *Message) *Message
+
+// ServerInterceptor 服务端拦截器,调用next继续处理,不调用则直接返回响应
+type ServerInterceptor func(ctx context.Context, request *Message, next UnaryHandler) *Message
+
+// Invoker 客户端调用函数
+type Invoker func(ctx context.Context, request *Message, opts ...CallOption) (*Message, error)
+
+// ClientInterceptor 客户端拦截器,调用next发起实际请求
+type ClientInterceptor func(ctx context.Context, request *Message, next Invoker, opts ...CallOption) (*Message, error)
+
+// MetricsObserver 请求指标回调,服务端err恒为nil
+type MetricsObserver func(cmd Command, result uint32, cost time.Duration, err error)
+
+// ChainServerInterceptors 将多个拦截器合并为一个,第一个位于最外层
+func ChainServerInterceptors(interceptors ...ServerInterceptor) ServerInterceptor {
+	switch len(interceptors) {
+	case 0:
+		return nil
+	case 1:
+		return interceptors[0]
+	}
+	return func(ctx context.Context, request *Message, next UnaryHandler) *Message {
+		return interceptors[0](ctx, request, chainServer(interceptors[1:], next))
+	}
+}
+
+func chainServer(interceptors []ServerInterceptor, final UnaryHandler) UnaryHandler {
+	if len(interceptors) == 0 {
+		return final
+	}
+	return func(ctx context.Context, request *Message) *Message {
+		return interceptors[0](ctx, request, chainServer(interceptors[1:], final))
+	}
+}
+
+// ChainClientInterceptors 将多个拦截器合并为一个,第一个位于最外层
+func ChainClientInterceptors(interceptors ...ClientInterceptor) ClientInterceptor {
+	switch len(interceptors) {
+	case 0:
+		return nil
+	case 1:
+		return interceptors[0]
+	}
+	return func(ctx context.Context, request *Message, next Invoker, opts ...CallOption) (*Message, error) {
+		return interceptors[0](ctx, request, chainClient(interceptors[1:], next), opts...)
+	}
+}
+
+func chainClient(interceptors []ClientInterceptor, final Invoker) Invoker {
+	if len(interceptors) == 0 {
+		return final
+	}
+	return func(ctx context.Context, request *Message, opts ...CallOption) (*Message, error) {
+		return interceptors[0](ctx, request, chainClient(interceptors[1:], final), opts...)
+	}
+}
+
+// ------------------------ server ------------------------
+
+// RecoveryInterceptor 捕获处理函数panic,回复ResultInternal
+func RecoveryInterceptor(logger gface.ILogger) ServerInterceptor {
+	return func(ctx context.Context, request *Message, next UnaryHandler) (resp *Message) {
+		defer func() {
+			if p := recover(); p != nil {
+				logger.ErrorF(nil, "grpc handle panic, command:%d,reqId:%d,panic:%v\n%s", request.Command, request.ReqId, p, debug.Stack())
+				resp = ErrorReply(request, ResultInternal, fmt.Errorf("internal error: %v", p))
+			}
+		}()
+		return next(ctx, request)
+	}
+}
+
+// LoggingInterceptor 记录请求耗时,Result非0时记录警告
+func LoggingInterceptor(logger gface.ILogger) ServerInterceptor {
+	return func(ctx context.Context, request *Message, next UnaryHandler) *Message {
+		start := time.Now()
+		resp := next(ctx, request)
+		if resp != nil && resp.Result != ResultOK {
+			logger.WarnF(nil, "grpc handle fail, command:%d,reqId:%d,result:%d,cost:%v,msg:%s", request.Command, request.ReqId, resp.Result, time.Since(start), resp.Body)
+		} else {
+			logger.DebugF(nil, "grpc handle done, command:%d,reqId:%d,cost:%v", request.Command, request.ReqId, time.Since(start))
+		}
+		return resp
+	}
+}
+
+// MetricsInterceptor 每个请求处理完后回调observe
+func MetricsInterceptor(observe MetricsObserver) ServerInterceptor {
+	return func(ctx context.Context, request *Message, next UnaryHandler) *Message {
+		start := time.Now()
+		resp := next(ctx, request)
+		result := ResultOK
+		if resp != nil {
+			result = resp.Result
+		}
+		observe(request.Command, result, time.Since(start), nil)
+		return resp
+	}
+}
+
+// AuthInterceptor 按命令鉴权,auth返回error时回复ResultUnauthorized
+// 连接级的token握手见 tcp.ServerOptions.Authenticator,这里用于命令粒度的权限校验
+func AuthInterceptor(auth func(ctx context.Context, request *Message) error) ServerInterceptor {
+	return func(ctx context.Context, request *Message, next UnaryHandler) *Message {
+		if err := auth(ctx, request); err != nil {
+			return ErrorReply(request, ResultUnauthorized, err)
+		}
+		return next(ctx, request)
+	}
+}
+
+// RateLimitInterceptor 按命令令牌桶限流,每个命令每秒limit个请求,允许突发burst个,超出回复ResultTooManyRequests
+func RateLimitInterceptor(limit float64, burst int) ServerInterceptor {
+	var limiters sync.Map
+	return func(ctx context.Context, request *Message, next UnaryHandler) *Message {
+		l, ok := limiters.Load(request.Command)
+		if !ok {
+			l, _ = limiters.LoadOrStore(request.Command, rate.NewLimiter(rate.Limit(limit), burst))
+		}
+		if !l.(*rate.Limiter).Allow() {
+			return ErrorReply(request, ResultTooManyRequests, gerr.New("rate limit exceeded", "command", request.Command))
+		}
+		return next(ctx, request)
+	}
+}
+
+// DeadlineInterceptor 请求到达时已超过调用方deadline则直接回复ResultTimeout,不再处理
+func DeadlineInterceptor() ServerInterceptor {
+	return func(ctx context.Context, request *Message, next UnaryHandler) *Message {
+		if err := ctx.Err(); err != nil {
+			return ErrorReply(request, ResultTimeout, err)
+		}
+		return next(ctx, request)
+	}
+}
+
+// TimeoutInterceptor 限制处理时长,超时回复ResultTimeout,命令单独配置的超时见 WithRouteTimeout
+func TimeoutInterceptor(timeout time.Duration) ServerInterceptor {
+	return func(ctx context.Context, request *Message, next UnaryHandler) *Message {
+		return handleWithTimeout(ctx, request, next, timeout)
+	}
+}
+
+// handleWithTimeout 在独立goroutine中处理请求,超时后立即回复ResultTimeout
+// 处理函数应关注ctx.Done()尽早退出,超时后其返回值会被丢弃,panic会转移到调用方goroutine
+func handleWithTimeout(ctx context.Context, request *Message, next UnaryHandler, timeout time.Duration) *Message {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		resp     *Message
+		panicked any
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- result{panicked: p}
+			}
+		}()
+		done <- result{resp: next(ctx, request)}
+	}()
+
+	select {
+	case r := <-done:
+		if r.panicked != nil {
+			panic(r.panicked)
+		}
+		return r.resp
+	case <-ctx.Done():
+		return ErrorReply(request, ResultTimeout, gerr.New("handle timeout", "command", request.Command, "timeout", timeout))
+	}
+}
+
+// ------------------------ client ------------------------
+
+// ClientLoggingInterceptor 记录调用耗时,失败时记录警告
+func ClientLoggingInterceptor(logger gface.ILogger) ClientInterceptor {
+	return func(ctx context.Context, request *Message, next Invoker, opts ...CallOption) (*Message, error) {
+		start := time.Now()
+		resp, err := next(ctx, request, opts...)
+		switch {
+		case err != nil:
+			logger.WarnF(nil, "grpc call fail, command:%d,reqId:%d,cost:%v,err:%v", request.Command, request.ReqId, time.Since(start), err)
+		case resp != nil && resp.Result != ResultOK:
+			logger.WarnF(nil, "grpc call fail, command:%d,reqId:%d,result:%d,cost:%v,msg:%s", request.Command, request.ReqId, resp.Result, time.Since(start), resp.Body)
+		default:
+			logger.DebugF(nil, "grpc call done, command:%d,reqId:%d,cost:%v", request.Command, request.ReqId, time.Since(start))
+		}
+		return resp, err
+	}
+}
+
+// ClientMetricsInterceptor 每次调用完成后回调observe
+func ClientMetricsInterceptor(observe MetricsObserver) ClientInterceptor {
+	return func(ctx context.Context, request *Message, next Invoker, opts ...CallOption) (*Message, error) {
+		start := time.Now()
+		resp, err := next(ctx, request, opts...)
+		result := ResultOK
+		if resp != nil {
+			result = resp.Result
+		}
+		observe(request.Command, result, time.Since(start), err)
+		return resp, err
+	}
+}
+
+// ClientTimeoutInterceptor ctx未设置deadline时使用默认超时,deadline会随请求传给服务端
+func ClientTimeoutInterceptor(timeout time.Duration) ClientInterceptor {
+	return func(ctx context.Context, request *Message, next Invoker, opts ...CallOption) (*Message, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return next(ctx, request, opts...)
+	}
+}
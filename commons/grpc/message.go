@@ -8,6 +8,8 @@ type Message struct {
 	Result    uint32     `json:"result"`   //错误码   0表示成功,body为业务数据，其他表示错误，body为错误描述
 	Body      []byte     `json:"body"`     //消息体
 	Heartbeat *Heartbeat `json:"heartbeat,omitempty"`
+	Metadata  Metadata   `json:"metadata,omitempty"` //元数据,编码在协议头Ext中
+	Version   uint8      `json:"version,omitempty"`  //协议版本,解码时为对端帧的版本,编码时为0使用协议默认版本
 }
 
 type Heartbeat struct {
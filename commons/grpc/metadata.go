@@ -0,0 +1,140 @@
+package grpc
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// 保留的元数据key
+const (
+	MetaDeadline = "grpc-deadline" // 请求截止时间 unix ms，服务端据此设置上下文deadline
+	MetaVersion  = "grpc-version"  // 协议版本协商，心跳请求携带本端支持的最高版本，响应携带双方共同的最高版本
+)
+
+// Metadata 随消息传输的键值对，编码在协议头的Ext中
+type Metadata map[string]string
+
+// NewMetadata 由key,value对创建元数据，奇数个参数时忽略最后一个
+func NewMetadata(kv ...string) Metadata {
+	md := make(Metadata, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		md[kv[i]] = kv[i+1]
+	}
+	return md
+}
+
+// Get 获取元数据，不存在时返回空字符串
+func (md Metadata) Get(key string) string {
+	return md[key]
+}
+
+// Set 设置元数据
+func (md Metadata) Set(key, value string) {
+	md[key] = value
+}
+
+// Clone 复制元数据
+func (md Metadata) Clone() Metadata {
+	if md == nil {
+		return nil
+	}
+	ret := make(Metadata, len(md))
+	for k, v := range md {
+		ret[k] = v
+	}
+	return ret
+}
+
+// Merge 合并元数据，other中的同名key覆盖md
+func (md Metadata) Merge(other Metadata) Metadata {
+	if len(other) == 0 {
+		return md
+	}
+	ret := md.Clone()
+	if ret == nil {
+		ret = make(Metadata, len(other))
+	}
+	for k, v := range other {
+		ret[k] = v
+	}
+	return ret
+}
+
+// Deadline 解析MetaDeadline
+func (md Metadata) Deadline() (time.Time, bool) {
+	v, ok := md[MetaDeadline]
+	if !ok {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
+// SetDeadline 设置MetaDeadline
+func (md Metadata) SetDeadline(deadline time.Time) {
+	md[MetaDeadline] = strconv.FormatInt(deadline.UnixMilli(), 10)
+}
+
+type incomingMetaKey struct{}
+
+// NewIncomingContext 服务端将请求元数据放入上下文
+func NewIncomingContext(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, incomingMetaKey{}, md)
+}
+
+// MetadataFromContext 服务端从上下文获取请求元数据
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(incomingMetaKey{}).(Metadata)
+	return md
+}
+
+// CallOptions 单次调用的配置
+type CallOptions struct {
+	Metadata Metadata
+	Codec    string // body编码,用于Invoke/Call,为空时使用json
+}
+
+// CallOption 单次调用配置项
+type CallOption func(opts *CallOptions)
+
+// WithMetadata 本次调用附带的元数据，以key,value对传入
+func WithMetadata(kv ...string) CallOption {
+	return func(opts *CallOptions) {
+		opts.Metadata = opts.Metadata.Merge(NewMetadata(kv...))
+	}
+}
+
+// WithCodec 本次调用body使用的编码，服务端按相同编码回复
+func WithCodec(name string) CallOption {
+	return func(opts *CallOptions) {
+		opts.Codec = name
+	}
+}
+
+// NewCallOptions 合并调用配置项
+func NewCallOptions(opts ...CallOption) *CallOptions {
+	callOpts := &CallOptions{}
+	for _, opt := range opts {
+		opt(callOpts)
+	}
+	return callOpts
+}
+
+// ApplyCallOptions 将调用配置应用到请求，ctx含deadline时写入MetaDeadline
+func ApplyCallOptions(ctx context.Context, request *Message, opts ...CallOption) {
+	callOpts := NewCallOptions(opts...)
+	md := request.Metadata.Merge(callOpts.Metadata)
+	if callOpts.Codec != "" {
+		md = md.Merge(NewMetadata(MetaCodec, callOpts.Codec))
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if _, exists := md[MetaDeadline]; !exists {
+			md = md.Merge(NewMetadata(MetaDeadline, strconv.FormatInt(deadline.UnixMilli(), 10)))
+		}
+	}
+	request.Metadata = md
+}
@@ -0,0 +1,33 @@
+package grpc
+
+import "context"
+
+// 认证方式
+const (
+	AuthTypeNone  = ""
+	AuthTypeTLS   = "tls"   // mTLS客户端证书
+	AuthTypeToken = "token" // token握手
+)
+
+// MetaToken token握手时携带token的元数据key
+const MetaToken = "grpc-token"
+
+// Peer 对端连接信息
+type Peer struct {
+	Addr     string // 远端地址
+	Identity string // 认证后的身份，mTLS为证书CommonName，token握手为认证函数返回值
+	AuthType string // 认证方式
+}
+
+type peerKey struct{}
+
+// WithPeer 在上下文中设置对端信息
+func WithPeer(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// PeerFromContext 从上下文获取对端信息，不存在时返回nil
+func PeerFromContext(ctx context.Context) *Peer {
+	p, _ := ctx.Value(peerKey{}).(*Peer)
+	return p
+}
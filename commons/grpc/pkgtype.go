@@ -6,4 +6,6 @@ const (
 	PkgTypeRequest PkgType = 0 + iota
 	PkgTypeReply
 	PkgTypePush
+	PkgTypeStream    // 流式响应帧，同一请求可有多帧
+	PkgTypeStreamEnd // 流式响应结束标记，Result非0时body为错误描述
 )
@@ -0,0 +1,39 @@
+package grpc
+
+import "fmt"
+
+// 通用错误码，Result非0时body为错误描述
+const (
+	ResultOK               uint32 = 0
+	ResultFail             uint32 = 1   // 处理函数返回错误
+	ResultBadRequest       uint32 = 400 // 请求body无法解析
+	ResultUnauthorized     uint32 = 401 // 认证失败
+	ResultForbidden        uint32 = 403 // 用户被封禁
+	ResultNotFound         uint32 = 404 // 命令未注册
+	ResultUnsupportedCodec uint32 = 415 // 不支持的编码
+	ResultTooManyRequests  uint32 = 429 // 触发限流
+	ResultInternal         uint32 = 500 // 处理函数panic
+	ResultTimeout          uint32 = 504 // 处理超时
+)
+
+// ResultError Result非0的响应转换的错误
+type ResultError struct {
+	Result uint32
+	Msg    string
+}
+
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("grpc result %d: %s", e.Result, e.Msg)
+}
+
+// ErrorReply 创建request对应的错误响应
+func ErrorReply(request *Message, result uint32, err error) *Message {
+	return &Message{
+		Command: request.Command,
+		PkgType: PkgTypeReply,
+		ReqId:   request.ReqId,
+		Seq:     request.Seq,
+		Result:  result,
+		Body:    []byte(err.Error()),
+	}
+}
@@ -1,32 +1,166 @@
 package grpc
 
-import "github.com/qiafan666/gotato/commons/gface"
+import (
+	"context"
+	"fmt"
+	"github.com/qiafan666/gotato/commons/gerr"
+	"github.com/qiafan666/gotato/commons/gface"
+	"runtime/debug"
+	"time"
+)
 
 type Handler interface {
 	Handle(*Message) *Message
 }
 
+// ContextHandler 可获取请求上下文的Handler，注册后优先调用HandleContext
+type ContextHandler interface {
+	HandleContext(ctx context.Context, request *Message) *Message
+}
+
+// route 已注册的命令
+type route struct {
+	handler Handler
+	timeout time.Duration // 处理超时,0为不限制
+}
+
+// RouteOption 注册命令时的可选配置
+type RouteOption func(*route)
+
+// WithRouteTimeout 设置命令的处理超时,超时回复ResultTimeout
+func WithRouteTimeout(timeout time.Duration) RouteOption {
+	return func(r *route) {
+		r.timeout = timeout
+	}
+}
+
 type Router struct {
-	routes map[Command]Handler
-	logger gface.ILogger
+	routes      map[Command]*route
+	streams     map[Command]StreamHandler
+	interceptor ServerInterceptor
+	logger      gface.ILogger
 }
 
 func NewRouter(logger gface.ILogger) *Router {
-	r := &Router{routes: make(map[Command]Handler), logger: logger}
+	r := &Router{
+		routes:  make(map[Command]*route),
+		streams: make(map[Command]StreamHandler),
+		logger:  logger,
+	}
 	return r
 }
 
-func (r *Router) Register(cmd Command, handler Handler) {
-	r.routes[cmd] = handler
+func (r *Router) Register(cmd Command, handler Handler, opts ...RouteOption) {
+	rt := &route{handler: handler}
+	for _, opt := range opts {
+		opt(rt)
+	}
+	r.routes[cmd] = rt
+}
+
+// Use 追加服务端拦截器,按添加顺序由外到内执行,同样作用于流式命令
+// 流式命令的next返回nil,拦截器直接返回的响应作为流的结束帧发送
+// 需在服务启动前调用
+func (r *Router) Use(interceptors ...ServerInterceptor) {
+	if r.interceptor != nil {
+		interceptors = append([]ServerInterceptor{r.interceptor}, interceptors...)
+	}
+	r.interceptor = ChainServerInterceptors(interceptors...)
+}
+
+// RegisterStream 注册流式处理
+func (r *Router) RegisterStream(cmd Command, handler StreamHandler) {
+	r.streams[cmd] = handler
 }
 
 func (r *Router) Handle(msg *Message, out chan<- *Message) {
+	r.HandleContext(context.Background(), msg, out)
+}
+
+func (r *Router) HandleContext(ctx context.Context, msg *Message, out chan<- *Message) {
 	r.logger.DebugF(nil, "grpc handle request msg, command:%d,reqId:%d,data:%s", msg.Command, msg.ReqId, msg.Body)
-	if handler, ok := r.routes[msg.Command]; ok {
-		resp := handler.Handle(msg)
-		r.logger.DebugF(nil, "grpc handle response msg, command:%d,reqId:%d,data:%s", resp.Command, resp.ReqId, resp.Body)
-		out <- resp
-	} else {
+	if handler, ok := r.streams[msg.Command]; ok {
+		r.handleStream(ctx, handler, msg, out)
+		return
+	}
+	rt, ok := r.routes[msg.Command]
+	if !ok {
 		r.logger.ErrorF(nil, "grpc handle request msg:%v, command not found", msg)
+		send(ctx, out, ErrorReply(msg, ResultNotFound, gerr.New("command not found", "command", msg.Command)))
+		return
+	}
+
+	handle := rt.handle
+	if rt.timeout > 0 {
+		handle = func(ctx context.Context, request *Message) *Message {
+			return handleWithTimeout(ctx, request, rt.handle, rt.timeout)
+		}
+	}
+	var resp *Message
+	if r.interceptor != nil {
+		resp = r.interceptor(ctx, msg, handle)
+	} else {
+		resp = handle(ctx, msg)
+	}
+	if resp == nil {
+		r.logger.WarnF(nil, "grpc handle request msg, command:%d,reqId:%d, handler returned nil", msg.Command, msg.ReqId)
+		return
+	}
+	r.logger.DebugF(nil, "grpc handle response msg, command:%d,reqId:%d,data:%s", resp.Command, resp.ReqId, resp.Body)
+	send(ctx, out, resp)
+}
+
+// send 写入响应，请求取消(连接断开或服务端停止)后放弃，避免out无人读取时永久阻塞
+func send(ctx context.Context, out chan<- *Message, resp *Message) {
+	select {
+	case out <- resp:
+	case <-ctx.Done():
+	}
+}
+
+// handle 调用注册的处理函数
+func (rt *route) handle(ctx context.Context, request *Message) *Message {
+	if h, ok := rt.handler.(ContextHandler); ok {
+		return h.HandleContext(ctx, request)
+	}
+	return rt.handler.Handle(request)
+}
+
+// handleStream 经过拦截器链调用流式处理函数,处理函数panic时回复ResultInternal结束帧
+func (r *Router) handleStream(ctx context.Context, handler StreamHandler, msg *Message, out chan<- *Message) {
+	stream := NewStream(ctx, msg, out)
+	defer func() {
+		if p := recover(); p != nil {
+			r.logger.ErrorF(nil, "grpc handle stream panic, command:%d,reqId:%d,panic:%v\n%s", msg.Command, msg.ReqId, p, debug.Stack())
+			if !stream.Ended() {
+				_ = stream.End(ResultInternal, []byte(fmt.Sprintf("internal error: %v", p)))
+			}
+		}
+	}()
+
+	var err error
+	final := func(ctx context.Context, request *Message) *Message {
+		err = handler.HandleStream(ctx, request, stream)
+		return nil
+	}
+	var resp *Message
+	if r.interceptor != nil {
+		resp = r.interceptor(ctx, msg, final)
+	} else {
+		final(ctx, msg)
+	}
+	if stream.Ended() {
+		return
+	}
+	if resp != nil {
+		// 拦截器拒绝(鉴权、限流)或恢复panic后的响应
+		_ = stream.End(resp.Result, resp.Body)
+		return
+	}
+	if err != nil {
+		r.logger.WarnF(nil, "grpc handle stream fail, command:%d,reqId:%d,err:%v", msg.Command, msg.ReqId, err)
+		_ = stream.End(ResultFail, []byte(err.Error()))
+		return
 	}
+	_ = stream.End(0, nil)
 }
@@ -1,5 +1,37 @@
 package grpc
 
+import "context"
+
 type IHandler interface {
 	Handle(request *Message, ch chan<- *Message)
 }
+
+// IContextHandler 可获取请求上下文(连接ID等)的处理接口，服务端优先调用HandleContext
+type IContextHandler interface {
+	HandleContext(ctx context.Context, request *Message, ch chan<- *Message)
+}
+
+// IPusher 服务端主动推送接口
+type IPusher interface {
+	// Push 推送消息到指定连接
+	Push(connId string, msg *Message) error
+	// Broadcast 推送消息到分组内的所有连接，返回成功推送的连接数
+	Broadcast(group string, msg *Message) int
+	// JoinGroup 连接加入分组
+	JoinGroup(connId string, group string) error
+	// LeaveGroup 连接离开分组
+	LeaveGroup(connId string, group string)
+}
+
+type connIdKey struct{}
+
+// WithConnId 在上下文中设置连接ID
+func WithConnId(ctx context.Context, connId string) context.Context {
+	return context.WithValue(ctx, connIdKey{}, connId)
+}
+
+// ConnIdFromContext 从上下文中获取连接ID，不存在时返回空字符串
+func ConnIdFromContext(ctx context.Context) string {
+	connId, _ := ctx.Value(connIdKey{}).(string)
+	return connId
+}
@@ -0,0 +1,80 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrStreamEnded 流已结束
+var ErrStreamEnded = errors.New("grpc stream ended")
+
+// StreamHandler 流式处理接口，一个请求可通过stream回复多帧
+// 返回后若未调用End，Router会自动发送结束帧，返回error时结束帧Result为ResultFail
+type StreamHandler interface {
+	HandleStream(ctx context.Context, request *Message, stream *Stream) error
+}
+
+// Stream 请求级别的流式响应 goroutine safe
+type Stream struct {
+	ctx     context.Context
+	request *Message
+	out     chan<- *Message
+	mu      sync.Mutex // 保证帧的发送顺序
+	ended   atomic.Bool
+}
+
+// NewStream 创建请求对应的流，帧写入out
+func NewStream(ctx context.Context, request *Message, out chan<- *Message) *Stream {
+	return &Stream{ctx: ctx, request: request, out: out}
+}
+
+// Context 请求上下文，连接断开后会被取消
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+// Send 发送一帧响应
+func (s *Stream) Send(body []byte) error {
+	return s.write(PkgTypeStream, 0, body)
+}
+
+// End 发送结束帧，之后的Send/End返回ErrStreamEnded
+func (s *Stream) End(result uint32, body []byte) error {
+	return s.write(PkgTypeStreamEnd, result, body)
+}
+
+// Ended 是否已发送结束帧
+func (s *Stream) Ended() bool {
+	return s.ended.Load()
+}
+
+func (s *Stream) write(pkgType PkgType, result uint32, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended.Load() {
+		return ErrStreamEnded
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if pkgType == PkgTypeStreamEnd {
+		s.ended.Store(true)
+	}
+	msg := &Message{
+		Command: s.request.Command,
+		PkgType: pkgType,
+		ReqId:   s.request.ReqId,
+		Seq:     s.request.Seq,
+		Result:  result,
+		Body:    body,
+	}
+	// out已满时随请求取消放弃发送，避免处理协程永久阻塞
+	select {
+	case s.out <- msg:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
@@ -0,0 +1,144 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"github.com/qiafan666/gotato/commons/gcache/gconsistent"
+	"github.com/qiafan666/gotato/commons/grpc"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrNoEndpoint 没有可用的服务实例
+var ErrNoEndpoint = errors.New("tcp no available endpoint")
+
+// 内置负载均衡策略
+const (
+	BalancerRoundRobin   = "round_robin"
+	BalancerLeastPending = "least_pending"
+	BalancerConsistent   = "consistent_hash"
+)
+
+const defaultHashReplicas = 100
+
+// IBalancer 负载均衡接口,Update与Pick可能并发调用
+type IBalancer interface {
+	// Update 可用实例变化时调用,endpoints已按地址排序
+	Update(endpoints []*Endpoint)
+	// Pick 为请求选择实例
+	Pick(ctx context.Context, request *grpc.Message) (*Endpoint, error)
+}
+
+// NewBalancer 按名字创建内置负载均衡,未知名字使用轮询
+func NewBalancer(name string) IBalancer {
+	switch name {
+	case BalancerLeastPending:
+		return &leastPendingBalancer{}
+	case BalancerConsistent:
+		return &consistentBalancer{}
+	default:
+		return &roundRobinBalancer{}
+	}
+}
+
+type hashKey struct{}
+
+// WithHashKey 设置一致性哈希的key,如用户ID,未设置时使用请求ReqId
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKey{}, key)
+}
+
+// HashKeyFromContext 获取一致性哈希的key
+func HashKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(hashKey{}).(string)
+	return key, ok
+}
+
+// ------------------------ round robin ------------------------
+
+type roundRobinBalancer struct {
+	mu        sync.RWMutex
+	endpoints []*Endpoint
+	next      atomic.Uint64
+}
+
+func (b *roundRobinBalancer) Update(endpoints []*Endpoint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.endpoints = endpoints
+}
+
+func (b *roundRobinBalancer) Pick(context.Context, *grpc.Message) (*Endpoint, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.endpoints) == 0 {
+		return nil, ErrNoEndpoint
+	}
+	idx := b.next.Add(1) - 1
+	return b.endpoints[idx%uint64(len(b.endpoints))], nil
+}
+
+// ------------------------ least pending ------------------------
+
+// leastPendingBalancer 选择进行中请求数最少的实例,相同时轮询
+type leastPendingBalancer struct {
+	roundRobinBalancer
+}
+
+func (b *leastPendingBalancer) Pick(context.Context, *grpc.Message) (*Endpoint, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	n := len(b.endpoints)
+	if n == 0 {
+		return nil, ErrNoEndpoint
+	}
+	start := int((b.next.Add(1) - 1) % uint64(n))
+	var picked *Endpoint
+	for i := 0; i < n; i++ {
+		e := b.endpoints[(start+i)%n]
+		if picked == nil || e.Pending() < picked.Pending() {
+			picked = e
+		}
+	}
+	return picked, nil
+}
+
+// ------------------------ consistent hash ------------------------
+
+// consistentBalancer 相同key的请求落到同一实例,实例变化时只影响部分key
+type consistentBalancer struct {
+	mu        sync.RWMutex
+	circle    *gconsistent.Consistent
+	endpoints map[string]*Endpoint
+}
+
+func (b *consistentBalancer) Update(endpoints []*Endpoint) {
+	circle := gconsistent.New(defaultHashReplicas)
+	m := make(map[string]*Endpoint, len(endpoints))
+	for _, e := range endpoints {
+		circle.Add(e.Addr)
+		m[e.Addr] = e
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.circle = circle
+	b.endpoints = m
+}
+
+func (b *consistentBalancer) Pick(ctx context.Context, request *grpc.Message) (*Endpoint, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.endpoints) == 0 {
+		return nil, ErrNoEndpoint
+	}
+	key, ok := HashKeyFromContext(ctx)
+	if !ok {
+		key = strconv.FormatInt(request.ReqId, 10)
+	}
+	addr, err := b.circle.Get(key)
+	if err != nil {
+		return nil, ErrNoEndpoint
+	}
+	return b.endpoints[addr], nil
+}
@@ -0,0 +1,162 @@
+package tcp
+
+import (
+	"context"
+	"github.com/qiafan666/gotato/commons/gface"
+	"github.com/qiafan666/gotato/commons/grpc"
+	"testing"
+	"time"
+)
+
+const cmdAddr grpc.Command = 101
+
+// addrHandler 返回处理请求的服务端地址
+type addrHandler string
+
+func (h addrHandler) Handle(request *grpc.Message) *grpc.Message {
+	return &grpc.Message{Command: request.Command, PkgType: grpc.PkgTypeReply, ReqId: request.ReqId, Seq: request.Seq, Body: []byte(h)}
+}
+
+func newServiceCluster(t *testing.T, ctx context.Context, n int) ([]string, []context.CancelFunc) {
+	addrs := make([]string, n)
+	stops := make([]context.CancelFunc, n)
+	for i := 0; i < n; i++ {
+		srvCtx, stop := context.WithCancel(ctx)
+		srv, router, addr := newTestServer(t, srvCtx, nil)
+		router.Register(cmdAddr, addrHandler(addr))
+		srv.Run(srvCtx)
+		addrs[i], stops[i] = addr, stop
+	}
+	return addrs, stops
+}
+
+func newTestServiceClient(t *testing.T, ctx context.Context, resolver IResolver, balancer string) *ServiceClient {
+	sc, err := NewServiceClient(ctx, "game", resolver, &ServiceClientOptions{
+		Client: ClientOptions{
+			MaxConn:    1,
+			Timeout:    time.Second,
+			RetryLimit: 1,
+			Logger:     gface.NewLogger("client", nil),
+		},
+		Balancer:       NewBalancer(balancer),
+		HealthInterval: 100 * time.Millisecond,
+		EjectFailures:  1,
+		EjectDuration:  200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sc
+}
+
+func callAddr(ctx context.Context, c grpc.IClient) (string, error) {
+	resp, err := c.Do(ctx, &grpc.Message{Command: cmdAddr, PkgType: grpc.PkgTypeRequest, ReqId: 1, Seq: grpc.NewSeq()})
+	if err != nil {
+		return "", err
+	}
+	return string(resp.Body), nil
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestServiceClientRoundRobin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addrs, stops := newServiceCluster(t, ctx, 3)
+	resolver := NewStaticResolver(map[string][]string{"game": addrs})
+	sc := newTestServiceClient(t, ctx, resolver, BalancerRoundRobin)
+	defer sc.Close()
+
+	hits := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		addr, err := callAddr(ctx, sc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hits[addr]++
+	}
+	for _, addr := range addrs {
+		if hits[addr] != 2 {
+			t.Fatalf("want 2 hits per endpoint, got %v", hits)
+		}
+	}
+
+	// 缩容
+	resolver.Set("game", addrs[:2])
+	waitFor(t, "endpoint removed", func() bool { return len(sc.Endpoints()) == 2 })
+	for i := 0; i < 4; i++ {
+		if addr, err := callAddr(ctx, sc); err != nil || addr == addrs[2] {
+			t.Fatalf("unexpected addr=%s, err=%v", addr, err)
+		}
+	}
+
+	// 实例宕机后被摘除,请求不再落到该实例
+	stops[0]()
+	waitFor(t, "endpoint ejected", func() bool {
+		for _, stat := range sc.Endpoints() {
+			if stat.Addr == addrs[0] {
+				return !stat.Healthy
+			}
+		}
+		return false
+	})
+	for i := 0; i < 4; i++ {
+		if addr, err := callAddr(ctx, sc); err != nil || addr != addrs[1] {
+			t.Fatalf("unexpected addr=%s, err=%v", addr, err)
+		}
+	}
+
+	resolver.Set("game", nil)
+	waitFor(t, "all endpoints removed", func() bool { return len(sc.Endpoints()) == 0 })
+	if _, err := callAddr(ctx, sc); err == nil {
+		t.Fatal("want no endpoint error")
+	}
+}
+
+func TestServiceClientConsistentHash(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addrs, _ := newServiceCluster(t, ctx, 3)
+	sc := newTestServiceClient(t, ctx, NewStaticResolver(map[string][]string{"game": addrs}), BalancerConsistent)
+	defer sc.Close()
+
+	for _, user := range []string{"u1", "u2", "u3", "u4"} {
+		userCtx := WithHashKey(ctx, user)
+		first, err := callAddr(userCtx, sc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			if addr, _ := callAddr(userCtx, sc); addr != first {
+				t.Fatalf("user %s moved from %s to %s", user, first, addr)
+			}
+		}
+	}
+}
+
+func TestLeastPendingBalancer(t *testing.T) {
+	endpoints := []*Endpoint{{Addr: "a"}, {Addr: "b"}, {Addr: "c"}}
+	endpoints[0].pending.Store(3)
+	endpoints[1].pending.Store(1)
+	endpoints[2].pending.Store(2)
+	b := NewBalancer(BalancerLeastPending)
+	b.Update(endpoints)
+	for i := 0; i < 3; i++ {
+		e, err := b.Pick(context.Background(), &grpc.Message{})
+		if err != nil || e.Addr != "b" {
+			t.Fatalf("want b, got %+v, err=%v", e, err)
+		}
+	}
+	b.Update(nil)
+	if _, err := b.Pick(context.Background(), &grpc.Message{}); err != ErrNoEndpoint {
+		t.Fatalf("want ErrNoEndpoint, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package tcp
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/afex/hystrix-go/hystrix"
 	"github.com/qiafan666/gotato/commons/gcast"
@@ -12,6 +13,7 @@ import (
 	"github.com/qiafan666/gotato/commons/grpc"
 	"github.com/qiafan666/gotato/commons/grpc/tcp/protocol"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -27,6 +29,20 @@ type ClientOptions struct {
 
 	Hystrix HystrixOptions // hystrix配置
 	Logger  gface.ILogger  // 日志接口
+
+	Dialer func(addr string, timeout time.Duration) (net.Conn, error) // 自定义拨号,如WebSocket网关的ws.Dialer,不为空时忽略TLS
+
+	TLS   *TLSOptions // 不为空时使用TLS连接
+	Token string      // 不为空时建立连接后先进行token握手
+
+	Compress          string // 请求body压缩算法,如grpc.CompressGzip,为空不压缩
+	CompressThreshold int    // body达到该长度 字节时压缩,默认1KB
+
+	Interceptors []grpc.ClientInterceptor // 客户端拦截器,按顺序由外到内执行
+
+	ProtocolVersion uint8 // 建立连接后协商的最高协议版本,为0时不协商使用protocol.Version1
+	MaxFrameSize    int   // 单帧ext+body最大长度,超过时关闭连接,默认16MB
+	Checksum        bool  // 请求为Version2及以上时附带CRC32
 }
 
 // HystrixOptions hystrix配置
@@ -66,6 +82,8 @@ func (h *HystrixOptions) Parse() hystrix.CommandConfig {
 	return conf
 }
 
+var _ grpc.IClient = (*Client)(nil)
+
 // Client TCP客户端结构体
 type Client struct {
 	network string
@@ -79,9 +97,22 @@ type Client struct {
 
 	hystrixCommandName string // hystrix命令名称
 
+	tlsConf *tls.Config // TLS配置,为空时使用明文连接
+
+	subMu sync.RWMutex
+	subs  map[grpc.Command]PushHandler // 推送订阅
+
+	interceptor grpc.ClientInterceptor // 合并后的客户端拦截器
+
 	logger gface.ILogger
 }
 
+// PushHandler 推送消息处理函数
+type PushHandler func(msg *grpc.Message)
+
+// StreamFrameHandler 流式响应帧处理函数,返回error时终止接收
+type StreamFrameHandler func(frame *grpc.Message) error
+
 // NewClient 创建新的TCP客户端
 // ctx: 上下文
 // addr: 服务器地址
@@ -91,15 +122,32 @@ func NewClient(ctx context.Context, addr string, opt *ClientOptions) *Client {
 		network: "tcp",
 		addr:    addr,
 		opt:     opt,
+		subs:    make(map[grpc.Command]PushHandler),
 		logger:  opt.Logger,
 	}
-	c.protocol = protocol.New()
+	c.interceptor = grpc.ChainClientInterceptors(opt.Interceptors...)
+	protoOpts := []protocol.Option{
+		protocol.WithCompress(opt.Compress, opt.CompressThreshold),
+		protocol.WithMaxFrameSize(opt.MaxFrameSize),
+	}
+	if opt.Checksum {
+		protoOpts = append(protoOpts, protocol.WithChecksum())
+	}
+	c.protocol = protocol.New(protoOpts...)
+
+	if opt.TLS != nil {
+		tlsConf, err := opt.TLS.clientTLSConfig(addr)
+		if err != nil {
+			c.logger.ErrorF(nil, "Client.NewClient: load tls config fail, err=%+v", err)
+		}
+		c.tlsConf = tlsConf
+	}
 
 	connPool, err := gpool.NewPool[*Conn](ctx, &gpool.Options[*Conn]{
 		MaxSize:  uint(opt.MaxConn),
 		InitSize: uint(opt.IdleConn),
 		New: func() (*Conn, error) {
-			conn, err := net.DialTimeout(c.network, c.addr, c.opt.Timeout)
+			conn, err := c.dial()
 			if err != nil {
 				return nil, err
 			}
@@ -109,7 +157,21 @@ func NewClient(ctx context.Context, addr string, opt *ClientOptions) *Client {
 				IdleTimeout: opt.IdleTimeout,
 				LiveTimeout: opt.LiveTimeout,
 				Logger:      opt.Logger,
+				OnPush:      c.dispatchPush,
+				Protocol:    c.protocol,
 			})
+			if opt.ProtocolVersion > protocol.Version1 {
+				if _, err = newConn.Negotiate(ctx, min(opt.ProtocolVersion, protocol.LatestVersion)); err != nil {
+					newConn.Close()
+					return nil, err
+				}
+			}
+			if opt.Token != "" {
+				if err = newConn.Handshake(opt.Token); err != nil {
+					newConn.Close()
+					return nil, err
+				}
+			}
 			return newConn, nil
 		},
 	})
@@ -127,15 +189,41 @@ func NewClient(ctx context.Context, addr string, opt *ClientOptions) *Client {
 	return c
 }
 
+// dial 建立到服务器的连接,配置了TLS时完成TLS握手
+func (c *Client) dial() (net.Conn, error) {
+	if c.opt.Dialer != nil {
+		return c.opt.Dialer(c.addr, c.opt.Timeout)
+	}
+	if c.opt.TLS == nil {
+		return net.DialTimeout(c.network, c.addr, c.opt.Timeout)
+	}
+	if c.tlsConf == nil {
+		return nil, gerr.New("invalid tls config")
+	}
+	dialer := &net.Dialer{Timeout: c.opt.Timeout}
+	return tls.DialWithDialer(dialer, c.network, c.addr, c.tlsConf)
+}
+
 // Do 执行RPC调用
 // ctx: 上下文
 // request: RPC请求消息
+// opts: 单次调用配置,如grpc.WithMetadata;ctx含deadline时会随请求传给服务端
+// 配置了Interceptors时请求先依次经过拦截器
 // 返回: RPC响应消息和错误信息
-func (c *Client) Do(ctx context.Context, request *grpc.Message) (*grpc.Message, error) {
+func (c *Client) Do(ctx context.Context, request *grpc.Message, opts ...grpc.CallOption) (*grpc.Message, error) {
+	if c.interceptor != nil {
+		return c.interceptor(ctx, request, c.invoke, opts...)
+	}
+	return c.invoke(ctx, request, opts...)
+}
+
+// invoke 经过hystrix熔断执行RPC调用
+func (c *Client) invoke(ctx context.Context, request *grpc.Message, opts ...grpc.CallOption) (*grpc.Message, error) {
 	var (
 		res *grpc.Message
 		err error
 	)
+	grpc.ApplyCallOptions(ctx, request, opts...)
 	hystrix.Do(c.hystrixCommandName, func() error {
 		res, err = c.do(ctx, request)
 		if err != nil {
@@ -242,3 +330,109 @@ func (c *Client) do(ctx context.Context, request *grpc.Message) (*grpc.Message,
 	}
 	return nil, nil
 }
+
+// Ping 从连接池获取连接并发送心跳,用于健康检查
+func (c *Client) Ping(ctx context.Context) error {
+	if c.pool == nil {
+		return gerr.New("conn pool not initialized", "addr", c.addr)
+	}
+	conn, err := c.pool.Get(ctx)
+	defer c.pool.Put(conn)
+	if err != nil {
+		return gerr.WrapMsg(err, "get conn fail")
+	}
+	if err = conn.Ping(ctx); err != nil {
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+// Close 关闭客户端及连接池中的所有连接
+func (c *Client) Close() {
+	if c.pool != nil {
+		c.pool.Close()
+	}
+}
+
+// Subscribe 订阅指定命令的推送消息,同一命令重复订阅会覆盖
+// 推送只会到达服务端已知的连接,通常需先通过请求让服务端记录连接(如加入分组)
+func (c *Client) Subscribe(cmd grpc.Command, handler PushHandler) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	c.subs[cmd] = handler
+}
+
+// Unsubscribe 取消订阅
+func (c *Client) Unsubscribe(cmd grpc.Command) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	delete(c.subs, cmd)
+}
+
+// dispatchPush 分发推送消息到订阅者
+func (c *Client) dispatchPush(msg *grpc.Message) {
+	c.subMu.RLock()
+	handler, ok := c.subs[msg.Command]
+	c.subMu.RUnlock()
+	if !ok {
+		c.logger.DebugF(nil, "Client.dispatchPush: no subscriber, command=%d", msg.Command)
+		return
+	}
+	handler(msg)
+}
+
+// Stream 发起流式请求,每收到一帧调用onFrame,直到收到结束帧
+// 两帧之间的等待超过ClientOptions.Timeout视为超时,流式请求不经过hystrix且不重试
+// 返回: 结束帧,其Result非0时body为服务端错误描述
+func (c *Client) Stream(ctx context.Context, request *grpc.Message, onFrame StreamFrameHandler, opts ...grpc.CallOption) (*grpc.Message, error) {
+	if ctx.Err() != nil {
+		return nil, gerr.WrapMsg(ctx.Err(), "context canceled")
+	}
+	grpc.ApplyCallOptions(ctx, request, opts...)
+
+	conn, err := c.pool.Get(ctx)
+	defer c.pool.Put(conn)
+	if err != nil {
+		c.logger.ErrorF(nil, "Client.Stream: get conn fail, reqId=%+v, err=%+v", request.ReqId, err)
+		return nil, gerr.WrapMsg(err, "get conn fail")
+	}
+
+	ch := NewStreamRecvChan(fmt.Sprintf("%d", request.Seq), defaultStreamBuffer)
+	defer func() {
+		conn.RemoveChan(ch)
+		ch.Close()
+	}()
+	if err = conn.Send(request, ch); err != nil {
+		conn.Close()
+		return nil, gerr.WrapMsg(err, "send message fail")
+	}
+
+	timer := time.NewTimer(c.opt.Timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, gerr.WrapMsg(ctx.Err(), "context canceled")
+
+		case frame := <-ch.Ch:
+			if frame == nil {
+				return nil, gerr.New("receive chan closed")
+			}
+			if frame.PkgType == grpc.PkgTypeStreamEnd || frame.PkgType == grpc.PkgTypeReply {
+				return frame, nil
+			}
+			if err = onFrame(frame); err != nil {
+				return nil, err
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(c.opt.Timeout)
+
+		case <-timer.C:
+			c.logger.DebugF(ctx, "Client.Stream: receive timeout, reqId=%+v", request.ReqId)
+			return nil, gerr.New("receive timeout")
+		}
+	}
+}
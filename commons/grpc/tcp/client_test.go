@@ -90,7 +90,7 @@ func TestHeartbeat(t *testing.T) {
 		IdleConn:   0,
 		Timeout:    10 * time.Second,
 		RetryLimit: 2,
-		Logger:     gface.NewLogger("testHeartbeat", zapLog()),
+		Logger:     gface.NewLogger("testHeartbeat", zapLog(t)),
 	})
 	_ = client
 
@@ -3,6 +3,7 @@ package tcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/qiafan666/gotato/commons/gcache"
 	"github.com/qiafan666/gotato/commons/gerr"
@@ -12,16 +13,19 @@ import (
 	"github.com/qiafan666/gotato/commons/grpc/tcp/protocol"
 	"github.com/qiafan666/gotato/commons/gticker"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // 定义默认的超时时间常量
 const (
-	defaultTimeout     = 2 * time.Second  // 默认超时时间
-	defaultPingTimeout = 3 * time.Second  // 默认心跳超时时间,3s
-	defaultIdleTimeout = 30 * time.Second // 默认空闲超时时间,30s
-	defaultLiveTimeout = 2 * time.Hour    // 默认存活超时时间,2h
+	defaultTimeout      = 2 * time.Second  // 默认超时时间
+	defaultPingTimeout  = 3 * time.Second  // 默认心跳超时时间,3s
+	defaultIdleTimeout  = 30 * time.Second // 默认空闲超时时间,30s
+	defaultLiveTimeout  = 2 * time.Hour    // 默认存活超时时间,2h
+	defaultStreamBuffer = 64               // 流式响应接收缓冲帧数
 )
 
 // RecvChan 接收响应的通道封装
@@ -30,32 +34,49 @@ type RecvChan struct {
 	Ch        chan *grpc.Message // 消息通道
 	closeOnce sync.Once          // 确保只关闭一次
 	closed    bool               // 关闭标志
+	done      chan struct{}      // 关闭信号,唤醒阻塞中的Write
+	mu        sync.RWMutex       // 保证Close时没有正在进行的Write
 }
 
 // NewRecvChan 创建一个用于接收响应的channel
 // chanId: 通道ID,需要确保唯一
 func NewRecvChan(chanId string) *RecvChan {
-	ch := make(chan *grpc.Message)
+	return NewStreamRecvChan(chanId, 0)
+}
+
+// NewStreamRecvChan 创建一个用于接收流式响应的带缓冲channel
+// chanId: 通道ID,需要确保唯一
+// size: 缓冲帧数
+func NewStreamRecvChan(chanId string, size int) *RecvChan {
 	return &RecvChan{
 		ChanId: chanId,
-		Ch:     ch,
+		Ch:     make(chan *grpc.Message, size),
+		done:   make(chan struct{}),
 	}
 }
 
 // Close 关闭接收通道
 func (ch *RecvChan) Close() {
 	ch.closeOnce.Do(func() {
+		close(ch.done)
+		ch.mu.Lock()
+		defer ch.mu.Unlock()
 		ch.closed = true
 		close(ch.Ch)
 	})
 }
 
-// Write 写入响应消息到通道
+// Write 写入响应消息到通道,通道关闭时丢弃
 func (ch *RecvChan) Write(msg *grpc.Message) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
 	if ch.closed {
 		return
 	}
-	ch.Ch <- msg
+	select {
+	case ch.Ch <- msg:
+	case <-ch.done:
+	}
 }
 
 // ConnOptions TCP连接配置选项
@@ -65,6 +86,9 @@ type ConnOptions struct {
 	IdleTimeout time.Duration // 空闲超时时间
 	LiveTimeout time.Duration // 最大存活时间
 	Logger      gface.ILogger // 日志接口
+
+	OnPush   func(msg *grpc.Message) // 推送消息回调,在读协程中顺序调用,不应阻塞
+	Protocol grpc.IProtocol          // 编解码协议,为空时使用默认协议
 }
 
 // Conn TCP连接封装
@@ -82,6 +106,7 @@ type Conn struct {
 	recvChans *gcache.ShardLockMap[string, *RecvChan] // 响应接收通道映射表
 
 	protocol grpc.IProtocol // RPC协议实现
+	version  atomic.Uint32  // 协商的协议版本,0为未协商
 
 	pingDeadline time.Time // 心跳超时截止时间
 	idleDeadline time.Time // 空闲超时截止时间
@@ -110,11 +135,14 @@ func NewConn(ctx context.Context, conn net.Conn, opt *ConnOptions) *Conn {
 		cancel:          cancel,
 		connId:          connId,
 		closeOnce:       sync.Once{},
-		closeChanNotify: make(chan any),
+		closeChanNotify: make(chan any, 1), // 带缓冲,未放入连接池的连接关闭时不会阻塞
 		recvChans:       gcache.NewShardLockMap[*RecvChan](),
-		protocol:        protocol.New(),
+		protocol:        opt.Protocol,
 		logger:          opt.Logger,
 	}
+	if c.protocol == nil {
+		c.protocol = protocol.New()
+	}
 	c.logger.DebugF(nil, "NewConn: connId=%+v, local=%s, remote=%s", connId, conn.LocalAddr().String(), conn.RemoteAddr().String())
 
 	// 设置连接选项
@@ -224,6 +252,13 @@ func (c *Conn) Send(v *grpc.Message, ch *RecvChan) error {
 		return gerr.New("send on closed conn")
 	}
 
+	// 未指定版本时使用协商的版本,复制消息避免影响重试或其他连接
+	if version := c.Version(); v.Version == 0 && version != 0 {
+		versioned := *v
+		versioned.Version = version
+		v = &versioned
+	}
+
 	// 编码消息
 	encode, e := c.protocol.Encode(c.ctx, v)
 	if e != nil {
@@ -260,11 +295,23 @@ func (c *Conn) read(ctx context.Context) {
 		// 解码接收到的消息
 		v, e := c.protocol.Decode(ctx, c)
 		if e != nil {
-			continue
+			// 单条消息内容错误可跳过,读取错误(对端关闭、TLS错误等)退出读循环
+			if errors.Is(e, protocol.ErrMalformed) {
+				c.logger.WarnF(nil, "Conn.read: decode fail, connId=%+v, err=%+v", c.connId, e)
+				continue
+			}
+			c.logger.DebugF(nil, "Conn.read: read fail, connId=%+v, err=%+v", c.connId, e)
+			return
 		}
 
 		// 处理心跳消息
 		if v.Command == grpc.CmdHeartbeat {
+			// Ping发起的心跳请求Seq不为0,响应写入对应的接收通道
+			if v.PkgType == grpc.PkgTypeReply && v.Seq != 0 {
+				if ch, ok := c.recvChans.Pop(heartbeatChanId(v.Seq)); ok {
+					ch.Write(v)
+				}
+			}
 			go c.handleHeartbeat(v)
 			continue
 		}
@@ -274,13 +321,27 @@ func (c *Conn) read(ctx context.Context) {
 
 		// 处理推送消息
 		if v.PkgType == grpc.PkgTypePush {
-			//TODO push
-			c.logger.DebugF(nil, "Conn.read: receive push msg, msg=%s", v.Body)
+			c.logger.DebugF(nil, "Conn.read: receive push msg, command=%d", v.Command)
+			if c.opt.OnPush != nil {
+				c.opt.OnPush(v)
+			}
 			continue
 		}
 
 		// 查找并写入对应的接收通道
 		chanId := fmt.Sprintf("%d", v.Seq)
+
+		// 流式响应中间帧,保留接收通道直到结束帧
+		if v.PkgType == grpc.PkgTypeStream {
+			ch, ok := c.recvChans.Get(chanId)
+			if !ok {
+				c.logger.DebugF(nil, "Conn.read: stream recvChan not exist, Seq=%+v", chanId)
+				continue
+			}
+			ch.Write(v)
+			continue
+		}
+
 		c.recvChans.RemoveCb(chanId, func(key string, ch *RecvChan, exists bool) bool {
 			if !exists {
 				c.logger.DebugF(nil, "Conn.read: recvChan not exist, Seq=%+v", chanId)
@@ -296,6 +357,97 @@ func (c *Conn) read(ctx context.Context) {
 	}
 }
 
+// Handshake token握手,在发送业务请求前调用,失败时服务端会关闭连接
+func (c *Conn) Handshake(token string) error {
+	seq := grpc.NewSeq()
+	req := &grpc.Message{
+		Command:  grpc.CmdHandshake,
+		PkgType:  grpc.PkgTypeRequest,
+		ReqId:    int64(seq),
+		Seq:      seq,
+		Metadata: grpc.NewMetadata(grpc.MetaToken, token),
+	}
+	ch := NewRecvChan(fmt.Sprintf("%d", seq))
+	defer func() {
+		c.RemoveChan(ch)
+		ch.Close()
+	}()
+	if err := c.Send(req, ch); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch.Ch:
+		if resp == nil {
+			return gerr.New("handshake receive chan closed")
+		}
+		if resp.Result != 0 {
+			return gerr.New("handshake fail", "result", resp.Result, "reason", string(resp.Body))
+		}
+		return nil
+	case <-time.After(c.opt.Timeout):
+		return gerr.New("handshake timeout")
+	}
+}
+
+// Ping 发送心跳请求并等待响应,用于探测对端是否存活
+func (c *Conn) Ping(ctx context.Context) error {
+	_, err := c.heartbeat(ctx, nil)
+	return err
+}
+
+// Negotiate 通过心跳协商协议版本,之后未指定版本的消息使用协商结果编码
+// maxVersion: 本端支持的最高版本;对端不支持协商时使用protocol.Version1
+func (c *Conn) Negotiate(ctx context.Context, maxVersion uint8) (uint8, error) {
+	resp, err := c.heartbeat(ctx, grpc.NewMetadata(grpc.MetaVersion, strconv.Itoa(int(maxVersion))))
+	if err != nil {
+		return 0, err
+	}
+	version := protocol.Version1
+	if v, err := strconv.Atoi(resp.Metadata.Get(grpc.MetaVersion)); err == nil && v > int(version) && v <= int(maxVersion) {
+		version = uint8(v)
+	}
+	c.version.Store(uint32(version))
+	return version, nil
+}
+
+// Version 协商的协议版本,0为未协商
+func (c *Conn) Version() uint8 {
+	return uint8(c.version.Load())
+}
+
+// heartbeat 发送带Seq的心跳请求并等待响应
+func (c *Conn) heartbeat(ctx context.Context, md grpc.Metadata) (*grpc.Message, error) {
+	req := c.pingRequest()
+	req.Seq = grpc.NewSeq()
+	req.ReqId = int64(req.Seq)
+	req.Metadata = md
+	ch := NewRecvChan(heartbeatChanId(req.Seq))
+	defer func() {
+		c.RemoveChan(ch)
+		ch.Close()
+	}()
+	if err := c.Send(req, ch); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, gerr.WrapMsg(ctx.Err(), "ping context done")
+	case resp := <-ch.Ch:
+		if resp == nil {
+			return nil, gerr.New("ping receive chan closed")
+		}
+		return resp, nil
+	case <-time.After(c.opt.PingTimeout):
+		return nil, gerr.New("ping timeout")
+	}
+}
+
+func heartbeatChanId(seq uint32) string {
+	return fmt.Sprintf("hb_%d", seq)
+}
+
 // ping 心跳检查循环
 func (c *Conn) ping(ctx context.Context) {
 	gticker.NewTicker(1500*time.Millisecond, func() {
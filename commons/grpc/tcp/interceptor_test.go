@@ -0,0 +1,153 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"github.com/qiafan666/gotato/commons/grpc"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	cmdPanic grpc.Command = 110 + iota
+	cmdSlow
+	cmdLimited
+	cmdAdmin
+	cmdUnknown
+	cmdAdminStream
+	cmdPanicStream
+)
+
+type funcHandler func(ctx context.Context, request *grpc.Message) *grpc.Message
+
+func (f funcHandler) Handle(request *grpc.Message) *grpc.Message {
+	return f(context.Background(), request)
+}
+
+func (f funcHandler) HandleContext(ctx context.Context, request *grpc.Message) *grpc.Message {
+	return f(ctx, request)
+}
+
+type panicStream struct{}
+
+func (panicStream) HandleStream(ctx context.Context, request *grpc.Message, stream *grpc.Stream) error {
+	panic("boom")
+}
+
+func okReply(ctx context.Context, request *grpc.Message) *grpc.Message {
+	return &grpc.Message{Command: request.Command, PkgType: grpc.PkgTypeReply, ReqId: request.ReqId, Seq: request.Seq}
+}
+
+func TestServerInterceptors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, router, addr := newTestServer(t, ctx, nil)
+	router.Use(
+		grpc.RecoveryInterceptor(srv.logger),
+		grpc.LoggingInterceptor(srv.logger),
+		grpc.AuthInterceptor(func(ctx context.Context, request *grpc.Message) error {
+			if request.Command == cmdAdmin && grpc.MetadataFromContext(ctx).Get("role") != "admin" {
+				return errors.New("admin only")
+			}
+			return nil
+		}),
+	)
+	router.Use(grpc.RateLimitInterceptor(0.001, 2))
+	router.Register(cmdPanic, funcHandler(func(ctx context.Context, request *grpc.Message) *grpc.Message {
+		panic("boom")
+	}))
+	router.Register(cmdSlow, funcHandler(func(ctx context.Context, request *grpc.Message) *grpc.Message {
+		<-ctx.Done()
+		return okReply(ctx, request)
+	}), grpc.WithRouteTimeout(100*time.Millisecond))
+	router.Register(cmdLimited, funcHandler(okReply))
+	router.Register(cmdAdmin, funcHandler(okReply))
+	srv.Run(ctx)
+
+	var calls atomic.Int32
+	client := newTestClient(ctx, addr, &ClientOptions{
+		Interceptors: []grpc.ClientInterceptor{
+			grpc.ClientMetricsInterceptor(func(cmd grpc.Command, result uint32, cost time.Duration, err error) {
+				calls.Add(1)
+			}),
+			grpc.ClientTimeoutInterceptor(2 * time.Second),
+		},
+	})
+
+	call := func(cmd grpc.Command, opts ...grpc.CallOption) uint32 {
+		resp, err := client.Do(ctx, &grpc.Message{Command: cmd, PkgType: grpc.PkgTypeRequest, ReqId: 1, Seq: grpc.NewSeq()}, opts...)
+		if err != nil {
+			t.Fatalf("command %d: %v", cmd, err)
+		}
+		return resp.Result
+	}
+
+	cases := []struct {
+		name string
+		cmd  grpc.Command
+		opts []grpc.CallOption
+		want uint32
+	}{
+		{"unknown", cmdUnknown, nil, grpc.ResultNotFound},
+		{"panic", cmdPanic, nil, grpc.ResultInternal},
+		{"timeout", cmdSlow, nil, grpc.ResultTimeout},
+		{"unauthorized", cmdAdmin, nil, grpc.ResultUnauthorized},
+		{"authorized", cmdAdmin, []grpc.CallOption{grpc.WithMetadata("role", "admin")}, grpc.ResultOK},
+		{"limited1", cmdLimited, nil, grpc.ResultOK},
+		{"limited2", cmdLimited, nil, grpc.ResultOK},
+		{"limited3", cmdLimited, nil, grpc.ResultTooManyRequests},
+	}
+	for _, c := range cases {
+		if got := call(c.cmd, c.opts...); got != c.want {
+			t.Fatalf("%s: want result %d, got %d", c.name, c.want, got)
+		}
+	}
+	if int(calls.Load()) != len(cases) {
+		t.Fatalf("want %d observed calls, got %d", len(cases), calls.Load())
+	}
+}
+
+func TestServerStreamInterceptors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, router, addr := newTestServer(t, ctx, nil)
+	router.Use(grpc.AuthInterceptor(func(ctx context.Context, request *grpc.Message) error {
+		if request.Command == cmdAdminStream && grpc.MetadataFromContext(ctx).Get("role") != "admin" {
+			return errors.New("admin only")
+		}
+		return nil
+	}))
+	router.RegisterStream(cmdAdminStream, countStream{})
+	router.RegisterStream(cmdPanicStream, panicStream{})
+	srv.Run(ctx)
+	client := newTestClient(ctx, addr, nil)
+
+	stream := func(cmd grpc.Command, opts ...grpc.CallOption) (uint32, int) {
+		frames := 0
+		end, err := client.Stream(ctx, &grpc.Message{Command: cmd, PkgType: grpc.PkgTypeRequest, ReqId: 1, Seq: grpc.NewSeq()},
+			func(frame *grpc.Message) error {
+				frames++
+				return nil
+			}, opts...)
+		if err != nil {
+			t.Fatalf("command %d: %v", cmd, err)
+		}
+		return end.Result, frames
+	}
+
+	// 未鉴权的流式命令不执行处理函数
+	if result, frames := stream(cmdAdminStream); result != grpc.ResultUnauthorized || frames != 0 {
+		t.Fatalf("unauthorized stream: result %d, frames %d", result, frames)
+	}
+	if result, frames := stream(cmdAdminStream, grpc.WithMetadata("role", "admin")); result != grpc.ResultOK || frames != 3 {
+		t.Fatalf("authorized stream: result %d, frames %d", result, frames)
+	}
+	// 处理函数panic不影响连接
+	if result, _ := stream(cmdPanicStream); result != grpc.ResultInternal {
+		t.Fatalf("panic stream: result %d", result)
+	}
+	if result, frames := stream(cmdAdminStream, grpc.WithMetadata("role", "admin")); result != grpc.ResultOK || frames != 3 {
+		t.Fatalf("stream after panic: result %d, frames %d", result, frames)
+	}
+}
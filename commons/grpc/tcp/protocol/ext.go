@@ -0,0 +1,90 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/qiafan666/gotato/commons/gerr"
+	"github.com/qiafan666/gotato/commons/grpc"
+)
+
+// ext 格式:
+// | version(1) | count(2) | keyLen(2) | key | valueLen(2) | value | ...
+// ExtSize为0表示无元数据，兼容旧版本；无法识别的version整体忽略
+const (
+	extVersion    = uint8(1)
+	maxExtSize    = math.MaxUint16
+	extHeaderSize = 1 + 2
+)
+
+func packExt(md grpc.Metadata) ([]byte, error) {
+	if len(md) == 0 {
+		return nil, nil
+	}
+	w := bytes.NewBuffer(make([]byte, 0, extHeaderSize+len(md)*16))
+	w.WriteByte(extVersion)
+	_ = binary.Write(w, endian, uint16(len(md)))
+	// 按key排序，保证相同元数据编码结果一致
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := md[k]
+		if len(k) > math.MaxUint16 || len(v) > math.MaxUint16 {
+			return nil, gerr.New("metadata entry too long", "key", k)
+		}
+		_ = binary.Write(w, endian, uint16(len(k)))
+		w.WriteString(k)
+		_ = binary.Write(w, endian, uint16(len(v)))
+		w.WriteString(v)
+	}
+	if w.Len() > maxExtSize {
+		return nil, gerr.New("metadata too long", "maxExtSize", maxExtSize, "extSize", w.Len())
+	}
+	return w.Bytes(), nil
+}
+
+func unpackExt(ext []byte) (grpc.Metadata, error) {
+	if len(ext) == 0 {
+		return nil, nil
+	}
+	if ext[0] != extVersion {
+		return nil, nil
+	}
+	if len(ext) < extHeaderSize {
+		return nil, gerr.WrapMsg(ErrMalformed, "protocol ext too short", "extSize", len(ext))
+	}
+	count := int(endian.Uint16(ext[1:]))
+	pos := extHeaderSize
+	readStr := func() (string, bool) {
+		if pos+2 > len(ext) {
+			return "", false
+		}
+		l := int(endian.Uint16(ext[pos:]))
+		pos += 2
+		if pos+l > len(ext) {
+			return "", false
+		}
+		s := string(ext[pos : pos+l])
+		pos += l
+		return s, true
+	}
+	// 每项至少4字节,避免按伪造的count预分配
+	md := make(grpc.Metadata, min(count, (len(ext)-extHeaderSize)/4))
+	for i := 0; i < count; i++ {
+		k, ok := readStr()
+		if !ok {
+			return nil, gerr.WrapMsg(ErrMalformed, "protocol ext key truncated", "index", i)
+		}
+		v, ok := readStr()
+		if !ok {
+			return nil, gerr.WrapMsg(ErrMalformed, "protocol ext value truncated", "index", i)
+		}
+		md[k] = v
+	}
+	return md, nil
+}
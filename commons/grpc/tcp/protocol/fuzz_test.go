@@ -0,0 +1,127 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/qiafan666/gotato/commons/grpc"
+	"io"
+	"testing"
+)
+
+const fuzzMaxFrameSize = 4096
+
+// countingReader 记录解码器读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func fuzzSeeds(f *testing.F) {
+	ctx := context.Background()
+	messages := []*grpc.Message{
+		{Command: grpc.CmdTestLogic, PkgType: grpc.PkgTypeRequest, ReqId: 1, Seq: 1, Body: []byte(`["BTCUSDT",2,0]`)},
+		{Command: grpc.CmdTestLogic, PkgType: grpc.PkgTypeReply, ReqId: 2, Seq: 2, Result: 400, Body: []byte("bad request")},
+		{Command: grpc.CmdTestLogic, PkgType: grpc.PkgTypeRequest, Seq: 3, Metadata: grpc.NewMetadata("trace", "abc", grpc.MetaDeadline, "1700000000000")},
+		{Command: grpc.CmdTestLogic, PkgType: grpc.PkgTypePush, Seq: 4, Body: bytes.Repeat([]byte("gotato"), 100), Version: Version2},
+		{PkgType: grpc.PkgTypeRequest, Heartbeat: &grpc.Heartbeat{Timeout: 4000}},
+	}
+	protocols := []grpc.IProtocol{
+		New(),
+		New(WithVersion(Version2), WithChecksum()),
+		New(WithCompress(grpc.CompressGzip, 64)),
+		New(WithCompress(grpc.CompressZstd, 64), WithVersion(Version2)),
+	}
+	for _, p := range protocols {
+		for _, m := range messages {
+			data, err := p.Encode(ctx, m)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(data)
+		}
+	}
+	f.Add([]byte{})
+	f.Add(make([]byte, headerSize))
+}
+
+// FuzzDecode 任意输入不会panic,读取的数据不超过header+trailer+maxFrameSize,解码成功的消息可以重新编码并得到相同结果
+func FuzzDecode(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ctx := context.Background()
+		p := New(WithMaxFrameSize(fuzzMaxFrameSize))
+		reader := &countingReader{r: bytes.NewReader(data)}
+		msg, err := p.Decode(ctx, reader)
+		if reader.n > headerSize+trailerSize+fuzzMaxFrameSize {
+			t.Fatalf("read %d bytes, exceeds frame limit", reader.n)
+		}
+		if err != nil {
+			return
+		}
+
+		encoded, err := New(WithMaxFrameSize(fuzzMaxFrameSize)).Encode(ctx, msg)
+		if err != nil {
+			// 解压后超过限制等情况无法原样编码
+			return
+		}
+		again, err := p.Decode(ctx, bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("decode re-encoded message fail: %v", err)
+		}
+		if again.Command != msg.Command || again.PkgType != msg.PkgType || again.Seq != msg.Seq ||
+			again.ReqId != msg.ReqId || again.Result != msg.Result || again.Version != msg.Version ||
+			!bytes.Equal(again.Body, msg.Body) || len(again.Metadata) != len(msg.Metadata) {
+			t.Fatalf("round trip mismatch, first=%+v, second=%+v", msg, again)
+		}
+	})
+}
+
+// FuzzDecodeResync 开启重新同步时任意输入不会panic,丢弃的数据不超过maxFrameSize
+func FuzzDecodeResync(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p := New(WithMaxFrameSize(fuzzMaxFrameSize), WithResync())
+		reader := &countingReader{r: bytes.NewReader(data)}
+		_, err := p.Decode(context.Background(), reader)
+		if reader.n > 2*(headerSize+trailerSize+fuzzMaxFrameSize) {
+			t.Fatalf("read %d bytes, exceeds resync limit", reader.n)
+		}
+		if err != nil && errors.Is(err, ErrFrameTooLarge) && reader.n > headerSize+trailerSize+fuzzMaxFrameSize+headerSize {
+			t.Fatalf("frame too large detected after reading %d bytes", reader.n)
+		}
+	})
+}
+
+// FuzzUnpackExt 任意ext不会panic,解析成功的元数据重新打包后结果一致
+func FuzzUnpackExt(f *testing.F) {
+	ext, _ := packExt(grpc.NewMetadata("trace", "abc", "token", ""))
+	f.Add(ext)
+	f.Add([]byte{extVersion, 0xff, 0xff})
+	f.Add([]byte{extVersion + 1})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		md, err := unpackExt(data)
+		if err != nil || md == nil {
+			return
+		}
+		packed, err := packExt(md)
+		if err != nil {
+			t.Fatalf("pack unpacked metadata fail: %v", err)
+		}
+		again, err := unpackExt(packed)
+		if err != nil || len(again) != len(md) {
+			t.Fatalf("round trip mismatch, first=%v, second=%v, err=%v", md, again, err)
+		}
+		for k, v := range md {
+			if again[k] != v {
+				t.Fatalf("round trip mismatch for key %q", k)
+			}
+		}
+	})
+}
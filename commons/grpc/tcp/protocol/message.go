@@ -3,19 +3,32 @@ package protocol
 import (
 	"bytes"
 	"encoding/binary"
-	"math"
 )
 
 var endian = binary.LittleEndian
 
 const (
-	tag         = uint32(0x70656562) // tag 固定值
-	maxBodySize = math.MaxUint32
+	tag   = uint32(0x70656562) // v1 tag 固定值
+	tagV2 = uint32(0x32656562) // v2及以上版本的tag,header后追加trailer
 )
 
+// 协议版本
 const (
-	headerSize = 4 + 4 + 2 + 4 + 4 + 8 + 4 + 2
-	tagLen     = 4
+	Version1      uint8 = 1 // 基础header
+	Version2      uint8 = 2 // header后追加 version|flags|checksum
+	LatestVersion       = Version2
+)
+
+// trailer flags
+const (
+	flagChecksum uint8 = 1 << 0 // checksum为ext+body的CRC32
+)
+
+const (
+	headerSize          = 4 + 4 + 2 + 4 + 4 + 8 + 4 + 2
+	trailerSize         = 1 + 1 + 4
+	tagLen              = 4
+	defaultMaxFrameSize = 16 << 20 // 默认ext+body最大16MB
 )
 
 type header struct {
@@ -29,6 +42,13 @@ type header struct {
 	ExtSize   uint16
 }
 
+// trailer v2及以上版本紧跟header
+type trailer struct {
+	Version  uint8
+	Flags    uint8
+	Checksum uint32
+}
+
 type heartbeat struct {
 	Type        uint16
 	TimeoutSize uint16
@@ -37,13 +57,29 @@ type heartbeat struct {
 
 type msg struct {
 	header
-	Ext  []byte
-	Body []byte
+	trailer // MagicWord为tagV2时有效
+	Ext     []byte
+	Body    []byte
+}
+
+// version 帧的协议版本
+func (m *msg) version() uint8 {
+	if m.MagicWord == tagV2 {
+		return m.trailer.Version
+	}
+	return Version1
 }
 
 func (m msg) Bytes() []byte {
-	w := bytes.NewBuffer([]byte{})
+	size := headerSize + len(m.Ext) + len(m.Body)
+	if m.MagicWord == tagV2 {
+		size += trailerSize
+	}
+	w := bytes.NewBuffer(make([]byte, 0, size))
 	binary.Write(w, endian, m.header)
+	if m.MagicWord == tagV2 {
+		binary.Write(w, endian, m.trailer)
+	}
 	if len(m.Ext) > 0 {
 		w.Write(m.Ext)
 	}
@@ -0,0 +1,58 @@
+package protocol
+
+import "github.com/qiafan666/gotato/commons/grpc"
+
+// defaultCompressThreshold 默认压缩阈值 字节
+const defaultCompressThreshold = 1024
+
+// Option 协议配置项
+type Option func(t *textRpcProtocol)
+
+// WithCompress 编码时body长度达到threshold则使用name对应的算法压缩,threshold<=0时使用1KB
+// name为空或未注册时不压缩,解码总是按对端标记的算法解压
+func WithCompress(name string, threshold int) Option {
+	return func(t *textRpcProtocol) {
+		c, ok := grpc.GetCompressor(name)
+		if !ok {
+			return
+		}
+		if threshold <= 0 {
+			threshold = defaultCompressThreshold
+		}
+		t.compressor = c
+		t.compressThreshold = threshold
+	}
+}
+
+// WithVersion 设置编码时默认使用的协议版本,消息Version不为0时以消息为准,默认Version1以兼容旧版本对端
+func WithVersion(version uint8) Option {
+	return func(t *textRpcProtocol) {
+		if version >= Version1 && version <= LatestVersion {
+			t.version = version
+		}
+	}
+}
+
+// WithMaxFrameSize 设置单帧ext+body的最大长度,解码时在分配内存前校验,默认16MB
+func WithMaxFrameSize(size int) Option {
+	return func(t *textRpcProtocol) {
+		if size > 0 {
+			t.maxFrameSize = size
+		}
+	}
+}
+
+// WithChecksum 编码Version2及以上的帧时附带ext+body的CRC32,解码总是校验带有checksum标记的帧
+func WithChecksum() Option {
+	return func(t *textRpcProtocol) {
+		t.checksum = true
+	}
+}
+
+// WithResync 帧头tag不匹配时向后扫描寻找下一个tag,最多丢弃maxFrameSize字节
+// 默认tag不匹配直接返回ErrBadMagic,由调用方关闭连接
+func WithResync() Option {
+	return func(t *textRpcProtocol) {
+		t.resync = true
+	}
+}
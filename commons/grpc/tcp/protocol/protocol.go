@@ -4,15 +4,40 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"github.com/qiafan666/gotato/commons/gerr"
 	"github.com/qiafan666/gotato/commons/grpc"
+	"hash/crc32"
 	"io"
 )
 
-type textRpcProtocol struct{}
+// ErrMalformed 消息已完整读取但内容无法解析，连接仍可继续读取后续消息
+var ErrMalformed = errors.New("protocol malformed message")
 
-func New() grpc.IProtocol {
-	return &textRpcProtocol{}
+// ErrBadMagic 帧头tag不匹配，后续数据无法定位帧边界，连接应关闭
+var ErrBadMagic = errors.New("protocol bad magic")
+
+// ErrFrameTooLarge 帧长度超过限制，未读取帧内容，连接应关闭
+var ErrFrameTooLarge = errors.New("protocol frame too large")
+
+type textRpcProtocol struct {
+	compressor        grpc.ICompressor // 为空时不压缩
+	compressThreshold int              // body大于等于该长度时压缩
+	version           uint8            // 消息未指定版本时的编码版本
+	maxFrameSize      int              // ext+body最大长度
+	checksum          bool             // 编码v2帧时是否附带checksum
+	resync            bool             // tag不匹配时是否扫描重新同步
+}
+
+func New(opts ...Option) grpc.IProtocol {
+	t := &textRpcProtocol{
+		version:      Version1,
+		maxFrameSize: defaultMaxFrameSize,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
 }
 
 func (t *textRpcProtocol) Encode(ctx context.Context, v *grpc.Message) ([]byte, error) {
@@ -21,13 +46,29 @@ func (t *textRpcProtocol) Encode(ctx context.Context, v *grpc.Message) ([]byte,
 		v.Body = t.packHeartbeatRequest(v.Heartbeat)
 	}
 
+	body, md, err := t.compress(v)
+	if err != nil {
+		return nil, err
+	}
+
+	ext, err := packExt(md)
+	if err != nil {
+		return nil, err
+	}
+
+	version := v.Version
+	if version == 0 {
+		version = t.version
+	}
 	return t.encode(
+		version,
 		v.Command,
 		v.PkgType,
 		v.Result,
 		v.Seq,
 		v.ReqId,
-		v.Body,
+		ext,
+		body,
 	)
 }
 func (t *textRpcProtocol) Decode(ctx context.Context, reader io.Reader) (*grpc.Message, error) {
@@ -41,9 +82,19 @@ func (t *textRpcProtocol) Decode(ctx context.Context, reader io.Reader) (*grpc.M
 		PkgType:   grpc.PkgType(m.PkgType),
 		ReqId:     m.ReqId,
 		Seq:       m.Seq,
-		Result:    m.Seq,
+		Result:    m.Result,
 		Body:      m.Body,
 		Heartbeat: nil,
+		Version:   m.version(),
+	}
+
+	v.Metadata, err = unpackExt(m.Ext)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = t.decompress(v); err != nil {
+		return nil, err
 	}
 
 	// 如果是发送心跳包,解析body,heartbeat设置
@@ -59,56 +110,81 @@ func (t *textRpcProtocol) Decode(ctx context.Context, reader io.Reader) (*grpc.M
 	return v, nil
 }
 
-func (t *textRpcProtocol) recv(ctx context.Context, reader io.Reader) (*msg, error) {
-	headerData := make([]byte, 0)
-	nextReadSize := headerSize
-
-	for {
-		// 读取header
-		buf, err := t.read(ctx, reader, uint32(nextReadSize))
-		if err != nil {
-			return nil, err
-		}
-		headerData = append(headerData, buf...)
-		if len(headerData) < headerSize {
-			return nil, gerr.New("header data too short", "headerSize", headerSize, "headerData", len(headerData))
-		}
-
-		pos := bytes.Index(headerData, endian.AppendUint32([]byte{}, tag))
-		if pos < 0 {
-			headerData = headerData[headerSize-tagLen:]
-			nextReadSize = headerSize - len(headerData)
-			continue
-		}
+// compress body达到阈值时压缩,并在元数据中标记算法,不修改v
+func (t *textRpcProtocol) compress(v *grpc.Message) ([]byte, grpc.Metadata, error) {
+	if t.compressor == nil || v.Command == grpc.CmdHeartbeat || len(v.Body) < t.compressThreshold ||
+		v.Metadata.Get(grpc.MetaCompress) != "" {
+		return v.Body, v.Metadata, nil
+	}
+	body, err := t.compressor.Compress(v.Body)
+	if err != nil {
+		return nil, nil, gerr.WrapMsg(err, "protocol compress body error", "compressor", t.compressor.Name())
+	}
+	md := v.Metadata.Merge(grpc.NewMetadata(grpc.MetaCompress, t.compressor.Name()))
+	return body, md, nil
+}
 
-		if pos > 0 {
-			headerData = headerData[pos:]
-			nextReadSize = headerSize - len(headerData)
-			continue
-		}
+// decompress 按元数据中的算法解压body,解码不受本端压缩配置影响
+func (t *textRpcProtocol) decompress(v *grpc.Message) error {
+	name := v.Metadata.Get(grpc.MetaCompress)
+	if name == "" {
+		return nil
+	}
+	c, ok := grpc.GetCompressor(name)
+	if !ok {
+		return gerr.WrapMsg(ErrMalformed, "protocol unsupported compressor", "compressor", name)
+	}
+	var (
+		body []byte
+		err  error
+	)
+	// 解压后长度同样受maxFrameSize限制
+	if lc, ok := c.(grpc.ILimitedDecompressor); ok {
+		body, err = lc.DecompressLimit(v.Body, t.maxFrameSize)
+	} else if body, err = c.Decompress(v.Body); err == nil && len(body) > t.maxFrameSize {
+		err = gerr.New("decompressed body too long", "maxFrameSize", t.maxFrameSize)
+	}
+	if err != nil {
+		return gerr.WrapMsg(ErrMalformed, "protocol decompress body error", "compressor", name, "err", err)
+	}
+	v.Body = body
+	delete(v.Metadata, grpc.MetaCompress)
+	return nil
+}
 
-		break
+func (t *textRpcProtocol) recv(ctx context.Context, reader io.Reader) (*msg, error) {
+	headerData, err := t.readHeader(ctx, reader)
+	if err != nil {
+		return nil, err
 	}
 
 	// 读取header
-	var newHeader header
-	bufReader := bytes.NewReader(headerData)
-	e := binary.Read(bufReader, endian, &newHeader)
-	if e != nil {
+	m := &msg{}
+	if e := binary.Read(bytes.NewReader(headerData), endian, &m.header); e != nil {
 		return nil, gerr.WrapMsg(e, "protocol unpack header error")
 	}
 
-	m := &msg{
-		header: newHeader,
-		Ext:    nil,
-		Body:   nil,
+	// 读取trailer
+	if m.MagicWord == tagV2 {
+		buf, err := t.read(ctx, reader, trailerSize)
+		if err != nil {
+			return nil, gerr.WrapMsg(err, "protocol trailer read error")
+		}
+		if e := binary.Read(bytes.NewReader(buf), endian, &m.trailer); e != nil {
+			return nil, gerr.WrapMsg(e, "protocol unpack trailer error")
+		}
+	}
+
+	// 分配内存前校验长度
+	if frameSize := int(m.ExtSize) + int(m.BodySize); frameSize > t.maxFrameSize {
+		return nil, gerr.WrapMsg(ErrFrameTooLarge, "protocol frame too large", "maxFrameSize", t.maxFrameSize, "frameSize", frameSize)
 	}
 
 	// 读取ext
 	if m.ExtSize > 0 {
 		buf, err := t.read(ctx, reader, uint32(m.ExtSize))
 		if err != nil {
-			return nil, gerr.WrapMsg(e, "protocol extSize read error")
+			return nil, gerr.WrapMsg(err, "protocol extSize read error")
 		}
 		m.Ext = buf
 	}
@@ -117,58 +193,90 @@ func (t *textRpcProtocol) recv(ctx context.Context, reader io.Reader) (*msg, err
 	if m.BodySize > 0 {
 		buf, err := t.read(ctx, reader, m.BodySize)
 		if err != nil {
-			return nil, gerr.WrapMsg(e, "protocol bodySize read error")
+			return nil, gerr.WrapMsg(err, "protocol bodySize read error")
 		}
 		m.Body = buf
 	}
 
+	// 帧已完整读取,内容错误不影响后续帧
+	if m.MagicWord == tagV2 {
+		if m.trailer.Version < Version2 {
+			return nil, gerr.WrapMsg(ErrMalformed, "protocol invalid version", "version", m.trailer.Version)
+		}
+		if m.Flags&flagChecksum != 0 && checksum(m.Ext, m.Body) != m.Checksum {
+			return nil, gerr.WrapMsg(ErrMalformed, "protocol checksum mismatch", "seq", m.Seq)
+		}
+	}
+
 	return m, nil
 }
 
-func (t *textRpcProtocol) read(ctx context.Context, reader io.Reader, length uint32) ([]byte, error) {
-	bytesBuffer := bytes.NewBuffer([]byte{})
-
-	totalLen := uint32(0) // 已读取的总长度
-
-	// 循环读取,直到读够length
+// readHeader 读取header,tag不匹配时按配置返回ErrBadMagic或向后扫描
+func (t *textRpcProtocol) readHeader(ctx context.Context, reader io.Reader) ([]byte, error) {
+	headerData, err := t.read(ctx, reader, headerSize)
+	if err != nil {
+		return nil, err
+	}
+	discarded := 0
 	for {
-		if ctx.Err() != nil {
-			return nil, gerr.WrapMsg(ctx.Err(), "protocol read context error")
+		if magic := endian.Uint32(headerData); magic == tag || magic == tagV2 {
+			return headerData, nil
 		}
-
-		size := 1024                    // 默认每次读取长度
-		leftLength := length - totalLen // 剩余待读取长度
-
-		// 已读满length
-		if leftLength <= 0 {
-			break
+		if !t.resync {
+			return nil, gerr.WrapMsg(ErrBadMagic, "protocol bad magic", "magic", endian.Uint32(headerData))
 		}
 
-		// 剩余待读取小于默认,最多读取不超过剩余长度的数据
-		if size > int(leftLength) {
-			size = int(leftLength)
+		// 丢弃下一个tag之前的数据,未找到时保留末尾可能是tag前缀的部分
+		pos := -1
+		for i := 1; i <= headerSize-tagLen; i++ {
+			if magic := endian.Uint32(headerData[i:]); magic == tag || magic == tagV2 {
+				pos = i
+				break
+			}
 		}
-		buf := make([]byte, size)
-		l, err := reader.Read(buf)
-		if err != nil {
-			return nil, gerr.WrapMsg(err, "protocol read buffer error")
+		if pos < 0 {
+			pos = headerSize - tagLen + 1
 		}
-		if l == 0 {
-			continue
+		discarded += pos
+		if discarded > t.maxFrameSize {
+			return nil, gerr.WrapMsg(ErrBadMagic, "protocol resync fail", "discarded", discarded)
 		}
-		totalLen += uint32(l)
-		bytesBuffer.Write(buf[0:l])
+		buf, err := t.read(ctx, reader, uint32(pos))
+		if err != nil {
+			return nil, err
+		}
+		headerData = append(headerData[pos:], buf...)
+	}
+}
+
+// read 读取length字节,调用前需确认length不超过限制
+func (t *textRpcProtocol) read(ctx context.Context, reader io.Reader, length uint32) ([]byte, error) {
+	buf := make([]byte, length)
+	totalLen := 0 // 已读取的总长度
 
-		if totalLen >= length {
-			break
+	// 循环读取,直到读够length
+	for totalLen < len(buf) {
+		if ctx.Err() != nil {
+			return nil, gerr.WrapMsg(ctx.Err(), "protocol read context error")
+		}
+		l, err := reader.Read(buf[totalLen:])
+		totalLen += l
+		if err != nil {
+			if err == io.EOF && totalLen == len(buf) {
+				break
+			}
+			return nil, gerr.WrapMsg(err, "protocol read buffer error")
 		}
 	}
-	return bytesBuffer.Bytes(), nil
+	return buf, nil
 }
 
-func (t *textRpcProtocol) encode(cmd grpc.Command, pkgType grpc.PkgType, result, Seq uint32, reqId int64, data []byte) ([]byte, error) {
-	if len(data) > maxBodySize {
-		return nil, gerr.New("data too long", "maxBodySize", maxBodySize, "dataSize", len(data))
+func (t *textRpcProtocol) encode(version uint8, cmd grpc.Command, pkgType grpc.PkgType, result, Seq uint32, reqId int64, ext, data []byte) ([]byte, error) {
+	if version < Version1 || version > LatestVersion {
+		return nil, gerr.New("unsupported protocol version", "version", version)
+	}
+	if len(ext)+len(data) > t.maxFrameSize {
+		return nil, gerr.New("data too long", "maxFrameSize", t.maxFrameSize, "dataSize", len(ext)+len(data))
 	}
 
 	newMsg := msg{
@@ -176,23 +284,37 @@ func (t *textRpcProtocol) encode(cmd grpc.Command, pkgType grpc.PkgType, result,
 			MagicWord: tag,
 			Command:   uint32(cmd),
 			PkgType:   uint16(pkgType),
+			Result:    result,
 			Seq:       Seq,
 			ReqId:     reqId,
 			BodySize:  uint32(len(data)),
-			ExtSize:   uint16(0),
+			ExtSize:   uint16(len(ext)),
 		},
-		Ext:  nil,
+		Ext:  ext,
 		Body: data,
 	}
+	if version >= Version2 {
+		newMsg.MagicWord = tagV2
+		newMsg.trailer.Version = version
+		if t.checksum {
+			newMsg.Flags |= flagChecksum
+			newMsg.Checksum = checksum(ext, data)
+		}
+	}
 	return newMsg.Bytes(), nil
 }
 
+// checksum ext+body的CRC32
+func checksum(ext, body []byte) uint32 {
+	return crc32.Update(crc32.ChecksumIEEE(ext), crc32.IEEETable, body)
+}
+
 func (t *textRpcProtocol) unpackHeartbeatRequest(body []byte) (*grpc.Heartbeat, error) {
 	var m heartbeat
 	r := bytes.NewReader(body)
 	err := binary.Read(r, endian, &m)
 	if err != nil {
-		return nil, gerr.WrapMsg(err, "protocol unpack heartbeat request error")
+		return nil, gerr.WrapMsg(ErrMalformed, "protocol unpack heartbeat request error", "err", err)
 	}
 
 	h := &grpc.Heartbeat{
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRequest(t *testing.T) {
@@ -207,13 +208,18 @@ func TestDecode(t *testing.T) {
 func TestRequestDecode(t *testing.T) {
 	p := New()
 
-	str := "62656570950100000000000000008aabee2a02000000e626e5ef81572c6d0f00000000005b2242544355534454222c322c305d"
+	// v1帧: command=405 seq=2 reqId=9310219146 body=["BTCUSDT",2,0]
+	str := "6265657095010000000000000000020000008aabee2a020000000f00000000005b2242544355534454222c322c305d"
 	data, _ := hex.DecodeString(str)
 	ctx := context.Background()
 	req, err := p.Decode(ctx, bytes.NewReader(data))
-	assert.Equal(t, nil, err)
+	require.NoError(t, err)
+	assert.Equal(t, grpc.Command(405), req.Command)
+	assert.Equal(t, uint32(2), req.Seq)
+	assert.Equal(t, int64(9310219146), req.ReqId)
+	assert.Equal(t, Version1, req.Version)
 	var v []any
-	json.Unmarshal(req.Body, &v)
+	require.NoError(t, json.Unmarshal(req.Body, &v))
 	t.Logf("%+v", v)
 }
 
@@ -238,3 +244,168 @@ func TestHeartbeatPack(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.ObjectsAreEqual(request, reqDecode)
 }
+
+func TestMetadata(t *testing.T) {
+	p := New()
+	ctx := context.Background()
+	request := &grpc.Message{
+		Command:  grpc.CmdTestLogic,
+		PkgType:  grpc.PkgTypeRequest,
+		ReqId:    1,
+		Seq:      2,
+		Body:     []byte("body"),
+		Metadata: grpc.NewMetadata("trace", "abc", "token", ""),
+	}
+	data, err := p.Encode(ctx, request)
+	assert.Nil(t, err)
+	decoded, err := p.Decode(ctx, bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, request.Metadata, decoded.Metadata)
+	assert.Equal(t, request.Body, decoded.Body)
+
+	// 旧版本对端ExtSize为0
+	request.Metadata = nil
+	data, err = p.Encode(ctx, request)
+	assert.Nil(t, err)
+	assert.Equal(t, headerSize+len(request.Body), len(data))
+	decoded, err = p.Decode(ctx, bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Nil(t, decoded.Metadata)
+
+	// 无法识别的ext版本被忽略
+	md, err := unpackExt([]byte{extVersion + 1, 0xff})
+	assert.Nil(t, err)
+	assert.Nil(t, md)
+	_, err = unpackExt([]byte{extVersion, 1, 0, 5, 0, 'a'})
+	assert.NotNil(t, err)
+}
+
+func TestCompress(t *testing.T) {
+	ctx := context.Background()
+	body := bytes.Repeat([]byte("gotato"), 500)
+	for _, name := range []string{grpc.CompressGzip, grpc.CompressZstd} {
+		request := &grpc.Message{
+			Command:  grpc.CmdTestLogic,
+			PkgType:  grpc.PkgTypeRequest,
+			Seq:      1,
+			Body:     body,
+			Metadata: grpc.NewMetadata("trace", "abc"),
+		}
+		data, err := New(WithCompress(name, 100)).Encode(ctx, request)
+		assert.Nil(t, err)
+		assert.Less(t, len(data), len(body))
+		assert.Equal(t, "", request.Metadata.Get(grpc.MetaCompress))
+
+		// 解码端未配置压缩也能按标记解压
+		decoded, err := New().Decode(ctx, bytes.NewReader(data))
+		assert.Nil(t, err)
+		assert.Equal(t, body, decoded.Body)
+		assert.Equal(t, grpc.NewMetadata("trace", "abc"), decoded.Metadata)
+	}
+
+	// 低于阈值不压缩
+	small := &grpc.Message{Command: grpc.CmdTestLogic, Body: []byte("small")}
+	data, err := New(WithCompress(grpc.CompressGzip, 100)).Encode(ctx, small)
+	assert.Nil(t, err)
+	assert.Equal(t, headerSize+len(small.Body), len(data))
+}
+
+func TestResultDecode(t *testing.T) {
+	p := New()
+	ctx := context.Background()
+	data, err := p.Encode(ctx, &grpc.Message{Command: grpc.CmdTestLogic, PkgType: grpc.PkgTypeReply, Seq: 7, Result: 415})
+	assert.Nil(t, err)
+	decoded, err := p.Decode(ctx, bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(415), decoded.Result)
+	assert.Equal(t, uint32(7), decoded.Seq)
+}
+
+func TestVersion(t *testing.T) {
+	ctx := context.Background()
+	request := &grpc.Message{Command: grpc.CmdTestLogic, PkgType: grpc.PkgTypeRequest, Seq: 1, Body: []byte("body")}
+
+	// 默认Version1,与旧版本header一致
+	data, err := New().Encode(ctx, request)
+	assert.Nil(t, err)
+	assert.Equal(t, headerSize+len(request.Body), len(data))
+	decoded, err := New().Decode(ctx, bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, Version1, decoded.Version)
+
+	// 消息指定版本优先于默认版本
+	data, err = New().Encode(ctx, &grpc.Message{Command: grpc.CmdTestLogic, Body: request.Body, Version: Version2})
+	assert.Nil(t, err)
+	assert.Equal(t, headerSize+trailerSize+len(request.Body), len(data))
+
+	data, err = New(WithVersion(Version2)).Encode(ctx, request)
+	assert.Nil(t, err)
+	decoded, err = New().Decode(ctx, bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, Version2, decoded.Version)
+	assert.Equal(t, request.Body, decoded.Body)
+
+	_, err = New().Encode(ctx, &grpc.Message{Version: LatestVersion + 1})
+	assert.NotNil(t, err)
+}
+
+func TestChecksum(t *testing.T) {
+	ctx := context.Background()
+	p := New(WithVersion(Version2), WithChecksum())
+	request := &grpc.Message{Command: grpc.CmdTestLogic, Seq: 1, Body: []byte("body"), Metadata: grpc.NewMetadata("k", "v")}
+	data, err := p.Encode(ctx, request)
+	assert.Nil(t, err)
+
+	// 连续两帧,第一帧body被篡改,第二帧仍可正常读取
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	reader := bytes.NewReader(append(corrupted, data...))
+	_, err = New().Decode(ctx, reader)
+	assert.ErrorIs(t, err, ErrMalformed)
+	decoded, err := New().Decode(ctx, reader)
+	assert.Nil(t, err)
+	assert.Equal(t, request.Body, decoded.Body)
+	assert.Equal(t, request.Metadata, decoded.Metadata)
+}
+
+func TestMaxFrameSize(t *testing.T) {
+	ctx := context.Background()
+	body := bytes.Repeat([]byte("a"), 2048)
+	_, err := New(WithMaxFrameSize(1024)).Encode(ctx, &grpc.Message{Body: body})
+	assert.NotNil(t, err)
+
+	data, err := New().Encode(ctx, &grpc.Message{Body: body})
+	assert.Nil(t, err)
+	_, err = New(WithMaxFrameSize(1024)).Decode(ctx, bytes.NewReader(data))
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+
+	// 只有header,声明的长度超过限制时不会等待读取body
+	_, err = New(WithMaxFrameSize(1024)).Decode(ctx, bytes.NewReader(data[:headerSize]))
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+
+	// 解压后的长度同样受限
+	compressed, err := New(WithCompress(grpc.CompressGzip, 1)).Encode(ctx, &grpc.Message{Command: grpc.CmdTestLogic, Body: body})
+	assert.Nil(t, err)
+	assert.Less(t, len(compressed), 1024)
+	_, err = New(WithMaxFrameSize(1024)).Decode(ctx, bytes.NewReader(compressed))
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestBadMagic(t *testing.T) {
+	ctx := context.Background()
+	data, err := New().Encode(ctx, &grpc.Message{Command: grpc.CmdTestLogic, Seq: 3, Body: []byte("body")})
+	assert.Nil(t, err)
+	garbage := append(bytes.Repeat([]byte{0x62}, 45), data...)
+
+	_, err = New().Decode(ctx, bytes.NewReader(garbage))
+	assert.ErrorIs(t, err, ErrBadMagic)
+
+	decoded, err := New(WithResync()).Decode(ctx, bytes.NewReader(garbage))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), decoded.Seq)
+	assert.Equal(t, []byte("body"), decoded.Body)
+
+	// 扫描长度受maxFrameSize限制
+	_, err = New(WithResync(), WithMaxFrameSize(16)).Decode(ctx, bytes.NewReader(garbage))
+	assert.ErrorIs(t, err, ErrBadMagic)
+}
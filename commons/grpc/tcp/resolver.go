@@ -0,0 +1,92 @@
+package tcp
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// IResolver 服务地址解析接口
+// discovery/getcd.SvcDiscoveryRegistryImpl 与 discovery/gzookeeper.ZkClient 均已实现
+type IResolver interface {
+	// WatchAddrs 监听服务地址列表,每次变化推送完整列表,首次推送当前列表,ctx取消后关闭通道
+	WatchAddrs(ctx context.Context, service string) (<-chan []string, error)
+}
+
+// StaticResolver 静态地址列表,可通过Set更新 goroutine safe
+type StaticResolver struct {
+	mu       sync.Mutex
+	addrs    map[string][]string
+	watchers map[string][]chan []string
+}
+
+// NewStaticResolver 创建静态解析器,addrs为 服务名->地址列表
+func NewStaticResolver(addrs map[string][]string) *StaticResolver {
+	r := &StaticResolver{
+		addrs:    make(map[string][]string),
+		watchers: make(map[string][]chan []string),
+	}
+	for service, list := range addrs {
+		r.addrs[service] = normalizeAddrs(list)
+	}
+	return r
+}
+
+// Set 更新服务地址列表并通知监听者
+func (r *StaticResolver) Set(service string, addrs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addrs[service] = normalizeAddrs(addrs)
+	for _, ch := range r.watchers[service] {
+		pushAddrs(ch, r.addrs[service])
+	}
+}
+
+// WatchAddrs 实现IResolver
+func (r *StaticResolver) WatchAddrs(ctx context.Context, service string) (<-chan []string, error) {
+	ch := make(chan []string, 1)
+	r.mu.Lock()
+	r.watchers[service] = append(r.watchers[service], ch)
+	pushAddrs(ch, r.addrs[service])
+	r.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		watchers := r.watchers[service]
+		for i, w := range watchers {
+			if w == ch {
+				r.watchers[service] = append(watchers[:i], watchers[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// pushAddrs 只保留最新列表,监听者处理慢时丢弃旧列表
+func pushAddrs(ch chan []string, addrs []string) {
+	list := append([]string(nil), addrs...)
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- list
+}
+
+// normalizeAddrs 去重并排序
+func normalizeAddrs(addrs []string) []string {
+	seen := make(map[string]struct{}, len(addrs))
+	ret := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if _, ok := seen[addr]; ok || addr == "" {
+			continue
+		}
+		seen[addr] = struct{}{}
+		ret = append(ret, addr)
+	}
+	sort.Strings(ret)
+	return ret
+}
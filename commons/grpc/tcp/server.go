@@ -1,24 +1,43 @@
 package tcp
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/cloudwego/netpoll"
+	"github.com/qiafan666/gotato/commons/gerr"
 	"github.com/qiafan666/gotato/commons/gface"
 	"github.com/qiafan666/gotato/commons/gid"
 	"github.com/qiafan666/gotato/commons/grpc"
 	"github.com/qiafan666/gotato/commons/grpc/tcp/protocol"
 	"github.com/qiafan666/gotato/commons/grpc/tcp/server"
 	"net"
+	"strconv"
 	"syscall"
 	"time"
 )
 
 type ServerOptions struct {
-	Timeout time.Duration
-	Logger  gface.ILogger
+	Timeout     time.Duration
+	IdleTimeout time.Duration // 连接在该时长内未收到任何消息(含心跳)时关闭,为0不限制
+	Logger      gface.ILogger
+
+	TLS           *TLSOptions   // 不为空时启用TLS,TLS连接不经过netpoll,每个连接一个读协程
+	Authenticator Authenticator // 不为空时要求客户端先完成token握手,用于没有PKI的环境
+	BindIdentity  bool          // 认证后以Peer.Identity作为用户ID绑定会话,同一用户重复登录时踢掉旧连接
+
+	Compress          string // 响应body压缩算法,如grpc.CompressGzip,为空不压缩
+	CompressThreshold int    // body达到该长度 字节时压缩,默认1KB
+
+	ProtocolVersion uint8 // 与客户端协商的最高协议版本,默认protocol.LatestVersion
+	MaxFrameSize    int   // 单帧ext+body最大长度,超过时关闭连接,默认16MB
+	Checksum        bool  // 响应为Version2及以上时附带CRC32
 }
 
+var _ grpc.IPusher = (*Server)(nil)
+
 type Server struct {
 	addr string
 
@@ -33,7 +52,8 @@ type Server struct {
 
 	logger gface.ILogger
 
-	ch chan *grpc.Message
+	ch     chan *grpc.Message // 处理结果，服务端停止后不再读取，发送方需同时等待请求ctx取消
+	runCtx context.Context    // Run的ctx，取消后请求ctx随之取消
 }
 
 func NewServer(addr string, handler grpc.IHandler, opt *ServerOptions) *Server {
@@ -42,10 +62,21 @@ func NewServer(addr string, handler grpc.IHandler, opt *ServerOptions) *Server {
 		handler: handler,
 		opt:     opt,
 	}
-	s.protocol = protocol.New()
+	if opt.ProtocolVersion == 0 || opt.ProtocolVersion > protocol.LatestVersion {
+		opt.ProtocolVersion = protocol.LatestVersion
+	}
+	protoOpts := []protocol.Option{
+		protocol.WithCompress(opt.Compress, opt.CompressThreshold),
+		protocol.WithMaxFrameSize(opt.MaxFrameSize),
+	}
+	if opt.Checksum {
+		protoOpts = append(protoOpts, protocol.WithChecksum())
+	}
+	s.protocol = protocol.New(protoOpts...)
 	s.serialId = gid.NewSerialId[uint64]()
 
 	s.ch = make(chan *grpc.Message, 4096)
+	s.runCtx = context.Background()
 	s.connManager = server.NewConnManager(opt.Logger)
 
 	s.logger = opt.Logger
@@ -53,6 +84,7 @@ func NewServer(addr string, handler grpc.IHandler, opt *ServerOptions) *Server {
 }
 
 func (s *Server) Run(ctx context.Context) {
+	s.runCtx = ctx
 	l := &net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
 		var opErr error
 		err := c.Control(func(fd uintptr) {
@@ -65,30 +97,54 @@ func (s *Server) Run(ctx context.Context) {
 		return opErr
 	}}
 
-	ln, err := l.Listen(ctx, "tcp", s.addr)
-	if err != nil {
-		s.logger.ErrorF(nil, "Server.Run: listen tcp addr fail, err=%+v", err)
-	}
-
-	eventLoop, err := netpoll.NewEventLoop(
-		s.handle,
-		netpoll.WithOnPrepare(s.prepare),
-		netpoll.WithOnConnect(s.connect),
-		netpoll.WithReadTimeout(time.Second),
-		netpoll.WithWriteTimeout(time.Second),
+	// addr为空时不监听端口,连接仍可通过ServeConn接入
+	var (
+		ln  net.Listener
+		err error
 	)
-	if err != nil {
-		s.logger.ErrorF(nil, "Server.Run: NewEventLoop fail, err=%+v", err)
+	if s.addr != "" {
+		ln, err = l.Listen(ctx, "tcp", s.addr)
+		if err != nil {
+			s.logger.ErrorF(nil, "Server.Run: listen tcp addr fail, err=%+v", err)
+			return
+		}
 	}
 
-	s.logger.InfoF(nil, "Server.Run: server start, addr=%s", s.addr)
-
-	go func() {
-		err = eventLoop.Serve(ln)
+	var eventLoop netpoll.EventLoop
+	switch {
+	case ln == nil:
+	case s.opt.TLS != nil:
+		tlsConf, e := s.opt.TLS.serverTLSConfig()
+		if e != nil {
+			s.logger.ErrorF(nil, "Server.Run: load tls config fail, err=%+v", e)
+			ln.Close()
+			return
+		}
+		go s.serveTLS(ctx, tls.NewListener(ln, tlsConf))
+	default:
+		loopOpts := []netpoll.Option{
+			netpoll.WithOnPrepare(s.prepare),
+			netpoll.WithOnConnect(s.connect),
+			netpoll.WithReadTimeout(time.Second),
+			netpoll.WithWriteTimeout(time.Second),
+		}
+		if s.opt.IdleTimeout > 0 {
+			loopOpts = append(loopOpts, netpoll.WithIdleTimeout(s.opt.IdleTimeout))
+		}
+		eventLoop, err = netpoll.NewEventLoop(s.handle, loopOpts...)
 		if err != nil {
-			s.logger.ErrorF(nil, "Server.Run: eventloop serve fail, err=%+v", err)
+			s.logger.ErrorF(nil, "Server.Run: NewEventLoop fail, err=%+v", err)
 		}
-	}()
+
+		go func() {
+			err = eventLoop.Serve(ln)
+			if err != nil {
+				s.logger.ErrorF(nil, "Server.Run: eventloop serve fail, err=%+v", err)
+			}
+		}()
+	}
+
+	s.logger.InfoF(nil, "Server.Run: server start, addr=%s, tls=%t", s.addr, s.opt.TLS != nil)
 
 	go func() {
 		for {
@@ -96,7 +152,16 @@ func (s *Server) Run(ctx context.Context) {
 			case msg := <-s.ch:
 				// 收到响应消息
 				reqKey := s.msgKey(msg)
-				req, err := s.connManager.GetRequest(reqKey)
+				var (
+					req *server.Request
+					err error
+				)
+				if msg.PkgType == grpc.PkgTypeStream {
+					// 流式响应的中间帧,保留请求直到结束帧
+					req, err = s.connManager.PeekRequest(reqKey)
+				} else {
+					req, err = s.connManager.GetRequest(reqKey)
+				}
 				if err != nil {
 					s.logger.WarnF(nil, "Server.Run: GetRequest fail, err=%+v", err)
 					continue
@@ -105,11 +170,16 @@ func (s *Server) Run(ctx context.Context) {
 					s.logger.WarnF(nil, "Server.Run: request is nil or closed")
 					continue
 				}
-				s.send(req.Context(), req.Conn(), msg)
+				s.send(req, msg)
 			case <-ctx.Done():
-				eventLoop.Shutdown(ctx)
-				ln.Close()
-				close(s.ch)
+				if eventLoop != nil {
+					eventLoop.Shutdown(ctx)
+				}
+				if ln != nil {
+					ln.Close()
+				}
+				s.connManager.CloseAll()
+				// 处理协程可能仍在发送，不能关闭s.ch
 				s.logger.InfoF(nil, "Server.Run: server closed")
 				return
 			}
@@ -122,11 +192,58 @@ func (s *Server) Run(ctx context.Context) {
 
 func (s *Server) handle(ctx context.Context, conn netpoll.Connection) error {
 	msg, err := s.protocol.Decode(ctx, netpoll.NewIOReader(conn.Reader()))
+	// 单帧内容错误(如checksum不匹配)跳过该帧,其他错误关闭连接
+	if errors.Is(err, protocol.ErrMalformed) {
+		s.logger.WarnF(nil, "Server.handle: drop malformed message, err=%+v", err)
+		return nil
+	}
 	if err != nil {
 		s.logger.InfoF(nil, "Server.handle: decode fail, err=%+v", err)
 		s.connManager.CloseConn(ctx)
 		return nil
 	}
+	return s.dispatch(ctx, msg)
+}
+
+// serveTLS TLS连接的accept循环
+func (s *Server) serveTLS(ctx context.Context, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.logger.WarnF(nil, "Server.serveTLS: accept fail, err=%+v", err)
+			continue
+		}
+		go s.serveTLSConn(ctx, conn.(*tls.Conn))
+	}
+}
+
+// serveTLSConn 完成TLS握手后循环读取消息
+func (s *Server) serveTLSConn(ctx context.Context, conn *tls.Conn) {
+	_ = conn.SetDeadline(time.Now().Add(s.handshakeTimeout()))
+	if err := conn.HandshakeContext(ctx); err != nil {
+		s.logger.InfoF(nil, "Server.serveTLSConn: tls handshake fail, remote=%s, err=%+v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	s.ServeConn(ctx, conn, tlsPeer(conn), nil)
+}
+
+// dispatch 处理解码后的消息
+func (s *Server) dispatch(ctx context.Context, msg *grpc.Message) error {
+	req, ok := s.connManager.GetConn(grpc.ConnIdFromContext(ctx))
+	if !ok {
+		return gerr.New("conn not found")
+	}
+
+	// 客户端使用更高版本时,之后的响应跟随该版本
+	if msg.Version > req.Version() {
+		req.SetVersion(min(msg.Version, s.opt.ProtocolVersion))
+	}
 
 	if msg.Command == grpc.CmdHeartbeat {
 		switch msg.PkgType {
@@ -139,29 +256,149 @@ func (s *Server) handle(ctx context.Context, conn netpoll.Connection) error {
 				Seq:     msg.Seq,
 				Result:  0,
 			}
-			return s.send(ctx, conn, resp)
+			if v, ok := s.negotiate(req, msg); ok {
+				resp.Metadata = grpc.NewMetadata(grpc.MetaVersion, strconv.Itoa(int(v)))
+			}
+			return s.send(req, resp)
 		case grpc.PkgTypeReply:
 			// TODO 记录上次ping响应时间
 			return nil
 		default:
 			return nil
 		}
+	}
+
+	if msg.Command == grpc.CmdHandshake {
+		return s.handshake(ctx, req, msg)
+	}
+	if s.opt.Authenticator != nil && !req.Authed() {
+		s.logger.InfoF(nil, "Server.dispatch: request before handshake, peer=%s, command=%d", req.Peer().Addr, msg.Command)
+		s.connManager.CloseConn(ctx)
+		return gerr.New("unauthenticated")
+	}
+
+	reqKey := s.msgKey(msg)
+	s.connManager.NewRequest(ctx, reqKey)
+	if h, ok := s.handler.(grpc.IContextHandler); ok {
+		go func() {
+			reqCtx, cancel := s.requestContext(ctx, req, msg)
+			defer cancel()
+			h.HandleContext(reqCtx, msg, s.ch)
+		}()
 	} else {
-		reqKey := s.msgKey(msg)
-		s.connManager.NewRequest(ctx, reqKey)
 		go s.handler.Handle(msg, s.ch)
 	}
 	return nil
 }
 
+// handshake 校验客户端token,失败时回复错误并关闭连接
+func (s *Server) handshake(ctx context.Context, req *server.Request, msg *grpc.Message) error {
+	resp := &grpc.Message{
+		Command: grpc.CmdHandshake,
+		PkgType: grpc.PkgTypeReply,
+		ReqId:   msg.ReqId,
+		Seq:     msg.Seq,
+	}
+	if s.opt.Authenticator == nil {
+		return s.send(req, resp)
+	}
+
+	identity, err := s.opt.Authenticator(ctx, msg.Metadata.Get(grpc.MetaToken))
+	if err != nil {
+		s.logger.InfoF(nil, "Server.handshake: auth fail, peer=%s, err=%+v", req.Peer().Addr, err)
+		resp.Result = grpc.ResultUnauthorized
+		resp.Body = []byte(err.Error())
+		_ = s.send(req, resp)
+		s.connManager.CloseConn(ctx)
+		return err
+	}
+	if s.connManager.Banned(identity) {
+		s.logger.InfoF(nil, "Server.handshake: user banned, peer=%s, identity=%s", req.Peer().Addr, identity)
+		resp.Result = grpc.ResultForbidden
+		resp.Body = []byte(server.ErrBanned.Error())
+		_ = s.send(req, resp)
+		s.connManager.CloseConn(ctx)
+		return server.ErrBanned
+	}
+	peer := *req.Peer()
+	peer.Identity = identity
+	peer.AuthType = grpc.AuthTypeToken
+	req.SetPeer(&peer, true)
+	if s.opt.BindIdentity {
+		if err = s.BindUser(grpc.ConnIdFromContext(ctx), identity); err != nil {
+			s.connManager.CloseConn(ctx)
+			return err
+		}
+	}
+	return s.send(req, resp)
+}
+
+func (s *Server) handshakeTimeout() time.Duration {
+	if s.opt.Timeout > 0 {
+		return s.opt.Timeout
+	}
+	return defaultTimeout
+}
+
+// ServeConn 接入一个已建立的连接并阻塞读取,直到连接关闭或ctx取消,用于TLS、WebSocket网关等不经过netpoll的连接
+// peer: 对端信息,AuthType不为空时视为已通过认证,为空时使用连接的远端地址;Identity被封禁时直接关闭
+// onOpen: 连接注册后、开始读取前调用,可为空
+func (s *Server) ServeConn(ctx context.Context, conn net.Conn, peer *grpc.Peer, onOpen func(connId string)) {
+	connCtx := s.newConn(ctx, conn)
+	defer s.connManager.CloseConn(connCtx)
+	connId := grpc.ConnIdFromContext(connCtx)
+	if req, ok := s.connManager.GetConn(connId); ok && peer != nil {
+		req.SetPeer(peer, peer.AuthType != grpc.AuthTypeNone)
+	}
+	if peer != nil && peer.Identity != "" {
+		if s.connManager.Banned(peer.Identity) {
+			s.logger.InfoF(nil, "Server.ServeConn: user banned, remote=%s, identity=%s", conn.RemoteAddr(), peer.Identity)
+			return
+		}
+		if s.opt.BindIdentity {
+			if err := s.BindUser(connId, peer.Identity); err != nil {
+				return
+			}
+		}
+	}
+	if onOpen != nil {
+		onOpen(connId)
+	}
+
+	reader := bufio.NewReader(conn)
+	for connCtx.Err() == nil {
+		if s.opt.IdleTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(s.opt.IdleTimeout))
+		}
+		msg, err := s.protocol.Decode(connCtx, reader)
+		if errors.Is(err, protocol.ErrMalformed) {
+			s.logger.WarnF(nil, "Server.ServeConn: drop malformed message, err=%+v", err)
+			continue
+		}
+		if err != nil {
+			s.logger.InfoF(nil, "Server.ServeConn: decode fail, err=%+v", err)
+			return
+		}
+		if err = s.dispatch(connCtx, msg); err != nil {
+			return
+		}
+	}
+}
+
+// CloseConn 关闭指定连接
+func (s *Server) CloseConn(connId string) {
+	if req, ok := s.connManager.GetConn(connId); ok {
+		s.connManager.CloseConn(req.Context())
+	}
+}
+
 func (s *Server) prepare(conn netpoll.Connection) context.Context {
 	ctx := context.Background()
 	return ctx
 }
 
 func (s *Server) connect(ctx context.Context, conn netpoll.Connection) context.Context {
-	connId := s.serialId.StringId()
-	ctx = s.connManager.NewConn(ctx, connId, conn)
+	ctx = s.newConn(ctx, conn)
 	_ = conn.AddCloseCallback(func(connection netpoll.Connection) error {
 		s.connManager.CloseConn(ctx)
 		return nil
@@ -170,21 +407,117 @@ func (s *Server) connect(ctx context.Context, conn netpoll.Connection) context.C
 	return ctx
 }
 
-func (s *Server) send(ctx context.Context, conn netpoll.Connection, resp *grpc.Message) error {
-	encode, err := s.protocol.Encode(ctx, resp)
+// newConn 分配连接ID并注册到ConnManager
+func (s *Server) newConn(ctx context.Context, conn net.Conn) context.Context {
+	connId := s.serialId.StringId()
+	return s.connManager.NewConn(ctx, connId, conn)
+}
+
+// negotiate 心跳请求携带MetaVersion时,取双方支持的最高版本
+func (s *Server) negotiate(req *server.Request, msg *grpc.Message) (uint8, bool) {
+	peerMax, err := strconv.Atoi(msg.Metadata.Get(grpc.MetaVersion))
+	if err != nil || peerMax < int(protocol.Version1) {
+		return 0, false
+	}
+	version := uint8(min(peerMax, int(s.opt.ProtocolVersion)))
+	req.SetVersion(version)
+	return version, true
+}
+
+// send 编码并发送消息,未指定版本时使用与该连接协商的版本
+func (s *Server) send(req *server.Request, resp *grpc.Message) error {
+	if v := req.Version(); resp.Version == 0 && v != 0 {
+		versioned := *resp
+		versioned.Version = v
+		resp = &versioned
+	}
+	encode, err := s.protocol.Encode(req.Context(), resp)
 	if err != nil {
 		s.logger.ErrorF(nil, "Send: encode fail, err=%+v", err)
 		return nil
 	}
 
-	_, e := conn.Write(encode)
+	_, e := req.Write(encode)
 	if e != nil {
-		s.connManager.CloseConn(ctx)
+		s.connManager.CloseConn(req.Context())
 		return e
 	}
 	return nil
 }
 
+// Push 推送消息到指定连接
+func (s *Server) Push(connId string, msg *grpc.Message) error {
+	req, ok := s.connManager.GetConn(connId)
+	if !ok {
+		return gerr.New("conn not found", "connId", connId)
+	}
+	// 浅拷贝，不修改调用方的消息
+	push := *msg
+	push.PkgType = grpc.PkgTypePush
+	return s.send(req, &push)
+}
+
+// Broadcast 推送消息到分组内的所有连接，返回成功推送的连接数
+func (s *Server) Broadcast(group string, msg *grpc.Message) int {
+	push := *msg
+	push.PkgType = grpc.PkgTypePush
+	// 各连接协商的版本可能不同，每个版本只编码一次
+	encoded := make(map[uint8][]byte)
+	count := 0
+	for _, req := range s.connManager.GroupConns(group) {
+		version := push.Version
+		if version == 0 {
+			version = req.Version()
+		}
+		encode, ok := encoded[version]
+		if !ok {
+			versioned := push
+			versioned.Version = version
+			var err error
+			if encode, err = s.protocol.Encode(context.Background(), &versioned); err != nil {
+				s.logger.ErrorF(nil, "Server.Broadcast: encode fail, version=%d, err=%+v", version, err)
+				return count
+			}
+			encoded[version] = encode
+		}
+		if _, e := req.Write(encode); e != nil {
+			s.logger.DebugF(nil, "Server.Broadcast: write fail, group=%s, err=%+v", group, e)
+			s.connManager.CloseConn(req.Context())
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// JoinGroup 连接加入分组，connId可在IContextHandler中通过grpc.ConnIdFromContext获取
+func (s *Server) JoinGroup(connId string, group string) error {
+	return s.connManager.JoinGroup(connId, group)
+}
+
+// LeaveGroup 连接离开分组，连接关闭时自动离开所有分组
+func (s *Server) LeaveGroup(connId string, group string) {
+	s.connManager.LeaveGroup(connId, group)
+}
+
+// requestContext 请求上下文,携带对端信息和请求元数据,并按MetaDeadline设置deadline
+func (s *Server) requestContext(ctx context.Context, req *server.Request, msg *grpc.Message) (context.Context, context.CancelFunc) {
+	ctx = grpc.WithPeer(ctx, req.Peer())
+	ctx = grpc.NewIncomingContext(ctx, msg.Metadata)
+	var cancel context.CancelFunc
+	if deadline, ok := msg.Metadata.Deadline(); ok {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	// 服务端停止时取消请求，避免处理协程阻塞在s.ch上
+	stop := context.AfterFunc(s.runCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
 func (s *Server) msgKey(msg *grpc.Message) string {
 	return fmt.Sprintf("%d_%d_%d", msg.Command, msg.ReqId, msg.Seq)
 }
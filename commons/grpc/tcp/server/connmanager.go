@@ -3,14 +3,19 @@ package server
 import (
 	"context"
 	"errors"
-	"github.com/cloudwego/netpoll"
 	"github.com/qiafan666/gotato/commons/gcache"
 	"github.com/qiafan666/gotato/commons/gface"
+	"github.com/qiafan666/gotato/commons/grpc"
+	"net"
+	"time"
 )
 
 type ConnManager struct {
-	connRequests *gcache.ShardLockMap[string, *Request] // connId -> requests
-	reqKeys      *gcache.ShardLockMap[string, string]   // reqKey -> connId
+	connRequests *gcache.ShardLockMap[string, *Request]                           // connId -> requests
+	reqKeys      *gcache.ShardLockMap[string, string]                             // reqKey -> connId
+	groups       *gcache.ShardLockMap[string, *gcache.ShardLockMap[string, bool]] // group -> connIds
+	users        *gcache.ShardLockMap[string, string]                             // userId -> connId
+	bans         *gcache.ShardLockMap[string, time.Time]                          // userId -> 解封时间,零值为永久封禁
 	logger       gface.ILogger
 }
 
@@ -18,6 +23,9 @@ func NewConnManager(logger gface.ILogger) *ConnManager {
 	m := &ConnManager{
 		connRequests: gcache.NewShardLockMap[*Request](),
 		reqKeys:      gcache.NewShardLockMap[string](),
+		groups:       gcache.NewShardLockMap[*gcache.ShardLockMap[string, bool]](),
+		users:        gcache.NewShardLockMap[string](),
+		bans:         gcache.NewShardLockMap[time.Time](),
 		logger:       logger,
 	}
 	return m
@@ -27,50 +35,79 @@ func NewConnManager(logger gface.ILogger) *ConnManager {
 func (cm *ConnManager) NewConn(
 	ctx context.Context,
 	connId string,
-	conn netpoll.Connection,
+	conn net.Conn,
 ) context.Context {
-	if cm.connRequests.Has(connId) {
-		return ctx
+	if req, ok := cm.connRequests.Get(connId); ok {
+		return req.Context()
 	}
 
 	cm.logger.DebugF(nil, "ConnManage.NewConn, connId=%+v", connId)
 
-	req := NewRequest(ctx, conn)
+	req := NewRequest(grpc.WithConnId(ctx, connId), conn)
 	cm.connRequests.Set(connId, req)
 
-	ctx = context.WithValue(ctx, "connId", connId)
-	return ctx
+	return req.Context()
 }
 
 func (cm *ConnManager) CloseConn(ctx context.Context) {
 	//根据connId 关闭连接,释放资源
-	connId := cm.getConnIdFromCtx(ctx)
+	connId := grpc.ConnIdFromContext(ctx)
 	if connId == "" {
 		return
 	}
 
 	cm.logger.DebugF(nil, "ConnManage.CloseConn, connId=%+v", connId)
 
+	var closed *Request
 	cm.connRequests.RemoveCb(connId, func(key string, v *Request, exists bool) bool {
-		if exists {
+		if !exists {
 			return false
 		}
 		cm.logger.DebugF(nil, "ConnManage.CloseConn, remove connRequests, connId=%+v", connId)
-		v.Close()
+		closed = v
+		return true
+	})
 
-		keys := v.Keys()
-		for _, reqKey := range keys {
+	if closed != nil {
+		// 在分片锁外关闭,netpoll主动关闭连接时会同步回调CloseConn
+		closed.Close()
+		for _, reqKey := range closed.Keys() {
 			cm.reqKeys.Remove(reqKey)
 			cm.logger.DebugF(nil, "ConnManage.CloseConn, remove reqKeys, connId=%+v, reqKey=%+v", connId, reqKey)
 		}
+		for _, group := range closed.Groups() {
+			cm.LeaveGroup(connId, group)
+		}
+		if userId := closed.UserId(); userId != "" {
+			cm.unbindUser(userId, connId)
+		}
+	}
+}
 
-		return true
-	})
+// CloseAll 关闭所有连接
+func (cm *ConnManager) CloseAll() {
+	for _, req := range cm.connRequests.Items() {
+		cm.CloseConn(req.Context())
+	}
+}
+
+// GetConn 根据connId获取连接
+func (cm *ConnManager) GetConn(connId string) (*Request, bool) {
+	req, ok := cm.connRequests.Get(connId)
+	if !ok || req == nil || req.IsClosed() {
+		return nil, false
+	}
+	return req, true
+}
+
+// ConnCount 当前连接数
+func (cm *ConnManager) ConnCount() int {
+	return cm.connRequests.Count()
 }
 
 // NewRequest 新请求, 保存reqKey与connId的关系
 func (cm *ConnManager) NewRequest(ctx context.Context, reqKey string) {
-	connId := cm.getConnIdFromCtx(ctx)
+	connId := grpc.ConnIdFromContext(ctx)
 	if connId == "" {
 		return
 	}
@@ -83,31 +120,80 @@ func (cm *ConnManager) NewRequest(ctx context.Context, reqKey string) {
 	req.NewKey(reqKey)
 }
 
+// GetRequest 获取请求对应的连接，并移除reqKey
 func (cm *ConnManager) GetRequest(reqKey string) (*Request, error) {
+	return cm.getRequest(reqKey, true)
+}
+
+// PeekRequest 获取请求对应的连接，保留reqKey，用于流式响应的中间帧
+func (cm *ConnManager) PeekRequest(reqKey string) (*Request, error) {
+	return cm.getRequest(reqKey, false)
+}
+
+func (cm *ConnManager) getRequest(reqKey string, remove bool) (*Request, error) {
 	connId, ok := cm.reqKeys.Get(reqKey)
 	if !ok {
 		return nil, errors.New("connId not found")
 	}
 	cm.logger.DebugF(nil, "ConnManage.GetRequest, connId=%+v, reqKey=%+v", connId, reqKey)
-	cm.reqKeys.Remove(reqKey)
+	if remove {
+		cm.reqKeys.Remove(reqKey)
+	}
 
 	req, ok := cm.connRequests.Get(connId)
 	if !ok || req == nil {
 		return nil, errors.New("request not found")
 	}
-	req.RemoveKey(reqKey)
+	if remove {
+		req.RemoveKey(reqKey)
+	}
 
 	return req, nil
 }
 
-func (cm *ConnManager) getConnIdFromCtx(ctx context.Context) string {
-	v := ctx.Value("connId")
-	if v == nil {
-		return ""
+// JoinGroup 连接加入分组
+func (cm *ConnManager) JoinGroup(connId string, group string) error {
+	req, ok := cm.GetConn(connId)
+	if !ok {
+		return errors.New("conn not found")
 	}
-	connId, ok := v.(string)
+	cm.groups.Upsert(group, nil, func(exist bool, valueInMap, _ *gcache.ShardLockMap[string, bool]) *gcache.ShardLockMap[string, bool] {
+		if !exist {
+			valueInMap = gcache.NewShardLockMap[bool]()
+		}
+		valueInMap.Set(connId, true)
+		return valueInMap
+	})
+	req.groups.Set(group, true)
+	return nil
+}
+
+// LeaveGroup 连接离开分组，分组为空时删除
+func (cm *ConnManager) LeaveGroup(connId string, group string) {
+	if req, ok := cm.connRequests.Get(connId); ok {
+		req.groups.Remove(group)
+	}
+	cm.groups.RemoveCb(group, func(key string, members *gcache.ShardLockMap[string, bool], exists bool) bool {
+		if !exists {
+			return false
+		}
+		members.Remove(connId)
+		return members.Count() == 0
+	})
+}
+
+// GroupConns 分组内的所有连接
+func (cm *ConnManager) GroupConns(group string) []*Request {
+	members, ok := cm.groups.Get(group)
 	if !ok {
-		return ""
+		return nil
+	}
+	connIds := members.Keys()
+	reqs := make([]*Request, 0, len(connIds))
+	for _, connId := range connIds {
+		if req, ok := cm.GetConn(connId); ok {
+			reqs = append(reqs, req)
+		}
 	}
-	return connId
+	return reqs
 }
@@ -2,25 +2,39 @@ package server
 
 import (
 	"context"
-	"github.com/cloudwego/netpoll"
 	"github.com/qiafan666/gotato/commons/gcache"
+	"github.com/qiafan666/gotato/commons/grpc"
+	"net"
 	"sync"
+	"sync/atomic"
 )
 
 type Request struct {
 	ctx       context.Context
-	conn      netpoll.Connection
+	cancel    context.CancelFunc
+	conn      net.Conn
+	peer      *grpc.Peer
+	authed    bool
+	peerMu    sync.RWMutex
+	writeMu   sync.Mutex // 响应、推送可能来自不同goroutine，写操作需串行
 	closeOnce sync.Once
-	closed    bool
+	closed    atomic.Bool
 	reqKeys   *gcache.ShardLockMap[string, bool]
+	groups    *gcache.ShardLockMap[string, bool]
+	attrs     *gcache.ShardLockMap[string, any]
+	userId    string        // 绑定的用户ID,由peerMu保护
+	version   atomic.Uint32 // 与对端协商的协议版本,0为未协商
 }
 
-func NewRequest(ctx context.Context, conn netpoll.Connection) *Request {
+func NewRequest(ctx context.Context, conn net.Conn) *Request {
 	req := &Request{
-		ctx:     ctx,
 		conn:    conn,
+		peer:    &grpc.Peer{Addr: conn.RemoteAddr().String()},
 		reqKeys: gcache.NewShardLockMap[bool](),
+		groups:  gcache.NewShardLockMap[bool](),
+		attrs:   gcache.NewShardLockMap[any](),
 	}
+	req.ctx, req.cancel = context.WithCancel(ctx)
 	return req
 }
 
@@ -36,21 +50,100 @@ func (r *Request) Keys() []string {
 	return r.reqKeys.Keys()
 }
 
+// Groups 连接所在的分组
+func (r *Request) Groups() []string {
+	return r.groups.Keys()
+}
+
+// Context 连接上下文，包含连接ID，连接关闭时被取消
 func (r *Request) Context() context.Context {
 	return r.ctx
 }
 
-func (r *Request) Conn() netpoll.Connection {
+func (r *Request) Conn() net.Conn {
 	return r.conn
 }
 
+// Peer 对端信息
+func (r *Request) Peer() *grpc.Peer {
+	r.peerMu.RLock()
+	defer r.peerMu.RUnlock()
+	return r.peer
+}
+
+// SetPeer 设置对端信息,authed表示对端已通过认证
+func (r *Request) SetPeer(peer *grpc.Peer, authed bool) {
+	r.peerMu.Lock()
+	defer r.peerMu.Unlock()
+	r.peer = peer
+	r.authed = authed
+}
+
+// Version 与对端协商的协议版本,0为未协商
+func (r *Request) Version() uint8 {
+	return uint8(r.version.Load())
+}
+
+// SetVersion 设置协议版本,之后的响应和推送使用该版本编码
+func (r *Request) SetVersion(version uint8) {
+	r.version.Store(uint32(version))
+}
+
+// UserId 连接绑定的用户ID,未绑定时为空
+func (r *Request) UserId() string {
+	r.peerMu.RLock()
+	defer r.peerMu.RUnlock()
+	return r.userId
+}
+
+func (r *Request) setUserId(userId string) {
+	r.peerMu.Lock()
+	defer r.peerMu.Unlock()
+	r.userId = userId
+}
+
+// SetAttr 设置会话属性,连接关闭后随连接释放
+func (r *Request) SetAttr(key string, value any) {
+	r.attrs.Set(key, value)
+}
+
+// Attr 获取会话属性
+func (r *Request) Attr(key string) (any, bool) {
+	return r.attrs.Get(key)
+}
+
+// RemoveAttr 删除会话属性
+func (r *Request) RemoveAttr(key string) {
+	r.attrs.Remove(key)
+}
+
+// Attrs 所有会话属性的快照
+func (r *Request) Attrs() map[string]any {
+	return r.attrs.Items()
+}
+
+// Authed 对端是否已通过认证
+func (r *Request) Authed() bool {
+	r.peerMu.RLock()
+	defer r.peerMu.RUnlock()
+	return r.authed
+}
+
+// Write 串行写入连接
+func (r *Request) Write(data []byte) (int, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	return r.conn.Write(data)
+}
+
 func (r *Request) Close() {
 	r.closeOnce.Do(func() {
-		r.closed = true
+		r.closed.Store(true)
+		r.cancel()
 		r.conn.Close()
 	})
 }
 
 func (r *Request) IsClosed() bool {
-	return r.closed
+	return r.closed.Load()
 }
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrBanned 用户处于封禁期
+var ErrBanned = errors.New("user banned")
+
+// BindUser 绑定用户与连接,同一用户只保留一个连接
+// 返回被替换的旧连接,由调用方通知并关闭;用户被封禁时返回ErrBanned
+func (cm *ConnManager) BindUser(connId string, userId string) (*Request, error) {
+	req, ok := cm.GetConn(connId)
+	if !ok {
+		return nil, errors.New("conn not found")
+	}
+	if cm.Banned(userId) {
+		return nil, ErrBanned
+	}
+	if prev := req.UserId(); prev != "" && prev != userId {
+		cm.unbindUser(prev, connId)
+	}
+
+	var oldConnId string
+	cm.users.Upsert(userId, connId, func(exist bool, valueInMap string, newValue string) string {
+		if exist {
+			oldConnId = valueInMap
+		}
+		return newValue
+	})
+	req.setUserId(userId)
+	cm.logger.DebugF(nil, "ConnManage.BindUser, connId=%+v, userId=%+v", connId, userId)
+
+	// 绑定期间连接可能已关闭且CloseConn未读到userId,撤销绑定并恢复被替换的旧连接
+	if req.IsClosed() {
+		cm.unbindUser(userId, connId)
+		if oldConnId != "" && oldConnId != connId {
+			cm.restoreUser(userId, oldConnId)
+		}
+		return nil, errors.New("conn closed")
+	}
+
+	if oldConnId == "" || oldConnId == connId {
+		return nil, nil
+	}
+	old, ok := cm.GetConn(oldConnId)
+	if !ok {
+		return nil, nil
+	}
+	return old, nil
+}
+
+// unbindUser 解除绑定,已被其他连接替换时保留
+func (cm *ConnManager) unbindUser(userId string, connId string) {
+	cm.users.RemoveCb(userId, func(key string, v string, exists bool) bool {
+		return exists && v == connId
+	})
+}
+
+// restoreUser 用户未绑定其他连接时重新绑定到仍打开的连接,绑定后连接已关闭时撤销
+func (cm *ConnManager) restoreUser(userId string, connId string) {
+	req, ok := cm.GetConn(connId)
+	if !ok || req.UserId() != userId {
+		return
+	}
+	if _, loaded := cm.users.SetIfAbsent(userId, connId); loaded {
+		return
+	}
+	if req.IsClosed() {
+		cm.unbindUser(userId, connId)
+	}
+}
+
+// UserConn 用户当前的连接
+func (cm *ConnManager) UserConn(userId string) (*Request, bool) {
+	connId, ok := cm.users.Get(userId)
+	if !ok {
+		return nil, false
+	}
+	return cm.GetConn(connId)
+}
+
+// OnlineCount 已绑定用户的连接数
+func (cm *ConnManager) OnlineCount() int {
+	return cm.users.Count()
+}
+
+// OnlineUsers 在线用户ID
+func (cm *ConnManager) OnlineUsers() []string {
+	return cm.users.Keys()
+}
+
+// Ban 封禁用户到until,零值为永久封禁,不会关闭已有连接
+func (cm *ConnManager) Ban(userId string, until time.Time) {
+	cm.bans.Set(userId, until)
+}
+
+// Unban 解除封禁
+func (cm *ConnManager) Unban(userId string) {
+	cm.bans.Remove(userId)
+}
+
+// Banned 用户是否处于封禁期,已过期的封禁会被清除
+func (cm *ConnManager) Banned(userId string) bool {
+	until, ok := cm.bans.Get(userId)
+	if !ok {
+		return false
+	}
+	if until.IsZero() || time.Now().Before(until) {
+		return true
+	}
+	cm.bans.RemoveCb(userId, func(key string, v time.Time, exists bool) bool {
+		return exists && v.Equal(until)
+	})
+	return false
+}
+
+// GroupCount 分组内的连接数
+func (cm *ConnManager) GroupCount(group string) int {
+	members, ok := cm.groups.Get(group)
+	if !ok {
+		return 0
+	}
+	return members.Count()
+}
+
+// Groups 所有非空分组
+func (cm *ConnManager) Groups() []string {
+	return cm.groups.Keys()
+}
@@ -3,11 +3,16 @@ package tcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/qiafan666/gotato/commons/gface"
 	"github.com/qiafan666/gotato/commons/gid"
 	"github.com/qiafan666/gotato/commons/grpc"
+	"github.com/qiafan666/gotato/commons/grpc/tcp/protocol"
 	"github.com/qiafan666/gotato/commons/gson"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"net"
+	"strings"
 	"testing"
 	"time"
 )
@@ -15,7 +20,7 @@ import (
 func TestServer(t *testing.T) {
 	ctx, cancelFunc := context.WithTimeout(context.Background(), 20*time.Minute)
 
-	logger := gface.NewLogger("server", zapLog())
+	logger := gface.NewLogger("server", zapLog(t))
 	router := grpc.NewRouter(logger)
 
 	router.Register(grpc.CmdTestLogic, &Test{})
@@ -41,7 +46,7 @@ func TestClient1(t *testing.T) {
 		IdleConn:   0,
 		Timeout:    10 * time.Second,
 		RetryLimit: 2,
-		Logger:     gface.NewLogger("client", zapLog()),
+		Logger:     gface.NewLogger("client", zapLog(t)),
 		Hystrix: HystrixOptions{
 			Timeout:                5000 * time.Millisecond,
 			SleepWindow:            500 * time.Millisecond,
@@ -96,3 +101,274 @@ func (t *Test) Handle(request *grpc.Message) (resp *grpc.Message) {
 	}
 	return response
 }
+
+const cmdJoin grpc.Command = 100
+
+type joinHandler struct {
+	server *Server
+}
+
+func (h *joinHandler) Handle(request *grpc.Message) *grpc.Message {
+	return nil
+}
+
+func (h *joinHandler) HandleContext(ctx context.Context, request *grpc.Message) *grpc.Message {
+	err := h.server.JoinGroup(grpc.ConnIdFromContext(ctx), string(request.Body))
+	resp := &grpc.Message{Command: request.Command, PkgType: grpc.PkgTypeReply, ReqId: request.ReqId, Seq: request.Seq}
+	if err != nil {
+		resp.Body = []byte(err.Error())
+	}
+	return resp
+}
+
+type countStream struct{}
+
+func (countStream) HandleStream(ctx context.Context, request *grpc.Message, stream *grpc.Stream) error {
+	for i := 0; i < 3; i++ {
+		if err := stream.Send([]byte(fmt.Sprintf("frame%d", i))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTestServer(t *testing.T, ctx context.Context, opt *ServerOptions) (*Server, *grpc.Router, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	if opt == nil {
+		opt = &ServerOptions{}
+	}
+	opt.Timeout = 3 * time.Second
+	opt.Logger = gface.NewLogger("server", nil)
+	router := grpc.NewRouter(opt.Logger)
+	return NewServer(addr, router, opt), router, addr
+}
+
+func newTestClient(ctx context.Context, addr string, opt *ClientOptions) *Client {
+	if opt == nil {
+		opt = &ClientOptions{}
+	}
+	opt.MaxConn = 1
+	opt.Timeout = 3 * time.Second
+	opt.RetryLimit = 1
+	opt.Logger = gface.NewLogger("client", nil)
+	return NewClient(ctx, addr, opt)
+}
+
+func TestServerPushStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, router, addr := newTestServer(t, ctx, nil)
+	router.Register(cmdJoin, &joinHandler{server: srv})
+	router.RegisterStream(grpc.CmdTestLogic, countStream{})
+	srv.Run(ctx)
+	client := newTestClient(ctx, addr, nil)
+
+	pushes := make(chan *grpc.Message, 1)
+	client.Subscribe(cmdJoin, func(msg *grpc.Message) { pushes <- msg })
+
+	resp, err := client.Do(ctx, &grpc.Message{Command: cmdJoin, PkgType: grpc.PkgTypeRequest, ReqId: 1, Seq: grpc.NewSeq(), Body: []byte("room")})
+	if err != nil || len(resp.Body) != 0 {
+		t.Fatalf("join fail, resp=%+v, err=%v", resp, err)
+	}
+	broadcast := &grpc.Message{Command: cmdJoin, PkgType: grpc.PkgTypeReply, Body: []byte("hello")}
+	if n := srv.Broadcast("room", broadcast); n != 1 {
+		t.Fatalf("want broadcast to 1 conn, got %d", n)
+	}
+	// 广播的消息可能被调用方复用，不能被修改
+	if broadcast.PkgType != grpc.PkgTypeReply {
+		t.Fatalf("broadcast modified caller message %+v", broadcast)
+	}
+	select {
+	case msg := <-pushes:
+		if msg.PkgType != grpc.PkgTypePush || string(msg.Body) != "hello" {
+			t.Fatalf("unexpected push %+v", msg)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("push not received")
+	}
+
+	var frames []string
+	end, err := client.Stream(ctx, &grpc.Message{Command: grpc.CmdTestLogic, PkgType: grpc.PkgTypeRequest, ReqId: 2, Seq: grpc.NewSeq()},
+		func(frame *grpc.Message) error {
+			frames = append(frames, string(frame.Body))
+			return nil
+		})
+	if err != nil || end.PkgType != grpc.PkgTypeStreamEnd {
+		t.Fatalf("stream fail, end=%+v, err=%v", end, err)
+	}
+	if len(frames) != 3 || frames[0] != "frame0" || frames[2] != "frame2" {
+		t.Fatalf("unexpected frames %v", frames)
+	}
+	if err = srv.Push("missing", &grpc.Message{Command: cmdJoin}); err == nil {
+		t.Fatal("want conn not found")
+	}
+}
+
+type metaHandler struct{}
+
+func (metaHandler) Handle(request *grpc.Message) *grpc.Message {
+	return nil
+}
+
+func (metaHandler) HandleContext(ctx context.Context, request *grpc.Message) *grpc.Message {
+	md := grpc.MetadataFromContext(ctx)
+	_, hasDeadline := ctx.Deadline()
+	return &grpc.Message{
+		Command:  request.Command,
+		PkgType:  grpc.PkgTypeReply,
+		ReqId:    request.ReqId,
+		Seq:      request.Seq,
+		Body:     []byte(fmt.Sprintf("%s_%t", md.Get("trace"), hasDeadline)),
+		Metadata: grpc.NewMetadata("server", "tcp"),
+	}
+}
+
+func TestServerMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, router, addr := newTestServer(t, ctx, nil)
+	router.Register(grpc.CmdTestLogic, metaHandler{})
+	srv.Run(ctx)
+	client := newTestClient(ctx, addr, nil)
+
+	callCtx, callCancel := context.WithTimeout(ctx, 3*time.Second)
+	defer callCancel()
+	resp, err := client.Do(callCtx, &grpc.Message{Command: grpc.CmdTestLogic, ReqId: 1, Seq: grpc.NewSeq()},
+		grpc.WithMetadata("trace", "t-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Body) != "t-1_true" || resp.Metadata.Get("server") != "tcp" {
+		t.Fatalf("unexpected resp %+v", resp)
+	}
+}
+
+type echoReq struct {
+	Name  string
+	Items []int
+}
+
+type echoResp struct {
+	Greeting string
+	Total    int
+}
+
+func TestServerTypedCodec(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, router, addr := newTestServer(t, ctx, &ServerOptions{Compress: grpc.CompressZstd, CompressThreshold: 64})
+	router.Register(grpc.CmdTestLogic, grpc.NewTypedHandler(func(ctx context.Context, req *echoReq) (*echoResp, error) {
+		if req.Name == "" {
+			return nil, fmt.Errorf("empty name")
+		}
+		resp := &echoResp{Greeting: "hello " + req.Name}
+		for _, item := range req.Items {
+			resp.Total += item
+		}
+		return resp, nil
+	}))
+	router.Register(cmdJoin, grpc.NewTypedHandler(func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		return wrapperspb.String(strings.Repeat(req.Value, 100)), nil
+	}))
+	srv.Run(ctx)
+	client := newTestClient(ctx, addr, &ClientOptions{Compress: grpc.CompressGzip, CompressThreshold: 64})
+
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+	for _, codec := range []string{grpc.CodecJSON, grpc.CodecMsgpack, grpc.CodecGob} {
+		resp, err := grpc.Call[echoResp](ctx, client, grpc.CmdTestLogic, &echoReq{Name: codec, Items: items}, grpc.WithCodec(codec))
+		if err != nil {
+			t.Fatalf("codec %s: %v", codec, err)
+		}
+		if resp.Greeting != "hello "+codec || resp.Total != 4950 {
+			t.Fatalf("codec %s: unexpected resp %+v", codec, resp)
+		}
+	}
+
+	resp, err := grpc.Call[wrapperspb.StringValue](ctx, client, cmdJoin, wrapperspb.String("ab"), grpc.WithCodec(grpc.CodecProto))
+	if err != nil || len(resp.Value) != 200 {
+		t.Fatalf("proto codec: resp=%v, err=%v", resp, err)
+	}
+
+	var resultErr *grpc.ResultError
+	_, err = grpc.Call[echoResp](ctx, client, grpc.CmdTestLogic, &echoReq{})
+	if !errors.As(err, &resultErr) || resultErr.Result != grpc.ResultFail {
+		t.Fatalf("want handler fail, got %v", err)
+	}
+	_, err = grpc.Call[echoResp](ctx, client, grpc.CmdTestLogic, &echoReq{Name: "x"}, grpc.WithMetadata(grpc.MetaCodec, "unknown"))
+	if !errors.As(err, &resultErr) || resultErr.Result != grpc.ResultUnsupportedCodec {
+		t.Fatalf("want unsupported codec, got %v", err)
+	}
+}
+
+func TestServerNegotiateVersion(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, router, addr := newTestServer(t, ctx, &ServerOptions{Checksum: true, MaxFrameSize: 1024})
+	router.Register(grpc.CmdTestLogic, metaHandler{})
+	srv.Run(ctx)
+
+	for _, want := range []uint8{protocol.Version1, protocol.Version2} {
+		client := newTestClient(ctx, addr, &ClientOptions{ProtocolVersion: want, Checksum: true})
+		conn, err := client.pool.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want > protocol.Version1 && conn.Version() != want {
+			t.Fatalf("want negotiated version %d, got %d", want, conn.Version())
+		}
+		client.pool.Put(conn)
+
+		resp, err := client.Do(ctx, &grpc.Message{Command: grpc.CmdTestLogic, PkgType: grpc.PkgTypeRequest, ReqId: 1, Seq: grpc.NewSeq()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Version != want {
+			t.Fatalf("want reply version %d, got %d", want, resp.Version)
+		}
+		client.Close()
+	}
+
+	// 广播按各连接协商的版本编码
+	router.Register(cmdJoin, &joinHandler{server: srv})
+	pushes := make(chan *grpc.Message, 2)
+	for i, version := range []uint8{protocol.Version1, protocol.Version2} {
+		client := newTestClient(ctx, addr, &ClientOptions{ProtocolVersion: version, Checksum: true})
+		defer client.Close()
+		client.Subscribe(cmdJoin, func(msg *grpc.Message) { pushes <- msg })
+		if _, err := client.Do(ctx, &grpc.Message{Command: cmdJoin, PkgType: grpc.PkgTypeRequest, ReqId: int64(10 + i), Seq: grpc.NewSeq(), Body: []byte("room")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := srv.Broadcast("room", &grpc.Message{Command: cmdJoin, Body: []byte("hello")}); n != 2 {
+		t.Fatalf("want broadcast to 2 conns, got %d", n)
+	}
+	versions := make(map[uint8]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-pushes:
+			versions[msg.Version] = string(msg.Body) == "hello"
+		case <-time.After(3 * time.Second):
+			t.Fatal("push not received")
+		}
+	}
+	if !versions[protocol.Version1] || !versions[protocol.Version2] {
+		t.Fatalf("want pushes in both versions, got %v", versions)
+	}
+
+	// 超过服务端帧长度限制时连接被关闭
+	client := newTestClient(ctx, addr, nil)
+	defer client.Close()
+	_, err := client.Do(ctx, &grpc.Message{Command: grpc.CmdTestLogic, PkgType: grpc.PkgTypeRequest, ReqId: 2, Seq: grpc.NewSeq(), Body: make([]byte, 2048)})
+	if err == nil {
+		t.Fatal("want error for oversized frame")
+	}
+}
@@ -0,0 +1,344 @@
+package tcp
+
+import (
+	"context"
+	"github.com/qiafan666/gotato/commons/gerr"
+	"github.com/qiafan666/gotato/commons/gface"
+	"github.com/qiafan666/gotato/commons/grpc"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultHealthInterval = 5 * time.Second
+	defaultEjectFailures  = 3
+	defaultEjectDuration  = 10 * time.Second
+)
+
+// ServiceClientOptions 服务客户端配置选项
+type ServiceClientOptions struct {
+	Client         ClientOptions // 每个实例的客户端配置
+	Balancer       IBalancer     // 负载均衡,为空时使用轮询
+	HealthInterval time.Duration // 心跳健康检查间隔,默认5s
+	EjectFailures  int           // 连续调用失败达到该次数时摘除实例,默认3
+	EjectDuration  time.Duration // 摘除后至少经过该时长才重新探测,默认10s
+}
+
+// Endpoint 一个服务实例
+type Endpoint struct {
+	Addr string
+
+	client    *Client
+	pending   atomic.Int64 // 进行中的请求数
+	failures  atomic.Int32 // 连续失败次数
+	ejected   atomic.Bool  // 是否已被摘除
+	ejectedAt atomic.Int64 // 摘除时间 unix ms
+}
+
+// Pending 进行中的请求数
+func (e *Endpoint) Pending() int64 {
+	return e.pending.Load()
+}
+
+// Healthy 是否可用
+func (e *Endpoint) Healthy() bool {
+	return !e.ejected.Load()
+}
+
+// Client 实例的客户端
+func (e *Endpoint) Client() *Client {
+	return e.client
+}
+
+// EndpointStat 实例状态快照
+type EndpointStat struct {
+	Addr     string `json:"addr"`
+	Pending  int64  `json:"pending"`
+	Failures int32  `json:"failures"`
+	Healthy  bool   `json:"healthy"`
+}
+
+var _ grpc.IClient = (*ServiceClient)(nil)
+
+// ServiceClient 通过服务发现访问一组实例的TCP客户端
+// 实例列表随解析器推送变化,调用失败或心跳失败的实例会被摘除,恢复后重新加入负载均衡
+type ServiceClient struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	service  string
+	opt      *ServiceClientOptions
+	balancer IBalancer
+
+	mu        sync.RWMutex
+	endpoints map[string]*Endpoint
+
+	subMu sync.RWMutex
+	subs  map[grpc.Command]PushHandler
+
+	logger gface.ILogger
+}
+
+// NewServiceClient 创建服务客户端,等待解析器推送首个地址列表后返回
+// ctx: 取消后停止监听并关闭所有连接
+// service: 服务名
+// resolver: 服务地址解析器
+func NewServiceClient(ctx context.Context, service string, resolver IResolver, opt *ServiceClientOptions) (*ServiceClient, error) {
+	if opt.Balancer == nil {
+		opt.Balancer = NewBalancer(BalancerRoundRobin)
+	}
+	if opt.HealthInterval <= 0 {
+		opt.HealthInterval = defaultHealthInterval
+	}
+	if opt.EjectFailures <= 0 {
+		opt.EjectFailures = defaultEjectFailures
+	}
+	if opt.EjectDuration <= 0 {
+		opt.EjectDuration = defaultEjectDuration
+	}
+
+	s := &ServiceClient{
+		service:   service,
+		opt:       opt,
+		balancer:  opt.Balancer,
+		endpoints: make(map[string]*Endpoint),
+		subs:      make(map[grpc.Command]PushHandler),
+		logger:    opt.Client.Logger,
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+
+	ch, err := resolver.WatchAddrs(s.ctx, service)
+	if err != nil {
+		s.cancel()
+		return nil, gerr.WrapMsg(err, "watch service addrs fail", "service", service)
+	}
+	select {
+	case addrs, ok := <-ch:
+		if !ok {
+			s.cancel()
+			return nil, gerr.New("resolver closed", "service", service)
+		}
+		s.update(addrs)
+	case <-ctx.Done():
+		s.cancel()
+		return nil, gerr.WrapMsg(ctx.Err(), "context canceled")
+	}
+
+	go s.watch(ch)
+	go s.healthCheck()
+	return s, nil
+}
+
+// Do 选择实例并执行RPC调用,实现grpc.IClient
+func (s *ServiceClient) Do(ctx context.Context, request *grpc.Message, opts ...grpc.CallOption) (*grpc.Message, error) {
+	e, err := s.balancer.Pick(ctx, request)
+	if err != nil {
+		return nil, gerr.WrapMsg(err, "pick endpoint fail", "service", s.service)
+	}
+	e.pending.Add(1)
+	defer e.pending.Add(-1)
+
+	resp, err := e.client.Do(ctx, request, opts...)
+	s.report(ctx, e, err)
+	return resp, err
+}
+
+// Stream 选择实例并发起流式请求
+func (s *ServiceClient) Stream(ctx context.Context, request *grpc.Message, onFrame StreamFrameHandler, opts ...grpc.CallOption) (*grpc.Message, error) {
+	e, err := s.balancer.Pick(ctx, request)
+	if err != nil {
+		return nil, gerr.WrapMsg(err, "pick endpoint fail", "service", s.service)
+	}
+	e.pending.Add(1)
+	defer e.pending.Add(-1)
+
+	resp, err := e.client.Stream(ctx, request, onFrame, opts...)
+	s.report(ctx, e, err)
+	return resp, err
+}
+
+// Subscribe 订阅所有实例指定命令的推送消息
+func (s *ServiceClient) Subscribe(cmd grpc.Command, handler PushHandler) {
+	s.subMu.Lock()
+	s.subs[cmd] = handler
+	s.subMu.Unlock()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.endpoints {
+		e.client.Subscribe(cmd, handler)
+	}
+}
+
+// Endpoints 所有实例的状态,按地址排序
+func (s *ServiceClient) Endpoints() []EndpointStat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ret := make([]EndpointStat, 0, len(s.endpoints))
+	for _, e := range s.endpoints {
+		ret = append(ret, EndpointStat{
+			Addr:     e.Addr,
+			Pending:  e.Pending(),
+			Failures: e.failures.Load(),
+			Healthy:  e.Healthy(),
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Addr < ret[j].Addr })
+	return ret
+}
+
+// Close 停止监听并关闭所有实例的连接
+func (s *ServiceClient) Close() {
+	s.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for addr, e := range s.endpoints {
+		e.client.Close()
+		delete(s.endpoints, addr)
+	}
+	s.balancer.Update(nil)
+}
+
+// watch 处理实例列表变化
+func (s *ServiceClient) watch(ch <-chan []string) {
+	for {
+		select {
+		case addrs, ok := <-ch:
+			if !ok {
+				return
+			}
+			s.update(addrs)
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// update 按最新地址列表增删实例
+func (s *ServiceClient) update(addrs []string) {
+	if s.ctx.Err() != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latest := make(map[string]struct{}, len(addrs))
+	for _, addr := range addrs {
+		latest[addr] = struct{}{}
+		if _, ok := s.endpoints[addr]; ok {
+			continue
+		}
+		cliOpt := s.opt.Client
+		e := &Endpoint{Addr: addr, client: NewClient(s.ctx, addr, &cliOpt)}
+		s.subMu.RLock()
+		for cmd, handler := range s.subs {
+			e.client.Subscribe(cmd, handler)
+		}
+		s.subMu.RUnlock()
+		s.endpoints[addr] = e
+		s.logger.InfoF(nil, "ServiceClient.update: add endpoint, service=%s, addr=%s", s.service, addr)
+	}
+	for addr, e := range s.endpoints {
+		if _, ok := latest[addr]; ok {
+			continue
+		}
+		e.client.Close()
+		delete(s.endpoints, addr)
+		s.logger.InfoF(nil, "ServiceClient.update: remove endpoint, service=%s, addr=%s", s.service, addr)
+	}
+	s.rebalance()
+}
+
+// rebalance 将可用实例同步给负载均衡,调用方需持有s.mu
+func (s *ServiceClient) rebalance() {
+	healthy := make([]*Endpoint, 0, len(s.endpoints))
+	for _, e := range s.endpoints {
+		if e.Healthy() {
+			healthy = append(healthy, e)
+		}
+	}
+	sort.Slice(healthy, func(i, j int) bool { return healthy[i].Addr < healthy[j].Addr })
+	s.balancer.Update(healthy)
+}
+
+// report 记录调用结果,连续失败达到阈值时摘除实例
+// 业务错误码随响应返回不计入失败,调用方自身取消或超时也不计入
+func (s *ServiceClient) report(ctx context.Context, e *Endpoint, err error) {
+	if err == nil {
+		e.failures.Store(0)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if int(e.failures.Add(1)) >= s.opt.EjectFailures {
+		s.eject(e, err)
+	}
+}
+
+func (s *ServiceClient) eject(e *Endpoint, err error) {
+	e.ejectedAt.Store(time.Now().UnixMilli())
+	if !e.ejected.CompareAndSwap(false, true) {
+		return
+	}
+	s.logger.WarnF(nil, "ServiceClient.eject: eject endpoint, service=%s, addr=%s, err=%+v", s.service, e.Addr, err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rebalance()
+}
+
+func (s *ServiceClient) recover(e *Endpoint) {
+	e.failures.Store(0)
+	if !e.ejected.CompareAndSwap(true, false) {
+		return
+	}
+	s.logger.InfoF(nil, "ServiceClient.recover: endpoint recovered, service=%s, addr=%s", s.service, e.Addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rebalance()
+}
+
+// healthCheck 定时发送心跳,失败摘除,被摘除的实例经过EjectDuration后重新探测
+func (s *ServiceClient) healthCheck() {
+	ticker := time.NewTicker(s.opt.HealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.probe()
+		}
+	}
+}
+
+func (s *ServiceClient) probe() {
+	s.mu.RLock()
+	endpoints := make([]*Endpoint, 0, len(s.endpoints))
+	for _, e := range s.endpoints {
+		endpoints = append(endpoints, e)
+	}
+	s.mu.RUnlock()
+
+	now := time.Now().UnixMilli()
+	var wg sync.WaitGroup
+	for _, e := range endpoints {
+		if e.ejected.Load() && now-e.ejectedAt.Load() < s.opt.EjectDuration.Milliseconds() {
+			continue
+		}
+		wg.Add(1)
+		go func(e *Endpoint) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(s.ctx, s.opt.HealthInterval)
+			defer cancel()
+			if err := e.client.Ping(ctx); err != nil {
+				s.eject(e, err)
+				return
+			}
+			s.recover(e)
+		}(e)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,162 @@
+package tcp
+
+import (
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gerr"
+	"github.com/qiafan666/gotato/commons/grpc"
+	"github.com/qiafan666/gotato/commons/grpc/tcp/server"
+)
+
+// 踢下线原因,作为grpc.CmdKick推送的body
+const (
+	KickReasonReplaced = "login elsewhere" // 同一用户在其他连接登录
+	KickReasonBanned   = "banned"          // 用户被封禁
+)
+
+// BindUser 绑定用户到连接,如在登录命令中通过grpc.ConnIdFromContext获取connId后调用
+// 同一用户只保留一个连接,旧连接收到grpc.CmdKick推送后关闭;用户被封禁时返回server.ErrBanned
+func (s *Server) BindUser(connId string, userId string) error {
+	old, err := s.connManager.BindUser(connId, userId)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		s.logger.InfoF(nil, "Server.BindUser: kick old conn, userId=%s, connId=%s", userId, grpc.ConnIdFromContext(old.Context()))
+		s.kick(old, KickReasonReplaced)
+	}
+	return nil
+}
+
+// UserId 连接绑定的用户ID,未绑定时为空
+func (s *Server) UserId(connId string) string {
+	req, ok := s.connManager.GetConn(connId)
+	if !ok {
+		return ""
+	}
+	return req.UserId()
+}
+
+// UserConnId 用户当前的连接ID
+func (s *Server) UserConnId(userId string) (string, bool) {
+	req, ok := s.connManager.UserConn(userId)
+	if !ok {
+		return "", false
+	}
+	return grpc.ConnIdFromContext(req.Context()), true
+}
+
+// Online 用户是否在线
+func (s *Server) Online(userId string) bool {
+	_, ok := s.connManager.UserConn(userId)
+	return ok
+}
+
+// OnlineCount 在线用户数
+func (s *Server) OnlineCount() int {
+	return s.connManager.OnlineCount()
+}
+
+// OnlineUsers 在线用户ID
+func (s *Server) OnlineUsers() []string {
+	return s.connManager.OnlineUsers()
+}
+
+// ConnCount 当前连接数,含未绑定用户的连接
+func (s *Server) ConnCount() int {
+	return s.connManager.ConnCount()
+}
+
+// PushUser 推送消息给用户
+func (s *Server) PushUser(userId string, msg *grpc.Message) error {
+	req, ok := s.connManager.UserConn(userId)
+	if !ok {
+		return gerr.New("user offline", "userId", userId)
+	}
+	// 浅拷贝，不修改调用方的消息
+	push := *msg
+	push.PkgType = grpc.PkgTypePush
+	return s.send(req, &push)
+}
+
+// Kick 推送grpc.CmdKick后关闭用户的连接,返回用户是否在线
+func (s *Server) Kick(userId string, reason string) bool {
+	req, ok := s.connManager.UserConn(userId)
+	if !ok {
+		return false
+	}
+	s.kick(req, reason)
+	return true
+}
+
+// kick 通知对端原因后关闭连接
+func (s *Server) kick(req *server.Request, reason string) {
+	_ = s.send(req, &grpc.Message{
+		Command: grpc.CmdKick,
+		PkgType: grpc.PkgTypePush,
+		Body:    []byte(reason),
+	})
+	s.connManager.CloseConn(req.Context())
+}
+
+// Ban 封禁用户并踢下线,封禁期内绑定用户或token握手会被拒绝
+// d: 封禁时长,小于等于0为永久封禁
+func (s *Server) Ban(userId string, d time.Duration) {
+	var until time.Time
+	if d > 0 {
+		until = time.Now().Add(d)
+	}
+	s.connManager.Ban(userId, until)
+	s.Kick(userId, KickReasonBanned)
+}
+
+// Unban 解除封禁
+func (s *Server) Unban(userId string) {
+	s.connManager.Unban(userId)
+}
+
+// Banned 用户是否处于封禁期
+func (s *Server) Banned(userId string) bool {
+	return s.connManager.Banned(userId)
+}
+
+// SetAttr 设置连接的会话属性,连接关闭后释放
+func (s *Server) SetAttr(connId string, key string, value any) error {
+	req, ok := s.connManager.GetConn(connId)
+	if !ok {
+		return gerr.New("conn not found", "connId", connId)
+	}
+	req.SetAttr(key, value)
+	return nil
+}
+
+// Attr 获取连接的会话属性
+func (s *Server) Attr(connId string, key string) (any, bool) {
+	req, ok := s.connManager.GetConn(connId)
+	if !ok {
+		return nil, false
+	}
+	return req.Attr(key)
+}
+
+// GroupCount 分组内的连接数
+func (s *Server) GroupCount(group string) int {
+	return s.connManager.GroupCount(group)
+}
+
+// GroupUsers 分组内已绑定用户的用户ID
+func (s *Server) GroupUsers(group string) []string {
+	reqs := s.connManager.GroupConns(group)
+	userIds := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		if userId := req.UserId(); userId != "" {
+			userIds = append(userIds, userId)
+		}
+	}
+	return userIds
+}
+
+// Groups 所有非空分组
+func (s *Server) Groups() []string {
+	return s.connManager.Groups()
+}
@@ -0,0 +1,107 @@
+package tcp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/grpc"
+)
+
+const (
+	cmdEnterRoom grpc.Command = 120
+	cmdNotice    grpc.Command = 121
+)
+
+func TestServerSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, router, addr := newTestServer(t, ctx, &ServerOptions{
+		Authenticator: func(ctx context.Context, token string) (string, error) {
+			return token, nil
+		},
+		BindIdentity: true,
+	})
+	router.Register(cmdEnterRoom, funcHandler(func(ctx context.Context, request *grpc.Message) *grpc.Message {
+		connId := grpc.ConnIdFromContext(ctx)
+		_ = srv.JoinGroup(connId, "room")
+		_ = srv.SetAttr(connId, "room", string(request.Body))
+		return okReply(ctx, request)
+	}))
+	srv.Run(ctx)
+
+	enter := func(client *Client) {
+		if _, err := client.Do(ctx, &grpc.Message{Command: cmdEnterRoom, PkgType: grpc.PkgTypeRequest, ReqId: 1, Seq: grpc.NewSeq(), Body: []byte("room")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subscribe := func(client *Client) (chan string, chan string) {
+		kicks, notices := make(chan string, 1), make(chan string, 1)
+		client.Subscribe(grpc.CmdKick, func(msg *grpc.Message) { kicks <- string(msg.Body) })
+		client.Subscribe(cmdNotice, func(msg *grpc.Message) { notices <- string(msg.Body) })
+		return kicks, notices
+	}
+	recv := func(ch chan string, what string) string {
+		select {
+		case v := <-ch:
+			return v
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timeout waiting for %s", what)
+			return ""
+		}
+	}
+
+	alice := newTestClient(ctx, addr, &ClientOptions{Token: "alice"})
+	aliceKicks, _ := subscribe(alice)
+	enter(alice)
+	bob := newTestClient(ctx, addr, &ClientOptions{Token: "bob"})
+	bobKicks, bobNotices := subscribe(bob)
+	enter(bob)
+
+	if srv.OnlineCount() != 2 || !srv.Online("alice") || srv.GroupCount("room") != 2 || len(srv.GroupUsers("room")) != 2 {
+		t.Fatalf("unexpected online=%d room=%v", srv.OnlineCount(), srv.GroupUsers("room"))
+	}
+	connId, ok := srv.UserConnId("bob")
+	if !ok || srv.UserId(connId) != "bob" {
+		t.Fatalf("locate bob fail, connId=%s", connId)
+	}
+	if v, ok := srv.Attr(connId, "room"); !ok || v != "room" {
+		t.Fatalf("unexpected attr %v", v)
+	}
+	notice := &grpc.Message{Command: cmdNotice, PkgType: grpc.PkgTypeReply, Body: []byte("hi")}
+	if err := srv.PushUser("bob", notice); err != nil {
+		t.Fatal(err)
+	}
+	if notice.PkgType != grpc.PkgTypeReply {
+		t.Fatalf("PushUser modified caller message %+v", notice)
+	}
+	if got := recv(bobNotices, "notice"); got != "hi" {
+		t.Fatalf("unexpected notice %s", got)
+	}
+
+	// 重复登录踢掉旧连接
+	other := newTestClient(ctx, addr, &ClientOptions{Token: "alice"})
+	enter(other)
+	if got := recv(aliceKicks, "replaced kick"); got != KickReasonReplaced {
+		t.Fatalf("unexpected kick reason %s", got)
+	}
+	waitFor(t, "old alice conn left room", func() bool { return srv.GroupCount("room") == 2 })
+	if srv.OnlineCount() != 2 {
+		t.Fatalf("want 2 online, got %d", srv.OnlineCount())
+	}
+
+	// 封禁后踢下线且无法重新握手
+	srv.Ban("bob", time.Minute)
+	if got := recv(bobKicks, "ban kick"); got != KickReasonBanned {
+		t.Fatalf("unexpected kick reason %s", got)
+	}
+	waitFor(t, "bob offline", func() bool { return !srv.Online("bob") })
+	if _, err := newTestClient(ctx, addr, &ClientOptions{Token: "bob"}).Do(ctx, peerRequest()); err == nil {
+		t.Fatal("banned user should be rejected")
+	}
+	srv.Unban("bob")
+	enter(newTestClient(ctx, addr, &ClientOptions{Token: "bob"}))
+	if !srv.Online("bob") {
+		t.Fatal("want bob online after unban")
+	}
+}
@@ -0,0 +1,164 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gerr"
+	"github.com/qiafan666/gotato/commons/grpc"
+)
+
+// TLSOptions TLS配置选项
+type TLSOptions struct {
+	CertFile string // 本端证书,服务端必填;客户端填写时用于mTLS
+	KeyFile  string // 本端私钥
+
+	// CAFile 校验对端证书的CA
+	// 服务端填写时开启mTLS,要求并校验客户端证书;客户端填写时用于校验服务端证书,为空使用系统CA
+	CAFile string
+
+	ServerName         string        // 客户端校验的服务端名,为空时使用地址中的host
+	InsecureSkipVerify bool          // 客户端跳过服务端证书校验,仅用于测试
+	ReloadInterval     time.Duration // 证书文件变更检查间隔,0表示不重新加载
+}
+
+// Authenticator token握手认证函数,返回对端身份
+type Authenticator func(ctx context.Context, token string) (identity string, err error)
+
+// certReloader 按间隔检查证书文件修改时间,变更后重新加载,加载失败时继续使用旧证书
+type certReloader struct {
+	certFile  string
+	keyFile   string
+	interval  time.Duration
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return gerr.WrapMsg(err, "load x509 key pair fail", "certFile", r.certFile)
+	}
+	r.cert = &cert
+	r.modTime = r.lastModTime()
+	r.checkedAt = time.Now()
+	return nil
+}
+
+func (r *certReloader) lastModTime() time.Time {
+	var last time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last
+}
+
+func (r *certReloader) get() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.interval > 0 && time.Since(r.checkedAt) >= r.interval {
+		r.checkedAt = time.Now()
+		if !r.lastModTime().Equal(r.modTime) {
+			_ = r.load()
+		}
+	}
+	return r.cert
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, gerr.WrapMsg(err, "read ca file fail", "caFile", caFile)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, gerr.New("no valid certificate in ca file", "caFile", caFile)
+	}
+	return pool, nil
+}
+
+// serverTLSConfig 服务端TLS配置
+func (o *TLSOptions) serverTLSConfig() (*tls.Config, error) {
+	reloader, err := newCertReloader(o.CertFile, o.KeyFile, o.ReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return reloader.get(), nil
+		},
+	}
+	if o.CAFile != "" {
+		if conf.ClientCAs, err = loadCertPool(o.CAFile); err != nil {
+			return nil, err
+		}
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return conf, nil
+}
+
+// clientTLSConfig 客户端TLS配置
+func (o *TLSOptions) clientTLSConfig(addr string) (*tls.Config, error) {
+	conf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if conf.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, gerr.WrapMsg(err, "split addr fail", "addr", addr)
+		}
+		conf.ServerName = host
+	}
+	if o.CAFile != "" {
+		var err error
+		if conf.RootCAs, err = loadCertPool(o.CAFile); err != nil {
+			return nil, err
+		}
+	}
+	if o.CertFile != "" {
+		reloader, err := newCertReloader(o.CertFile, o.KeyFile, o.ReloadInterval)
+		if err != nil {
+			return nil, err
+		}
+		conf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.get(), nil
+		}
+	}
+	return conf, nil
+}
+
+// tlsPeer 由TLS连接状态生成对端信息,未提供客户端证书时Identity为空
+func tlsPeer(conn *tls.Conn) *grpc.Peer {
+	p := &grpc.Peer{Addr: conn.RemoteAddr().String()}
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return p
+	}
+	cert := state.PeerCertificates[0]
+	p.AuthType = grpc.AuthTypeTLS
+	p.Identity = cert.Subject.CommonName
+	if p.Identity == "" && len(cert.DNSNames) > 0 {
+		p.Identity = cert.DNSNames[0]
+	}
+	return p
+}
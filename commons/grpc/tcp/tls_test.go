@@ -0,0 +1,195 @@
+package tcp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/grpc"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	ca := &testCA{cert: cert, key: key, dir: t.TempDir()}
+	writePEM(t, ca.path("ca.pem"), "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) path(name string) string {
+	return filepath.Join(ca.dir, name)
+}
+
+// issue 签发证书,返回证书和私钥文件路径
+func (ca *testCA) issue(t *testing.T, name, commonName string, serial int64) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := ca.path(name+".pem"), ca.path(name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, file, typ string, der []byte) {
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type peerHandler struct{}
+
+func (peerHandler) Handle(request *grpc.Message) *grpc.Message {
+	return nil
+}
+
+func (peerHandler) HandleContext(ctx context.Context, request *grpc.Message) *grpc.Message {
+	peer := grpc.PeerFromContext(ctx)
+	return &grpc.Message{
+		Command: request.Command,
+		PkgType: grpc.PkgTypeReply,
+		ReqId:   request.ReqId,
+		Seq:     request.Seq,
+		Body:    []byte(peer.AuthType + ":" + peer.Identity),
+	}
+}
+
+func peerRequest() *grpc.Message {
+	seq := grpc.NewSeq()
+	return &grpc.Message{Command: grpc.CmdTestLogic, PkgType: grpc.PkgTypeRequest, ReqId: int64(seq), Seq: seq}
+}
+
+func TestServerMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "server", "server", 2)
+	clientCert, clientKey := ca.issue(t, "client", "client-1", 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, router, addr := newTestServer(t, ctx, &ServerOptions{
+		TLS: &TLSOptions{CertFile: serverCert, KeyFile: serverKey, CAFile: ca.path("ca.pem")},
+	})
+	router.Register(grpc.CmdTestLogic, peerHandler{})
+	srv.Run(ctx)
+
+	client := newTestClient(ctx, addr, &ClientOptions{
+		TLS: &TLSOptions{CertFile: clientCert, KeyFile: clientKey, CAFile: ca.path("ca.pem")},
+	})
+	resp, err := client.Do(ctx, peerRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Body) != "tls:client-1" {
+		t.Fatalf("unexpected peer %s", resp.Body)
+	}
+
+	// 未提供客户端证书
+	anonymous := newTestClient(ctx, addr, &ClientOptions{TLS: &TLSOptions{CAFile: ca.path("ca.pem")}})
+	if _, err = anonymous.Do(ctx, peerRequest()); err == nil {
+		t.Fatal("want mtls verify fail")
+	}
+}
+
+func TestServerTokenAuth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, router, addr := newTestServer(t, ctx, &ServerOptions{
+		Authenticator: func(ctx context.Context, token string) (string, error) {
+			if token != "secret" {
+				return "", errors.New("invalid token")
+			}
+			return "user-1", nil
+		},
+	})
+	router.Register(grpc.CmdTestLogic, peerHandler{})
+	srv.Run(ctx)
+
+	client := newTestClient(ctx, addr, &ClientOptions{Token: "secret"})
+	resp, err := client.Do(ctx, peerRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Body) != "token:user-1" {
+		t.Fatalf("unexpected peer %s", resp.Body)
+	}
+
+	for _, token := range []string{"wrong", ""} {
+		bad := newTestClient(ctx, addr, &ClientOptions{Token: token})
+		if _, err = bad.Do(ctx, peerRequest()); err == nil {
+			t.Fatalf("token %q should be rejected", token)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, "server", "old", 2)
+	r, err := newCertReloader(certFile, keyFile, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(r.get().Certificate[0])
+	if leaf.Subject.CommonName != "old" {
+		t.Fatalf("unexpected cert %s", leaf.Subject.CommonName)
+	}
+
+	ca.issue(t, "server", "new", 3)
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	time.Sleep(2 * time.Millisecond)
+	leaf, _ = x509.ParseCertificate(r.get().Certificate[0])
+	if leaf.Subject.CommonName != "new" {
+		t.Fatalf("cert not reloaded, got %s", leaf.Subject.CommonName)
+	}
+}
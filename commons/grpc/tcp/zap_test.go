@@ -10,12 +10,14 @@ import (
 	"path"
 	"runtime"
 	"strings"
+	"testing"
 	"time"
 )
 
-func zapLog() *zap.SugaredLogger {
+// zapLog 日志写入测试的临时目录，避免在源码目录中生成日志文件
+func zapLog(t testing.TB) *zap.SugaredLogger {
 
-	writeSyncer := getLogWriter(fmt.Sprintf("%s/%s.log", "./log", "test"))
+	writeSyncer := getLogWriter(fmt.Sprintf("%s/%s.log", t.TempDir(), "test"))
 
 	encoder := DevEncoder()
 
@@ -0,0 +1,104 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/qiafan666/gotato/commons/gerr"
+)
+
+// Invoke 按调用配置的编码序列化req并发起调用，响应反序列化到resp，resp为nil时忽略响应body
+// 响应Result非0时返回*ResultError
+func Invoke(ctx context.Context, c IClient, cmd Command, req any, resp any, opts ...CallOption) error {
+	callOpts := NewCallOptions(opts...)
+	codec, ok := GetCodec(callOpts.Codec)
+	if !ok {
+		return gerr.New("unsupported codec", "codec", callOpts.Codec)
+	}
+	body, err := codec.Marshal(req)
+	if err != nil {
+		return gerr.WrapMsg(err, "marshal request fail", "codec", codec.Name())
+	}
+
+	seq := NewSeq()
+	request := &Message{
+		Command:  cmd,
+		PkgType:  PkgTypeRequest,
+		ReqId:    int64(seq),
+		Seq:      seq,
+		Body:     body,
+		Metadata: NewMetadata(MetaCodec, codec.Name()),
+	}
+	reply, err := c.Do(ctx, request, opts...)
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return gerr.New("empty reply")
+	}
+	if reply.Result != ResultOK {
+		return &ResultError{Result: reply.Result, Msg: string(reply.Body)}
+	}
+	if resp == nil || len(reply.Body) == 0 {
+		return nil
+	}
+	replyCodec, err := MessageCodec(reply)
+	if err != nil {
+		return err
+	}
+	if err = replyCodec.Unmarshal(reply.Body, resp); err != nil {
+		return gerr.WrapMsg(err, "unmarshal reply fail", "codec", replyCodec.Name())
+	}
+	return nil
+}
+
+// Call Invoke的泛型版本
+func Call[Resp any](ctx context.Context, c IClient, cmd Command, req any, opts ...CallOption) (*Resp, error) {
+	resp := new(Resp)
+	if err := Invoke(ctx, c, cmd, req, resp, opts...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// TypedHandler 按请求的编码自动反序列化请求、序列化响应的Handler
+type TypedHandler[Req, Resp any] struct {
+	fn func(ctx context.Context, req *Req) (*Resp, error)
+}
+
+// NewTypedHandler 创建TypedHandler，fn返回error时回复ResultFail
+func NewTypedHandler[Req, Resp any](fn func(ctx context.Context, req *Req) (*Resp, error)) *TypedHandler[Req, Resp] {
+	return &TypedHandler[Req, Resp]{fn: fn}
+}
+
+func (h *TypedHandler[Req, Resp]) Handle(request *Message) *Message {
+	return h.HandleContext(context.Background(), request)
+}
+
+func (h *TypedHandler[Req, Resp]) HandleContext(ctx context.Context, request *Message) *Message {
+	codec, err := MessageCodec(request)
+	if err != nil {
+		return ErrorReply(request, ResultUnsupportedCodec, err)
+	}
+	req := new(Req)
+	if len(request.Body) > 0 {
+		if err = codec.Unmarshal(request.Body, req); err != nil {
+			return ErrorReply(request, ResultBadRequest, err)
+		}
+	}
+	resp, err := h.fn(ctx, req)
+	if err != nil {
+		return ErrorReply(request, ResultFail, err)
+	}
+	body, err := codec.Marshal(resp)
+	if err != nil {
+		return ErrorReply(request, ResultFail, err)
+	}
+	return &Message{
+		Command:  request.Command,
+		PkgType:  PkgTypeReply,
+		ReqId:    request.ReqId,
+		Seq:      request.Seq,
+		Body:     body,
+		Metadata: NewMetadata(MetaCodec, codec.Name()),
+	}
+}
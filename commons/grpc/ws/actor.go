@@ -0,0 +1,87 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gapp/chanrpc"
+	"github.com/qiafan666/gotato/commons/gcommon"
+	"github.com/qiafan666/gotato/commons/grpc"
+)
+
+var _ grpc.ContextHandler = (*ActorHandler)(nil)
+
+// ActorRequest 投递给gapp模块chanrpc的网关请求
+// 模块通过 RegisterByName(ActorMsgName(cmd), handler) 注册,handler中以ReqCtx.Reply回复*grpc.Message
+type ActorRequest struct {
+	Ctx     context.Context // 请求上下文,含连接ID、对端、元数据
+	Message *grpc.Message
+}
+
+// MsgID 实现chanrpc.IMsgID,按命令区分消息
+func (r *ActorRequest) MsgID() uint32 {
+	return gcommon.Str2Uint32(ActorMsgName(r.Message.Command))
+}
+
+// Reply 创建成功响应
+func (r *ActorRequest) Reply(body []byte) *grpc.Message {
+	return &grpc.Message{
+		Command: r.Message.Command,
+		PkgType: grpc.PkgTypeReply,
+		ReqId:   r.Message.ReqId,
+		Seq:     r.Message.Seq,
+		Body:    body,
+	}
+}
+
+// ActorMsgName 命令在chanrpc中注册的消息名
+func ActorMsgName(cmd grpc.Command) string {
+	return fmt.Sprintf("grpc_command_%d", cmd)
+}
+
+// ActorHandler 将命令转发给gapp模块的chanrpc,在模块协程中处理,可注册到grpc.Router
+// 如 router.Register(cmd, ws.NewActorHandler(module.Server(), 3*time.Second))
+type ActorHandler struct {
+	server  chanrpc.IServer
+	timeout time.Duration
+}
+
+// NewActorHandler 创建转发到server的Handler,timeout为等待模块响应的超时时间
+// 超时由gapp的定时器实现,需在gapp进程中使用或已调用timer.Run
+func NewActorHandler(server chanrpc.IServer, timeout time.Duration) *ActorHandler {
+	return &ActorHandler{server: server, timeout: timeout}
+}
+
+func (h *ActorHandler) Handle(request *grpc.Message) *grpc.Message {
+	return h.HandleContext(context.Background(), request)
+}
+
+func (h *ActorHandler) HandleContext(ctx context.Context, request *grpc.Message) *grpc.Message {
+	ack := h.server.CallT(ctx, &ActorRequest{Ctx: ctx, Message: request}, h.timeout)
+	if ack.Err != nil {
+		result := grpc.ResultFail
+		switch {
+		case errors.Is(ack.Err, chanrpc.ErrTimeout):
+			result = grpc.ResultTimeout
+		case errors.Is(ack.Err, chanrpc.ErrPeerMsgNotRegsitered):
+			result = grpc.ResultNotFound
+		case errors.Is(ack.Err, chanrpc.ErrPeerChanRPCFull), errors.Is(ack.Err, chanrpc.ErrPeerMsgDropped):
+			result = grpc.ResultTooManyRequests
+		case errors.Is(ack.Err, chanrpc.ErrPeerPanic):
+			result = grpc.ResultInternal
+		}
+		return grpc.ErrorReply(request, result, ack.Err)
+	}
+	switch resp := ack.Ack.(type) {
+	case *grpc.Message:
+		return resp
+	case []byte:
+		return (&ActorRequest{Message: request}).Reply(resp)
+	case nil:
+		return (&ActorRequest{Message: request}).Reply(nil)
+	default:
+		return grpc.ErrorReply(request, grpc.ResultInternal, fmt.Errorf("unexpected actor reply %T", resp))
+	}
+}
@@ -0,0 +1,107 @@
+// Package ws 提供WebSocket网关,浏览器客户端以二进制帧传输与tcp相同的grpc.Message编码
+package ws
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/qiafan666/gotato/commons/gerr"
+)
+
+var _ net.Conn = (*frameConn)(nil)
+
+// frameConn 将WebSocket连接适配为net.Conn
+// 每次Write发送一个二进制帧,Read将连续的二进制帧视为字节流,协议层的一条消息可以跨帧
+type frameConn struct {
+	ws      *websocket.Conn
+	reader  io.Reader  // 当前帧的reader
+	writeMu sync.Mutex // websocket只允许一个并发写
+}
+
+func newFrameConn(ws *websocket.Conn) *frameConn {
+	return &frameConn{ws: ws}
+}
+
+func (c *frameConn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			msgType, reader, err := c.ws.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			if msgType != websocket.BinaryMessage {
+				return 0, gerr.New("websocket text message not supported")
+			}
+			c.reader = reader
+		}
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *frameConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *frameConn) Close() error {
+	c.writeMu.Lock()
+	_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	return c.ws.Close()
+}
+
+func (c *frameConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+func (c *frameConn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+func (c *frameConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *frameConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *frameConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
+
+// Dialer 返回tcp.ClientOptions.Dialer,addr为ws://或wss://地址,用于机器人、压测等Go客户端通过网关接入
+// header: 握手请求头,如携带认证token,可为空
+func Dialer(header http.Header) func(addr string, timeout time.Duration) (net.Conn, error) {
+	return func(addr string, timeout time.Duration) (net.Conn, error) {
+		dialer := *websocket.DefaultDialer
+		dialer.HandshakeTimeout = timeout
+		ws, resp, err := dialer.Dial(addr, header)
+		if err != nil {
+			if resp != nil {
+				return nil, gerr.WrapMsg(err, "websocket dial fail", "addr", addr, "status", resp.StatusCode)
+			}
+			return nil, gerr.WrapMsg(err, "websocket dial fail", "addr", addr)
+		}
+		return newFrameConn(ws), nil
+	}
+}
@@ -0,0 +1,132 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/qiafan666/gotato/commons/gface"
+	"github.com/qiafan666/gotato/commons/grpc"
+	"github.com/qiafan666/gotato/commons/grpc/tcp"
+)
+
+// AuthTypeWebSocket 通过GatewayOptions.Authenticate认证的对端
+const AuthTypeWebSocket = "websocket"
+
+// Authenticate 握手请求认证函数,返回用户ID,返回error时拒绝升级
+type Authenticate func(r *http.Request) (userId string, err error)
+
+// GatewayOptions 网关配置选项
+type GatewayOptions struct {
+	ReadBufferSize  int                        // 读缓冲区大小,默认4KB
+	WriteBufferSize int                        // 写缓冲区大小,默认4KB
+	CheckOrigin     func(r *http.Request) bool // 跨域检查,为空时只允许与Host相同的Origin,允许所有来源需显式设置为AllowAllOrigins
+	Authenticate    Authenticate               // 为空时不认证,连接不会绑定用户
+	Logger          gface.ILogger              // 日志接口
+}
+
+// Gateway WebSocket网关,将升级后的连接交给tcp.Server处理
+// 消息处理、推送、分组、拦截器、心跳与tcp连接一致,认证后的用户通过tcp.Server.BindUser绑定会话
+// 同一用户重复登录时踢掉旧连接,封禁的用户无法接入
+type Gateway struct {
+	server   *tcp.Server
+	upgrader websocket.Upgrader
+	opt      *GatewayOptions
+
+	ctx context.Context
+
+	logger gface.ILogger
+}
+
+// NewGateway 创建网关
+// ctx: 取消后关闭所有连接
+// server: 处理消息的服务端,不需要监听TCP端口时使用空地址创建,需调用Run启动
+func NewGateway(ctx context.Context, server *tcp.Server, opt *GatewayOptions) *Gateway {
+	g := &Gateway{
+		server: server,
+		opt:    opt,
+		ctx:    ctx,
+		logger: opt.Logger,
+	}
+	g.upgrader = websocket.Upgrader{
+		ReadBufferSize:  opt.ReadBufferSize,
+		WriteBufferSize: opt.WriteBufferSize,
+		CheckOrigin:     opt.CheckOrigin,
+	}
+	return g
+}
+
+// AllowAllOrigins 允许所有来源的跨域检查
+// 认证依赖cookie时不要使用,否则任意网站都能以用户身份建立连接(跨站WebSocket劫持)
+func AllowAllOrigins(r *http.Request) bool {
+	return true
+}
+
+// Handler 返回gin处理函数,如 engine.GET("/ws", gateway.Handler())
+func (g *Gateway) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		g.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// ServeHTTP 实现http.Handler,阻塞直到连接关闭
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	peer := &grpc.Peer{Addr: r.RemoteAddr}
+	if g.opt.Authenticate != nil {
+		userId, err := g.opt.Authenticate(r)
+		if err != nil {
+			g.logger.InfoF(nil, "Gateway.ServeHTTP: authenticate fail, remote=%s, err=%+v", r.RemoteAddr, err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if g.server.Banned(userId) {
+			g.logger.InfoF(nil, "Gateway.ServeHTTP: user banned, remote=%s, userId=%s", r.RemoteAddr, userId)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		peer.Identity = userId
+		peer.AuthType = AuthTypeWebSocket
+	}
+
+	ws, err := g.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		g.logger.InfoF(nil, "Gateway.ServeHTTP: upgrade fail, remote=%s, err=%+v", r.RemoteAddr, err)
+		return
+	}
+
+	g.server.ServeConn(g.ctx, newFrameConn(ws), peer, func(connId string) {
+		if peer.Identity == "" {
+			return
+		}
+		if err := g.server.BindUser(connId, peer.Identity); err != nil {
+			g.logger.InfoF(nil, "Gateway.ServeHTTP: bind user fail, userId=%s, err=%+v", peer.Identity, err)
+			g.server.CloseConn(connId)
+		}
+	})
+}
+
+// ConnId 用户当前的连接ID
+func (g *Gateway) ConnId(userId string) (string, bool) {
+	return g.server.UserConnId(userId)
+}
+
+// Online 用户是否在线
+func (g *Gateway) Online(userId string) bool {
+	return g.server.Online(userId)
+}
+
+// OnlineCount 在线用户数,含通过tcp.Server其他方式绑定的用户
+func (g *Gateway) OnlineCount() int {
+	return g.server.OnlineCount()
+}
+
+// Push 推送消息给用户
+func (g *Gateway) Push(userId string, msg *grpc.Message) error {
+	return g.server.PushUser(userId, msg)
+}
+
+// Kick 推送grpc.CmdKick后关闭用户的连接
+func (g *Gateway) Kick(userId string, reason string) bool {
+	return g.server.Kick(userId, reason)
+}
@@ -0,0 +1,171 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gapp/chanrpc"
+	"github.com/qiafan666/gotato/commons/gapp/logger"
+	"github.com/qiafan666/gotato/commons/gapp/timer"
+	"github.com/qiafan666/gotato/commons/gface"
+	"github.com/qiafan666/gotato/commons/grpc"
+	"github.com/qiafan666/gotato/commons/grpc/tcp"
+)
+
+const (
+	cmdEcho  grpc.Command = 100
+	cmdPush  grpc.Command = 101
+	cmdActor grpc.Command = 102
+	cmdNoop  grpc.Command = 103
+)
+
+func init() {
+	logger.DefaultLogger = gface.NewLogger("gapp", nil)
+}
+
+type echoHandler struct{}
+
+func (echoHandler) Handle(request *grpc.Message) *grpc.Message {
+	return &grpc.Message{Command: request.Command, PkgType: grpc.PkgTypeReply, ReqId: request.ReqId, Seq: request.Seq, Body: request.Body}
+}
+
+func newTestGateway(t *testing.T, ctx context.Context) (*Gateway, *grpc.Router, string) {
+	logger := gface.NewLogger("gateway", nil)
+	router := grpc.NewRouter(logger)
+	server := tcp.NewServer("", router, &tcp.ServerOptions{Timeout: 3 * time.Second, Logger: logger})
+	server.Run(ctx)
+
+	gateway := NewGateway(ctx, server, &GatewayOptions{
+		Authenticate: func(r *http.Request) (string, error) {
+			if userId := r.Header.Get("X-User"); userId != "" {
+				return userId, nil
+			}
+			return "", errors.New("missing user")
+		},
+		Logger: logger,
+	})
+	ts := httptest.NewServer(gateway)
+	t.Cleanup(ts.Close)
+	return gateway, router, "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+func newTestClient(ctx context.Context, addr, userId string) *tcp.Client {
+	return tcp.NewClient(ctx, addr, &tcp.ClientOptions{
+		MaxConn:    1,
+		Timeout:    3 * time.Second,
+		RetryLimit: 1,
+		Logger:     gface.NewLogger("client", nil),
+		Dialer:     Dialer(http.Header{"X-User": []string{userId}}),
+	})
+}
+
+func call(t *testing.T, ctx context.Context, client *tcp.Client, cmd grpc.Command, body []byte) *grpc.Message {
+	resp, err := client.Do(ctx, &grpc.Message{Command: cmd, PkgType: grpc.PkgTypeRequest, ReqId: 1, Seq: grpc.NewSeq(), Body: body})
+	if err != nil {
+		t.Fatalf("command %d: %v", cmd, err)
+	}
+	return resp
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gateway, router, addr := newTestGateway(t, ctx)
+	router.Register(cmdEcho, echoHandler{})
+
+	if _, err := Dialer(nil)(addr, time.Second); err == nil {
+		t.Fatal("want dial without user rejected")
+	}
+
+	// 未设置CheckOrigin时拒绝跨域连接
+	if _, err := Dialer(http.Header{"X-User": []string{"alice"}, "Origin": []string{"http://evil.example"}})(addr, time.Second); err == nil {
+		t.Fatal("want cross origin dial rejected")
+	}
+
+	client := newTestClient(ctx, addr, "alice")
+	if resp := call(t, ctx, client, cmdEcho, []byte("hello")); string(resp.Body) != "hello" {
+		t.Fatalf("want echo body, got %q", resp.Body)
+	}
+	if !gateway.Online("alice") || gateway.OnlineCount() != 1 {
+		t.Fatalf("want alice online, count %d", gateway.OnlineCount())
+	}
+
+	pushes := make(chan *grpc.Message, 1)
+	client.Subscribe(cmdPush, func(msg *grpc.Message) { pushes <- msg })
+	if err := gateway.Push("alice", &grpc.Message{Command: cmdPush, PkgType: grpc.PkgTypePush, Body: []byte("news")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-pushes:
+		if string(msg.Body) != "news" {
+			t.Fatalf("want push body, got %q", msg.Body)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for push")
+	}
+	if err := gateway.Push("bob", &grpc.Message{Command: cmdPush, PkgType: grpc.PkgTypePush}); err == nil {
+		t.Fatal("want push to offline user fail")
+	}
+
+	// 重复登录踢掉旧连接
+	first, _ := gateway.ConnId("alice")
+	other := newTestClient(ctx, addr, "alice")
+	call(t, ctx, other, cmdEcho, nil)
+	waitFor(t, "old conn kicked", func() bool {
+		connId, _ := gateway.ConnId("alice")
+		return connId != first && gateway.OnlineCount() == 1
+	})
+
+	gateway.Kick("alice", "bye")
+	waitFor(t, "alice offline", func() bool { return !gateway.Online("alice") })
+}
+
+func TestActorHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, router, addr := newTestGateway(t, ctx)
+	// chanrpc同步调用的超时依赖gapp的定时器
+	timer.Run(nil, gface.NewLogger("timer", nil))
+	defer timer.Stop()
+
+	module := chanrpc.NewServer(16)
+	module.RegisterByName(ActorMsgName(cmdActor), func(ctx context.Context, reqCtx *chanrpc.ReqCtx) {
+		req := reqCtx.Req.(*ActorRequest)
+		reqCtx.Reply(append([]byte("actor:"), req.Message.Body...))
+	})
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case reqCtx := <-module.ChanReq():
+				module.Exec(reqCtx)
+			}
+		}
+	}()
+	router.Register(cmdActor, NewActorHandler(module, time.Second))
+	router.Register(cmdNoop, NewActorHandler(module, time.Second))
+
+	client := newTestClient(ctx, addr, "alice")
+	if resp := call(t, ctx, client, cmdActor, []byte("ping")); resp.Result != grpc.ResultOK || string(resp.Body) != "actor:ping" {
+		t.Fatalf("unexpected actor reply result=%d body=%q", resp.Result, resp.Body)
+	}
+	if resp := call(t, ctx, client, cmdNoop, nil); resp.Result != grpc.ResultNotFound {
+		t.Fatalf("want not found, got %d", resp.Result)
+	}
+}
@@ -0,0 +1,120 @@
+package gstate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// label 转换的标签，有守卫时为 event [guard]
+func (t *Transition) label() string {
+	if t.GuardName == "" {
+		return string(t.Event)
+	}
+	return fmt.Sprintf("%s [%s]", t.Event, t.GuardName)
+}
+
+// initialState 状态机的初始状态，即第一个添加的转换的起始状态
+func (sm *StateMachine) initialState() State {
+	if len(sm.ordered) == 0 {
+		return sm.state
+	}
+	return sm.ordered[0].FromState
+}
+
+func (sm *StateMachine) roots() []State {
+	var roots []State
+	for _, s := range sm.states {
+		if sm.nodes[s].parent == "" {
+			roots = append(roots, s)
+		}
+	}
+	return roots
+}
+
+// ToDot 导出Graphviz dot格式的状态图，复合状态为cluster，连到复合状态的边指向其初始叶子状态
+func (sm *StateMachine) ToDot(name string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %q {\n", name)
+	sb.WriteString("\tcompound=true;\n")
+	sb.WriteString("\tnode [shape=box, style=rounded];\n")
+	sb.WriteString("\t\"__start\" [shape=point];\n")
+	for _, s := range sm.roots() {
+		sm.writeDotState(&sb, s, "\t")
+	}
+	if initial := sm.initialState(); initial != "" {
+		attrs := sm.dotCluster(nil, "lhead", initial)
+		fmt.Fprintf(&sb, "\t\"__start\" -> %q [%s];\n", sm.leaf(initial), strings.Join(attrs, ", "))
+	}
+	for _, t := range sm.ordered {
+		attrs := []string{fmt.Sprintf("label=%q", t.label())}
+		attrs = sm.dotCluster(attrs, "ltail", t.FromState)
+		attrs = sm.dotCluster(attrs, "lhead", t.ToState)
+		fmt.Fprintf(&sb, "\t%q -> %q [%s];\n", sm.leaf(t.FromState), sm.leaf(t.ToState), strings.Join(attrs, ", "))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func (sm *StateMachine) writeDotState(sb *strings.Builder, s State, indent string) {
+	n := sm.nodes[s]
+	if len(n.children) == 0 {
+		fmt.Fprintf(sb, "%s%q;\n", indent, s)
+		return
+	}
+	fmt.Fprintf(sb, "%ssubgraph %q {\n", indent, "cluster_"+string(s))
+	label := string(s)
+	switch n.history {
+	case HistoryShallow:
+		label += " (H)"
+	case HistoryDeep:
+		label += " (H*)"
+	}
+	fmt.Fprintf(sb, "%s\tlabel=%q;\n", indent, label)
+	for _, c := range n.children {
+		sm.writeDotState(sb, c, indent+"\t")
+	}
+	fmt.Fprintf(sb, "%s}\n", indent)
+}
+
+// dotCluster 复合状态的边需要通过lhead/ltail裁剪到cluster边界
+func (sm *StateMachine) dotCluster(attrs []string, attr string, s State) []string {
+	if n := sm.nodes[s]; n == nil || len(n.children) == 0 {
+		return attrs
+	}
+	return append(attrs, fmt.Sprintf("%s=%q", attr, "cluster_"+string(s)))
+}
+
+// ToMermaid 导出Mermaid stateDiagram-v2格式的状态图
+func (sm *StateMachine) ToMermaid() string {
+	var sb strings.Builder
+	sb.WriteString("stateDiagram-v2\n")
+	if initial := sm.initialState(); initial != "" {
+		fmt.Fprintf(&sb, "\t[*] --> %s\n", initial)
+	}
+	for _, s := range sm.roots() {
+		sm.writeMermaidState(&sb, s, "\t")
+	}
+	for _, t := range sm.ordered {
+		fmt.Fprintf(&sb, "\t%s --> %s : %s\n", t.FromState, t.ToState, t.label())
+	}
+	return sb.String()
+}
+
+func (sm *StateMachine) writeMermaidState(sb *strings.Builder, s State, indent string) {
+	n := sm.nodes[s]
+	if len(n.children) == 0 {
+		return
+	}
+	fmt.Fprintf(sb, "%sstate %s {\n", indent, s)
+	fmt.Fprintf(sb, "%s\t[*] --> %s\n", indent, n.initial)
+	for _, c := range n.children {
+		sm.writeMermaidState(sb, c, indent+"\t")
+	}
+	fmt.Fprintf(sb, "%s}\n", indent)
+	switch n.history {
+	case HistoryShallow:
+		fmt.Fprintf(sb, "%snote right of %s : shallow history\n", indent, s)
+	case HistoryDeep:
+		fmt.Fprintf(sb, "%snote right of %s : deep history\n", indent, s)
+	}
+}
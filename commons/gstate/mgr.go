@@ -24,7 +24,7 @@ func NewStateMachineManager(logger gface.ILogger) *StateMachineManager {
 func (smm *StateMachineManager) AddMachine(name string, sm *StateMachine) {
 	smm.mu.Lock()
 	defer smm.mu.Unlock()
-	sm.logger = smm.logger
+	sm.SetLogger(smm.logger)
 	if _, exists := smm.machines[name]; exists {
 		smm.logger.ErrorF(nil, "state machine %s already exists", name)
 		return
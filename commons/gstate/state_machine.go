@@ -2,41 +2,127 @@ package gstate
 
 import (
 	"context"
+	"errors"
 	"github.com/qiafan666/gotato/commons/gface"
 )
 
+var (
+	ErrNoTransition  = errors.New("gstate no transition found")
+	ErrGuardRejected = errors.New("gstate transition rejected by guard")
+	ErrUnknownState  = errors.New("gstate unknown state")
+)
+
 // State 表示状态机中的状态
 type State string
 
 // Event 表示事件
 type Event string
 
+// HistoryKind 复合状态的历史类型，决定重新进入复合状态时恢复到哪个子状态
+type HistoryKind int
+
+const (
+	HistoryNone    HistoryKind = iota // 进入初始子状态
+	HistoryShallow                    // 恢复上次离开时的直接子状态
+	HistoryDeep                       // 恢复上次离开时的叶子状态
+)
+
+// Guard 转换条件，返回false时不执行该转换
+type Guard func(data []interface{}) bool
+
+// StateHook 进入或离开状态时的回调，from为转换前的叶子状态，to为转换后的叶子状态
+type StateHook func(event Event, from, to State, data []interface{})
+
+// TransitionListener 完成状态转换后的回调
+type TransitionListener func(event Event, from, to State, data []interface{})
+
 // Transition 定义一个结构体来记录状态转换信息
 type Transition struct {
 	FromState State
 	ToState   State
+	Event     Event
+	GuardName string // 守卫名称，用于导出图
+
+	guard   Guard
+	handler func(data []interface{})
+}
+
+// TransitionOption 转换配置项
+type TransitionOption func(t *Transition)
+
+// WithGuard 设置转换条件，同一状态同一事件的多个转换按添加顺序检查，执行第一个满足条件的转换
+func WithGuard(name string, guard Guard) TransitionOption {
+	return func(t *Transition) {
+		t.GuardName = name
+		t.guard = guard
+	}
 }
 
-// StateMachine 状态机结构体
+// stateNode 状态的层级关系与回调
+type stateNode struct {
+	parent   State
+	children []State
+	initial  State
+	history  HistoryKind
+	onEnter  []StateHook
+	onExit   []StateHook
+}
+
+// Snapshot 状态机的当前状态与历史，可序列化后持久化，通过Restore恢复
+type Snapshot struct {
+	State   State           `json:"state"`
+	History map[State]State `json:"history,omitempty"`
+}
+
+// StateMachine 状态机结构体，非goroutine safe，多个goroutine使用时由调用方或StateMachineManager加锁
+// 支持层级状态：当前状态总是叶子状态，事件先在叶子状态查找转换，找不到时向父状态冒泡
 type StateMachine struct {
 	state       State
-	transitions map[State]map[Event]*Transition
-	handlers    map[Event]func(data []interface{}) // 事件处理函数
-	logger      gface.ILogger                      // 日志记录器
-	ctx         context.Context                    // 上下文
+	transitions map[State]map[Event][]*Transition
+	ordered     []*Transition // 按添加顺序记录的转换，用于导出
+	nodes       map[State]*stateNode
+	states      []State         // 按出现顺序记录的状态，用于导出
+	history     map[State]State // 复合状态 -> 上次离开时的子状态或叶子状态
+	listeners   []TransitionListener
+	logger      gface.ILogger   // 日志记录器
+	ctx         context.Context // 上下文
 }
 
 // NewStateMachine 创建一个新的状态机
 func NewStateMachine(ctx context.Context) *StateMachine {
 	return &StateMachine{
-		transitions: make(map[State]map[Event]*Transition),
-		handlers:    make(map[Event]func(data []interface{})),
+		transitions: make(map[State]map[Event][]*Transition),
+		nodes:       make(map[State]*stateNode),
+		history:     make(map[State]State),
+		logger:      gface.NewLogger("state_machine", nil),
 		ctx:         ctx,
 	}
 }
 
-// AddTransition 添加状态转换
-func (sm *StateMachine) AddTransition(fromState State, toState State, event Event, handler func(data []interface{})) {
+// SetLogger 设置日志记录器，加入StateMachineManager时使用管理器的日志记录器
+func (sm *StateMachine) SetLogger(logger gface.ILogger) {
+	sm.logger = logger
+}
+
+func (sm *StateMachine) node(state State) *stateNode {
+	n, ok := sm.nodes[state]
+	if !ok {
+		n = &stateNode{}
+		sm.nodes[state] = n
+		sm.states = append(sm.states, state)
+	}
+	return n
+}
+
+func (sm *StateMachine) parentOf(state State) State {
+	if n, ok := sm.nodes[state]; ok {
+		return n.parent
+	}
+	return ""
+}
+
+// AddTransition 添加状态转换，handler在离开原状态之后、进入新状态之前执行
+func (sm *StateMachine) AddTransition(fromState State, toState State, event Event, handler func(data []interface{}), opts ...TransitionOption) {
 
 	if fromState == "" || toState == "" || event == "" {
 		sm.logger.ErrorF(sm.ctx, "fromState or toState or event is empty,fromState:%v,toState:%v,event:%v", fromState, toState, event)
@@ -47,43 +133,258 @@ func (sm *StateMachine) AddTransition(fromState State, toState State, event Even
 	if sm.state == "" {
 		sm.state = fromState
 	}
+	sm.node(fromState)
+	sm.node(toState)
 
 	if sm.transitions[fromState] == nil {
-		sm.transitions[fromState] = make(map[Event]*Transition)
+		sm.transitions[fromState] = make(map[Event][]*Transition)
 	}
-	sm.transitions[fromState][event] = &Transition{
+	t := &Transition{
 		FromState: fromState,
 		ToState:   toState,
+		Event:     event,
+		handler:   handler, // 事件处理函数
 	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	sm.transitions[fromState][event] = append(sm.transitions[fromState][event], t)
+	sm.ordered = append(sm.ordered, t)
+}
 
-	// 事件处理函数
-	sm.handlers[event] = handler
+// AddSubState 将child添加为parent的子状态，parent的第一个子状态为初始子状态
+// 转换的目标为复合状态时进入其初始子状态，或按SetHistory恢复上次的子状态
+func (sm *StateMachine) AddSubState(parent, child State) {
+	if parent == "" || child == "" || parent == child {
+		sm.logger.ErrorF(sm.ctx, "invalid sub state,parent:%v,child:%v", parent, child)
+		return
+	}
+	for s := parent; s != ""; s = sm.parentOf(s) {
+		if s == child {
+			sm.logger.ErrorF(sm.ctx, "sub state cycle,parent:%v,child:%v", parent, child)
+			return
+		}
+	}
+	p := sm.node(parent)
+	c := sm.node(child)
+	if c.parent != "" {
+		sm.logger.ErrorF(sm.ctx, "state %v already has parent %v", child, c.parent)
+		return
+	}
+	c.parent = parent
+	p.children = append(p.children, child)
+	if p.initial == "" {
+		p.initial = child
+	}
+}
+
+// SetInitialSubState 设置复合状态的初始子状态
+func (sm *StateMachine) SetInitialSubState(parent, child State) {
+	if sm.parentOf(child) != parent {
+		sm.logger.ErrorF(sm.ctx, "state %v is not sub state of %v", child, parent)
+		return
+	}
+	sm.node(parent).initial = child
+}
+
+// SetHistory 设置复合状态的历史类型
+func (sm *StateMachine) SetHistory(parent State, kind HistoryKind) {
+	sm.node(parent).history = kind
+}
+
+// OnEnter 添加进入状态时的回调，进入子状态时会先进入其父状态
+func (sm *StateMachine) OnEnter(state State, hook StateHook) {
+	n := sm.node(state)
+	n.onEnter = append(n.onEnter, hook)
+}
+
+// OnExit 添加离开状态时的回调，离开父状态时会先离开其子状态
+func (sm *StateMachine) OnExit(state State, hook StateHook) {
+	n := sm.node(state)
+	n.onExit = append(n.onExit, hook)
+}
+
+// AddListener 添加状态转换完成后的回调
+func (sm *StateMachine) AddListener(listener TransitionListener) {
+	sm.listeners = append(sm.listeners, listener)
+}
+
+// Fire 处理事件并转换状态，没有可用的转换时返回ErrNoTransition，转换都被守卫拒绝时返回ErrGuardRejected
+func (sm *StateMachine) Fire(event Event, data []interface{}) error {
+	sm.state = sm.leaf(sm.state)
+	rejected := false
+	// 查找当前状态下，是否有对应的事件转换，找不到时向父状态查找
+	for s := sm.state; s != ""; s = sm.parentOf(s) {
+		for _, t := range sm.transitions[s][event] {
+			if t.guard != nil && !t.guard(data) {
+				rejected = true
+				continue
+			}
+			sm.transit(t, event, data)
+			return nil
+		}
+	}
+	if rejected {
+		return ErrGuardRejected
+	}
+	return ErrNoTransition
 }
 
 // HandleEvent 处理事件并转换状态
 func (sm *StateMachine) handleEvent(name string, event Event, data []interface{}) {
+	from := sm.state
+	switch err := sm.Fire(event, data); {
+	case err == nil:
+		sm.logger.InfoF(sm.ctx, "name：%s，event：%v，state switch: %v -> %v", name, event, from, sm.state)
+	case errors.Is(err, ErrGuardRejected):
+		sm.logger.WarnF(sm.ctx, "name：%s，event：%v，current state: %v，transition rejected by guard", name, event, sm.state)
+	default:
+		sm.logger.ErrorF(sm.ctx, "name：%s，event:%v，current state: %v，no transition found", name, event, sm.state)
+	}
+}
+
+// transit 执行转换：从当前叶子状态向上离开到公共父状态，执行handler，再向下进入目标状态
+func (sm *StateMachine) transit(t *Transition, event Event, data []interface{}) {
+	from := sm.state
+	domain := sm.lca(t.FromState, t.ToState)
+	if domain == t.FromState || domain == t.ToState {
+		// 自转换或父子之间的转换，离开并重新进入
+		domain = sm.parentOf(domain)
+	}
 
-	// 查找当前状态下，是否有对应的事件转换
-	if memoryState, ok := sm.transitions[sm.state][event]; ok {
-		sm.logger.InfoF(sm.ctx, "name：%s，event：%v，current state: %v，event state switch: %v -> %v", name, event, sm.state, memoryState.FromState, memoryState.ToState)
-
-		if sm.state == memoryState.FromState {
-			// 状态转换
-			if handler, exists := sm.handlers[event]; exists && handler != nil {
-				handler(data) // 执行事件处理函数
-				sm.state = memoryState.ToState
-			} else {
-				sm.logger.WarnF(sm.ctx, "name：%s，event：%v，current state: %v，event state switch: %v -> %v，but no handler found", name, event, sm.state, memoryState.FromState, memoryState.ToState)
+	// 先记录离开的复合状态的历史，重新进入同一复合状态时使用
+	var exit []State
+	for s := from; s != domain; s = sm.parentOf(s) {
+		if len(exit) > 0 {
+			switch sm.nodes[s].history {
+			case HistoryShallow:
+				sm.history[s] = exit[len(exit)-1]
+			case HistoryDeep:
+				sm.history[s] = from
 			}
-		} else {
-			sm.logger.WarnF(sm.ctx, "name：%s，event：%v，current state: %v，event state switch: %v -> %v，but current state is not equal to event state switch from state", name, event, sm.state, memoryState.FromState, memoryState.ToState)
 		}
-	} else {
-		sm.logger.ErrorF(sm.ctx, "name：%s，event:%v，current state: %v，no transition found", name, event, sm.state)
+		exit = append(exit, s)
+	}
+	enter := sm.entryPath(domain, t.ToState)
+	to := enter[len(enter)-1]
+
+	for _, s := range exit {
+		for _, hook := range sm.nodes[s].onExit {
+			hook(event, from, to, data)
+		}
+	}
+	if t.handler != nil {
+		t.handler(data) // 执行事件处理函数
 	}
+	for _, s := range enter {
+		for _, hook := range sm.nodes[s].onEnter {
+			hook(event, from, to, data)
+		}
+	}
+	sm.state = to
+	for _, listener := range sm.listeners {
+		listener(event, from, to, data)
+	}
+}
+
+// lca 两个状态最近的公共祖先（包括自身），没有时返回空
+func (sm *StateMachine) lca(a, b State) State {
+	ancestors := make(map[State]struct{})
+	for s := a; s != ""; s = sm.parentOf(s) {
+		ancestors[s] = struct{}{}
+	}
+	for s := b; s != ""; s = sm.parentOf(s) {
+		if _, ok := ancestors[s]; ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// entryPath 从domain的下一层到target，再按历史或初始子状态到叶子状态的进入顺序
+func (sm *StateMachine) entryPath(domain, target State) []State {
+	var path []State
+	for s := target; s != domain && s != ""; s = sm.parentOf(s) {
+		path = append(path, s)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	for s := target; ; {
+		n := sm.nodes[s]
+		if n == nil || len(n.children) == 0 {
+			return path
+		}
+		next := n.initial
+		if h, ok := sm.history[s]; ok && sm.isDescendant(h, s) {
+			if n.history == HistoryDeep {
+				return append(path, sm.entryPath(s, h)...)
+			}
+			if n.history == HistoryShallow {
+				next = h
+			}
+		}
+		path = append(path, next)
+		s = next
+	}
+}
+
+// leaf 按初始子状态找到state下的叶子状态
+func (sm *StateMachine) leaf(state State) State {
+	for {
+		n := sm.nodes[state]
+		if n == nil || n.initial == "" {
+			return state
+		}
+		state = n.initial
+	}
+}
+
+func (sm *StateMachine) isDescendant(state, ancestor State) bool {
+	for s := sm.parentOf(state); s != ""; s = sm.parentOf(s) {
+		if s == ancestor {
+			return true
+		}
+	}
+	return false
 }
 
 // GetState 打印当前状态
 func (sm *StateMachine) GetState() State {
 	return sm.state
 }
+
+// IsIn 当前状态是否为state或state的子状态
+func (sm *StateMachine) IsIn(state State) bool {
+	return sm.state == state || sm.isDescendant(sm.state, state)
+}
+
+// Snapshot 返回当前状态与历史，用于持久化
+func (sm *StateMachine) Snapshot() *Snapshot {
+	s := &Snapshot{State: sm.state}
+	if len(sm.history) > 0 {
+		s.History = make(map[State]State, len(sm.history))
+		for k, v := range sm.history {
+			s.History[k] = v
+		}
+	}
+	return s
+}
+
+// Restore 从Snapshot恢复当前状态与历史，不执行进入回调，状态未定义时返回ErrUnknownState
+func (sm *StateMachine) Restore(s *Snapshot) error {
+	if _, ok := sm.nodes[s.State]; !ok {
+		return ErrUnknownState
+	}
+	for k, v := range s.History {
+		if !sm.isDescendant(v, k) {
+			return ErrUnknownState
+		}
+	}
+	sm.state = sm.leaf(s.State)
+	sm.history = make(map[State]State, len(s.History))
+	for k, v := range s.History {
+		sm.history[k] = v
+	}
+	return nil
+}
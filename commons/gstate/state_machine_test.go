@@ -0,0 +1,170 @@
+package gstate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newPlayerMachine 玩家状态机：Online下有Lobby与Battle，Battle下有Matching与Fighting
+func newPlayerMachine(trace *[]string) *StateMachine {
+	sm := NewStateMachine(context.Background())
+	sm.AddTransition("Offline", "Online", "Login", nil)
+	sm.AddTransition("Online", "Offline", "Logout", nil)
+	sm.AddTransition("Lobby", "Battle", "Join", nil, WithGuard("hasTicket", func(data []interface{}) bool {
+		return len(data) > 0 && data[0].(bool)
+	}))
+	sm.AddTransition("Matching", "Fighting", "Matched", nil)
+	sm.AddTransition("Battle", "Lobby", "Leave", func(data []interface{}) {
+		*trace = append(*trace, "handler:Leave")
+	})
+	sm.AddSubState("Online", "Lobby")
+	sm.AddSubState("Online", "Battle")
+	sm.AddSubState("Battle", "Matching")
+	sm.AddSubState("Battle", "Fighting")
+	for _, s := range []State{"Offline", "Online", "Lobby", "Battle", "Matching", "Fighting"} {
+		state := s
+		sm.OnEnter(state, func(event Event, from, to State, data []interface{}) {
+			*trace = append(*trace, "enter:"+string(state))
+		})
+		sm.OnExit(state, func(event Event, from, to State, data []interface{}) {
+			*trace = append(*trace, "exit:"+string(state))
+		})
+	}
+	return sm
+}
+
+func TestHierarchicalStateMachine(t *testing.T) {
+	var trace []string
+	sm := newPlayerMachine(&trace)
+
+	if err := sm.Fire("Login", nil); err != nil {
+		t.Fatal(err)
+	}
+	if sm.GetState() != "Lobby" || !sm.IsIn("Online") {
+		t.Fatalf("state = %s", sm.GetState())
+	}
+	if err := sm.Fire("Join", []interface{}{false}); !errors.Is(err, ErrGuardRejected) {
+		t.Fatalf("guard err = %v", err)
+	}
+	if err := sm.Fire("Matched", nil); !errors.Is(err, ErrNoTransition) {
+		t.Fatalf("no transition err = %v", err)
+	}
+	if err := sm.Fire("Join", []interface{}{true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Fire("Matched", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	sm.AddListener(func(event Event, from, to State, data []interface{}) {
+		events = append(events, string(from)+"-"+string(event)+"->"+string(to))
+	})
+	trace = nil
+	// Leave定义在父状态Battle上，从叶子状态Fighting冒泡
+	if err := sm.Fire("Leave", nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "exit:Fighting,exit:Battle,handler:Leave,enter:Lobby"
+	if got := strings.Join(trace, ","); got != want {
+		t.Fatalf("trace = %s, want %s", got, want)
+	}
+	if len(events) != 1 || events[0] != "Fighting-Leave->Lobby" {
+		t.Fatalf("events = %v", events)
+	}
+
+	trace = nil
+	// Logout定义在Online上，离开所有子状态
+	if err := sm.Fire("Logout", nil); err != nil {
+		t.Fatal(err)
+	}
+	want = "exit:Lobby,exit:Online,enter:Offline"
+	if got := strings.Join(trace, ","); got != want {
+		t.Fatalf("trace = %s, want %s", got, want)
+	}
+}
+
+func TestStateMachineHistory(t *testing.T) {
+	for _, tc := range []struct {
+		kind HistoryKind
+		want State
+	}{
+		{HistoryNone, "Lobby"},
+		{HistoryShallow, "Matching"},
+		{HistoryDeep, "Fighting"},
+	} {
+		var trace []string
+		sm := newPlayerMachine(&trace)
+		sm.SetHistory("Online", tc.kind)
+		_ = sm.Fire("Login", nil)
+		_ = sm.Fire("Join", []interface{}{true})
+		_ = sm.Fire("Matched", nil)
+		_ = sm.Fire("Logout", nil)
+
+		// 持久化后在新的状态机上恢复
+		b, err := json.Marshal(sm.Snapshot())
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored := newPlayerMachine(&trace)
+		restored.SetHistory("Online", tc.kind)
+		var snapshot Snapshot
+		if err = json.Unmarshal(b, &snapshot); err != nil {
+			t.Fatal(err)
+		}
+		if err = restored.Restore(&snapshot); err != nil {
+			t.Fatal(err)
+		}
+		if restored.GetState() != "Offline" {
+			t.Fatalf("restored state = %s", restored.GetState())
+		}
+		if err = restored.Fire("Login", nil); err != nil {
+			t.Fatal(err)
+		}
+		if restored.GetState() != tc.want {
+			t.Fatalf("history %d: state = %s, want %s", tc.kind, restored.GetState(), tc.want)
+		}
+	}
+
+	sm := NewStateMachine(context.Background())
+	sm.AddTransition("A", "B", "Go", nil)
+	if err := sm.Restore(&Snapshot{State: "C"}); !errors.Is(err, ErrUnknownState) {
+		t.Fatalf("restore unknown state err = %v", err)
+	}
+}
+
+func TestStateMachineExport(t *testing.T) {
+	var trace []string
+	sm := newPlayerMachine(&trace)
+	sm.SetHistory("Online", HistoryDeep)
+
+	dot := sm.ToDot("player")
+	for _, want := range []string{
+		`subgraph "cluster_Online"`,
+		`"__start" -> "Offline"`,
+		`"Offline" -> "Lobby" [label="Login", lhead="cluster_Online"]`,
+		`"Lobby" -> "Matching" [label="Join [hasTicket]", lhead="cluster_Battle"]`,
+		`label="Online (H*)"`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Fatalf("dot missing %s:\n%s", want, dot)
+		}
+	}
+
+	mermaid := sm.ToMermaid()
+	for _, want := range []string{
+		"stateDiagram-v2",
+		"[*] --> Offline",
+		"state Battle {",
+		"[*] --> Matching",
+		"Lobby --> Battle : Join [hasTicket]",
+		"note right of Online : deep history",
+	} {
+		if !strings.Contains(mermaid, want) {
+			t.Fatalf("mermaid missing %s:\n%s", want, mermaid)
+		}
+	}
+}
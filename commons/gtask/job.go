@@ -0,0 +1,84 @@
+package gtask
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JobState 任务所处的状态
+type JobState string
+
+const (
+	JobReady   JobState = "ready"   // 等待执行
+	JobDelayed JobState = "delayed" // 延迟执行或等待重试
+	JobActive  JobState = "active"  // 执行中
+	JobWaiting JobState = "waiting" // 同一顺序键的前序任务未完成
+	JobDead    JobState = "dead"    // 重试耗尽进入死信队列
+)
+
+// Job 持久化任务，以json保存在redis中
+type Job struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`              // 任务类型，对应Queue.Register注册的处理函数
+	Payload   json.RawMessage `json:"payload,omitempty"` // 任务参数，通过Bind解析
+	Key       string          `json:"key,omitempty"`     // 顺序键，同一个键的任务按入队顺序逐个执行，与Pool.AddTask的poolDecide含义一致
+	Unique    string          `json:"unique,omitempty"`  // 唯一键，同一个唯一键同时只能存在一个未完成的任务
+	MaxRetry  int             `json:"max_retry"`         // 最大重试次数
+	Attempts  int             `json:"attempts"`          // 已失败次数
+	LastError string          `json:"last_error,omitempty"`
+	CreatedAt int64           `json:"created_at"` // 入队时间，毫秒
+	RunAt     int64           `json:"run_at"`     // 计划执行时间，毫秒
+	FailedAt  int64           `json:"failed_at,omitempty"`
+
+	token int64 // 本次取出时的租约令牌
+}
+
+// Bind 将Payload解析到v
+func (j *Job) Bind(v any) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// JobOption 入队配置项
+type JobOption func(j *Job)
+
+// WithDelay 延迟d后执行
+func WithDelay(d time.Duration) JobOption {
+	return func(j *Job) {
+		j.RunAt = j.CreatedAt + d.Milliseconds()
+	}
+}
+
+// WithRunAt 在t时执行
+func WithRunAt(t time.Time) JobOption {
+	return func(j *Job) {
+		j.RunAt = t.UnixMilli()
+	}
+}
+
+// WithKey 设置顺序键，同一个键的任务按入队顺序逐个执行，前一个任务重试期间后续任务等待
+func WithKey(key string) JobOption {
+	return func(j *Job) {
+		j.Key = key
+	}
+}
+
+// WithUnique 设置唯一键，已存在未完成的同名任务时Enqueue返回ErrJobDuplicate
+func WithUnique(unique string) JobOption {
+	return func(j *Job) {
+		j.Unique = unique
+	}
+}
+
+// WithMaxRetry 设置最大重试次数，覆盖队列的默认值
+func WithMaxRetry(n int) JobOption {
+	return func(j *Job) {
+		j.MaxRetry = n
+	}
+}
+
+// WithJobID 指定任务ID，默认生成uuid
+func WithJobID(id string) JobOption {
+	return func(j *Job) {
+		j.ID = id
+	}
+}
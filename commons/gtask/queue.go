@@ -0,0 +1,649 @@
+package gtask
+
+/* Queue 基于redis的持久化任务队列
+ * 1. 任务按类型注册处理函数，参数以json序列化后保存在redis中，进程重启不丢失
+ * 2. 支持延迟执行、指数退避重试、唯一任务，重试耗尽后进入死信队列
+ * 3. 同一个顺序键的任务在整个集群中逐个按入队顺序执行，与Pool的poolDecide保证一致
+ * 4. 执行中的任务持有租约，进程崩溃后租约到期的任务重新入队，即至少执行一次
+ *
+ * redis中的数据，同一个队列的key使用相同的hash tag，可用于集群
+ *   jobs    hash  id -> 任务json
+ *   runat   hash  id -> 计划执行时间，顺序键的后续任务成为队首时使用
+ *   ready   list  等待执行的任务id
+ *   delayed zset  延迟或等待重试的任务id，score为计划执行时间
+ *   active  zset  执行中的任务id，score为租约到期时间
+ *   lease   hash  id -> 租约令牌，每次取出任务时递增，结束、重试与续约时校验，租约过期被其他协程取走后旧持有者的写回无效
+ *   dead    zset  死信任务id，score为进入死信队列的时间
+ *   unique  hash  唯一键 -> id
+ *   key:<k> list  顺序键下未完成的任务id，队首的任务才会进入ready或delayed
+ */
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/qiafan666/gotato/commons/gcommon"
+	"github.com/qiafan666/gotato/commons/gface"
+	"github.com/qiafan666/gotato/commons/stores/redis_cli"
+)
+
+const (
+	defaultQueuePrefix  = "gtask:"
+	defaultConcurrency  = 10
+	defaultPollInterval = time.Second
+	defaultLease        = time.Minute
+	leaseRenewDivisor   = 3 // 每lease/3续约一次
+	defaultMaxRetry     = 5
+	defaultBackoffBase  = time.Second
+	defaultBackoffMax   = time.Hour
+	moveBatch           = 100 // 每次取任务时最多移动的到期任务数
+)
+
+var (
+	ErrJobDuplicate = errors.New("gtask job duplicate")
+	ErrJobNotFound  = errors.New("gtask job not found")
+	ErrNoHandler    = errors.New("gtask job handler not registered")
+	ErrQueueStopped = errors.New("gtask queue stopped")
+)
+
+// enqueueScript 写入任务，任务ID或唯一键已存在时返回已存在的任务ID，顺序键下的非队首任务只加入顺序键列表
+// KEYS: jobs, runat, ready, delayed, unique, keyList, dead
+// ARGV: id, data, runAt, now, unique, hasKey, fromDead
+var enqueueScript = redis_cli.NewScript(`
+if ARGV[7] == '1' then
+	if not redis.call('ZSCORE', KEYS[7], ARGV[1]) then
+		return {-1, ''}
+	end
+elseif redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+	return {0, ARGV[1]}
+end
+if ARGV[5] ~= '' then
+	local old = redis.call('HGET', KEYS[5], ARGV[5])
+	if old then
+		return {0, old}
+	end
+	redis.call('HSET', KEYS[5], ARGV[5], ARGV[1])
+end
+redis.call('ZREM', KEYS[7], ARGV[1])
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+if ARGV[6] == '1' and redis.call('RPUSH', KEYS[6], ARGV[1]) > 1 then
+	return {1, ARGV[1]}
+end
+if tonumber(ARGV[3]) > tonumber(ARGV[4]) then
+	redis.call('ZADD', KEYS[4], ARGV[3], ARGV[1])
+else
+	redis.call('RPUSH', KEYS[3], ARGV[1])
+end
+return {1, ARGV[1]}
+`)
+
+// dequeueScript 将到期的延迟任务与租约到期的执行中任务移入ready，再取出一个任务并设置租约，返回新的租约令牌
+// KEYS: jobs, ready, delayed, active, lease
+// ARGV: now, leaseUntil, batch
+var dequeueScript = redis_cli.NewScript(`
+for _, k in ipairs({KEYS[3], KEYS[4]}) do
+	local due = redis.call('ZRANGEBYSCORE', k, '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[3]))
+	for _, id in ipairs(due) do
+		redis.call('ZREM', k, id)
+		redis.call('RPUSH', KEYS[2], id)
+	end
+end
+local id = redis.call('LPOP', KEYS[2])
+if not id then
+	return false
+end
+redis.call('ZADD', KEYS[4], ARGV[2], id)
+local token = redis.call('HINCRBY', KEYS[5], id, 1)
+return {id, redis.call('HGET', KEYS[1], id) or '', token}
+`)
+
+// finishScript 结束执行中的任务，data为空时删除任务，否则更新任务并加入死信队列
+// 释放唯一键，将顺序键的下一个任务放入ready或delayed
+// 租约令牌不一致时说明租约已过期并被其他协程取走，不做任何修改
+// KEYS: jobs, runat, ready, delayed, active, unique, keyList, dead, lease
+// ARGV: id, unique, hasKey, now, data, token
+var finishScript = redis_cli.NewScript(`
+if redis.call('HGET', KEYS[9], ARGV[1]) ~= ARGV[6] or redis.call('ZREM', KEYS[5], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[9], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+if ARGV[5] == '' then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+else
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[5])
+	redis.call('ZADD', KEYS[8], ARGV[4], ARGV[1])
+end
+if ARGV[2] ~= '' and redis.call('HGET', KEYS[6], ARGV[2]) == ARGV[1] then
+	redis.call('HDEL', KEYS[6], ARGV[2])
+end
+if ARGV[3] == '1' then
+	redis.call('LREM', KEYS[7], 1, ARGV[1])
+	local next = redis.call('LINDEX', KEYS[7], 0)
+	if next then
+		local at = tonumber(redis.call('HGET', KEYS[2], next) or '0')
+		if at > tonumber(ARGV[4]) then
+			redis.call('ZADD', KEYS[4], at, next)
+		else
+			redis.call('RPUSH', KEYS[3], next)
+		end
+	end
+end
+return 1
+`)
+
+// retryScript 将执行失败的任务放回delayed等待重试，顺序键的队首不变，租约令牌不一致时不做任何修改
+// KEYS: jobs, runat, delayed, active, lease
+// ARGV: id, data, runAt, token
+var retryScript = redis_cli.NewScript(`
+if redis.call('HGET', KEYS[5], ARGV[1]) ~= ARGV[4] or redis.call('ZREM', KEYS[4], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[3], ARGV[3], ARGV[1])
+return 1
+`)
+
+// extendScript 续约执行中的任务，租约令牌不一致或任务已不在执行中时返回0
+// KEYS: active, lease
+// ARGV: id, token, leaseUntil
+var extendScript = redis_cli.NewScript(`
+if redis.call('HGET', KEYS[2], ARGV[1]) ~= ARGV[2] or not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+// HandlerFunc 任务处理函数，返回错误时按退避时间重试，ctx在租约丢失或队列停止时取消
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+// QueueStats 队列中各状态的任务数
+type QueueStats struct {
+	Ready   int
+	Delayed int
+	Active  int
+	Dead    int
+}
+
+type queueOptions struct {
+	prefix       string
+	concurrency  int
+	pollInterval time.Duration
+	lease        time.Duration
+	maxRetry     int
+	backoffBase  time.Duration
+	backoffMax   time.Duration
+	logger       gface.ILogger
+}
+
+// QueueOption 队列配置项
+type QueueOption func(o *queueOptions)
+
+// WithQueuePrefix 设置redis key前缀，默认gtask:
+func WithQueuePrefix(prefix string) QueueOption {
+	return func(o *queueOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithConcurrency 设置当前进程中执行任务的协程数
+func WithConcurrency(n int) QueueOption {
+	return func(o *queueOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithPollInterval 设置队列为空时拉取任务的间隔
+func WithPollInterval(d time.Duration) QueueOption {
+	return func(o *queueOptions) {
+		o.pollInterval = d
+	}
+}
+
+// WithLease 设置任务执行的租约时间，执行期间每lease/3自动续约，进程崩溃或续约失败超过租约时间后任务被其他协程重新执行
+func WithLease(d time.Duration) QueueOption {
+	return func(o *queueOptions) {
+		o.lease = d
+	}
+}
+
+// WithDefaultMaxRetry 设置任务的默认最大重试次数
+func WithDefaultMaxRetry(n int) QueueOption {
+	return func(o *queueOptions) {
+		o.maxRetry = n
+	}
+}
+
+// WithBackoff 设置重试的退避时间，第n次重试等待base*2^(n-1)，最多等待max
+func WithBackoff(base, max time.Duration) QueueOption {
+	return func(o *queueOptions) {
+		o.backoffBase = base
+		o.backoffMax = max
+	}
+}
+
+// WithQueueLogger 设置日志
+func WithQueueLogger(logger gface.ILogger) QueueOption {
+	return func(o *queueOptions) {
+		o.logger = logger
+	}
+}
+
+// Queue 持久化任务队列 goroutine safe
+// 多个进程可以使用同名队列共同消费，Enqueue不需要Start
+type Queue struct {
+	rds  *redis_cli.Redis
+	name string
+	opts *queueOptions
+	base string
+
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+	started  bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wait     sync.WaitGroup
+}
+
+// NewQueue 创建名为name的任务队列
+func NewQueue(rds *redis_cli.Redis, name string, opts ...QueueOption) *Queue {
+	o := &queueOptions{
+		prefix:       defaultQueuePrefix,
+		concurrency:  defaultConcurrency,
+		pollInterval: defaultPollInterval,
+		lease:        defaultLease,
+		maxRetry:     defaultMaxRetry,
+		backoffBase:  defaultBackoffBase,
+		backoffMax:   defaultBackoffMax,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.logger == nil {
+		o.logger = gface.NewLogger("gtask", nil)
+	}
+	q := &Queue{
+		rds:      rds,
+		name:     name,
+		opts:     o,
+		base:     o.prefix + "{" + name + "}:",
+		handlers: make(map[string]HandlerFunc),
+	}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	return q
+}
+
+// Name 队列名
+func (q *Queue) Name() string {
+	return q.name
+}
+
+func (q *Queue) key(name string) string {
+	return q.base + name
+}
+
+// keyList 顺序键列表的key，没有顺序键时脚本不会使用
+func (q *Queue) keyList(job *Job) string {
+	return q.key("key:" + job.Key)
+}
+
+// Register 注册任务类型的处理函数，需在Start前调用
+func (q *Queue) Register(typ string, handler HandlerFunc) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[typ] = handler
+}
+
+// Enqueue 将任务加入队列，payload以json序列化，返回任务ID
+// 任务ID已存在或设置了唯一键且已存在未完成的同名任务时返回已存在的任务ID与ErrJobDuplicate
+func (q *Queue) Enqueue(ctx context.Context, typ string, payload any, opts ...JobOption) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UnixMilli()
+	job := &Job{
+		Type:      typ,
+		Payload:   data,
+		MaxRetry:  q.opts.maxRetry,
+		CreatedAt: now,
+		RunAt:     now,
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+	if job.ID == "" {
+		job.ID = gcommon.GenerateUUID()
+	}
+	return q.enqueue(ctx, job, now, false)
+}
+
+func (q *Queue) enqueue(ctx context.Context, job *Job, now int64, fromDead bool) (string, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	keys := []string{q.key("jobs"), q.key("runat"), q.key("ready"), q.key("delayed"), q.key("unique"), q.keyList(job), q.key("dead")}
+	res, err := q.rds.ScriptRunCtx(ctx, enqueueScript, keys,
+		job.ID, string(data), job.RunAt, now, job.Unique, boolArg(job.Key != ""), boolArg(fromDead))
+	if err != nil {
+		return "", err
+	}
+	reply := res.([]any)
+	id, _ := reply[1].(string)
+	switch reply[0].(int64) {
+	case 0:
+		return id, ErrJobDuplicate
+	case -1:
+		return "", ErrJobNotFound
+	}
+	return id, nil
+}
+
+// Start 启动WithConcurrency个协程拉取并执行任务
+func (q *Queue) Start() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ctx.Err() != nil {
+		return ErrQueueStopped
+	}
+	if q.started {
+		return nil
+	}
+	q.started = true
+	q.wait.Add(q.opts.concurrency)
+	for i := 0; i < q.opts.concurrency; i++ {
+		go q.worker()
+	}
+	return nil
+}
+
+// Stop 停止拉取任务，取消执行中任务的ctx并等待处理函数返回
+// 处理函数因ctx取消返回错误时任务按失败重试，未返回的任务在租约到期后重新执行
+func (q *Queue) Stop() {
+	q.cancel()
+	q.wait.Wait()
+}
+
+func (q *Queue) worker() {
+	defer q.wait.Done()
+	ticker := time.NewTicker(q.opts.pollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := q.dequeue(q.ctx)
+		if err != nil && q.ctx.Err() == nil {
+			q.opts.logger.ErrorF(nil, "queue %s dequeue error: %v", q.name, err)
+		}
+		if job != nil {
+			q.execute(job)
+			continue
+		}
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *Queue) dequeue(ctx context.Context) (*Job, error) {
+	now := time.Now()
+	keys := []string{q.key("jobs"), q.key("ready"), q.key("delayed"), q.key("active"), q.key("lease")}
+	res, err := q.rds.ScriptRunCtx(ctx, dequeueScript, keys,
+		now.UnixMilli(), now.Add(q.opts.lease).UnixMilli(), moveBatch)
+	if errors.Is(err, redis_cli.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	reply := res.([]any)
+	id, _ := reply[0].(string)
+	data, _ := reply[1].(string)
+	token, _ := reply[2].(int64)
+	job := &Job{}
+	if err = json.Unmarshal([]byte(data), job); err != nil {
+		// 任务数据丢失或损坏，从队列中移除
+		q.opts.logger.ErrorF(nil, "queue %s job %s decode error: %v", q.name, id, err)
+		job = &Job{ID: id, token: token}
+		return nil, q.finish(ctx, job, nil)
+	}
+	job.token = token
+	return job, nil
+}
+
+func (q *Queue) execute(job *Job) {
+	q.mu.RLock()
+	handler, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+
+	var err error
+	if ok {
+		err = q.call(handler, job)
+	} else {
+		err = ErrNoHandler
+	}
+	// 队列停止后仍需写回结果
+	ctx := context.Background()
+	if err == nil {
+		err = q.finish(ctx, job, nil)
+	} else {
+		err = q.fail(ctx, job, err)
+	}
+	if err != nil {
+		q.opts.logger.ErrorF(nil, "queue %s job %s update error: %v", q.name, job.ID, err)
+	}
+}
+
+func (q *Queue) call(handler HandlerFunc, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			buf := make([]byte, 4096)
+			l := runtime.Stack(buf, false)
+			q.opts.logger.ErrorF(nil, "%v: %s", r, buf[:l])
+			err = fmt.Errorf("gtask job panic: %v", r)
+		}
+	}()
+	ctx, cancel := context.WithCancel(q.ctx)
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go q.heartbeat(job, cancel, done)
+	return handler(ctx, job)
+}
+
+// heartbeat 处理函数执行期间定期续约，租约已被其他协程取走时取消处理函数的ctx
+func (q *Queue) heartbeat(job *Job, cancel context.CancelFunc, done <-chan struct{}) {
+	ticker := time.NewTicker(q.opts.lease / leaseRenewDivisor)
+	defer ticker.Stop()
+	keys := []string{q.key("active"), q.key("lease")}
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		until := time.Now().Add(q.opts.lease).UnixMilli()
+		res, err := q.rds.ScriptRunCtx(context.Background(), extendScript, keys, job.ID, job.token, until)
+		if err != nil {
+			// 续约失败时继续尝试，租约到期前恢复即可
+			q.opts.logger.WarnF(nil, "queue %s job %s extend lease error: %v", q.name, job.ID, err)
+			continue
+		}
+		if res.(int64) == 0 {
+			q.opts.logger.WarnF(nil, "queue %s job %s lease lost", q.name, job.ID)
+			cancel()
+			return
+		}
+	}
+}
+
+// fail 记录失败，未超过最大重试次数时按退避时间重试，否则进入死信队列
+// 未注册处理函数同样按失败重试，滚动发布时可由已注册该类型的节点处理
+func (q *Queue) fail(ctx context.Context, job *Job, cause error) error {
+	now := time.Now().UnixMilli()
+	job.Attempts++
+	job.LastError = cause.Error()
+	job.FailedAt = now
+	if job.Attempts > job.MaxRetry {
+		return q.finish(ctx, job, job)
+	}
+	job.RunAt = now + q.backoff(job.Attempts).Milliseconds()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	keys := []string{q.key("jobs"), q.key("runat"), q.key("delayed"), q.key("active"), q.key("lease")}
+	res, err := q.rds.ScriptRunCtx(ctx, retryScript, keys, job.ID, string(data), job.RunAt, job.token)
+	if err == nil && res.(int64) == 0 {
+		q.opts.logger.WarnF(nil, "queue %s job %s lease lost, retry ignored", q.name, job.ID)
+	}
+	return err
+}
+
+// finish 结束任务，dead不为空时写入死信队列
+func (q *Queue) finish(ctx context.Context, job *Job, dead *Job) error {
+	var data []byte
+	if dead != nil {
+		var err error
+		if data, err = json.Marshal(dead); err != nil {
+			return err
+		}
+	}
+	keys := []string{q.key("jobs"), q.key("runat"), q.key("ready"), q.key("delayed"), q.key("active"),
+		q.key("unique"), q.keyList(job), q.key("dead"), q.key("lease")}
+	res, err := q.rds.ScriptRunCtx(ctx, finishScript, keys,
+		job.ID, job.Unique, boolArg(job.Key != ""), time.Now().UnixMilli(), string(data), job.token)
+	if err == nil && res.(int64) == 0 {
+		q.opts.logger.WarnF(nil, "queue %s job %s lease lost, result ignored", q.name, job.ID)
+	}
+	return err
+}
+
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := float64(q.opts.backoffBase) * math.Pow(2, float64(attempts-1))
+	if d > float64(q.opts.backoffMax) {
+		return q.opts.backoffMax
+	}
+	return time.Duration(d)
+}
+
+// Stats 返回队列中各状态的任务数，顺序键下等待前序任务的任务不计入
+func (q *Queue) Stats(ctx context.Context) (*QueueStats, error) {
+	stats := &QueueStats{}
+	var err error
+	if stats.Ready, err = q.rds.LlenCtx(ctx, q.key("ready")); err != nil {
+		return nil, err
+	}
+	if stats.Delayed, err = q.rds.ZcardCtx(ctx, q.key("delayed")); err != nil {
+		return nil, err
+	}
+	if stats.Active, err = q.rds.ZcardCtx(ctx, q.key("active")); err != nil {
+		return nil, err
+	}
+	if stats.Dead, err = q.rds.ZcardCtx(ctx, q.key("dead")); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Get 返回未完成或死信任务的信息与状态，任务不存在时返回ErrJobNotFound
+func (q *Queue) Get(ctx context.Context, id string) (*Job, JobState, error) {
+	data, err := q.rds.HgetCtx(ctx, q.key("jobs"), id)
+	if errors.Is(err, redis_cli.Nil) {
+		return nil, "", ErrJobNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	job := &Job{}
+	if err = json.Unmarshal([]byte(data), job); err != nil {
+		return nil, "", err
+	}
+	for _, s := range []JobState{JobDead, JobActive, JobDelayed} {
+		if _, err = q.rds.ZscoreCtx(ctx, q.key(string(s)), id); err == nil {
+			return job, s, nil
+		} else if !errors.Is(err, redis_cli.Nil) {
+			return nil, "", err
+		}
+	}
+	if job.Key != "" {
+		head, err := q.rds.LindexCtx(ctx, q.keyList(job), 0)
+		if err != nil && !errors.Is(err, redis_cli.Nil) {
+			return nil, "", err
+		}
+		if head != id {
+			return job, JobWaiting, nil
+		}
+	}
+	return job, JobReady, nil
+}
+
+// Dead 按进入死信队列的时间倒序返回死信任务
+func (q *Queue) Dead(ctx context.Context, offset, limit int) ([]*Job, error) {
+	ids, err := q.rds.ZrevrangeCtx(ctx, q.key("dead"), int64(offset), int64(offset+limit-1))
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	vals, err := q.rds.HmgetCtx(ctx, q.key("jobs"), ids...)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(vals))
+	for _, v := range vals {
+		if v == "" {
+			continue
+		}
+		job := &Job{}
+		if err = json.Unmarshal([]byte(v), job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// RetryDead 将死信任务重新入队立即执行，失败次数清零
+func (q *Queue) RetryDead(ctx context.Context, id string) error {
+	job, state, err := q.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if state != JobDead {
+		return ErrJobNotFound
+	}
+	now := time.Now().UnixMilli()
+	job.Attempts = 0
+	job.RunAt = now
+	_, err = q.enqueue(ctx, job, now, true)
+	return err
+}
+
+// RemoveDead 删除死信任务
+func (q *Queue) RemoveDead(ctx context.Context, id string) error {
+	n, err := q.rds.ZremCtx(ctx, q.key("dead"), id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	_, err = q.rds.HdelCtx(ctx, q.key("jobs"), id)
+	return err
+}
+
+func boolArg(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,325 @@
+package gtask
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/qiafan666/gotato/commons/stores/redis_cli"
+)
+
+func newTestQueue(t *testing.T, opts ...QueueOption) (*Queue, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+	rds := redis_cli.MustNewRedis(redis_cli.RedisConf{Host: s.Addr(), Type: redis_cli.NodeType})
+	opts = append([]QueueOption{
+		WithPollInterval(5 * time.Millisecond),
+		WithBackoff(5*time.Millisecond, 20*time.Millisecond),
+	}, opts...)
+	return NewQueue(rds, "test", opts...), s
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+type mailPayload struct {
+	To  string `json:"to"`
+	Seq int    `json:"seq"`
+}
+
+func TestQueueOrderAndRetry(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t, WithConcurrency(4))
+
+	var mu sync.Mutex
+	var got []int
+	failed := false
+	q.Register("mail", func(ctx context.Context, job *Job) error {
+		var p mailPayload
+		if err := job.Bind(&p); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		// 第一个任务首次失败，后续同一顺序键的任务需要等待它重试成功
+		if p.Seq == 0 && !failed {
+			failed = true
+			return errors.New("smtp unavailable")
+		}
+		got = append(got, p.Seq)
+		return nil
+	})
+	for i := 0; i < 10; i++ {
+		if _, err := q.Enqueue(ctx, "mail", &mailPayload{To: "a", Seq: i}, WithKey("user-1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 10
+	})
+	for i, seq := range got {
+		if seq != i {
+			t.Fatalf("order broken: %v", got)
+		}
+	}
+	stats, err := q.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stats != (QueueStats{}) {
+		t.Fatalf("stats = %+v, want empty", stats)
+	}
+}
+
+func TestQueueDelayUniqueDead(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t, WithDefaultMaxRetry(1))
+
+	var mu sync.Mutex
+	var runs []string
+	q.Register("report", func(ctx context.Context, job *Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		runs = append(runs, job.ID)
+		if job.ID == "bad" {
+			return errors.New("broken")
+		}
+		return nil
+	})
+
+	id, err := q.Enqueue(ctx, "report", nil, WithUnique("daily"), WithDelay(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dup, err := q.Enqueue(ctx, "report", nil, WithUnique("daily")); !errors.Is(err, ErrJobDuplicate) || dup != id {
+		t.Fatalf("duplicate enqueue: id %s, err %v", dup, err)
+	}
+	if _, state, err := q.Get(ctx, id); err != nil || state != JobDelayed {
+		t.Fatalf("state %s, err %v", state, err)
+	}
+	if _, err = q.Enqueue(ctx, "report", nil, WithJobID("bad")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = q.Enqueue(ctx, "unknown", nil, WithJobID("orphan")); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if err = q.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+
+	waitFor(t, func() bool {
+		stats, err := q.Stats(ctx)
+		return err == nil && stats.Dead == 2 && stats.Delayed == 0 && stats.Ready == 0 && stats.Active == 0
+	})
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("delayed job ran too early")
+	}
+	mu.Lock()
+	// bad执行1次加重试1次，report执行1次
+	if len(runs) != 3 {
+		t.Fatalf("runs = %v", runs)
+	}
+	mu.Unlock()
+
+	dead, err := q.Dead(ctx, 0, 10)
+	if err != nil || len(dead) != 2 {
+		t.Fatalf("dead = %v, err %v", dead, err)
+	}
+	for _, job := range dead {
+		switch job.ID {
+		case "bad":
+			if job.Attempts != 2 || job.LastError != "broken" {
+				t.Fatalf("bad job = %+v", job)
+			}
+		case "orphan":
+			// 未注册处理函数同样重试后才进入死信队列
+			if job.Attempts != 2 || job.LastError != ErrNoHandler.Error() {
+				t.Fatalf("orphan job = %+v", job)
+			}
+		}
+	}
+
+	// 唯一键在任务完成后释放
+	if _, err = q.Enqueue(ctx, "report", nil, WithUnique("daily")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = q.RemoveDead(ctx, "orphan"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = q.Get(ctx, "orphan"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("removed job err %v", err)
+	}
+	if err = q.RetryDead(ctx, "bad"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(runs) >= 6
+	})
+}
+
+// TestQueueNoHandlerRetry 未注册处理函数的任务按退避重试，注册后可继续执行
+func TestQueueNoHandlerRetry(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t, WithDefaultMaxRetry(100))
+	if _, err := q.Enqueue(ctx, "late", nil, WithJobID("late")); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+
+	waitFor(t, func() bool {
+		job, _, err := q.Get(ctx, "late")
+		return err == nil && job.Attempts > 0
+	})
+	done := make(chan struct{})
+	q.Register("late", func(ctx context.Context, job *Job) error {
+		close(done)
+		return nil
+	})
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("job not retried after handler registered")
+	}
+	waitFor(t, func() bool {
+		stats, err := q.Stats(ctx)
+		return err == nil && *stats == (QueueStats{})
+	})
+}
+
+func TestQueueLeaseRecovery(t *testing.T) {
+	ctx := context.Background()
+	q, s := newTestQueue(t, WithLease(50*time.Millisecond))
+	id, err := q.Enqueue(ctx, "sync", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟取出任务后进程崩溃
+	job, err := q.dequeue(ctx)
+	if err != nil || job == nil || job.ID != id {
+		t.Fatalf("dequeue %v, err %v", job, err)
+	}
+
+	other := NewQueue(redis_cli.MustNewRedis(redis_cli.RedisConf{Host: s.Addr(), Type: redis_cli.NodeType}), "test",
+		WithPollInterval(5*time.Millisecond))
+	done := make(chan string, 1)
+	other.Register("sync", func(ctx context.Context, job *Job) error {
+		done <- job.ID
+		return nil
+	})
+	if err = other.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop()
+	select {
+	case got := <-done:
+		if got != id {
+			t.Fatalf("got %s, want %s", got, id)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("job not recovered after lease expired")
+	}
+}
+
+func TestQueueLeaseFencing(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t, WithLease(30*time.Millisecond))
+	first, err := q.Enqueue(ctx, "sync", nil, WithKey("user-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = q.Enqueue(ctx, "sync", nil, WithKey("user-1")); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := q.dequeue(ctx)
+	if err != nil || stale == nil || stale.ID != first {
+		t.Fatalf("dequeue %v, err %v", stale, err)
+	}
+	// 租约过期后被其他协程重新取走
+	time.Sleep(40 * time.Millisecond)
+	current, err := q.dequeue(ctx)
+	if err != nil || current == nil || current.ID != first {
+		t.Fatalf("dequeue %v, err %v", current, err)
+	}
+
+	// 旧持有者的写回无效，不能释放新租约或推进顺序键
+	if err = q.finish(ctx, stale, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = q.fail(ctx, stale, errors.New("late failure")); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := q.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stats != (QueueStats{Active: 1}) {
+		t.Fatalf("stats after stale writes = %+v", stats)
+	}
+
+	if err = q.finish(ctx, current, nil); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err = q.Stats(ctx); err != nil || *stats != (QueueStats{Ready: 1}) {
+		t.Fatalf("stats after finish = %+v, err %v", stats, err)
+	}
+}
+
+func TestQueueLeaseHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t, WithLease(30*time.Millisecond), WithConcurrency(2))
+	var mu sync.Mutex
+	runs := 0
+	q.Register("slow", func(ctx context.Context, job *Job) error {
+		mu.Lock()
+		runs++
+		mu.Unlock()
+		// 执行时间超过租约，续约后不会被其他协程重复执行
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(150 * time.Millisecond):
+			return nil
+		}
+	})
+	if _, err := q.Enqueue(ctx, "slow", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+	waitFor(t, func() bool {
+		stats, err := q.Stats(ctx)
+		return err == nil && *stats == (QueueStats{})
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if runs != 1 {
+		t.Fatalf("runs = %d, want 1", runs)
+	}
+}
@@ -0,0 +1,59 @@
+package redis_cli
+
+import (
+	"context"
+	"fmt"
+
+	red "github.com/go-redis/redis/v8"
+)
+
+// PubSub is an alias of redis_cli.PubSub.
+type PubSub = red.PubSub
+
+// Publish is the implementation of redis publish command.
+func (s *Redis) Publish(channel, message string) (int64, error) {
+	return s.PublishCtx(context.Background(), channel, message)
+}
+
+// PublishCtx is the implementation of redis publish command.
+func (s *Redis) PublishCtx(ctx context.Context, channel, message string) (val int64, err error) {
+	err = s.brk.DoWithAcceptable(func() error {
+		conn, err := getRedis(s)
+		if err != nil {
+			return err
+		}
+
+		val, err = conn.Publish(ctx, channel, message).Result()
+		return err
+	}, acceptable)
+
+	return
+}
+
+// Subscribe subscribes the given channels, the caller should close the returned PubSub.
+func (s *Redis) Subscribe(ctx context.Context, channels ...string) (*PubSub, error) {
+	var pubsub *PubSub
+	switch s.Type {
+	case ClusterType:
+		conn, err := getCluster(s)
+		if err != nil {
+			return nil, err
+		}
+		pubsub = conn.Subscribe(ctx, channels...)
+	case NodeType:
+		conn, err := getClient(s)
+		if err != nil {
+			return nil, err
+		}
+		pubsub = conn.Subscribe(ctx, channels...)
+	default:
+		return nil, fmt.Errorf("redis type '%s' is not supported", s.Type)
+	}
+
+	// 等待订阅确认,确保返回后发布的消息不会丢失
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, err
+	}
+	return pubsub, nil
+}
@@ -0,0 +1,34 @@
+package redis_cli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedis_PubSub(t *testing.T) {
+	runOnRedis(t, func(client *Redis) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		pubsub, err := client.Subscribe(ctx, "news")
+		assert.Nil(t, err)
+		defer pubsub.Close()
+
+		n, err := client.PublishCtx(ctx, "news", "hello")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n)
+
+		msg, err := pubsub.ReceiveMessage(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, "news", msg.Channel)
+		assert.Equal(t, "hello", msg.Payload)
+	})
+
+	runOnRedisWithError(t, func(client *Redis) {
+		_, err := client.Publish("news", "hello")
+		assert.NotNil(t, err)
+	})
+}
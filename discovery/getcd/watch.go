@@ -0,0 +1,89 @@
+package getcd
+
+import (
+	"context"
+	"fmt"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"sort"
+	"time"
+)
+
+const (
+	watchRetryMin = 100 * time.Millisecond
+	watchRetryMax = 10 * time.Second
+)
+
+// WatchAddrs 监听服务地址列表,每次变化推送完整列表,ctx取消后关闭通道
+// 实现 grpc/tcp.IResolver,地址取自注册键 rootDirectory/serviceName/host:port 的最后一段
+// watch因版本被压缩、失去leader等原因关闭时,重新读取列表并从新版本继续监听,直到ctx取消
+func (r *SvcDiscoveryRegistryImpl) WatchAddrs(ctx context.Context, serviceName string) (<-chan []string, error) {
+	prefix := fmt.Sprintf("%s/%s/", r.rootDirectory, serviceName)
+	addrs, rev, err := r.getAddrs(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []string, 1)
+	ch <- addrs
+	go func() {
+		defer close(ch)
+		push := func(addrs []string) {
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- addrs
+		}
+		backoff := watchRetryMin
+		for {
+			watchCtx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+			watchChan := r.client.Watch(watchCtx, prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+			for resp := range watchChan {
+				if resp.Err() != nil {
+					break
+				}
+				addrs, newRev, err := r.getAddrs(ctx, prefix)
+				if err != nil {
+					continue
+				}
+				rev = newRev
+				backoff = watchRetryMin
+				push(addrs)
+			}
+			cancel()
+
+			// watch已关闭,退避后重新读取完整列表,补上断开期间遗漏的变化
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(backoff*2, watchRetryMax)
+				addrs, newRev, err := r.getAddrs(ctx, prefix)
+				if err == nil {
+					rev = newRev
+					push(addrs)
+					break
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// getAddrs 获取前缀下的所有地址及当前版本号
+func (r *SvcDiscoveryRegistryImpl) getAddrs(ctx context.Context, prefix string) ([]string, int64, error) {
+	resp, err := r.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	addrs := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if _, addr := r.splitEndpoint(string(kv.Key)); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+	return addrs, resp.Header.Revision, nil
+}
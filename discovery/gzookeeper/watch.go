@@ -0,0 +1,74 @@
+package gzookeeper
+
+import (
+	"context"
+	"github.com/go-zookeeper/zk"
+	"github.com/qiafan666/gotato/commons/gerr"
+	"github.com/qiafan666/gotato/commons/glog"
+	"sort"
+	"time"
+)
+
+const watchRetryInterval = time.Second
+
+// WatchAddrs 监听服务地址列表,每次变化推送完整列表,ctx取消后关闭通道
+// 实现 grpc/tcp.IResolver,地址取自服务节点下各临时节点的数据
+func (s *ZkClient) WatchAddrs(ctx context.Context, serviceName string) (<-chan []string, error) {
+	if err := s.ensureName(serviceName); err != nil {
+		return nil, err
+	}
+	path := s.getPath(serviceName)
+	addrs, events, err := s.childrenAddrs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []string, 1)
+	ch <- addrs
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-events:
+			}
+			// 会话断开等情况下节点暂时不可读,保留上次结果并定时重试
+			for addrs, events, err = s.childrenAddrs(path); err != nil; addrs, events, err = s.childrenAddrs(path) {
+				glog.Slog.WarnKVs(GetZkCtx, "zk watch addrs error", "path", path, "err", err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(watchRetryInterval):
+				}
+			}
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- addrs
+		}
+	}()
+	return ch, nil
+}
+
+// childrenAddrs 读取子节点地址并注册子节点变化监听
+func (s *ZkClient) childrenAddrs(path string) ([]string, <-chan zk.Event, error) {
+	children, _, events, err := s.conn.ChildrenW(path)
+	if err != nil {
+		return nil, nil, gerr.WrapMsg(err, "children watch error", "path", path)
+	}
+	addrs := make([]string, 0, len(children))
+	for _, child := range children {
+		data, _, err := s.conn.Get(path + "/" + child)
+		if err != nil {
+			// 子节点可能在读取间隙被删除
+			continue
+		}
+		if len(data) > 0 {
+			addrs = append(addrs, string(data))
+		}
+	}
+	sort.Strings(addrs)
+	return addrs, events, nil
+}